@@ -26,28 +26,49 @@ package cniovs
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	_ "encoding/json"
 	"errors"
 	"fmt"
 	_ "io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	_ "runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
 
 	"github.com/Billy99/user-space-net-plugin/cniovs/ovsdb"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
 	"github.com/Billy99/user-space-net-plugin/usrsptypes"
 )
 
 //
 // Constants
 //
+const (
+	dbgMtu = false
+)
+
 const defaultCNIDir = "/var/lib/cni/vhostuser"
 const defaultOvsScript = "/usr/share/openvswitch/scripts/ovs-config.py"
+const defaultOvsDbSock = "db.sock"
+
+// Longest name of an OVS port. OVS names the devices of the ports after the
+// ports, and kernel device names are limited to IFNAMSIZ - 1.
+const maxOvsPortName = 15
+const defaultOvsBridge = "br0"
+const defaultHostOvsDbSock = "/var/run/openvswitch/db.sock"
+const ovsProbeTimeout = 2 * time.Second
 
 //
 // Types
@@ -58,24 +79,49 @@ type CniOvs struct {
 //
 // API Functions
 //
-func (cniOvs CniOvs) AddOnHost(conf *usrsptypes.NetConf, containerID string, ipResult *current.Result) error {
+func (cniOvs CniOvs) AddOnHost(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
 	var err error
 	var data ovsdb.OvsSavedData
 
 	fmt.Printf("ENTER OVS CNI - ADD:\n")
 
+	//
+	// Make sure the mirror destination exists before creating anything
+	//
+	if conf.HostConf.MirrorConf.Destination != "" {
+		err = checkMirrorDestination(conf.HostConf.MirrorConf.Destination)
+		if err != nil {
+			return err
+		}
+	}
+
 	//
 	// Create Local Interface
 	//
 	if conf.HostConf.IfType == "vhostuser" {
-		err = addLocalDeviceVhost(conf, containerID, &data)
+		err = addLocalDeviceVhost(conf, args, &data)
 	} else {
 		err = errors.New("ERROR: Unknown HostConf.IfType:" + conf.HostConf.IfType)
 	}
+	err = journal(args, "create", fmt.Sprintf("%s %s", conf.HostConf.IfType, data.Vhostname), err)
 	if err != nil {
 		return err
 	}
 
+	//
+	// Apply the MTU, OVS keeps the port at 1500 without mtu_request
+	//
+	if conf.Mtu != 0 {
+		err = setPortMtu(data.Vhostname, conf.Mtu)
+		err = journal(args, "mtu", fmt.Sprintf("port %s %d", data.Vhostname, conf.Mtu), err)
+		if err != nil {
+			cmd_args := []string{"delete", data.Vhostname}
+			execCommand(defaultOvsScript, cmd_args)
+			return err
+		}
+		data.Mtu = conf.Mtu
+	}
+
 	//
 	// Bring Interface UP
 	//
@@ -84,16 +130,53 @@ func (cniOvs CniOvs) AddOnHost(conf *usrsptypes.NetConf, containerID string, ipR
 	// Add Interface to Local Network
 	//
 	if conf.HostConf.NetType == "bridge" {
-		err = errors.New("ERROR: NetType bridge not currenly supported")
+		return usrsptypes.NewEngineNotSupportedError("ovs-dpdk", "netType bridge")
 	} else if conf.HostConf.NetType == "interface" {
 		if len(ipResult.IPs) != 0 {
 		}
 	}
 
+	//
+	// Mirror the interface traffic, if requested
+	//
+	if conf.HostConf.MirrorConf.Destination != "" {
+		direction := conf.HostConf.MirrorConf.Direction
+		if direction == "" {
+			direction = "both"
+		}
+
+		// ovs-vsctl create Mirror
+		cmd_args := []string{"mirror", data.Vhostname, conf.HostConf.MirrorConf.Destination, direction}
+		_, err = execCommand(defaultOvsScript, cmd_args)
+		err = journal(args, "mirror", fmt.Sprintf("port %s to %s", data.Vhostname, conf.HostConf.MirrorConf.Destination), err)
+		if err != nil {
+			cmd_args = []string{"delete", data.Vhostname}
+			execCommand(defaultOvsScript, cmd_args)
+			return fmt.Errorf("ERROR: Failed to mirror %s: %v", data.Vhostname, err)
+		}
+	}
+
 	//
 	// Save Config - Save Create Data for Delete
 	//
-	err = ovsdb.SaveConfig(conf, containerID, &data)
+	err = ovsdb.SaveConfig(conf, args.ContainerID, &data)
+	if err != nil {
+		return err
+	}
+
+	//
+	// Save Attachment Data for other applications
+	//
+	err = usrspdb.SaveAttachment(&usrspdb.AttachmentInfo{
+		ContainerID:     args.ContainerID,
+		IfName:          args.IfName,
+		Network:         conf.Name,
+		Engine:          "ovs-dpdk",
+		ContainerEngine: usrsptypes.GetContainerEngine(conf),
+		IfType:          conf.HostConf.IfType,
+		PortName:        data.Vhostname,
+		SocketPath:      data.SockPath,
+	})
 	if err != nil {
 		return err
 	}
@@ -103,22 +186,120 @@ func (cniOvs CniOvs) AddOnHost(conf *usrsptypes.NetConf, containerID string, ipR
 	return err
 }
 
-func (cniOvs CniOvs) AddOnContainer(conf *usrsptypes.NetConf, containerID string, ipResult *current.Result) error {
+func (cniOvs CniOvs) AddOnContainer(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
+	var err error
+	var data ovsdb.OvsSavedData
+
+	// Only an OVS instance running in the container needs to be configured
+	// from here, other container engines consume the socket directly.
+	if conf.ContainerConf.Engine != "ovs-dpdk" {
+		return nil
+	}
+
+	if conf.HostConf.Engine != "ovs-dpdk" {
+		return fmt.Errorf("ERROR: ContainerConf.Engine ovs-dpdk requires HostConf.Engine ovs-dpdk, not %s",
+			conf.HostConf.Engine)
+	}
+	if GetOvsVhostMode(conf) != "server" {
+		return fmt.Errorf("ERROR: ContainerConf.Engine ovs-dpdk requires the host OVS to be the vhost-user server")
+	}
+
+	//
+	// Create the peer port in the container OVS instance
+	//
+	data.DbSocket, err = getContainerOvsDbSock(conf, args)
+	if err != nil {
+		return err
+	}
+	data.Bridge = getContainerOvsBridge(conf)
+	data.SockPath = getVhostSockPath(conf, args.ContainerID)
+
+	// ovs-vsctl --db=unix:<dbSocket> add-port
+	cmd_args := []string{"create-peer", data.SockPath, data.DbSocket, data.Bridge}
+	output, err := execCommand(defaultOvsScript, cmd_args)
+	if err != nil {
+		return fmt.Errorf("ERROR: Failed to create port on container bridge %s: %v", data.Bridge, err)
+	}
+	data.Vhostname = strings.Replace(string(output), "\n", "", -1)
+	data.Ifname = usrsptypes.GetIfName(conf, args)
+
+	//
+	// Apply the IPAM addresses to the internal port of the container bridge
+	//
+	if err = addBridgeAddresses(args.Netns, data.Bridge, ipResult, &data); err != nil {
+		cmd_args = []string{"delete-peer", data.Vhostname, data.DbSocket, data.Bridge}
+		execCommand(defaultOvsScript, cmd_args)
+		return err
+	}
+
+	//
+	// Save Config - Save Create Data for Delete
+	//
+	err = ovsdb.SaveContainerConfig(conf, args.ContainerID, &data)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (cniOvs CniOvs) DelFromHost(conf *usrsptypes.NetConf, containerID string) error {
+// UpdateOnHost Apply the parts of the configuration which can change on a
+// repeated ADD of an existing attachment. Only the MTU can change.
+func (cniOvs CniOvs) UpdateOnHost(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	var data ovsdb.OvsSavedData
+
+	if conf.Mtu == 0 {
+		return nil
+	}
+
+	//
+	// Load Config - The file is removed on load, so it is always saved back
+	//
+	err := ovsdb.LoadConfig(conf, args.ContainerID, &data)
+	if err != nil {
+		return err
+	}
+	if data.Vhostname == "" {
+		return fmt.Errorf("ERROR: No saved OVS data for %s-%s", usrsptypes.GetContainerToken(args.ContainerID), conf.If0name)
+	}
+
+	if conf.Mtu != data.Mtu {
+		if dbgMtu {
+			fmt.Printf("OVS CNI - UPDATE: MTU of %s from %d to %d\n", data.Vhostname, data.Mtu, conf.Mtu)
+		}
+		if err = setPortMtu(data.Vhostname, conf.Mtu); err == nil {
+			data.Mtu = conf.Mtu
+		}
+	}
+
+	if saveErr := ovsdb.SaveConfig(conf, args.ContainerID, &data); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	return err
+}
+
+func (cniOvs CniOvs) DelFromHost(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
 	var data ovsdb.OvsSavedData
 	var err error
 
 	//
 	// Load Config - Retrieved squirreled away data needed for processing delete
 	//
-	err = ovsdb.LoadConfig(conf, containerID, &data)
+	err = ovsdb.LoadConfig(conf, args.ContainerID, &data)
 	if err != nil {
 		return err
 	}
 
+	//
+	// Stop mirroring the interface, if it was requested
+	//
+	if conf.HostConf.MirrorConf.Destination != "" {
+		// ovs-vsctl remove Mirror, the interface is deleted even if this fails
+		cmd_args := []string{"unmirror", data.Vhostname}
+		execCommand(defaultOvsScript, cmd_args)
+	}
+
 	//
 	// Remove Interface from Local Network
 	//
@@ -127,15 +308,82 @@ func (cniOvs CniOvs) DelFromHost(conf *usrsptypes.NetConf, containerID string) e
 	// Delete Local Interface
 	//
 	if conf.HostConf.IfType == "vhostuser" {
-		return delLocalDeviceVhost(conf, containerID, &data)
+		err = delLocalDeviceVhost(conf, args.ContainerID, &data)
 	} else {
-		return errors.New("ERROR: Unknown HostConf.Type:" + conf.HostConf.IfType)
+		err = errors.New("ERROR: Unknown HostConf.Type:" + conf.HostConf.IfType)
+	}
+	err = journal(args, "delete", "port "+data.Vhostname, err)
+	if err != nil {
+		return err
 	}
 
-	return err
+	err = usrspdb.DeleteAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	//
+	// Remove the directory of the container once its last interface is gone.
+	// With an OVS instance in the container, the directory holds its ovsdb
+	// socket, so it is removed once the container side is cleaned up.
+	//
+	if conf.ContainerConf.Engine == "ovs-dpdk" {
+		return nil
+	}
+	return cleanupContainerDir(args.ContainerID)
 }
 
-func (cniOvs CniOvs) DelFromContainer(conf *usrsptypes.NetConf, containerID string) error {
+func (cniOvs CniOvs) DelFromContainer(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	var data ovsdb.OvsSavedData
+
+	if conf.ContainerConf.Engine != "ovs-dpdk" {
+		return nil
+	}
+
+	//
+	// Load Config - Nothing to do if the container side was never configured
+	//
+	found, err := ovsdb.LoadContainerConfig(conf, args.ContainerID, &data)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		//
+		// Remove the addresses, the netns may already be gone
+		//
+		delBridgeAddresses(args.Netns, data.Bridge, data.IPAddrs)
+
+		// ovs-vsctl --db=unix:<dbSocket> --if-exists del-port, unless the
+		// OVS instance of the container is already gone with its socket.
+		if _, statErr := os.Stat(data.DbSocket); statErr == nil {
+			cmd_args := []string{"delete-peer", data.Vhostname, data.DbSocket, data.Bridge}
+			if _, err = execCommand(defaultOvsScript, cmd_args); err != nil {
+				return fmt.Errorf("ERROR: Failed to delete port %s from container bridge %s: %v",
+					data.Vhostname, data.Bridge, err)
+			}
+		}
+	}
+
+	return cleanupContainerDir(args.ContainerID)
+}
+
+func (cniOvs CniOvs) Capabilities() []string {
+	return []string{
+		usrsptypes.CapabilityVhostUser,
+		usrsptypes.CapabilityMirror,
+		usrsptypes.CapabilityMtu,
+	}
+}
+
+// Probe() - OVS is reachable when its ovsdb socket accepts a connection.
+func (cniOvs CniOvs) Probe() error {
+	conn, err := net.DialTimeout("unix", defaultHostOvsDbSock, ovsProbeTimeout)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
 	return nil
 }
 
@@ -149,6 +397,183 @@ func execCommand(cmd string, args []string) ([]byte, error) {
 	return exec.Command(cmd, args...).Output()
 }
 
+// journal Record a step programming the attachment in its journal, see
+// usrspdb. The error of the step is returned as is.
+func journal(args *skel.CmdArgs, step string, request string, err error) error {
+	usrspdb.RecordJournal(args.ContainerID, args.IfName, "ovs-dpdk", step, request, err)
+	return err
+}
+
+// GetOvsVhostMode Determine if OVS is the vhost-user server (dpdkvhostuser,
+// the default) or the client (dpdkvhostuserclient). OVS is the client if
+// the host is configured as client, or the container as server.
+func GetOvsVhostMode(conf *usrsptypes.NetConf) string {
+	if conf.HostConf.VhostConf.Mode == "client" || conf.ContainerConf.VhostConf.Mode == "server" {
+		return "client"
+	}
+	return "server"
+}
+
+// GetContainerDir Directory of the vhost-user sockets of the container,
+// shared with the container.
+func GetContainerDir(containerID string) string {
+	return filepath.Join(defaultCNIDir, containerID)
+}
+
+// checkMirrorDestination Make sure the mirror destination is a port of the
+// OVS bridge. If not, the error lists the available ports.
+func checkMirrorDestination(destination string) error {
+	cmd_args := []string{"listports"}
+	output, err := execCommand(defaultOvsScript, cmd_args)
+	if err != nil {
+		return fmt.Errorf("ERROR: Failed to list OVS ports: %v", err)
+	}
+
+	ports := strings.Fields(string(output))
+	for _, port := range ports {
+		if port == destination {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("ERROR: mirror destination %s not found, available ports: %s",
+		destination, strings.Join(ports, ", "))
+}
+
+// setPortMtu Set mtu_request on the Interface of the port, and make sure the
+// MTU reported by OVS matches. OVS silently clamps the MTU if the mbufs of
+// the hugepage memory are too small for it.
+func setPortMtu(port string, mtu int) error {
+	cmd_args := []string{"setmtu", port, strconv.Itoa(mtu)}
+	output, err := execCommand(defaultOvsScript, cmd_args)
+	if err != nil {
+		return fmt.Errorf("ERROR: Failed to set MTU %d on %s: %v", mtu, port, err)
+	}
+
+	reported := strings.TrimSpace(string(output))
+	if reported != strconv.Itoa(mtu) {
+		return fmt.Errorf("ERROR: MTU of %s is %s, not the requested %d, the mbufs may be too small for it",
+			port, reported, mtu)
+	}
+
+	return nil
+}
+
+// getVhostSockPath Socket file shared between the host and the container.
+// OVS names the port after the socket file, see getPortName().
+func getVhostSockPath(conf *usrsptypes.NetConf, containerID string) string {
+	return filepath.Join(defaultCNIDir, containerID, getPortName(conf, containerID))
+}
+
+// getPortName Name of the OVS port of the interface: the port prefix, then
+// a suffix derived from the container ID and the interface name, filling
+// the name up to maxOvsPortName. The name is the same on every ADD of the
+// interface, DEL deletes the port by the name saved on ADD.
+func getPortName(conf *usrsptypes.NetConf, containerID string) string {
+	prefix := usrsptypes.GetOvsPortPrefix(conf)
+	sum := sha256.Sum256([]byte(containerID + "-" + conf.If0name))
+
+	return prefix + hex.EncodeToString(sum[:])[:maxOvsPortName-len(prefix)]
+}
+
+// getContainerOvsDbSock Path on the host of the ovsdb socket of the OVS
+// instance in the container. A path in the container is translated through
+// the rootfs of the container, see usrsptypes.ResolveContainerPath().
+func getContainerOvsDbSock(conf *usrsptypes.NetConf, args *skel.CmdArgs) (string, error) {
+	ovsConf := &conf.ContainerConf.OvsConf
+	if ovsConf.DbSocketContainerPath != "" {
+		return usrsptypes.ResolveContainerPath(args.Netns, ovsConf.DbSocketContainerPath)
+	}
+	if ovsConf.DbSocketHostPath != "" {
+		return ovsConf.DbSocketHostPath, nil
+	}
+	if ovsConf.DbSocket != "" {
+		return ovsConf.DbSocket, nil
+	}
+	return filepath.Join(defaultCNIDir, args.ContainerID, defaultOvsDbSock), nil
+}
+
+// getContainerOvsBridge Bridge of the OVS instance in the container.
+func getContainerOvsBridge(conf *usrsptypes.NetConf) string {
+	if conf.ContainerConf.OvsConf.Bridge != "" {
+		return conf.ContainerConf.OvsConf.Bridge
+	}
+	return defaultOvsBridge
+}
+
+// addBridgeAddresses Add the IPAM addresses to the internal port of the
+// container bridge, which has the name of the bridge, and bring it up.
+func addBridgeAddresses(netnsPath string, bridge string, ipResult *current.Result, data *ovsdb.OvsSavedData) error {
+	if ipResult == nil || len(ipResult.IPs) == 0 {
+		return nil
+	}
+	if netnsPath == "" {
+		return fmt.Errorf("ERROR: Network namespace required to configure bridge %s", bridge)
+	}
+
+	return ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(bridge)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q: %v", bridge, err)
+		}
+
+		for _, ipConfig := range ipResult.IPs {
+			addr := ipConfig.Address
+			if err = netlink.AddrAdd(link, &netlink.Addr{IPNet: &addr}); err != nil {
+				return fmt.Errorf("failed to add address %s to %q: %v", addr.String(), bridge, err)
+			}
+			data.IPAddrs = append(data.IPAddrs, addr.String())
+		}
+
+		if err = netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("failed to set %q up: %v", bridge, err)
+		}
+
+		return nil
+	})
+}
+
+// delBridgeAddresses Remove the addresses added by addBridgeAddresses.
+func delBridgeAddresses(netnsPath string, bridge string, ipAddrs []string) error {
+	if netnsPath == "" || len(ipAddrs) == 0 {
+		return nil
+	}
+
+	return ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(bridge)
+		if err != nil {
+			// Already gone
+			return nil
+		}
+
+		for _, ipAddr := range ipAddrs {
+			addr, err := netlink.ParseAddr(ipAddr)
+			if err != nil {
+				continue
+			}
+			netlink.AddrDel(link, addr)
+		}
+
+		return nil
+	})
+}
+
+// cleanupContainerDir Remove the socket directory of the container, and
+// anything left in it, if no other interface of the container remains.
+func cleanupContainerDir(containerID string) error {
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+	for _, info := range attachments {
+		if info.ContainerID == containerID {
+			return nil
+		}
+	}
+
+	return usrsptypes.RemoveContainerDir(defaultCNIDir, containerID)
+}
+
 func generateRandomMacAddress() string {
 	buf := make([]byte, 6)
 	if _, err := rand.Read(buf); err != nil {
@@ -162,26 +587,19 @@ func generateRandomMacAddress() string {
 	return macAddr
 }
 
-func addLocalDeviceVhost(conf *usrsptypes.NetConf, containerID string, data *ovsdb.OvsSavedData) error {
+func addLocalDeviceVhost(conf *usrsptypes.NetConf, args *skel.CmdArgs, data *ovsdb.OvsSavedData) error {
 
-	s := []string{containerID[:12], conf.If0name}
-	sockRef := strings.Join(s, "-")
+	containerID := args.ContainerID
 
 	sockDir := filepath.Join(defaultCNIDir, containerID)
-	if _, err := os.Stat(sockDir); err != nil {
-		if os.IsNotExist(err) {
-			if err := os.MkdirAll(sockDir, 0700); err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
+	if err := usrsptypes.CreateSharedDir(conf, sockDir); err != nil {
+		return err
 	}
 
-	sockPath := filepath.Join(sockDir, sockRef)
+	sockPath := getVhostSockPath(conf, containerID)
 
-	// ovs-vsctl add-port
-	cmd_args := []string{"create", sockPath}
+	// ovs-vsctl add-port, description and network are stored in the external-ids of the Interface
+	cmd_args := []string{"create", sockPath, usrsptypes.GetIfDescription(args), GetOvsVhostMode(conf), conf.Name}
 	if output, err := execCommand(defaultOvsScript, cmd_args); err == nil {
 		vhostName := strings.Replace(string(output), "\n", "", -1)
 
@@ -191,8 +609,13 @@ func addLocalDeviceVhost(conf *usrsptypes.NetConf, containerID string, data *ovs
 		}
 
 		data.Vhostname = vhostName
-		data.Ifname = conf.If0name
-		data.IfMac = generateRandomMacAddress()
+		data.Ifname = usrsptypes.GetIfName(conf, args)
+		if conf.ContainerConf.Mac != "" {
+			data.IfMac = conf.ContainerConf.Mac
+		} else {
+			data.IfMac = generateRandomMacAddress()
+		}
+		data.SockPath = sockPath
 	}
 
 	return nil
@@ -200,25 +623,34 @@ func addLocalDeviceVhost(conf *usrsptypes.NetConf, containerID string, data *ovs
 
 func delLocalDeviceVhost(conf *usrsptypes.NetConf, containerID string, data *ovsdb.OvsSavedData) error {
 
+	// Without saved data (a DEL repeated, or an ADD which failed before
+	// creating the port), there is no port to delete.
+	if data.Vhostname == "" {
+		return nil
+	}
+
 	// ovs-vsctl --if-exists del-port
 	cmd_args := []string{"delete", data.Vhostname}
 	if _, err := execCommand(defaultOvsScript, cmd_args); err == nil {
 		path := filepath.Join(defaultCNIDir, containerID)
 
 		folder, err := os.Open(path)
-		if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
 			return err
 		}
 		defer folder.Close()
 
-		fileBaseName := fmt.Sprintf("%s-%s", containerID[:12], conf.If0name)
+		// The socket file is named after the port, saved on ADD.
+		fileBaseName := filepath.Base(data.SockPath)
 		filesForContainerID, err := folder.Readdirnames(0)
 		if err != nil {
 			return err
 		}
 		numDeletedFiles := 0
 
-		// Remove files with matching container ID and IF name
+		// Remove files with matching port name
 		for _, fileName := range filesForContainerID {
 			if match, _ := regexp.MatchString(fileBaseName+".*", fileName); match == true {
 				file := filepath.Join(path, fileName)
@@ -21,9 +21,9 @@ package ovsdb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -45,10 +45,17 @@ const defaultLocalCNIDir = "/var/run/ovs/cni/data"
 // This structure is a union of all the VPP data (for all types of
 // interfaces) that need to be preserved for later use.
 type OvsSavedData struct {
-	Vhostname string `json:"vhostname"` // Vhost Port name
-	VhostMac  string `json:"vhostmac"`  // Vhost port MAC address
-	Ifname    string `json:"ifname"`    // Interface name
-	IfMac     string `json:"ifmac"`     // Interface Mac address
+	Vhostname string `json:"vhostname"`     // Vhost Port name
+	VhostMac  string `json:"vhostmac"`      // Vhost port MAC address
+	Ifname    string `json:"ifname"`        // Interface name
+	IfMac     string `json:"ifmac"`         // Interface Mac address
+	SockPath  string `json:"sockpath"`      // Vhost socket file shared with the container
+	Mtu       int    `json:"mtu,omitempty"` // MTU requested on the Vhost port, if any
+
+	// Only used for the OVS instance in the container
+	DbSocket string   `json:"dbsocket,omitempty"` // Container ovsdb socket
+	Bridge   string   `json:"bridge,omitempty"`   // Container bridge the vhost port was added to
+	IPAddrs  []string `json:"ipaddrs,omitempty"`  // Addresses added to the container bridge internal port
 }
 
 // This structure is used to pass additional data outside of the usrsptypes date into the container.
@@ -61,14 +68,20 @@ type additionalData struct {
 // API Functions
 //
 
+// GetStateDir() - Directory of the saved data, for the cleanup of corrupt
+//  files.
+func GetStateDir() string {
+	return defaultLocalCNIDir
+}
+
 // SaveConfig() - Some data needs to be saved for cmdDel().
 //  This function squirrels the data away to be retrieved later.
 func SaveConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData) error {
 
 	// Current implementation is to write data to a file with the name:
-	//   /var/run/ovs/cni/data/local-<ContainerId:12>-<If0name>.json
+	//   /var/run/ovs/cni/data/local-<ContainerToken>-<If0name>.json
 
-	fileName := fmt.Sprintf("local-%s-%s.json", containerID[:12], conf.If0name)
+	fileName := fmt.Sprintf("local-%s-%s.json", usrsptypes.GetContainerToken(containerID), conf.If0name)
 	if dataBytes, err := json.Marshal(data); err == nil {
 		sockDir := defaultLocalCNIDir
 		// OLD: sockDir := filepath.Join(defaultCNIDir, containerID)
@@ -86,7 +99,7 @@ func SaveConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData
 		path := filepath.Join(sockDir, fileName)
 
 		fmt.Printf("SAVE FILE: path=%s dataBytes=%s\n", path, dataBytes)
-		return ioutil.WriteFile(path, dataBytes, 0644)
+		return usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
 	} else {
 		return fmt.Errorf("ERROR: serializing delegate VPP saved data: %v", err)
 	}
@@ -94,16 +107,15 @@ func SaveConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData
 
 func LoadConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData) error {
 
-	fileName := fmt.Sprintf("local-%s-%s.json", containerID[:12], conf.If0name)
+	fileName := fmt.Sprintf("local-%s-%s.json", usrsptypes.GetContainerToken(containerID), conf.If0name)
 	sockDir := defaultLocalCNIDir
 	path := filepath.Join(sockDir, fileName)
 
 	if _, err := os.Stat(path); err == nil {
-		if dataBytes, err := ioutil.ReadFile(path); err == nil {
-			if err = json.Unmarshal(dataBytes, data); err != nil {
-				return fmt.Errorf("ERROR: Failed to parse VPP saved data: %v", err)
-			}
-		} else {
+		err = usrsptypes.ReadStateFile(path, data)
+		if errors.Is(err, usrsptypes.ErrCorruptState) {
+			return err
+		} else if err != nil {
 			return fmt.Errorf("ERROR: Failed to read VPP saved data: %v", err)
 		}
 
@@ -117,6 +129,56 @@ func LoadConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData
 	return nil
 }
 
+// SaveContainerConfig() - Save the data of the vhost port created in the OVS
+//  instance in the container, for cmdDel().
+func SaveContainerConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData) error {
+
+	// Current implementation is to write data to a file with the name:
+	//   /var/run/ovs/cni/data/container-<ContainerToken>-<If0name>.json
+
+	fileName := fmt.Sprintf("container-%s-%s.json", usrsptypes.GetContainerToken(containerID), conf.If0name)
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("ERROR: serializing container OVS saved data: %v", err)
+	}
+
+	if _, err := os.Stat(defaultLocalCNIDir); err != nil {
+		if os.IsNotExist(err) {
+			if err := os.MkdirAll(defaultLocalCNIDir, 0700); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+	}
+
+	path := filepath.Join(defaultLocalCNIDir, fileName)
+
+	return usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
+}
+
+// LoadContainerConfig() - Retrieve and remove the data saved by
+//  SaveContainerConfig(). Returns false if there is no data.
+func LoadContainerConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData) (bool, error) {
+
+	fileName := fmt.Sprintf("container-%s-%s.json", usrsptypes.GetContainerToken(containerID), conf.If0name)
+	path := filepath.Join(defaultLocalCNIDir, fileName)
+
+	err := usrsptypes.ReadStateFile(path, data)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if errors.Is(err, usrsptypes.ErrCorruptState) {
+		return false, err
+	} else if err != nil {
+		return false, fmt.Errorf("ERROR: Failed to read container OVS saved data: %v", err)
+	}
+
+	// Delete file (and directory if empty)
+	fileCleanup(defaultLocalCNIDir, path)
+
+	return true, nil
+}
+
 // This function deletes the input file (if provided) and the associated
 // directory (if provided) if the directory is empty.
 //  directory string - Directory file is located in, Use "" if directory
@@ -125,12 +187,14 @@ func LoadConfig(conf *usrsptypes.NetConf, containerID string, data *OvsSavedData
 //    only the directory should be deleted.
 func fileCleanup(directory string, filepath string) (err error) {
 
-	// If File is provided, delete it.
+	// If File is provided, delete it. A file already gone is not an error,
+	// so a repeated DEL succeeds.
 	if filepath != "" {
 		err = os.Remove(filepath)
-		if err != nil {
+		if err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("ERROR: Failed to delete file: %v", err)
 		}
+		err = nil
 	}
 
 	// If Directory is provided and it is empty, delete it.
@@ -20,6 +20,7 @@ import sys
 import subprocess
 import re
 import string
+import time
 
 def execCommand(command):
 	''' Execute the shell command and return the output'''
@@ -28,30 +29,103 @@ def execCommand(command):
 		return data
 	return None
 
-def createVhostPort(sock):
-	'''Create the Vhost User port, OVS works as Vhost User server'''
+def createVhostPort(sock, desc=None, mode='server', network=None):
+	'''Create the Vhost User port, OVS works as Vhost User server (default) or client'''
 	tmp = sock.rsplit('/', 1)
 	sock_dir, sock_file = tmp[0], tmp[1]
 
 	try:
-		# Add the DPDK Vhost User Port, OVS works as the server
-		cmd = 'ovs-vsctl add-port br0 {} -- set Interface {} type=dpdkvhostuser'.format(sock_file, sock_file)
+		if mode == 'client':
+			# Add the DPDK Vhost User Client Port, the application in the
+			# container is the server and creates the socket
+			cmd = 'ovs-vsctl add-port br0 {} -- set Interface {} type=dpdkvhostuserclient options:vhost-server-path={}'.format(sock_file, sock_file, sock)
+		else:
+			# Add the DPDK Vhost User Port, OVS works as the server
+			cmd = 'ovs-vsctl add-port br0 {} -- set Interface {} type=dpdkvhostuser'.format(sock_file, sock_file)
+		if desc:
+			# Record the owner of the port for operators
+			cmd += ' external-ids:usrsp-description="{}"'.format(desc)
+		if network:
+			# Record the network of the port, for cleanup per network
+			cmd += ' external-ids:usrsp-network="{}"'.format(network)
 		execCommand(cmd)
 
-		# Move the socket to desired location
-		cmd = 'mv /usr/local/var/run/openvswitch/{} {}/{}'.format(sock_file, sock_dir, sock_file)
-		execCommand(cmd)
+		if mode != 'client':
+			# Move the socket to desired location
+			cmd = 'mv /usr/local/var/run/openvswitch/{} {}/{}'.format(sock_file, sock_dir, sock_file)
+			execCommand(cmd)
 	except:
 		print "Some errors occured, please have a check..."
 
 	# For the OVS, the socket file name is composed with the socket dir and the Interface name	
 	return sock_file
 
+def createPeerVhostPort(sock, db, bridge):
+	'''Create the peer Vhost User port in the OVS instance of the container,
+	which works as Vhost User client of the host OVS'''
+	sock_file = sock.rsplit('/', 1)[1]
+
+	cmd = 'ovs-vsctl --db=unix:{} add-port {} {} -- set Interface {} type=dpdkvhostuserclient options:vhost-server-path={}'.format(db, bridge, sock_file, sock_file, sock)
+	execCommand(cmd)
+
+	return sock_file
+
+def deletePeerVhostPort(port, db, bridge):
+	'''Remove the peer Vhost User port from the OVS instance of the container'''
+	cmd = 'ovs-vsctl --db=unix:{} --if-exists del-port {} {}'.format(db, bridge, port)
+	return re.sub("\n\s*\n*", "", execCommand(cmd))
+
 def deleteVhostPort(port):
 	'''Remove the DPDK Vhost User port from the OVS bridge'''
 	cmd = 'ovs-vsctl --if-exists del-port br0 {}'.format(port)
 	return re.sub("\n\s*\n*", "", execCommand(cmd))
 
+def setPortMtu(port, mtu):
+	'''Request the MTU of the port, and return the MTU reported by OVS once
+	applied. OVS silently clamps the MTU if the mbufs are too small.'''
+	cmd = 'ovs-vsctl set Interface {} mtu_request={}'.format(port, mtu)
+	execCommand(cmd)
+
+	# The port is reconfigured asynchronously
+	reported = None
+	for i in range(10):
+		cmd = 'ovs-vsctl get Interface {} mtu'.format(port)
+		reported = re.sub("\n\s*\n*", "", execCommand(cmd))
+		if reported == str(mtu):
+			break
+		time.sleep(0.1)
+
+	return reported
+
+def listPorts():
+	'''List the ports of the OVS bridge'''
+	cmd = 'ovs-vsctl list-ports br0'
+	return execCommand(cmd).split()
+
+def createMirror(port, dest, direction='both'):
+	'''Mirror the traffic of the port to the destination port'''
+	name = 'usrsp-{}'.format(port)
+
+	cmd = 'ovs-vsctl -- --id=@src get Port {} -- --id=@dst get Port {} -- --id=@m create Mirror name={}'.format(port, dest, name)
+	if direction in ('rx', 'both'):
+		# Traffic received from the port
+		cmd += ' select-src-port=@src'
+	if direction in ('tx', 'both'):
+		# Traffic sent to the port
+		cmd += ' select-dst-port=@src'
+	cmd += ' output-port=@dst -- add Bridge br0 mirrors @m'
+	execCommand(cmd)
+
+	return name
+
+def deleteMirror(port):
+	'''Remove the Mirror of the port from the OVS bridge'''
+	name = 'usrsp-{}'.format(port)
+	cmd = 'ovs-vsctl -- --id=@m get Mirror {} -- remove Bridge br0 mirrors @m'.format(name)
+	execCommand(cmd)
+
+	return name
+
 def getVhostPortMac(port):
 	'''Get MAC address of the specified Vhost User Port'''
 	cmd = 'ovs-ofctl show br0'
@@ -75,9 +149,31 @@ def main():
 		exit(1)
 
 	if sys.argv[1] == 'create':
-		print createVhostPort(sys.argv[2])
+		if len(sys.argv) > 5:
+			print createVhostPort(sys.argv[2], sys.argv[3], sys.argv[4], sys.argv[5])
+		elif len(sys.argv) > 4:
+			print createVhostPort(sys.argv[2], sys.argv[3], sys.argv[4])
+		elif len(sys.argv) > 3:
+			print createVhostPort(sys.argv[2], sys.argv[3])
+		else:
+			print createVhostPort(sys.argv[2])
+	elif sys.argv[1] == 'create-peer':
+		print createPeerVhostPort(sys.argv[2], sys.argv[3], sys.argv[4])
+	elif sys.argv[1] == 'delete-peer':
+		print deletePeerVhostPort(sys.argv[2], sys.argv[3], sys.argv[4])
 	elif sys.argv[1] == 'delete':
 		print deleteVhostPort(sys.argv[2])
+	elif sys.argv[1] == 'setmtu':
+		print setPortMtu(sys.argv[2], sys.argv[3])
+	elif sys.argv[1] == 'listports':
+		print '\n'.join(listPorts())
+	elif sys.argv[1] == 'mirror':
+		if len(sys.argv) > 4:
+			print createMirror(sys.argv[2], sys.argv[3], sys.argv[4])
+		else:
+			print createMirror(sys.argv[2], sys.argv[3])
+	elif sys.argv[1] == 'unmirror':
+		print deleteMirror(sys.argv[2])
 	elif sys.argv[1] == 'getmac':
 		print getVhostPortMac(sys.argv[2])
 	elif sys.argv[1] == 'config':
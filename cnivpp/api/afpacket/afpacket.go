@@ -0,0 +1,109 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vppafpacket
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/af_packet"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugAfPacket = false
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func AfPacketCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&af_packet.AfPacketCreate{},
+		&af_packet.AfPacketCreateReply{},
+		&af_packet.AfPacketDelete{},
+		&af_packet.AfPacketDeleteReply{},
+	)
+	if err != nil {
+		if debugAfPacket {
+			fmt.Println("VPP af_packet failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to create an af_packet Interface attached to the given host
+// (kernel) interface.
+// Input:
+//   ch *api.Channel
+//   hostIfName string - Name of the kernel interface to attach to
+func CreateAfPacketInterface(ch *api.Channel, hostIfName string) (swIfIndex uint32, err error) {
+
+	// Populate the Add Structure
+	req := &af_packet.AfPacketCreate{
+		HostIfName:      []byte(hostIfName),
+		UseRandomHwAddr: 1,
+	}
+
+	reply := &af_packet.AfPacketCreateReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugAfPacket {
+			fmt.Println("Error creating af_packet interface:", err)
+		}
+		return
+	} else {
+		swIfIndex = reply.SwIfIndex
+	}
+
+	return
+}
+
+// Attempt to delete the af_packet interface attached to the given host
+// (kernel) interface.
+func DeleteAfPacketInterface(ch *api.Channel, hostIfName string) (err error) {
+
+	// Populate the Delete Structure
+	req := &af_packet.AfPacketDelete{
+		HostIfName: []byte(hostIfName),
+	}
+
+	reply := &af_packet.AfPacketDeleteReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugAfPacket {
+			fmt.Println("Error deleting af_packet interface:", err)
+		}
+		return err
+	}
+
+	return err
+}
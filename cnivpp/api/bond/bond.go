@@ -0,0 +1,270 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vppbond
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/bond"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugBond = false
+
+// Bond Modes, values as defined by VPP.
+type BondMode uint8
+
+const (
+	ModeRoundRobin   BondMode = 1
+	ModeActiveBackup BondMode = 2
+	ModeXor          BondMode = 3
+	ModeBroadcast    BondMode = 4
+	ModeLacp         BondMode = 5
+)
+
+// Load Balance algorithms, only used by ModeXor and ModeLacp.
+type BondLb uint8
+
+const (
+	LbL2  BondLb = 0
+	LbL34 BondLb = 1
+	LbL23 BondLb = 2
+)
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func BondCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&bond.BondCreate{},
+		&bond.BondCreateReply{},
+		&bond.BondDelete{},
+		&bond.BondDeleteReply{},
+		&bond.BondEnslave{},
+		&bond.BondEnslaveReply{},
+		&bond.BondDetachSlave{},
+		&bond.BondDetachSlaveReply{},
+		&bond.SwInterfaceBondDump{},
+		&bond.SwInterfaceBondDetails{},
+		&bond.SwInterfaceSlaveDump{},
+		&bond.SwInterfaceSlaveDetails{},
+	)
+	if err != nil {
+		if debugBond {
+			fmt.Println("VPP bond failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to create a Bond Interface. VPP names the interface BondEthernetX.
+// Input:
+//   ch *api.Channel
+//   mode BondMode - ModeRoundRobin, ModeActiveBackup, ModeXor, ModeBroadcast or ModeLacp
+//   lb BondLb - Load Balance algorithm, ignored unless mode is ModeXor or ModeLacp
+func CreateBond(ch *api.Channel, mode BondMode, lb BondLb) (swIfIndex uint32, err error) {
+
+	// Populate the Add Structure
+	req := &bond.BondCreate{
+		Mode: uint8(mode),
+		Lb:   uint8(lb),
+	}
+
+	reply := &bond.BondCreateReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Creating bond interface failed: %s", vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugBond {
+			fmt.Println("Error creating bond interface:", err)
+		}
+		return
+	}
+
+	swIfIndex = reply.SwIfIndex
+
+	return
+}
+
+// Attempt to delete a Bond Interface.
+func DeleteBond(ch *api.Channel, swIfIndex uint32) (err error) {
+
+	// Populate the Delete Structure
+	req := &bond.BondDelete{
+		SwIfIndex: swIfIndex,
+	}
+
+	reply := &bond.BondDeleteReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Deleting bond interface %d failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugBond {
+			fmt.Println("Error deleting bond interface:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to add a member interface to a Bond Interface.
+// Input:
+//   ch *api.Channel
+//   swIfIndex uint32 - SwIfIndex of the member interface
+//   bondSwIfIndex uint32 - SwIfIndex of the Bond Interface
+func EnslaveInterface(ch *api.Channel, swIfIndex uint32, bondSwIfIndex uint32) (err error) {
+
+	// Populate the Add Structure
+	req := &bond.BondEnslave{
+		SwIfIndex:     swIfIndex,
+		BondSwIfIndex: bondSwIfIndex,
+	}
+
+	reply := &bond.BondEnslaveReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Adding interface %d to bond %d failed: %s", swIfIndex, bondSwIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugBond {
+			fmt.Println("Error adding interface to bond:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to remove a member interface from its Bond Interface.
+func DetachInterface(ch *api.Channel, swIfIndex uint32) (err error) {
+
+	// Populate the Delete Structure
+	req := &bond.BondDetachSlave{
+		SwIfIndex: swIfIndex,
+	}
+
+	reply := &bond.BondDetachSlaveReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Removing interface %d from bond failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugBond {
+			fmt.Println("Error removing interface from bond:", err)
+		}
+	}
+
+	return err
+}
+
+// Loop through the Bond Interfaces and their members and find the Bond
+// Interface the given interface is a member of.
+// Returns:
+//   uint32 - swIfIndex of the Bond Interface, if found.
+//   bool - Found flag
+func FindBondOfMember(ch *api.Channel, swIfIndex uint32) (bondSwIfIndex uint32, found bool) {
+
+	for _, bondIndex := range getBonds(ch) {
+		for _, memberIndex := range getMembers(ch, bondIndex) {
+			if memberIndex == swIfIndex {
+				return bondIndex, true
+			}
+		}
+	}
+
+	return
+}
+
+//
+// Local Functions
+//
+
+// Loop through the Bond Interfaces and return their swIfIndex.
+func getBonds(ch *api.Channel) (bonds []uint32) {
+
+	// Populate the Message Structure
+	req := &bond.SwInterfaceBondDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &bond.SwInterfaceBondDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugBond {
+				fmt.Println("Error searching bond interfaces:", err)
+			}
+		} else {
+			bonds = append(bonds, reply.SwIfIndex)
+		}
+	}
+	return
+}
+
+// Loop through the members of the Bond Interface and return their swIfIndex.
+func getMembers(ch *api.Channel, bondSwIfIndex uint32) (members []uint32) {
+
+	// Populate the Message Structure
+	req := &bond.SwInterfaceSlaveDump{
+		SwIfIndex: bondSwIfIndex,
+	}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &bond.SwInterfaceSlaveDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugBond {
+				fmt.Println("Error searching bond members:", err)
+			}
+		} else {
+			members = append(members, reply.SwIfIndex)
+		}
+	}
+	return
+}
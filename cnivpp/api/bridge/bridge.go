@@ -24,6 +24,8 @@ import (
 
 	"git.fd.io/govpp.git/api"
 	"git.fd.io/govpp.git/core/bin_api/l2"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
 )
 
 //
@@ -31,6 +33,9 @@ import (
 //
 const debugBridge = false
 
+// BviSwIfIndex of a Bridge Domain without BVI interface.
+const noBvi = ^uint32(0)
+
 //
 // API Functions
 //
@@ -81,7 +86,7 @@ func CreateBridge(ch *api.Channel, bridgeDomain uint32) error {
 
 	reply := &l2.BridgeDomainAddDelReply{}
 
-	err := ch.SendRequest(req).ReceiveReply(reply)
+	err := vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugBridge {
@@ -110,7 +115,7 @@ func DeleteBridge(ch *api.Channel, bridgeDomain uint32) error {
 
 	reply := &l2.BridgeDomainAddDelReply{}
 
-	err := ch.SendRequest(req).ReceiveReply(reply)
+	err := vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugBridge {
@@ -123,7 +128,13 @@ func DeleteBridge(ch *api.Channel, bridgeDomain uint32) error {
 }
 
 // Attempt to add an interface to a Bridge Domain.
-func AddBridgeInterface(ch *api.Channel, bridgeDomain uint32, swIfId uint32) error {
+// Input:
+//   ch *api.Channel
+//   bridgeDomain uint32 - Bridge Domain Id, created if it does not exist
+//   swIfId uint32 - Interface to add
+//   shg uint8 - Split horizon group of the interface, 0 for none
+//   bvi bool - Interface is the BVI of the Bridge Domain, there can only be one
+func AddBridgeInterface(ch *api.Channel, bridgeDomain uint32, swIfId uint32, shg uint8, bvi bool) error {
 	var err error
 
 	// Determine if bridge domain exists, and if not, create it. CreateBridge()
@@ -137,14 +148,22 @@ func AddBridgeInterface(ch *api.Channel, bridgeDomain uint32, swIfId uint32) err
 	req := &l2.SwInterfaceSetL2Bridge{
 		BdID:        bridgeDomain,
 		RxSwIfIndex: swIfId,
-		Shg:         0,
+		Shg:         shg,
 		Bvi:         0,
 		Enable:      1,
 	}
 
+	if bvi {
+		bviSwIfIndex := findBridgeBvi(ch, bridgeDomain)
+		if bviSwIfIndex != noBvi && bviSwIfIndex != swIfId {
+			return fmt.Errorf("ERROR: Bridge Domain %d already has BVI interface %d", bridgeDomain, bviSwIfIndex)
+		}
+		req.Bvi = 1
+	}
+
 	reply := &l2.SwInterfaceSetL2BridgeReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugBridge {
@@ -170,7 +189,7 @@ func RemoveBridgeInterface(ch *api.Channel, bridgeDomain uint32, swIfId uint32)
 
 	reply := &l2.SwInterfaceSetL2BridgeReply{}
 
-	err := ch.SendRequest(req).ReceiveReply(reply)
+	err := vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugBridge {
@@ -200,7 +219,7 @@ func DumpBridge(ch *api.Channel, bridgeDomain uint32) {
 
 	reply := &l2.BridgeDomainDetails{}
 
-	err := ch.SendRequest(req).ReceiveReply(reply)
+	err := vppinfra.SendRequest(ch, req, reply)
 
 	if err == nil {
 		fmt.Printf("    Bridge Domain %d: Fld=%d UuFld=%d Fwd=%d Lrn=%d Arp=%d Mac=%d Bvi=%d NSwId=%d BdTag=%s\n",
@@ -227,6 +246,36 @@ func DumpBridge(ch *api.Channel, bridgeDomain uint32) {
 	}
 }
 
+// Retrieve the Ids of all the Bridge Domains, including the ones not
+// created by the UserSpace CNI.
+func ListBridges(ch *api.Channel) ([]uint32, error) {
+	var bridgeDomains []uint32
+
+	// Populate the Message Structure. ~0 dumps all the Bridge Domains.
+	req := &l2.BridgeDomainDump{
+		BdID: ^uint32(0),
+	}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &l2.BridgeDomainDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugBridge {
+				fmt.Println("Error listing Bridge Domains:", err)
+			}
+			return nil, err
+		}
+
+		bridgeDomains = append(bridgeDomains, reply.BdID)
+	}
+
+	return bridgeDomains, nil
+}
+
 //
 // Local Functions
 //
@@ -269,3 +318,28 @@ func findBridge(ch *api.Channel, bridgeDomain uint32) (bool, uint32) {
 
 	return rval, count
 }
+
+// Determine the BVI interface of the input Bridge.
+// Return: uint32 - BVI interface, noBvi if none or the Bridge doesn't exist
+func findBridgeBvi(ch *api.Channel, bridgeDomain uint32) uint32 {
+	var bviSwIfIndex uint32 = noBvi
+
+	// Populate the Message Structure
+	req := &l2.BridgeDomainDump{
+		BdID: bridgeDomain,
+	}
+	reqCtx := ch.SendMultiRequest(req)
+
+	// See findBridge() for the use of SendMultiRequest.
+	for {
+		reply := &l2.BridgeDomainDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop || err != nil {
+			break // break out of the loop
+		}
+
+		bviSwIfIndex = reply.BviSwIfIndex
+	}
+
+	return bviSwIfIndex
+}
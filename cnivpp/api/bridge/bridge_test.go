@@ -0,0 +1,152 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vppbridge
+
+import (
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"git.fd.io/govpp.git/adapter/mock"
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core"
+	"git.fd.io/govpp.git/core/bin_api/l2"
+	"git.fd.io/govpp.git/core/bin_api/vpe"
+)
+
+// openTestChannel() - Connect to the govpp mock adapter, which replies as
+//  set up on the returned adapter. The returned function disconnects.
+func openTestChannel(t *testing.T) (*mock.VppAdapter, *api.Channel, func()) {
+	// The mock adapter and govpp log every message.
+	log.SetOutput(ioutil.Discard)
+	quiet := logrus.New()
+	quiet.Out = ioutil.Discard
+	core.SetLogger(quiet)
+
+	vpp := &mock.VppAdapter{}
+	conn, err := core.Connect(vpp)
+	if err != nil {
+		t.Fatalf("core.Connect(): %v", err)
+	}
+
+	ch, err := conn.NewAPIChannel()
+	if err != nil {
+		conn.Disconnect()
+		t.Fatalf("NewAPIChannel(): %v", err)
+	}
+
+	return vpp, ch, func() {
+		ch.Close()
+		conn.Disconnect()
+	}
+}
+
+func TestAddBridgeInterface(t *testing.T) {
+	vpp, ch, disconnect := openTestChannel(t)
+	defer disconnect()
+
+	// The mock adapter knows the control ping by its ID only.
+	ping := &vpe.ControlPing{}
+	pingID, _ := vpp.GetMsgID(ping.GetMessageName(), ping.GetCrcString())
+
+	// Fake VPP with Bridge Domain 4, its BVI set by the test, recording the
+	// sw_interface_set_l2_bridge requests.
+	var mu sync.Mutex
+	var bviSwIfIndex uint32
+	var sent []l2.SwInterfaceSetL2Bridge
+	vpp.MockReplyHandler(func(request mock.MessageDTO) ([]byte, uint16, bool) {
+		var reply api.Message
+		switch {
+		case request.MsgName == (&l2.BridgeDomainDump{}).GetMessageName():
+			mu.Lock()
+			reply = &l2.BridgeDomainDetails{BdID: 4, BviSwIfIndex: bviSwIfIndex, NSwIfs: 1,
+				SwIfDetails: []l2.BridgeDomainSwIf{{SwIfIndex: 3}}}
+			mu.Unlock()
+		case request.MsgName == (&l2.SwInterfaceSetL2Bridge{}).GetMessageName():
+			req := l2.SwInterfaceSetL2Bridge{}
+			if err := (&core.MsgCodec{}).DecodeMsg(request.Data, &req); err != nil {
+				return nil, 0, false
+			}
+			mu.Lock()
+			sent = append(sent, req)
+			mu.Unlock()
+			reply = &l2.SwInterfaceSetL2BridgeReply{}
+		case request.MsgID == pingID:
+			reply = &vpe.ControlPingReply{}
+		default:
+			return nil, 0, false
+		}
+
+		msgID, err := vpp.GetMsgID(reply.GetMessageName(), reply.GetCrcString())
+		if err != nil {
+			return nil, 0, false
+		}
+		data, err := vpp.ReplyBytes(request, reply)
+		return data, msgID, err == nil
+	})
+
+	tests := []struct {
+		name    string
+		shg     uint8
+		bvi     bool
+		domBvi  uint32
+		wantErr bool
+		want    []l2.SwInterfaceSetL2Bridge
+	}{
+		{"plain", 0, false, noBvi, false,
+			[]l2.SwInterfaceSetL2Bridge{{RxSwIfIndex: 5, BdID: 4, Shg: 0, Bvi: 0, Enable: 1}}},
+		{"shg", 2, false, noBvi, false,
+			[]l2.SwInterfaceSetL2Bridge{{RxSwIfIndex: 5, BdID: 4, Shg: 2, Bvi: 0, Enable: 1}}},
+		{"bvi", 0, true, noBvi, false,
+			[]l2.SwInterfaceSetL2Bridge{{RxSwIfIndex: 5, BdID: 4, Shg: 0, Bvi: 1, Enable: 1}}},
+		{"shg and bvi", 3, true, noBvi, false,
+			[]l2.SwInterfaceSetL2Bridge{{RxSwIfIndex: 5, BdID: 4, Shg: 3, Bvi: 1, Enable: 1}}},
+		// Added again, by a repeated ADD.
+		{"bvi already", 0, true, 5, false,
+			[]l2.SwInterfaceSetL2Bridge{{RxSwIfIndex: 5, BdID: 4, Shg: 0, Bvi: 1, Enable: 1}}},
+		// One BVI per Bridge Domain, nothing is sent.
+		{"other bvi", 0, true, 7, true, nil},
+		{"not bvi with other bvi", 2, false, 7, false,
+			[]l2.SwInterfaceSetL2Bridge{{RxSwIfIndex: 5, BdID: 4, Shg: 2, Bvi: 0, Enable: 1}}},
+	}
+
+	for _, test := range tests {
+		mu.Lock()
+		bviSwIfIndex = test.domBvi
+		sent = nil
+		mu.Unlock()
+
+		err := AddBridgeInterface(ch, 4, 5, test.shg, test.bvi)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: AddBridgeInterface() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		mu.Lock()
+		if len(sent) != len(test.want) {
+			t.Errorf("%s: AddBridgeInterface() sent %+v, want %+v", test.name, sent, test.want)
+		} else {
+			for i := range sent {
+				if sent[i] != test.want[i] {
+					t.Errorf("%s: AddBridgeInterface() sent %+v, want %+v", test.name, sent[i], test.want[i])
+				}
+			}
+		}
+		mu.Unlock()
+	}
+}
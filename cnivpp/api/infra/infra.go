@@ -21,6 +21,9 @@ package vppinfra
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -34,6 +37,29 @@ import (
 //
 const debugInfra = false
 
+// Maximum number of requests outstanding on a channel at once. Must stay
+// below the size of the govpp reply channel buffer (100).
+const maxPipelineDepth = 50
+
+// Reconnect handling when VPP restarts during an operation. VPP is ready
+// to accept a connection once its API shared memory file exists.
+const maxReconnectAttempts = 3
+const reconnectWaitTimeout = 30 * time.Second
+const reconnectPollInterval = 500 * time.Millisecond
+const vppApiShmFile = "/dev/shm/vpe-api"
+
+// Errors returned by govpp when the connection to VPP is lost.
+var channelErrors = []string{
+	"no reply received within the timeout period",
+	"unable to send the messge",
+	"not connected to VPP",
+}
+
+// Connection to VPP kept open between operations, see SetPersistent().
+// govpp only supports one connection per process.
+var persistent = false
+var persistentConn *core.Connection
+
 //
 // Types
 //
@@ -44,10 +70,23 @@ type ConnectionData struct {
 	closeFlag      bool
 }
 
+// A request and the reply it is decoded into, for SendPipelined().
+type PipelinedRequest struct {
+	Request api.Message
+	Reply   api.Message
+}
+
 //
 // API Functions
 //
 
+// Keep the Connection to VPP open when the Channel is closed, and reuse it
+// for the next Channel, for a long running process like the daemon. The
+// Connection is only replaced when VPP restarts, see VppReconnect().
+func SetPersistent(enable bool) {
+	persistent = enable
+}
+
 // Open a Connection and Channel to VPP to allow communication to VPP.
 func VppOpenCh() (ConnectionData, error) {
 
@@ -58,15 +97,27 @@ func VppOpenCh() (ConnectionData, error) {
 	//   Logrus has six logging levels: DebugLevel, InfoLevel, WarningLevel, ErrorLevel, FatalLevel and PanicLevel.
 	core.SetLogger(&logrus.Logger{Level: logrus.ErrorLevel})
 
-	// Connect to VPP
-	vppCh.conn, err = govpp.Connect("")
-	if err != nil {
-		if debugInfra {
-			fmt.Println("Error:", err)
+	if persistent && persistentConn != nil {
+		vppCh.conn = persistentConn
+	} else {
+		// Connect to VPP. The vendored govpp only has the shared memory
+		// transport, so the API segment has to be visible in /dev/shm.
+		vppCh.conn, err = govpp.Connect("")
+		if err != nil {
+			err = fmt.Errorf("ERROR: connect to VPP over shared memory (%s) failed: %v", vppApiShmFile, err)
+			if debugInfra {
+				fmt.Println("Error:", err)
+			}
+			return vppCh, err
+		}
+
+		// A persistent Connection is never closed by VppCloseCh().
+		if persistent {
+			persistentConn = vppCh.conn
+		} else {
+			vppCh.disconnectFlag = true
 		}
-		return vppCh, err
 	}
-	vppCh.disconnectFlag = true
 
 	// Create an API channel to VPP
 	vppCh.Ch, err = vppCh.conn.NewAPIChannel()
@@ -95,3 +146,132 @@ func VppCloseCh(vppCh ConnectionData) {
 		vppCh.disconnectFlag = false
 	}
 }
+
+// Check whether VPP is running, by its API shared memory file, without
+// connecting to it.
+func VppApiExists() error {
+	if _, err := os.Stat(vppApiShmFile); err != nil {
+		return fmt.Errorf("VPP API shared memory %s not found", vppApiShmFile)
+	}
+	return nil
+}
+
+// Close the Connection and Channel to VPP and open new ones, once VPP is
+// ready to accept a connection again.
+func VppReconnect(vppCh *ConnectionData) error {
+
+	VppCloseCh(*vppCh)
+	*vppCh = ConnectionData{}
+
+	// The persistent Connection was lost with VPP.
+	if persistentConn != nil {
+		persistentConn.Disconnect()
+		persistentConn = nil
+	}
+
+	deadline := time.Now().Add(reconnectWaitTimeout)
+	for {
+		if _, err := os.Stat(vppApiShmFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("VPP not ready after %v", reconnectWaitTimeout)
+		}
+		time.Sleep(reconnectPollInterval)
+	}
+
+	newCh, err := VppOpenCh()
+	if err != nil {
+		return err
+	}
+	*vppCh = newCh
+
+	return nil
+}
+
+// Run an operation on the Channel to VPP. If the operation fails because the
+// connection to VPP was lost (VPP restarted), reconnect and replay the entire
+// operation, up to maxReconnectAttempts times. The operation must read the
+// Channel from vppCh each time it is run, and must be safe to replay.
+func VppRetry(vppCh *ConnectionData, operation func() error) error {
+
+	err := operation()
+	for attempt := 1; err != nil && isChannelError(err); attempt++ {
+		if attempt > maxReconnectAttempts {
+			return fmt.Errorf("ERROR: Lost connection to VPP, giving up after %d reconnect attempts: %v",
+				maxReconnectAttempts, err)
+		}
+
+		logrus.Warningf("Lost connection to VPP (%v), reconnecting and replaying operation, attempt %d of %d",
+			err, attempt, maxReconnectAttempts)
+
+		if reconnectErr := VppReconnect(vppCh); reconnectErr != nil {
+			return fmt.Errorf("ERROR: Lost connection to VPP (%v) and failed to reconnect: %v", err, reconnectErr)
+		}
+
+		err = operation()
+	}
+
+	return err
+}
+
+// Send a set of independent requests without waiting on each reply, then
+// collect all the replies. VPP processes the requests in order, so the
+// requests must not depend on the result of each other. All the replies
+// are collected, even on error, to leave the channel in a clean state.
+// The first error is returned.
+func SendPipelined(ch *api.Channel, requests []PipelinedRequest) (err error) {
+
+	for start := 0; start < len(requests); start += maxPipelineDepth {
+		end := start + maxPipelineDepth
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		ctxs := make([]*api.RequestCtx, 0, end-start)
+		for _, pipelined := range requests[start:end] {
+			ctxs = append(ctxs, ch.SendRequest(pipelined.Request))
+		}
+
+		for i, ctx := range ctxs {
+			if replyErr := ctx.ReceiveReply(requests[start+i].Reply); replyErr != nil && err == nil {
+				if debugInfra {
+					fmt.Println("Error:", replyErr)
+				}
+				err = replyErr
+			}
+		}
+
+		// A request answered with a transient retval is sent again alone,
+		// see SendRequest().
+		for _, pipelined := range requests[start:end] {
+			if err != nil || retryAttempts == 1 {
+				break
+			}
+			if retval, ok := getRetval(pipelined.Reply); ok && IsTransientRetval(retval) {
+				err = SendRequest(ch, pipelined.Request, pipelined.Reply)
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//
+// Local Functions
+//
+
+// isChannelError() - Determine if the error is due to the loss of the
+//  connection to VPP, as opposed to VPP rejecting the request.
+func isChannelError(err error) bool {
+	for _, channelError := range channelErrors {
+		if strings.Contains(err.Error(), channelError) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vppinfra
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"git.fd.io/govpp.git/adapter/mock"
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core"
+)
+
+// Round trip of a request to VPP injected by the fake adapter.
+const testLatency = time.Millisecond
+
+// Number of requests of an operation, like the routes of an attachment.
+const testRequestCount = 20
+
+//
+// Fake VPP
+//
+
+// A request and its reply, only known to the fake adapter.
+type testRequest struct {
+	Value uint32
+}
+
+func (*testRequest) GetMessageName() string          { return "usrsp_test" }
+func (*testRequest) GetMessageType() api.MessageType { return api.RequestMessage }
+func (*testRequest) GetCrcString() string            { return "00000000" }
+
+type testReply struct {
+	Retval int32
+}
+
+func (*testReply) GetMessageName() string          { return "usrsp_test_reply" }
+func (*testReply) GetMessageType() api.MessageType { return api.ReplyMessage }
+func (*testReply) GetCrcString() string            { return "00000000" }
+
+type delayedReply struct {
+	deliverAt time.Time
+	context   uint32
+	msgID     uint16
+	data      []byte
+}
+
+// latencyAdapter - The govpp mock adapter, with the replies delivered
+//  latency after the request is sent, in order, like VPP would. Requests
+//  sent without waiting on the previous reply overlap.
+type latencyAdapter struct {
+	*mock.VppAdapter
+	latency time.Duration
+	replies chan delayedReply
+}
+
+func newLatencyAdapter(latency time.Duration) *latencyAdapter {
+	a := &latencyAdapter{
+		VppAdapter: &mock.VppAdapter{},
+		latency:    latency,
+		replies:    make(chan delayedReply, 1024),
+	}
+
+	a.MockReplyHandler(func(request mock.MessageDTO) ([]byte, uint16, bool) {
+		reply := &testReply{}
+		msgID, err := a.GetMsgID(reply.GetMessageName(), reply.GetCrcString())
+		if err != nil {
+			return nil, 0, false
+		}
+		data, err := a.ReplyBytes(request, reply)
+		return data, msgID, err == nil
+	})
+
+	return a
+}
+
+func (a *latencyAdapter) SetMsgCallback(cb func(context uint32, msgID uint16, data []byte)) {
+	a.VppAdapter.SetMsgCallback(func(context uint32, msgID uint16, data []byte) {
+		a.replies <- delayedReply{time.Now().Add(a.latency), context, msgID, data}
+	})
+
+	go func() {
+		for reply := range a.replies {
+			time.Sleep(time.Until(reply.deliverAt))
+			cb(reply.context, reply.msgID, reply.data)
+		}
+	}()
+}
+
+func (a *latencyAdapter) Disconnect() {
+	close(a.replies)
+}
+
+// quietLogs() - The mock adapter and govpp log every reply.
+func quietLogs() {
+	log.SetOutput(ioutil.Discard)
+	quiet := logrus.New()
+	quiet.Out = ioutil.Discard
+	core.SetLogger(quiet)
+}
+
+// openTestChannel() - Connect to a fake VPP answering every request after
+//  latency. The returned function disconnects.
+func openTestChannel(tb testing.TB, latency time.Duration) (*api.Channel, func()) {
+	quietLogs()
+
+	conn, err := core.Connect(newLatencyAdapter(latency))
+	if err != nil {
+		tb.Fatalf("core.Connect(): %v", err)
+	}
+
+	ch, err := conn.NewAPIChannel()
+	if err != nil {
+		conn.Disconnect()
+		tb.Fatalf("NewAPIChannel(): %v", err)
+	}
+
+	return ch, func() {
+		ch.Close()
+		conn.Disconnect()
+	}
+}
+
+func newTestRequests(count int) []PipelinedRequest {
+	requests := make([]PipelinedRequest, count)
+	for i := range requests {
+		requests[i] = PipelinedRequest{Request: &testRequest{Value: uint32(i)}, Reply: &testReply{Retval: -1}}
+	}
+	return requests
+}
+
+//
+// Tests
+//
+
+func TestSendPipelined(t *testing.T) {
+	ch, disconnect := openTestChannel(t, testLatency)
+	defer disconnect()
+
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{"empty", 0},
+		{"one", 1},
+		{"pipeline depth", maxPipelineDepth},
+		{"several pipelines", 2*maxPipelineDepth + 1},
+	}
+
+	for _, test := range tests {
+		requests := newTestRequests(test.count)
+
+		start := time.Now()
+		if err := SendPipelined(ch, requests); err != nil {
+			t.Errorf("%s: SendPipelined() error = %v", test.name, err)
+			continue
+		}
+		for i, pipelined := range requests {
+			if pipelined.Reply.(*testReply).Retval != 0 {
+				t.Errorf("%s: reply %d not received", test.name, i)
+			}
+		}
+
+		// One round trip per pipeline, not per request.
+		pipelines := (test.count + maxPipelineDepth - 1) / maxPipelineDepth
+		if elapsed := time.Since(start); test.count > 1 && elapsed >= time.Duration(test.count)*testLatency {
+			t.Errorf("%s: SendPipelined() took %v for %d pipelines of %v", test.name, elapsed, pipelines, testLatency)
+		}
+	}
+}
+
+//
+// Benchmarks
+//
+
+func BenchmarkSendSerial(b *testing.B) {
+	ch, disconnect := openTestChannel(b, testLatency)
+	defer disconnect()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, pipelined := range newTestRequests(testRequestCount) {
+			if err := SendRequest(ch, pipelined.Request, pipelined.Reply); err != nil {
+				b.Fatalf("SendRequest(): %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkSendPipelined(b *testing.B) {
+	ch, disconnect := openTestChannel(b, testLatency)
+	defer disconnect()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := SendPipelined(ch, newTestRequests(testRequestCount)); err != nil {
+			b.Fatalf("SendPipelined(): %v", err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Retval: The reply of a VPP API request carries a retval, a vnet error
+// code (vnet/api_errno.h), which govpp does not check. Under load, VPP
+// answers some requests with a transient retval (like IN_PROGRESS): the
+// request is sent again by SendRequest(), after a short backoff doubling
+// at each attempt, up to the attempts of the retry policy. Other retvals
+// are failures, reported with the message of retvalTable by
+// RetvalString().
+//
+// Add the retvals of the messages used by the plugin to retvalTable as
+// they are met, flagging those worth retrying as transient.
+//
+
+package vppinfra
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"git.fd.io/govpp.git/api"
+)
+
+//
+// Constants
+//
+
+// Default retry policy of the transient retvals, see SetRetryPolicy().
+const DefaultRetryAttempts = 5
+const DefaultRetryBackoff = 50 * time.Millisecond
+
+// Longest wait between two attempts.
+const maxRetryBackoff = 2 * time.Second
+
+//
+// Types
+//
+
+// A retval of the VPP API.
+type retvalInfo struct {
+	name      string // Name in vnet/api_errno.h
+	message   string // Reported in the errors
+	transient bool   // Whether the request is sent again
+}
+
+//
+// Variables
+//
+
+// Retvals of the messages used by the plugin.
+var retvalTable = map[int32]retvalInfo{
+	10:   {"IN_PROGRESS", "operation in progress", true},
+	-1:   {"UNSPECIFIED", "unspecified error", false},
+	-2:   {"INVALID_SW_IF_INDEX", "invalid interface (sw_if_index)", false},
+	-3:   {"NO_SUCH_FIB", "no such FIB / VRF", false},
+	-6:   {"NO_SUCH_ENTRY", "no such entry", false},
+	-7:   {"INVALID_VALUE", "invalid value", false},
+	-9:   {"UNIMPLEMENTED", "not implemented", false},
+	-10:  {"INVALID_SW_IF_INDEX_2", "invalid second interface (sw_if_index)", false},
+	-30:  {"FEATURE_DISABLED", "feature disabled by configuration", false},
+	-50:  {"NEXT_HOP_NOT_IN_FIB", "next hop not in FIB", false},
+	-60:  {"ADDRESS_NOT_FOUND_FOR_INTERFACE", "address not found on interface", false},
+	-62:  {"IP6_NOT_ENABLED", "IPv6 not enabled on interface", false},
+	-73:  {"INVALID_ARGUMENT", "invalid argument", false},
+	-77:  {"RESPONSE_NOT_READY", "response not ready", true},
+	-79:  {"IF_ALREADY_EXISTS", "interface already exists", false},
+	-81:  {"VALUE_EXIST", "value already exists", false},
+	-105: {"ADDRESS_IN_USE", "address in use", false},
+	-107: {"QUEUE_FULL", "queue full", true},
+	-114: {"ADDRESS_FOUND_FOR_INTERFACE", "address already present", false},
+}
+
+// Retry policy of the transient retvals.
+var retryAttempts = DefaultRetryAttempts
+var retryBackoff = DefaultRetryBackoff
+
+//
+// API Functions
+//
+
+// Set the number of attempts (1 for no retry) of a request answered with a
+// transient retval, and the wait before the first retry.
+func SetRetryPolicy(attempts int, backoff time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	retryAttempts = attempts
+	retryBackoff = backoff
+}
+
+// Whether a request answered with the retval is sent again.
+func IsTransientRetval(retval int32) bool {
+	return retvalTable[retval].transient
+}
+
+// Message of a retval for the errors, like "address already present
+// (retval=-114)". A retval not in retvalTable only gives its value.
+func RetvalString(retval int32) string {
+	if info, ok := retvalTable[retval]; ok {
+		return fmt.Sprintf("%s (retval=%d)", info.message, retval)
+	}
+	return fmt.Sprintf("retval=%d", retval)
+}
+
+// Send a request and receive its reply, sending it again while the reply
+// carries a transient retval, following the retry policy. Only the errors
+// of the channel are returned, the retval is left in the reply for the
+// caller to check.
+func SendRequest(ch *api.Channel, req api.Message, reply api.Message) (err error) {
+	backoff := retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err = ch.SendRequest(req).ReceiveReply(reply)
+		if err != nil {
+			return
+		}
+
+		retval, ok := getRetval(reply)
+		if ok == false || IsTransientRetval(retval) == false || attempt >= retryAttempts {
+			return
+		}
+
+		logrus.Debugf("VPP %s: %s, retrying in %v, attempt %d of %d",
+			req.GetMessageName(), RetvalString(retval), backoff, attempt+1, retryAttempts)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+//
+// Local Functions
+//
+
+// getRetval() - The Retval field of a reply, replies without one (like
+//  details of a dump) return false.
+func getRetval(reply api.Message) (int32, bool) {
+	value := reflect.ValueOf(reply)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return 0, false
+	}
+
+	field := value.FieldByName("Retval")
+	if field.IsValid() == false || field.Kind() != reflect.Int32 {
+		return 0, false
+	}
+	return int32(field.Int()), true
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vppinfra
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"git.fd.io/govpp.git/adapter/mock"
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core"
+)
+
+// openRetvalChannel() - Connect to a fake VPP answering the requests with
+//  the retvals in order, 0 once they are used. The returned function gives
+//  the number of requests received.
+func openRetvalChannel(t *testing.T, retvals []int32) (*api.Channel, func() int, func()) {
+	quietLogs()
+
+	vpp := &mock.VppAdapter{}
+	var mu sync.Mutex
+	received := 0
+	vpp.MockReplyHandler(func(request mock.MessageDTO) ([]byte, uint16, bool) {
+		mu.Lock()
+		reply := &testReply{}
+		if received < len(retvals) {
+			reply.Retval = retvals[received]
+		}
+		received++
+		mu.Unlock()
+
+		msgID, err := vpp.GetMsgID(reply.GetMessageName(), reply.GetCrcString())
+		if err != nil {
+			return nil, 0, false
+		}
+		data, err := vpp.ReplyBytes(request, reply)
+		return data, msgID, err == nil
+	})
+
+	conn, err := core.Connect(vpp)
+	if err != nil {
+		t.Fatalf("core.Connect(): %v", err)
+	}
+	ch, err := conn.NewAPIChannel()
+	if err != nil {
+		conn.Disconnect()
+		t.Fatalf("NewAPIChannel(): %v", err)
+	}
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+	return ch, count, func() {
+		ch.Close()
+		conn.Disconnect()
+	}
+}
+
+func TestSendRequestRetry(t *testing.T) {
+	defer SetRetryPolicy(DefaultRetryAttempts, DefaultRetryBackoff)
+
+	tests := []struct {
+		name         string
+		attempts     int
+		retvals      []int32
+		wantRetval   int32
+		wantReceived int
+	}{
+		{"success", 3, nil, 0, 1},
+		{"in progress once", 3, []int32{10}, 0, 2},
+		{"queue full", 3, []int32{-107, -77}, 0, 3},
+		// Still transient after the last attempt, the retval is returned.
+		{"attempts exhausted", 3, []int32{-107, -107, -107, -107}, -107, 3},
+		{"no retry", 1, []int32{10}, 10, 1},
+		{"failure", 3, []int32{-114}, -114, 1},
+	}
+
+	for _, test := range tests {
+		SetRetryPolicy(test.attempts, time.Millisecond)
+		ch, received, disconnect := openRetvalChannel(t, test.retvals)
+
+		reply := &testReply{}
+		if err := SendRequest(ch, &testRequest{}, reply); err != nil {
+			t.Errorf("%s: SendRequest() error = %v", test.name, err)
+		} else if reply.Retval != test.wantRetval || received() != test.wantReceived {
+			t.Errorf("%s: SendRequest() retval %d after %d requests, want %d after %d",
+				test.name, reply.Retval, received(), test.wantRetval, test.wantReceived)
+		}
+
+		disconnect()
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	defer SetRetryPolicy(DefaultRetryAttempts, DefaultRetryBackoff)
+
+	SetRetryPolicy(0, time.Second)
+	if retryAttempts != 1 || retryBackoff != time.Second {
+		t.Errorf("SetRetryPolicy(0) = %d attempts, %v, want 1 attempt", retryAttempts, retryBackoff)
+	}
+}
+
+func TestRetvalString(t *testing.T) {
+	tests := []struct {
+		retval        int32
+		want          string
+		wantTransient bool
+	}{
+		{-114, "address already present (retval=-114)", false},
+		{10, "operation in progress (retval=10)", true},
+		{-107, "queue full (retval=-107)", true},
+		{-999, "retval=-999", false},
+	}
+
+	for _, test := range tests {
+		if got := RetvalString(test.retval); got != test.want {
+			t.Errorf("RetvalString(%d) = %q, want %q", test.retval, got, test.want)
+		}
+		if got := IsTransientRetval(test.retval); got != test.wantTransient {
+			t.Errorf("IsTransientRetval(%d) = %v, want %v", test.retval, got, test.wantTransient)
+		}
+	}
+}
+
+func TestGetRetval(t *testing.T) {
+	tests := []struct {
+		name       string
+		reply      api.Message
+		wantRetval int32
+		wantOk     bool
+	}{
+		{"reply", &testReply{Retval: -2}, -2, true},
+		// Like the details of a dump
+		{"no retval", &testRequest{Value: 1}, 0, false},
+	}
+
+	for _, test := range tests {
+		retval, ok := getRetval(test.reply)
+		if retval != test.wantRetval || ok != test.wantOk {
+			t.Errorf("%s: getRetval() = %d, %v, want %d, %v", test.name, retval, ok, test.wantRetval, test.wantOk)
+		}
+	}
+}
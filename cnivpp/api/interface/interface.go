@@ -21,11 +21,19 @@ package vppinterface
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types/current"
 
 	"git.fd.io/govpp.git/api"
 	"git.fd.io/govpp.git/core/bin_api/interfaces"
+	"git.fd.io/govpp.git/core/bin_api/ip"
+	"git.fd.io/govpp.git/core/bin_api/vpe"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
 )
 
 //
@@ -33,6 +41,28 @@ import (
 //
 const debugInterface = false
 
+// Maximum length of an interface tag. VPP stores the tag in a 64 byte
+// array, which must be NULL terminated.
+const MaxTagLength = 63
+
+// Rx mode of the queues of an interface, as defined by VPP.
+type RxMode uint8
+
+const (
+	RxModePolling   RxMode = 1
+	RxModeInterrupt RxMode = 2
+	RxModeAdaptive  RxMode = 3
+)
+
+// Configuration of an interface, as read back from VPP.
+type InterfaceDetails struct {
+	Name    string
+	AdminUp bool
+	LinkUp  bool
+	Mac     string
+	Mtu     uint16
+}
+
 //
 // API Functions
 //
@@ -44,6 +74,21 @@ func InterfaceCompatibilityCheck(ch *api.Channel) (err error) {
 		&interfaces.SwInterfaceSetFlagsReply{},
 		&interfaces.SwInterfaceAddDelAddress{},
 		&interfaces.SwInterfaceAddDelAddressReply{},
+		&interfaces.SwInterfaceTagAddDel{},
+		&interfaces.SwInterfaceTagAddDelReply{},
+		&interfaces.SwInterfaceDump{},
+		&interfaces.SwInterfaceDetails{},
+		&interfaces.SwInterfaceSetUnnumbered{},
+		&interfaces.SwInterfaceSetUnnumberedReply{},
+		&interfaces.SwInterfaceSetRxMode{},
+		&interfaces.SwInterfaceSetRxModeReply{},
+		&interfaces.WantInterfaceEvents{},
+		&interfaces.WantInterfaceEventsReply{},
+		&interfaces.SwInterfaceEvent{},
+		&ip.IPAddressDump{},
+		&ip.IPAddressDetails{},
+		&vpe.CliInband{},
+		&vpe.CliInbandReply{},
 	)
 	if err != nil {
 		if debugInterface {
@@ -65,7 +110,7 @@ func SetState(ch *api.Channel, swIfIndex uint32, isUp uint8) error {
 
 	reply := &interfaces.SwInterfaceSetFlagsReply{}
 
-	err := ch.SendRequest(req).ReceiveReply(reply)
+	err := vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugInterface {
@@ -77,37 +122,110 @@ func SetState(ch *api.Channel, swIfIndex uint32, isUp uint8) error {
 	return nil
 }
 
+// Attempt to add or delete the addresses in the IPAM result on an interface.
+// Each address in the result is programmed, so results with multiple
+// addresses (IPv4 and IPv6, or DHCP results) are fully applied.
 func AddDelIpAddress(ch *api.Channel, swIfIndex uint32, isAdd uint8, ipResult *current.Result) error {
-
-	// Populate the Add Structure
-	req := &interfaces.SwInterfaceAddDelAddress{
-		SwIfIndex: swIfIndex,
-		IsAdd:     isAdd, // 1 = add, 0 = delete
-		DelAll:    0,
-	}
+	var requests []vppinfra.PipelinedRequest
 
 	for _, ip := range ipResult.IPs {
+		// Populate the Add Structure
+		req := &interfaces.SwInterfaceAddDelAddress{
+			SwIfIndex: swIfIndex,
+			IsAdd:     isAdd, // 1 = add, 0 = delete
+			DelAll:    0,
+		}
+
 		if ip.Version == "4" {
 			req.IsIpv6 = 0
 			req.Address = []byte(ip.Address.IP.To4())
-			prefix, _ := ip.Address.Mask.Size()
-			req.AddressLength = byte(prefix)
 		} else if ip.Version == "6" {
 			req.IsIpv6 = 1
 			req.Address = []byte(ip.Address.IP.To16())
-			prefix, _ := ip.Address.Mask.Size()
-			req.AddressLength = byte(prefix)
+		} else {
+			if debugInterface {
+				fmt.Println("Skipping address with unknown version:", ip.Version)
+			}
+			continue
 		}
+		prefix, _ := ip.Address.Mask.Size()
+		req.AddressLength = byte(prefix)
+
+		requests = append(requests, vppinfra.PipelinedRequest{
+			Request: req,
+			Reply:   &interfaces.SwInterfaceAddDelAddressReply{},
+		})
+	}
+
+	// The addresses are independent of each other, so send them all
+	// before waiting on the replies.
+	err := vppinfra.SendPipelined(ch, requests)
+
+	if err != nil {
+		if debugInterface {
+			fmt.Println("Error:", err)
+		}
+		return err
+	}
 
-		// Only one address is currently supported.
-		if req.AddressLength != 0 {
-			break
+	return nil
+}
+
+// Attempt to make an interface unnumbered, borrowing the addresses of
+// another interface, or to remove the unnumbered binding.
+// Input:
+//   ch *api.Channel
+//   parentSwIfIndex uint32 - Interface the addresses are borrowed from, like a loopback
+//   swIfIndex uint32 - Interface made unnumbered
+//   isAdd uint8 - 1 = add, 0 = delete
+func SetUnnumbered(ch *api.Channel, parentSwIfIndex uint32, swIfIndex uint32, isAdd uint8) error {
+
+	// Populate the Request Structure
+	req := &interfaces.SwInterfaceSetUnnumbered{
+		SwIfIndex:           parentSwIfIndex,
+		UnnumberedSwIfIndex: swIfIndex,
+		IsAdd:               isAdd,
+	}
+
+	reply := &interfaces.SwInterfaceSetUnnumberedReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Unnumbered interface %d from %d failed: %s", swIfIndex, parentSwIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugInterface {
+			fmt.Println("Error:", err)
 		}
+		return err
 	}
 
-	reply := &interfaces.SwInterfaceAddDelAddressReply{}
+	return nil
+}
+
+// Attempt to set the rx mode of all the queues of an interface.
+// Input:
+//   ch *api.Channel
+//   swIfIndex uint32 - Interface the rx mode is set on
+//   mode RxMode - RxModePolling, RxModeInterrupt or RxModeAdaptive
+func SetRxMode(ch *api.Channel, swIfIndex uint32, mode RxMode) error {
 
-	err := ch.SendRequest(req).ReceiveReply(reply)
+	// Populate the Request Structure
+	req := &interfaces.SwInterfaceSetRxMode{
+		SwIfIndex:    swIfIndex,
+		QueueIDValid: 0, // All queues
+		Mode:         uint8(mode),
+	}
+
+	reply := &interfaces.SwInterfaceSetRxModeReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Rx mode %d on interface %d failed: %s", mode, swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
 
 	if err != nil {
 		if debugInterface {
@@ -118,3 +236,412 @@ func AddDelIpAddress(ch *api.Channel, swIfIndex uint32, isAdd uint8, ipResult *c
 
 	return nil
 }
+
+// Attempt to set the tag on an interface. The tag is truncated to
+// MaxTagLength if needed. The tag is removed by VPP when the interface
+// is deleted.
+func SetTag(ch *api.Channel, swIfIndex uint32, tag string) error {
+
+	// Populate the Add Structure
+	req := &interfaces.SwInterfaceTagAddDel{
+		IsAdd:     1,
+		SwIfIndex: swIfIndex,
+		Tag:       []byte(truncateTag(tag)),
+	}
+
+	reply := &interfaces.SwInterfaceTagAddDelReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugInterface {
+			fmt.Println("Error:", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Loop through the list of interfaces and find the interface with the
+// given tag. The tag is truncated to MaxTagLength before comparing, same
+// as SetTag().
+// Returns:
+//   uint32 - swIfIndex of the interface, if found.
+//   bool - Found flag
+func FindInterfaceByTag(ch *api.Channel, tag string) (swIfIndex uint32, found bool) {
+
+	tag = truncateTag(tag)
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error searching interface:", err)
+			}
+		} else if found == false && tag == strings.TrimRight(string(reply.Tag), "\x00") {
+			// Keep reading until the last reply so the channel is left clean.
+			found = true
+			swIfIndex = reply.SwIfIndex
+		}
+	}
+
+	return
+}
+
+// Search for the interface with the given VPP interface name (for example
+// GigabitEthernet0/8/0) and return its Software Index.
+func FindInterfaceByName(ch *api.Channel, name string) (swIfIndex uint32, found bool) {
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error searching interface:", err)
+			}
+		} else if found == false && name == strings.TrimRight(string(reply.InterfaceName), "\x00") {
+			// Keep reading until the last reply so the channel is left clean.
+			found = true
+			swIfIndex = reply.SwIfIndex
+		}
+	}
+
+	return
+}
+
+// Return the tag of the interface with the given VPP interface name. Only
+// the interfaces matching the name are dumped.
+// Returns:
+//   string - Tag of the interface, empty if it has none.
+//   bool - Found flag
+func GetInterfaceTag(ch *api.Channel, name string) (tag string, found bool) {
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{
+		NameFilterValid: 1,
+		NameFilter:      []byte(name),
+	}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error searching interface:", err)
+			}
+		} else if found == false && name == strings.TrimRight(string(reply.InterfaceName), "\x00") {
+			// The filter matches substrings, keep reading until the last reply.
+			found = true
+			tag = strings.TrimRight(string(reply.Tag), "\x00")
+		}
+	}
+
+	return
+}
+
+// Return the tag of the interface with the given Software Index.
+// Returns:
+//   string - Tag of the interface, empty if it has none.
+//   bool - Found flag
+func GetInterfaceTagByIndex(ch *api.Channel, swIfIndex uint32) (tag string, found bool) {
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error searching interface:", err)
+			}
+		} else if reply.SwIfIndex == swIfIndex {
+			// Keep reading until the last reply so the channel is left clean.
+			found = true
+			tag = strings.TrimRight(string(reply.Tag), "\x00")
+		}
+	}
+
+	return
+}
+
+// Return the configuration of the interface with the given Software Index.
+// Returns:
+//   InterfaceDetails - Admin and link state, MAC address and MTU
+//   bool - Found flag
+func GetInterfaceDetails(ch *api.Channel, swIfIndex uint32) (details InterfaceDetails, found bool) {
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error searching interface:", err)
+			}
+		} else if reply.SwIfIndex == swIfIndex {
+			// Keep reading until the last reply so the channel is left clean.
+			found = true
+			details.Name = strings.TrimRight(string(reply.InterfaceName), "\x00")
+			details.AdminUp = reply.AdminUpDown == 1
+			details.LinkUp = reply.LinkUpDown == 1
+			details.Mtu = reply.LinkMtu
+			if reply.L2AddressLength != 0 && int(reply.L2AddressLength) <= len(reply.L2Address) {
+				details.Mac = net.HardwareAddr(reply.L2Address[:reply.L2AddressLength]).String()
+			}
+		}
+	}
+
+	return
+}
+
+// Attempt to read the link state of an interface. The channel registers for
+// the interface events of VPP before reading the state, so a transition
+// notified within wait overrides the state read instead of being missed.
+// Input:
+//   ch *api.Channel
+//   swIfIndex uint32 - Interface whose link state is read
+//   wait time.Duration - Time the events of the interface are waited for
+func GetLinkState(ch *api.Channel, swIfIndex uint32, wait time.Duration) (linkUp bool, err error) {
+
+	notifChan := make(chan api.Message, 16)
+	subscription, err := ch.SubscribeNotification(notifChan, interfaces.NewSwInterfaceEvent)
+	if err != nil {
+		return
+	}
+	defer ch.UnsubscribeNotification(subscription)
+
+	err = wantInterfaceEvents(ch, 1)
+	if err != nil {
+		return
+	}
+	defer wantInterfaceEvents(ch, 0)
+
+	details, found := GetInterfaceDetails(ch, swIfIndex)
+	if found == false {
+		err = fmt.Errorf("ERROR: Reading link state failed: interface %d not found", swIfIndex)
+		return
+	}
+	linkUp = details.LinkUp
+
+	timeout := time.After(wait)
+	for {
+		select {
+		case msg := <-notifChan:
+			event, ok := msg.(*interfaces.SwInterfaceEvent)
+			if ok == false || event.SwIfIndex != swIfIndex {
+				continue
+			}
+			if event.Deleted != 0 {
+				err = fmt.Errorf("ERROR: Reading link state failed: interface %d deleted", swIfIndex)
+				return
+			}
+			linkUp = event.LinkUpDown == 1
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// Return the addresses (CIDR) of the interface with the given Software
+// Index, IPv4 then IPv6.
+func GetIpAddresses(ch *api.Channel, swIfIndex uint32) (addresses []string, err error) {
+
+	for _, isIpv6 := range []uint8{0, 1} {
+		// Populate the Message Structure
+		req := &ip.IPAddressDump{
+			SwIfIndex: swIfIndex,
+			IsIpv6:    isIpv6,
+		}
+		reqCtx := ch.SendMultiRequest(req)
+
+		for {
+			reply := &ip.IPAddressDetails{}
+			stop, replyErr := reqCtx.ReceiveReply(reply)
+			if stop {
+				break // break out of the loop
+			}
+			if replyErr != nil {
+				if debugInterface {
+					fmt.Println("Error listing addresses:", replyErr)
+				}
+				err = replyErr
+				continue
+			}
+
+			// The address is in a 16 byte array, IPv4 in the first 4 bytes.
+			length := net.IPv6len
+			if isIpv6 == 0 {
+				length = net.IPv4len
+			}
+			if len(reply.IP) < length {
+				continue
+			}
+			ipNet := net.IPNet{
+				IP:   net.IP(reply.IP[:length]),
+				Mask: net.CIDRMask(int(reply.PrefixLength), length*8),
+			}
+			addresses = append(addresses, ipNet.String())
+		}
+	}
+
+	return
+}
+
+// Return the counters of the interface with the given Software Index, as
+// shown by "vppctl show interface". VPP 18.04 only has the counters in the
+// stats streamed to registered clients, so the CLI is used.
+func GetCounters(ch *api.Channel, swIfIndex uint32) (counters string, err error) {
+
+	details, found := GetInterfaceDetails(ch, swIfIndex)
+	if found == false {
+		err = fmt.Errorf("ERROR: Interface %d not found", swIfIndex)
+		return
+	}
+
+	cmd := "show interface " + details.Name
+
+	// Populate the Request Structure
+	req := &vpe.CliInband{
+		Length: uint32(len(cmd)),
+		Cmd:    []byte(cmd),
+	}
+
+	reply := &vpe.CliInbandReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: CLI \"%s\" failed: %s", cmd, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugInterface {
+			fmt.Println("Error reading interface counters:", err)
+		}
+		return
+	}
+
+	counters = string(reply.Reply)
+
+	return
+}
+
+// Return the names of all the interfaces in VPP.
+func GetInterfaceNames(ch *api.Channel) (names []string) {
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error listing interface:", err)
+			}
+		} else {
+			names = append(names, strings.TrimRight(string(reply.InterfaceName), "\x00"))
+		}
+	}
+
+	return
+}
+
+// Determine if an interface with the given Software Index exists in VPP.
+func InterfaceExists(ch *api.Channel, swIfIndex uint32) (found bool) {
+
+	// Populate the Message Structure
+	req := &interfaces.SwInterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &interfaces.SwInterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugInterface {
+				fmt.Println("Error searching interface:", err)
+			}
+		} else if reply.SwIfIndex == swIfIndex {
+			// Keep reading until the last reply so the channel is left clean.
+			found = true
+		}
+	}
+
+	return
+}
+
+//
+// Local Functions
+//
+
+// wantInterfaceEvents() - Register (1) or unregister (0) the process for
+//  the interface events of VPP.
+func wantInterfaceEvents(ch *api.Channel, enable uint32) error {
+
+	// Populate the Request Structure
+	req := &interfaces.WantInterfaceEvents{
+		EnableDisable: enable,
+		Pid:           uint32(os.Getpid()),
+	}
+
+	reply := &interfaces.WantInterfaceEventsReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Interface events %d failed: %s", enable, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugInterface {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	return err
+}
+
+func truncateTag(tag string) string {
+	if len(tag) > MaxTagLength {
+		return tag[:MaxTagLength]
+	}
+	return tag
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vppinterface
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/sirupsen/logrus"
+
+	"git.fd.io/govpp.git/adapter/mock"
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core"
+	"git.fd.io/govpp.git/core/bin_api/interfaces"
+	"git.fd.io/govpp.git/core/bin_api/ip"
+	"git.fd.io/govpp.git/core/bin_api/vpe"
+)
+
+// openTestChannel() - Connect to the govpp mock adapter, which replies as
+//  set up on the returned adapter. The returned function disconnects.
+func openTestChannel(t *testing.T) (*mock.VppAdapter, *api.Channel, func()) {
+	// The mock adapter and govpp log every message.
+	log.SetOutput(ioutil.Discard)
+	quiet := logrus.New()
+	quiet.Out = ioutil.Discard
+	core.SetLogger(quiet)
+
+	vpp := &mock.VppAdapter{}
+	conn, err := core.Connect(vpp)
+	if err != nil {
+		t.Fatalf("core.Connect(): %v", err)
+	}
+
+	ch, err := conn.NewAPIChannel()
+	if err != nil {
+		conn.Disconnect()
+		t.Fatalf("NewAPIChannel(): %v", err)
+	}
+
+	return vpp, ch, func() {
+		ch.Close()
+		conn.Disconnect()
+	}
+}
+
+func TestAddDelIpAddress(t *testing.T) {
+	vpp, ch, disconnect := openTestChannel(t)
+	defer disconnect()
+
+	// Fake VPP counting the address requests.
+	var mu sync.Mutex
+	sent := 0
+	vpp.MockReplyHandler(func(request mock.MessageDTO) ([]byte, uint16, bool) {
+		if request.MsgName != "sw_interface_add_del_address" {
+			return nil, 0, false
+		}
+		mu.Lock()
+		sent++
+		mu.Unlock()
+
+		reply := &interfaces.SwInterfaceAddDelAddressReply{}
+		msgID, err := vpp.GetMsgID(reply.GetMessageName(), reply.GetCrcString())
+		if err != nil {
+			return nil, 0, false
+		}
+		data, err := vpp.ReplyBytes(request, reply)
+		return data, msgID, err == nil
+	})
+
+	newIPConfig := func(version string, cidr string) *current.IPConfig {
+		ipAddr, ipNet, _ := net.ParseCIDR(cidr)
+		ipNet.IP = ipAddr
+		return &current.IPConfig{Version: version, Address: *ipNet}
+	}
+
+	tests := []struct {
+		name     string
+		ips      []*current.IPConfig
+		wantSent int
+	}{
+		{"none", nil, 0},
+		{"ipv4", []*current.IPConfig{newIPConfig("4", "10.1.1.5/24")}, 1},
+		// Every address is programmed, not only the first one.
+		{"dual stack", []*current.IPConfig{newIPConfig("4", "10.1.1.5/24"), newIPConfig("6", "2001:db8::5/64")}, 2},
+		{"dhcp addresses", []*current.IPConfig{newIPConfig("4", "10.1.1.5/24"), newIPConfig("4", "10.2.1.5/16")}, 2},
+		{"unknown version", []*current.IPConfig{newIPConfig("5", "10.1.1.5/24"), newIPConfig("4", "10.1.1.6/24")}, 1},
+	}
+
+	for _, test := range tests {
+		mu.Lock()
+		sent = 0
+		mu.Unlock()
+
+		err := AddDelIpAddress(ch, 1, 1, &current.Result{IPs: test.ips})
+		if err != nil {
+			t.Errorf("%s: AddDelIpAddress() error = %v", test.name, err)
+			continue
+		}
+
+		mu.Lock()
+		if sent != test.wantSent {
+			t.Errorf("%s: AddDelIpAddress() sent %d requests, want %d", test.name, sent, test.wantSent)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestInterfaceExists(t *testing.T) {
+	vpp, ch, disconnect := openTestChannel(t)
+	defer disconnect()
+
+	tests := []struct {
+		name      string
+		dumped    []uint32
+		swIfIndex uint32
+		want      bool
+	}{
+		{"present", []uint32{0, 1, 2}, 1, true},
+		{"last", []uint32{0, 1, 2}, 2, true},
+		{"deleted", []uint32{0, 2}, 1, false},
+		{"no interface", nil, 1, false},
+	}
+
+	for _, test := range tests {
+		// The dump replies, then the control ping reply ending them.
+		for _, swIfIndex := range test.dumped {
+			vpp.MockReply(&interfaces.SwInterfaceDetails{SwIfIndex: swIfIndex})
+		}
+		vpp.MockReply(&vpe.ControlPingReply{})
+
+		if got := InterfaceExists(ch, test.swIfIndex); got != test.want {
+			t.Errorf("%s: InterfaceExists() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetInterfaceDetails(t *testing.T) {
+	vpp, ch, disconnect := openTestChannel(t)
+	defer disconnect()
+
+	mac := []byte{0x02, 0xfe, 0x01, 0x02, 0x03, 0x04}
+
+	tests := []struct {
+		name      string
+		dumped    []interfaces.SwInterfaceDetails
+		swIfIndex uint32
+		want      InterfaceDetails
+		wantFound bool
+	}{
+		{"admin up", []interfaces.SwInterfaceDetails{
+			{SwIfIndex: 0},
+			{SwIfIndex: 3, AdminUpDown: 1, LinkUpDown: 1, LinkMtu: 9000, L2AddressLength: 6, L2Address: mac},
+		}, 3, InterfaceDetails{AdminUp: true, LinkUp: true, Mac: "02:fe:01:02:03:04", Mtu: 9000}, true},
+		{"admin down", []interfaces.SwInterfaceDetails{
+			{SwIfIndex: 3, LinkMtu: 1500},
+		}, 3, InterfaceDetails{Mtu: 1500}, true},
+		{"not found", []interfaces.SwInterfaceDetails{{SwIfIndex: 0}}, 3, InterfaceDetails{}, false},
+	}
+
+	for _, test := range tests {
+		for i := range test.dumped {
+			vpp.MockReply(&test.dumped[i])
+		}
+		vpp.MockReply(&vpe.ControlPingReply{})
+
+		got, found := GetInterfaceDetails(ch, test.swIfIndex)
+		if found != test.wantFound || got != test.want {
+			t.Errorf("%s: GetInterfaceDetails() = %+v, %v, want %+v, %v", test.name, got, found, test.want, test.wantFound)
+		}
+	}
+}
+
+func TestGetIpAddresses(t *testing.T) {
+	vpp, ch, disconnect := openTestChannel(t)
+	defer disconnect()
+
+	// The mock adapter knows the control ping by its ID only.
+	ping := &vpe.ControlPing{}
+	pingID, _ := vpp.GetMsgID(ping.GetMessageName(), ping.GetCrcString())
+
+	// Fake VPP with one address of each family, the IPv4 dump first.
+	dumps := 0
+	vpp.MockReplyHandler(func(request mock.MessageDTO) ([]byte, uint16, bool) {
+		var reply api.Message
+		switch {
+		case request.MsgName == (&ip.IPAddressDump{}).GetMessageName():
+			dumps++
+			if dumps%2 == 1 {
+				reply = &ip.IPAddressDetails{IP: net.ParseIP("10.1.1.1").To4(), PrefixLength: 24, SwIfIndex: 3}
+			} else {
+				reply = &ip.IPAddressDetails{IP: net.ParseIP("2001:db8::1"), PrefixLength: 64, SwIfIndex: 3, IsIpv6: 1}
+			}
+		case request.MsgID == pingID:
+			reply = &vpe.ControlPingReply{}
+		default:
+			return nil, 0, false
+		}
+
+		msgID, err := vpp.GetMsgID(reply.GetMessageName(), reply.GetCrcString())
+		if err != nil {
+			return nil, 0, false
+		}
+		data, err := vpp.ReplyBytes(request, reply)
+		return data, msgID, err == nil
+	})
+
+	addresses, err := GetIpAddresses(ch, 3)
+	if err != nil {
+		t.Fatalf("GetIpAddresses() error = %v", err)
+	}
+
+	want := []string{"10.1.1.1/24", "2001:db8::1/64"}
+	if len(addresses) != len(want) || addresses[0] != want[0] || addresses[1] != want[1] {
+		t.Errorf("GetIpAddresses() = %v, want %v", addresses, want)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vppip6nd
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+	"net"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/ip"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugIp6nd = false
+
+//
+// Types
+//
+
+// Parameters of the Router Advertisements sent on an interface.
+type RaConfig struct {
+	Managed     bool   // Managed address configuration flag
+	Other       bool   // Other configuration flag
+	MaxInterval uint32 // Maximum interval between RAs in seconds
+	MinInterval uint32 // Minimum interval between RAs in seconds
+	Lifetime    uint32 // Router lifetime in seconds
+}
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func Ip6ndCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&ip.SwInterfaceIP6ndRaConfig{},
+		&ip.SwInterfaceIP6ndRaConfigReply{},
+		&ip.SwInterfaceIP6EnableDisable{},
+		&ip.SwInterfaceIP6EnableDisableReply{},
+		&ip.SwInterfaceIP6SetLinkLocalAddress{},
+		&ip.SwInterfaceIP6SetLinkLocalAddressReply{},
+	)
+	if err != nil {
+		if debugIp6nd {
+			fmt.Println("VPP IPv6 ND failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to enable or disable IPv6 processing on an interface.
+// isEnable (1 = enable, 0 = disable)
+func EnableDisable(ch *api.Channel, swIfIndex uint32, isEnable uint8) error {
+
+	// Populate the Request Structure
+	req := &ip.SwInterfaceIP6EnableDisable{
+		SwIfIndex: swIfIndex,
+		Enable:    isEnable,
+	}
+
+	reply := &ip.SwInterfaceIP6EnableDisableReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugIp6nd {
+			fmt.Println("Error enabling IPv6 on interface:", err)
+		}
+		return err
+	}
+
+	return err
+}
+
+// Attempt to suppress (or restore) Router Advertisements sent on an
+// interface. isSuppress (1 = suppress, 0 = send)
+func SetRaSuppress(ch *api.Channel, swIfIndex uint32, isSuppress uint8) error {
+
+	// Populate the Request Structure
+	req := &ip.SwInterfaceIP6ndRaConfig{
+		SwIfIndex: swIfIndex,
+		Suppress:  isSuppress,
+	}
+
+	reply := &ip.SwInterfaceIP6ndRaConfigReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugIp6nd {
+			fmt.Println("Error configuring IPv6 RA on interface:", err)
+		}
+		return err
+	}
+
+	return err
+}
+
+// Attempt to set the parameters of the Router Advertisements sent on an
+// interface. Zero intervals and lifetime keep the VPP defaults.
+func SetRaConfig(ch *api.Channel, swIfIndex uint32, cfg RaConfig) error {
+
+	// Populate the Request Structure
+	req := &ip.SwInterfaceIP6ndRaConfig{
+		SwIfIndex:   swIfIndex,
+		Managed:     boolToUint8(cfg.Managed),
+		Other:       boolToUint8(cfg.Other),
+		MaxInterval: cfg.MaxInterval,
+		MinInterval: cfg.MinInterval,
+		Lifetime:    cfg.Lifetime,
+	}
+
+	// VPP only applies the lifetime with DefaultRouter set.
+	if cfg.Lifetime != 0 {
+		req.DefaultRouter = 1
+	}
+
+	reply := &ip.SwInterfaceIP6ndRaConfigReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugIp6nd {
+			fmt.Println("Error configuring IPv6 RA parameters on interface:", err)
+		}
+		return err
+	}
+
+	return err
+}
+
+// Attempt to set the IPv6 link-local address of an interface, replacing
+// the one VPP derives from the MAC address.
+func SetLinkLocalAddress(ch *api.Channel, swIfIndex uint32, address net.IP) error {
+
+	if address.To4() != nil || address.To16() == nil || address.IsLinkLocalUnicast() == false {
+		return fmt.Errorf("ERROR: %s is not an IPv6 link-local address", address.String())
+	}
+
+	// Populate the Request Structure
+	req := &ip.SwInterfaceIP6SetLinkLocalAddress{
+		SwIfIndex: swIfIndex,
+		Address:   []byte(address.To16()),
+	}
+
+	reply := &ip.SwInterfaceIP6SetLinkLocalAddressReply{}
+
+	err := vppinfra.SendRequest(ch, req, reply)
+
+	if err != nil {
+		if debugIp6nd {
+			fmt.Println("Error setting IPv6 link-local address on interface:", err)
+		}
+		return err
+	}
+
+	return err
+}
+
+//
+// Local Functions
+//
+
+func boolToUint8(value bool) uint8 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -22,9 +22,12 @@ package vppmemif
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"git.fd.io/govpp.git/api"
 	"git.fd.io/govpp.git/core/bin_api/memif"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
 )
 
 //
@@ -33,6 +36,11 @@ import (
 
 const debugMemif = false
 
+// Buffer size used by VPP when a memif buffer size is not provided, and the
+// largest power of 2 buffer size that fits in the API (u16).
+const DefaultBufferSize = 2048
+const MaxBufferSize = 32768
+
 type MemifRole uint8
 
 const (
@@ -48,6 +56,14 @@ const (
 	ModePuntInject MemifMode = 2
 )
 
+// Memif interface found by FindMemifBySocket().
+type MemifInfo struct {
+	SwIfIndex uint32
+	IfName    string
+	AdminUp   bool
+	LinkUp    bool
+}
+
 // Dump Strings
 var modeStr = [...]string{"eth", "ip ", "pnt"}
 var roleStr = [...]string{"master", "slave "}
@@ -81,8 +97,11 @@ func MemifCompatibilityCheck(ch *api.Channel) (err error) {
 // Input:
 //   ch *api.Channel
 //   socketId uint32
+//   id uint32 - Id of the interface on the socket, the peer connects with the same id
 //   role MemifRole - RoleMaster or RoleSlave
-func CreateMemifInterface(ch *api.Channel, socketId uint32, role MemifRole, mode MemifMode) (swIfIndex uint32, err error) {
+//   bufferSize uint16 - Size of each buffer in the memif rings
+//   hwAddr net.HardwareAddr - MAC address of the interface, VPP generates one if nil
+func CreateMemifInterface(ch *api.Channel, socketId uint32, id uint32, role MemifRole, mode MemifMode, bufferSize uint16, hwAddr net.HardwareAddr) (swIfIndex uint32, err error) {
 
 	// Populate the Add Structure
 	req := &memif.MemifCreate{
@@ -90,17 +109,17 @@ func CreateMemifInterface(ch *api.Channel, socketId uint32, role MemifRole, mode
 		Mode:     uint8(mode),
 		RxQueues: 1,
 		TxQueues: 1,
-		ID:       0,
+		ID:       id,
 		SocketID: socketId,
 		//Secret: "",
 		RingSize:   1024,
-		BufferSize: 2048,
-		//HwAddr: "",
+		BufferSize: bufferSize,
+		HwAddr:     []byte(hwAddr),
 	}
 
 	reply := &memif.MemifCreateReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugMemif {
@@ -136,7 +155,11 @@ func DeleteMemifInterface(ch *api.Channel, swIfIndex uint32) (err error) {
 
 	reply := &memif.MemifDeleteReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Deleting memif interface %d failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
 
 	if err != nil {
 		if debugMemif {
@@ -206,6 +229,83 @@ func DumpMemif(ch *api.Channel) {
 	fmt.Printf("  Interface Count: %d\n", count)
 }
 
+// Determine if the given memif interface is connected to its peer (link up).
+// Returns an error if the interface does not exist.
+func IsMemifConnected(ch *api.Channel, swIfIndex uint32) (connected bool, err error) {
+	var found bool
+
+	// Populate the Message Structure
+	req := &memif.MemifDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &memif.MemifDetails{}
+		stop, replyErr := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if replyErr != nil {
+			if debugMemif {
+				fmt.Println("Error dumping memif interface:", replyErr)
+			}
+			err = replyErr
+		} else if swIfIndex == reply.SwIfIndex {
+			found = true
+			connected = reply.LinkUpDown == 1
+		}
+	}
+
+	if err == nil && found == false {
+		err = fmt.Errorf("memif interface %d not found", swIfIndex)
+	}
+
+	return
+}
+
+// Find the memif interface with the given id on the given socket file, the
+// interface CreateMemifInterface() would conflict with. Nothing is found if
+// the socket file is not known to VPP.
+// Input:
+//   ch *api.Channel
+//   socketFile string - Socket file the interface is created on
+//   id uint32 - Id of the interface on the socket
+// Returns:
+//   MemifInfo - The interface, if found.
+//   bool - Found flag
+func FindMemifBySocket(ch *api.Channel, socketFile string, id uint32) (info MemifInfo, found bool) {
+
+	socketFound, socketId := findMemifSocket(ch, socketFile)
+	if socketFound == false {
+		return
+	}
+
+	// Populate the Message Structure
+	req := &memif.MemifDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &memif.MemifDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugMemif {
+				fmt.Println("Error searching memif interface:", err)
+			}
+		} else if found == false && reply.SocketID == socketId && reply.ID == id {
+			// Keep reading until the last reply so the channel is left clean.
+			found = true
+			info.SwIfIndex = reply.SwIfIndex
+			info.IfName = strings.TrimRight(string(reply.IfName), "\x00")
+			info.AdminUp = reply.AdminUpDown == 1
+			info.LinkUp = reply.LinkUpDown == 1
+		}
+	}
+
+	return
+}
+
 // API to Create the MemIf Socketfile.
 func CreateMemifSocket(ch *api.Channel, socketFile string) (socketId uint32, err error) {
 
@@ -228,7 +328,7 @@ func CreateMemifSocket(ch *api.Channel, socketFile string) (socketId uint32, err
 
 	reply := &memif.MemifSocketFilenameAddDelReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
 
 	if debugMemif {
 		if err != nil {
@@ -251,7 +351,7 @@ func DeleteMemifSocket(ch *api.Channel, socketId uint32) (err error) {
 
 	reply := &memif.MemifSocketFilenameAddDelReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
 
 	if debugMemif {
 		if err != nil {
@@ -0,0 +1,334 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vppnat
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/nat"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugNat = false
+
+// Which side of NAT44 an interface is on.
+type NatSide uint8
+
+const (
+	SideOutside NatSide = 0
+	SideInside  NatSide = 1
+)
+
+// IP protocol numbers supported by NAT44 static mappings.
+const (
+	ProtocolTcp uint8 = 6
+	ProtocolUdp uint8 = 17
+)
+
+// Used as the external interface of a static mapping when an external
+// address is provided instead.
+const noSwIfIndex = ^uint32(0)
+
+// Maximum length of a static mapping tag. VPP stores the tag in a 64 byte
+// array, which must be NULL terminated.
+const maxTagLength = 63
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to. The NAT plugin is optional
+// in VPP, so this is only checked when NAT is requested.
+func NatCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&nat.Nat44InterfaceAddDelFeature{},
+		&nat.Nat44InterfaceAddDelFeatureReply{},
+		&nat.Nat44AddDelAddressRange{},
+		&nat.Nat44AddDelAddressRangeReply{},
+		&nat.Nat44AddDelInterfaceAddr{},
+		&nat.Nat44AddDelInterfaceAddrReply{},
+		&nat.Nat44InterfaceDump{},
+		&nat.Nat44InterfaceDetails{},
+		&nat.Nat44AddressDump{},
+		&nat.Nat44AddressDetails{},
+		&nat.Nat44InterfaceAddrDump{},
+		&nat.Nat44InterfaceAddrDetails{},
+		&nat.Nat44AddDelStaticMapping{},
+		&nat.Nat44AddDelStaticMappingReply{},
+	)
+	if err != nil {
+		if debugNat {
+			fmt.Println("VPP NAT failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or remove the NAT44 feature on an interface.
+// Input:
+//   ch *api.Channel
+//   swIfIndex uint32 - Interface to add or remove the feature on
+//   side NatSide - SideInside or SideOutside
+//   isAdd uint8 - 1 = add, 0 = delete
+func SetInterfaceFeature(ch *api.Channel, swIfIndex uint32, side NatSide, isAdd uint8) (err error) {
+
+	// Adding a feature that is already there is an error in VPP, and the
+	// outside interface is shared by all the interfaces using NAT.
+	if (isAdd == 1) == findInterfaceFeature(ch, swIfIndex, side) {
+		return nil
+	}
+
+	// Populate the Request Structure
+	req := &nat.Nat44InterfaceAddDelFeature{
+		IsAdd:     isAdd,
+		IsInside:  uint8(side),
+		SwIfIndex: swIfIndex,
+	}
+
+	reply := &nat.Nat44InterfaceAddDelFeatureReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: NAT44 feature on interface %d failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugNat {
+			fmt.Println("Error setting NAT44 interface feature:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to add a range of IPv4 addresses to the NAT44 address pool. The
+// range is skipped if its first address is already in the pool. Addresses
+// are shared by all the interfaces using NAT, so they are never removed.
+func AddAddressRange(ch *api.Channel, first net.IP, last net.IP) (err error) {
+
+	if first.To4() == nil || last.To4() == nil {
+		return fmt.Errorf("ERROR: NAT44 address range must be IPv4")
+	}
+
+	if findAddress(ch, first) {
+		return nil
+	}
+
+	// Populate the Request Structure
+	req := &nat.Nat44AddDelAddressRange{
+		FirstIPAddress: []byte(first.To4()),
+		LastIPAddress:  []byte(last.To4()),
+		IsAdd:          1,
+	}
+
+	reply := &nat.Nat44AddDelAddressRangeReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: NAT44 address range %s-%s failed: %s", first.String(), last.String(), vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugNat {
+			fmt.Println("Error adding NAT44 address range:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to use the address of an interface as the NAT44 address pool.
+// Skipped if the interface address is already used. Like the address
+// range, it is shared so it is never removed.
+func AddInterfaceAddress(ch *api.Channel, swIfIndex uint32) (err error) {
+
+	if findInterfaceAddress(ch, swIfIndex) {
+		return nil
+	}
+
+	// Populate the Request Structure
+	req := &nat.Nat44AddDelInterfaceAddr{
+		IsAdd:     1,
+		SwIfIndex: swIfIndex,
+	}
+
+	reply := &nat.Nat44AddDelInterfaceAddrReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: NAT44 address of interface %d failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugNat {
+			fmt.Println("Error adding NAT44 interface address:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or remove a NAT44 static mapping (port forward) from an
+// external address and port to a local address and port.
+// Input:
+//   ch *api.Channel
+//   isAdd uint8 - 1 = add, 0 = delete
+//   protocol uint8 - ProtocolTcp or ProtocolUdp
+//   localIP net.IP, localPort uint16 - Address and port traffic is forwarded to
+//   externalIP net.IP, externalPort uint16 - Address and port traffic is received
+//     on. If externalIP is nil, the address of externalSwIfIndex is used.
+//   tag string - Description of the owner of the mapping
+func AddDelStaticMapping(ch *api.Channel, isAdd uint8, protocol uint8,
+	localIP net.IP, localPort uint16,
+	externalIP net.IP, externalPort uint16, externalSwIfIndex uint32, tag string) (err error) {
+
+	if localIP.To4() == nil {
+		return fmt.Errorf("ERROR: NAT44 static mapping local address must be IPv4")
+	}
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+
+	// Populate the Request Structure
+	req := &nat.Nat44AddDelStaticMapping{
+		IsAdd:             isAdd,
+		LocalIPAddress:    []byte(localIP.To4()),
+		ExternalIPAddress: []byte(net.IPv4zero.To4()),
+		Protocol:          protocol,
+		LocalPort:         localPort,
+		ExternalPort:      externalPort,
+		ExternalSwIfIndex: externalSwIfIndex,
+		Tag:               []byte(tag),
+	}
+	if externalIP != nil {
+		if externalIP.To4() == nil {
+			return fmt.Errorf("ERROR: NAT44 static mapping external address must be IPv4")
+		}
+		req.ExternalIPAddress = []byte(externalIP.To4())
+		req.ExternalSwIfIndex = noSwIfIndex
+	}
+
+	reply := &nat.Nat44AddDelStaticMappingReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: NAT44 static mapping to %s:%d failed: %s", localIP.String(), localPort, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugNat {
+			fmt.Println("Error setting NAT44 static mapping:", err)
+		}
+	}
+
+	return err
+}
+
+//
+// Local Functions
+//
+
+// Loop through the NAT44 interfaces and determine if the feature is set on
+// the given side of the interface.
+func findInterfaceFeature(ch *api.Channel, swIfIndex uint32, side NatSide) (found bool) {
+
+	// Populate the Message Structure
+	req := &nat.Nat44InterfaceDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &nat.Nat44InterfaceDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugNat {
+				fmt.Println("Error searching NAT44 interface:", err)
+			}
+		} else if swIfIndex == reply.SwIfIndex && NatSide(reply.IsInside) == side {
+			found = true
+		}
+	}
+	return
+}
+
+// Loop through the NAT44 address pool and determine if the address is in it.
+func findAddress(ch *api.Channel, address net.IP) (found bool) {
+
+	// Populate the Message Structure
+	req := &nat.Nat44AddressDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &nat.Nat44AddressDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugNat {
+				fmt.Println("Error searching NAT44 address:", err)
+			}
+		} else if bytes.Equal(reply.IPAddress, address.To4()) {
+			found = true
+		}
+	}
+	return
+}
+
+// Loop through the NAT44 interface addresses and determine if the interface
+// address is in use.
+func findInterfaceAddress(ch *api.Channel, swIfIndex uint32) (found bool) {
+
+	// Populate the Message Structure
+	req := &nat.Nat44InterfaceAddrDump{}
+	reqCtx := ch.SendMultiRequest(req)
+
+	for {
+		reply := &nat.Nat44InterfaceAddrDetails{}
+		stop, err := reqCtx.ReceiveReply(reply)
+		if stop {
+			break // break out of the loop
+		}
+		if err != nil {
+			if debugNat {
+				fmt.Println("Error searching NAT44 interface address:", err)
+			}
+		} else if swIfIndex == reply.SwIfIndex {
+			found = true
+		}
+	}
+	return
+}
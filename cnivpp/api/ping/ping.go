@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vppping
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/vpe"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugPing = false
+
+// VPP has no binary API for ping, so the CLI is used and its summary line,
+// like "Statistics: 3 sent, 3 received, 0% packet loss", is parsed.
+var receivedRegexp = regexp.MustCompile(`(\d+) received`)
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func PingCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&vpe.CliInband{},
+		&vpe.CliInbandReply{},
+	)
+	if err != nil {
+		if debugPing {
+			fmt.Println("VPP ping failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to ping the given address from VPP. VPP picks the interface the
+// requests are sent on from the FIB.
+// Input:
+//   ch *api.Channel
+//   address net.IP - Address to ping
+//   count int - Number of echo requests sent
+// Returns:
+//   int - Number of echo replies received
+func Ping(ch *api.Channel, address net.IP, count int) (received int, err error) {
+
+	cmd := fmt.Sprintf("ping %s repeat %d", address.String(), count)
+
+	// Populate the Request Structure
+	req := &vpe.CliInband{
+		Length: uint32(len(cmd)),
+		Cmd:    []byte(cmd),
+	}
+
+	reply := &vpe.CliInbandReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Ping of %s failed: %s", address.String(), vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPing {
+			fmt.Println("Error sending ping:", err)
+		}
+		return
+	}
+
+	if debugPing {
+		fmt.Printf("PING %s:\n%s\n", address.String(), string(reply.Reply))
+	}
+
+	match := receivedRegexp.FindSubmatch(reply.Reply)
+	if match == nil {
+		err = fmt.Errorf("ERROR: Ping of %s failed: %s", address.String(), string(reply.Reply))
+		return
+	}
+
+	received, err = strconv.Atoi(string(match[1]))
+
+	return
+}
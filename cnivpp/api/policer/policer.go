@@ -0,0 +1,276 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vpppolicer
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/classify"
+	"git.fd.io/govpp.git/core/bin_api/policer"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugPolicer = false
+
+// Unused table index of the policer_classify_set_interface request.
+const NoTable = ^uint32(0)
+
+// Policer values of the VPP API (sse2_qos_*).
+const (
+	rateTypeKbps     = 0 // Rates in kbit/s, bursts in bytes
+	roundTypeClosest = 0
+	policerType1r2c  = 0 // Single rate, two colors: conform or exceed
+	actionDrop       = 0
+	actionTransmit   = 1
+)
+
+// A classify table matching every packet: one vector (16 bytes) of mask,
+// all zero, so every packet hashes to the single session.
+const matchAllLength = 16
+const matchAllBuckets = 2
+const matchAllMemorySize = 1 << 20
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func PolicerCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&policer.PolicerAddDel{},
+		&policer.PolicerAddDelReply{},
+		&classify.ClassifyAddDelTable{},
+		&classify.ClassifyAddDelTableReply{},
+		&classify.ClassifyAddDelSession{},
+		&classify.ClassifyAddDelSessionReply{},
+		&classify.PolicerClassifySetInterface{},
+		&classify.PolicerClassifySetInterfaceReply{},
+	)
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("VPP Policer failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to create a single rate policer, transmitting the traffic under
+// the rate and dropping the rest.
+// Input:
+//   ch *api.Channel
+//   name string - Name of the policer, unique in VPP
+//   rateKbps uint32 - Committed rate in kbit/s
+//   burstBytes uint64 - Committed burst in bytes
+func AddPolicer(ch *api.Channel, name string, rateKbps uint32, burstBytes uint64) (policerIndex uint32, err error) {
+
+	// Populate the Request Structure
+	req := &policer.PolicerAddDel{
+		IsAdd:             1,
+		Name:              []byte(name),
+		Cir:               rateKbps,
+		Cb:                burstBytes,
+		RateType:          rateTypeKbps,
+		RoundType:         roundTypeClosest,
+		Type:              policerType1r2c,
+		ConformActionType: actionTransmit,
+		ExceedActionType:  actionDrop,
+		ViolateActionType: actionDrop,
+	}
+
+	reply := &policer.PolicerAddDelReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Creating policer %s failed: %s", name, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("Error creating policer:", err)
+		}
+		return
+	}
+
+	policerIndex = reply.PolicerIndex
+
+	return
+}
+
+// Attempt to delete a policer by name.
+func DelPolicer(ch *api.Channel, name string) (err error) {
+
+	// Populate the Request Structure
+	req := &policer.PolicerAddDel{
+		IsAdd: 0,
+		Name:  []byte(name),
+	}
+
+	reply := &policer.PolicerAddDelReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Deleting policer %s failed: %s", name, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("Error deleting policer:", err)
+		}
+	}
+
+	return
+}
+
+// Attempt to create a classify table with a single session, matching every
+// packet and sending it to the policer.
+// Returns:
+//   uint32 - Index of the classify table
+//   error - Error if the table or the session could not be created
+func AddMatchAllTable(ch *api.Channel, policerIndex uint32) (tableIndex uint32, err error) {
+
+	// Populate the Request Structure
+	req := &classify.ClassifyAddDelTable{
+		IsAdd:          1,
+		TableIndex:     NoTable,
+		Nbuckets:       matchAllBuckets,
+		MemorySize:     matchAllMemorySize,
+		MatchNVectors:  1,
+		NextTableIndex: NoTable,
+		MissNextIndex:  NoTable,
+		MaskLen:        matchAllLength,
+		Mask:           make([]byte, matchAllLength),
+	}
+
+	reply := &classify.ClassifyAddDelTableReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Creating classify table failed: %s", vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("Error creating classify table:", err)
+		}
+		return
+	}
+
+	tableIndex = reply.NewTableIndex
+
+	// The session hit of a policer classify table is the policer index.
+	sessionReq := &classify.ClassifyAddDelSession{
+		IsAdd:        1,
+		TableIndex:   tableIndex,
+		HitNextIndex: policerIndex,
+		OpaqueIndex:  NoTable,
+		MatchLen:     matchAllLength,
+		Match:        make([]byte, matchAllLength),
+	}
+
+	sessionReply := &classify.ClassifyAddDelSessionReply{}
+
+	err = vppinfra.SendRequest(ch, sessionReq, sessionReply)
+
+	if err == nil && sessionReply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Creating classify session in table %d failed: %s", tableIndex, vppinfra.RetvalString(sessionReply.Retval))
+	}
+
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("Error creating classify session:", err)
+		}
+		DelTable(ch, tableIndex)
+	}
+
+	return
+}
+
+// Attempt to delete a classify table, along with its sessions.
+func DelTable(ch *api.Channel, tableIndex uint32) (err error) {
+
+	// Populate the Request Structure
+	req := &classify.ClassifyAddDelTable{
+		IsAdd:      0,
+		DelChain:   1,
+		TableIndex: tableIndex,
+	}
+
+	reply := &classify.ClassifyAddDelTableReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Deleting classify table %d failed: %s", tableIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("Error deleting classify table:", err)
+		}
+	}
+
+	return
+}
+
+// Attempt to police (or stop policing) the traffic received on an
+// interface with the classify tables. Tables not used are NoTable.
+// Input:
+//   ch *api.Channel
+//   swIfIndex uint32 - Interface whose received traffic is policed
+//   ip4Table, ip6Table, l2Table uint32 - Classify tables, or NoTable
+//   isAdd uint8 - 1 to police, 0 to stop
+func SetInterface(ch *api.Channel, swIfIndex uint32, ip4Table uint32, ip6Table uint32, l2Table uint32, isAdd uint8) (err error) {
+
+	// Populate the Request Structure
+	req := &classify.PolicerClassifySetInterface{
+		SwIfIndex:     swIfIndex,
+		IP4TableIndex: ip4Table,
+		IP6TableIndex: ip6Table,
+		L2TableIndex:  l2Table,
+		IsAdd:         isAdd,
+	}
+
+	reply := &classify.PolicerClassifySetInterfaceReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Setting policer on interface %d failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPolicer {
+			fmt.Println("Error setting policer on interface:", err)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vpppunt
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/ip"
+	"git.fd.io/govpp.git/core/bin_api/punt"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugPunt = false
+
+// IP version of the punted traffic.
+type PuntIpVersion uint8
+
+const (
+	Ipv4    PuntIpVersion = 4
+	Ipv6    PuntIpVersion = 6
+	IpvBoth PuntIpVersion = 255
+)
+
+// L4 Protocols
+const (
+	ProtocolTcp uint8 = 6
+	ProtocolUdp uint8 = 17
+)
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func PuntCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&punt.Punt{},
+		&punt.PuntReply{},
+		&ip.IPPuntRedirect{},
+		&ip.IPPuntRedirectReply{},
+	)
+	if err != nil {
+		if debugPunt {
+			fmt.Println("VPP punt failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or delete the punt of the traffic to VPP for the given
+// L4 protocol and port, instead of dropping it. Punt registrations apply
+// to all interfaces.
+// Input:
+//   ch *api.Channel
+//   isAdd uint8 - 1 = add, 0 = delete
+//   ipv PuntIpVersion - Ipv4, Ipv6 or IpvBoth
+//   protocol uint8 - ProtocolTcp or ProtocolUdp
+//   port uint16 - L4 destination port
+func AddDelPunt(ch *api.Channel, isAdd uint8, ipv PuntIpVersion, protocol uint8, port uint16) (err error) {
+
+	// Populate the Request Structure
+	req := &punt.Punt{
+		IsAdd:      isAdd,
+		Ipv:        uint8(ipv),
+		L4Protocol: protocol,
+		L4Port:     port,
+	}
+
+	reply := &punt.PuntReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Punt of protocol %d port %d failed: %s", protocol, port, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPunt {
+			fmt.Println("Error setting punt:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or delete the redirect of the traffic punted on an
+// interface to another interface.
+// Input:
+//   ch *api.Channel
+//   rxSwIfIndex uint32 - Interface the punted traffic is received on
+//   txSwIfIndex uint32 - Interface the punted traffic is sent to
+//   isAdd uint8 - 1 = add, 0 = delete
+//   isIpv6 uint8 - 1 = IPv6 traffic, 0 = IPv4 traffic
+func AddDelPuntRedirect(ch *api.Channel, rxSwIfIndex uint32, txSwIfIndex uint32, isAdd uint8, isIpv6 uint8) (err error) {
+
+	// Populate the Request Structure. No next hop, the traffic is sent out
+	// of the interface as is.
+	req := &ip.IPPuntRedirect{
+		RxSwIfIndex: rxSwIfIndex,
+		TxSwIfIndex: txSwIfIndex,
+		IsAdd:       isAdd,
+		IsIP6:       isIpv6,
+		Nh:          make([]byte, 16),
+	}
+
+	reply := &ip.IPPuntRedirectReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Punt redirect from interface %d to %d failed: %s", rxSwIfIndex, txSwIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugPunt {
+			fmt.Println("Error setting punt redirect:", err)
+		}
+	}
+
+	return err
+}
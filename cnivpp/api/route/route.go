@@ -0,0 +1,204 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vpproute
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+	"net"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/ip"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugRoute = false
+
+// No classify table, as used by VPP.
+const noClassifyTable = ^uint32(0)
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func RouteCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&ip.IPAddDelRoute{},
+		&ip.IPAddDelRouteReply{},
+		&ip.IPTableAddDel{},
+		&ip.IPTableAddDelReply{},
+	)
+	if err != nil {
+		if debugRoute {
+			fmt.Println("VPP route failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or delete a host route (/32 or /128) to the given address,
+// attached to the given interface, in the given table.
+// Input:
+//   ch *api.Channel
+//   isAdd uint8 - 1 = add, 0 = delete
+//   address net.IP - Destination of the route
+//   swIfIndex uint32 - Interface the destination is reached on
+//   tableId uint32 - FIB table of the route, 0 for the default table
+func AddDelHostRoute(ch *api.Channel, isAdd uint8, address net.IP, swIfIndex uint32, tableId uint32) (err error) {
+
+	// Populate the Request Structure
+	req := &ip.IPAddDelRoute{
+		NextHopSwIfIndex:   swIfIndex,
+		TableID:            tableId,
+		ClassifyTableIndex: noClassifyTable,
+		IsAdd:              isAdd,
+		NextHopWeight:      1,
+		NextHopAddress:     make([]byte, 16),
+	}
+
+	if address.To4() != nil {
+		req.DstAddressLength = 32
+		req.DstAddress = []byte(address.To4())
+	} else {
+		req.IsIPv6 = 1
+		req.DstAddressLength = 128
+		req.DstAddress = []byte(address.To16())
+	}
+
+	reply := &ip.IPAddDelRouteReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Route to %s via interface %d in table %d failed: %s", address.String(), swIfIndex, tableId, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugRoute {
+			fmt.Println("Error setting route:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or delete a path of the route to the given prefix, via the
+// given next hop on the given interface. The paths of a prefix make one
+// multipath route: the paths with the lowest preference are used, and the
+// traffic is shared between them by weight.
+// Input:
+//   ch *api.Channel
+//   isAdd uint8 - 1 = add, 0 = delete
+//   dst *net.IPNet - Destination of the route
+//   gw net.IP - Next hop, nil for a destination attached to the interface
+//   swIfIndex uint32 - Interface the next hop is reached on
+//   tableId uint32 - FIB table of the route, 0 for the default table
+//   preference uint8 - Preference of the path, lower is preferred
+//   weight uint8 - Share of the traffic of the path, at least 1
+func AddDelRoute(ch *api.Channel, isAdd uint8, dst *net.IPNet, gw net.IP, swIfIndex uint32, tableId uint32, preference uint8, weight uint8) (err error) {
+
+	prefixLength, _ := dst.Mask.Size()
+
+	// Populate the Request Structure
+	req := &ip.IPAddDelRoute{
+		NextHopSwIfIndex:   swIfIndex,
+		TableID:            tableId,
+		ClassifyTableIndex: noClassifyTable,
+		IsAdd:              isAdd,
+		IsMultipath:        1,
+		NextHopWeight:      weight,
+		NextHopPreference:  preference,
+		DstAddressLength:   uint8(prefixLength),
+		NextHopAddress:     make([]byte, 16),
+	}
+
+	if dst.IP.To4() != nil {
+		req.DstAddress = []byte(dst.IP.To4())
+		if gw != nil {
+			copy(req.NextHopAddress, gw.To4())
+		}
+	} else {
+		req.IsIPv6 = 1
+		req.DstAddress = []byte(dst.IP.To16())
+		if gw != nil {
+			copy(req.NextHopAddress, gw.To16())
+		}
+	}
+
+	reply := &ip.IPAddDelRouteReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		nextHop := "attached"
+		if gw != nil {
+			nextHop = gw.String()
+		}
+		err = fmt.Errorf("ERROR: Route to %s via %s on interface %d in table %d failed: %s", dst.String(), nextHop, swIfIndex, tableId, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugRoute {
+			fmt.Println("Error setting route:", err)
+		}
+	}
+
+	return err
+}
+
+// Attempt to add or delete a FIB table. VPP creates the table on add only if
+// it doesn't exist yet, so adding an existing table is not an error.
+// Input:
+//   ch *api.Channel
+//   isAdd uint8 - 1 = add, 0 = delete
+//   isIPv6 uint8 - 1 = IPv6 table, 0 = IPv4 table
+//   tableId uint32 - FIB table, must not be 0 (the default table)
+func AddDelTable(ch *api.Channel, isAdd uint8, isIPv6 uint8, tableId uint32) (err error) {
+
+	// Populate the Request Structure
+	req := &ip.IPTableAddDel{
+		TableID: tableId,
+		IsIpv6:  isIPv6,
+		IsAdd:   isAdd,
+	}
+
+	reply := &ip.IPTableAddDelReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: FIB table %d (IPv6=%d) failed: %s", tableId, isIPv6, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugRoute {
+			fmt.Println("Error setting FIB table:", err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vppspan
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/span"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugSpan = false
+
+// Direction of the traffic mirrored by SPAN.
+type SpanState uint8
+
+const (
+	StateDisable SpanState = 0
+	StateRx      SpanState = 1
+	StateTx      SpanState = 2
+	StateBoth    SpanState = 3
+)
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func SpanCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&span.SwInterfaceSpanEnableDisable{},
+		&span.SwInterfaceSpanEnableDisableReply{},
+	)
+	if err != nil {
+		if debugSpan {
+			fmt.Println("VPP SPAN failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to mirror (SPAN) the traffic of an interface to another
+// interface, or to stop mirroring it.
+// Input:
+//   ch *api.Channel
+//   swIfIndexFrom uint32 - Interface whose traffic is mirrored
+//   swIfIndexTo uint32 - Interface the traffic is mirrored to
+//   state SpanState - StateRx, StateTx, StateBoth or StateDisable
+func SetSpan(ch *api.Channel, swIfIndexFrom uint32, swIfIndexTo uint32, state SpanState) (err error) {
+
+	// Populate the Request Structure
+	req := &span.SwInterfaceSpanEnableDisable{
+		SwIfIndexFrom: swIfIndexFrom,
+		SwIfIndexTo:   swIfIndexTo,
+		State:         uint8(state),
+	}
+
+	reply := &span.SwInterfaceSpanEnableDisableReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: SPAN from interface %d to %d failed: %s", swIfIndexFrom, swIfIndexTo, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugSpan {
+			fmt.Println("Error setting SPAN:", err)
+		}
+	}
+
+	return err
+}
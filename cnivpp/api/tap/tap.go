@@ -0,0 +1,124 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vpptap
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/tapv2"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugTap = false
+
+// Let VPP pick the tap instance number.
+const autoTapId = ^uint32(0)
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func TapCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&tapv2.TapCreateV2{},
+		&tapv2.TapCreateV2Reply{},
+		&tapv2.TapDeleteV2{},
+		&tapv2.TapDeleteV2Reply{},
+	)
+	if err != nil {
+		if debugTap {
+			fmt.Println("VPP tap failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to create a tap Interface, with the kernel end of the tap in
+// the given network namespace.
+// Input:
+//   ch *api.Channel
+//   netns string - Network namespace (path) of the kernel interface
+//   hostIfName string - Name of the kernel interface
+func CreateTapInterface(ch *api.Channel, netns string, hostIfName string) (swIfIndex uint32, err error) {
+
+	// Populate the Add Structure
+	req := &tapv2.TapCreateV2{
+		ID:               autoTapId,
+		UseRandomMac:     1,
+		HostNamespaceSet: 1,
+		HostNamespace:    []byte(netns),
+		HostIfNameSet:    1,
+		HostIfName:       []byte(hostIfName),
+	}
+
+	reply := &tapv2.TapCreateV2Reply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Creating tap interface %s failed: %s", hostIfName, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugTap {
+			fmt.Println("Error creating tap interface:", err)
+		}
+		return
+	} else {
+		swIfIndex = reply.SwIfIndex
+	}
+
+	return
+}
+
+// Attempt to delete a tap interface. The kernel end of the tap is deleted
+// with it.
+func DeleteTapInterface(ch *api.Channel, swIfIndex uint32) (err error) {
+
+	// Populate the Delete Structure
+	req := &tapv2.TapDeleteV2{
+		SwIfIndex: swIfIndex,
+	}
+
+	reply := &tapv2.TapDeleteV2Reply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: Deleting tap interface %d failed: %s", swIfIndex, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugTap {
+			fmt.Println("Error deleting tap interface:", err)
+		}
+	}
+
+	return err
+}
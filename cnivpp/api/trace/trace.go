@@ -0,0 +1,113 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary simple-client is an example VPP management application that exercises the
+// govpp API on real-world use-cases.
+package vpptrace
+
+// Generates Go bindings for all VPP APIs located in the json directory.
+//go:generate binapi-generator --input-dir=../../bin_api --output-dir=../../bin_api
+
+import (
+	"fmt"
+
+	"git.fd.io/govpp.git/api"
+	"git.fd.io/govpp.git/core/bin_api/vpe"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+const debugTrace = false
+
+// VPP has no binary API for the packet trace, so the CLI is used, as
+// with "vppctl trace add", "show trace" and "clear trace".
+
+//
+// API Functions
+//
+
+// Check whether generated API messages are compatible with the version
+// of VPP which the library is connected to.
+func TraceCompatibilityCheck(ch *api.Channel) (err error) {
+	err = ch.CheckMessageCompatibility(
+		&vpe.CliInband{},
+		&vpe.CliInbandReply{},
+	)
+	if err != nil {
+		if debugTrace {
+			fmt.Println("VPP trace failed compatibility")
+		}
+	}
+
+	return err
+}
+
+// Attempt to trace the next packets received by a graph node, like
+// memif-input. The trace is global to VPP, not to an interface.
+// Input:
+//   ch *api.Channel
+//   node string - Input node of the graph
+//   count int - Number of packets traced
+func AddTrace(ch *api.Channel, node string, count int) (err error) {
+	_, err = runCli(ch, fmt.Sprintf("trace add %s %d", node, count))
+	return
+}
+
+// Attempt to retrieve the packets traced so far.
+func ShowTrace(ch *api.Channel) (trace string, err error) {
+	return runCli(ch, "show trace")
+}
+
+// Attempt to stop tracing and discard the packets traced.
+func ClearTrace(ch *api.Channel) (err error) {
+	_, err = runCli(ch, "clear trace")
+	return
+}
+
+//
+// Local Functions
+//
+
+// runCli() - Run a CLI command and return its output.
+func runCli(ch *api.Channel, cmd string) (output string, err error) {
+
+	// Populate the Request Structure
+	req := &vpe.CliInband{
+		Length: uint32(len(cmd)),
+		Cmd:    []byte(cmd),
+	}
+
+	reply := &vpe.CliInbandReply{}
+
+	err = vppinfra.SendRequest(ch, req, reply)
+
+	if err == nil && reply.Retval != 0 {
+		err = fmt.Errorf("ERROR: CLI \"%s\" failed: %s", cmd, vppinfra.RetvalString(reply.Retval))
+	}
+
+	if err != nil {
+		if debugTrace {
+			fmt.Println("Error running CLI:", err)
+		}
+		return
+	}
+
+	output = string(reply.Reply)
+
+	return
+}
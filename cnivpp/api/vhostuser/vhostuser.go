@@ -24,6 +24,8 @@ import (
 
 	"git.fd.io/govpp.git/api"
 	"git.fd.io/govpp.git/core/bin_api/vhost_user"
+
+	vppinfra "github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
 )
 
 //
@@ -42,6 +44,15 @@ const (
 // Dump Strings
 var modeStr = [...]string{"client", "server"}
 
+// Virtio features that can be set when creating a Vhost-User Interface,
+// and the first VPP release whose create_vhost_user_if can set them. The
+// API this library is generated from (VPP 18.04) has no feature fields.
+var featureMinVersion = map[string]string{
+	"gso":        "19.08",
+	"csum":       "19.08",
+	"packedRing": "20.05",
+}
+
 //
 // API Functions
 //
@@ -66,6 +77,21 @@ func VhostUserCompatibilityCheck(ch *api.Channel) (err error) {
 	return err
 }
 
+// Check whether the given virtio feature can be set when creating a
+// Vhost-User Interface with the generated API.
+// Returns:
+//   bool - Supported flag
+//   string - First VPP release that supports setting the feature
+func FeatureSupported(feature string) (supported bool, minVersion string) {
+	minVersion, known := featureMinVersion[feature]
+	if known == false {
+		return false, ""
+	}
+
+	// None of the known features are in the VPP 18.04 create_vhost_user_if.
+	return false, minVersion
+}
+
 // Attempt to create a Vhost-User Interface.
 // Input:
 //   ch *api.Channel
@@ -86,7 +112,7 @@ func CreateVhostUserInterface(ch *api.Channel, mode VhostUserMode, socketFile st
 
 	reply := &vhost_user.CreateVhostUserIfReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugVhost {
@@ -110,7 +136,7 @@ func DeleteVhostUserInterface(ch *api.Channel, swIfIndex uint32) (err error) {
 
 	reply := &vhost_user.DeleteVhostUserIfReply{}
 
-	err = ch.SendRequest(req).ReceiveReply(reply)
+	err = vppinfra.SendRequest(ch, req, reply)
 
 	if err != nil {
 		if debugVhost {
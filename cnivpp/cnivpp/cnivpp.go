@@ -27,17 +27,35 @@ package cnivpp
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/sirupsen/logrus"
 
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/afpacket"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/bond"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/api/bridge"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/api/interface"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/ip6nd"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/api/memif"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/nat"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/ping"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/policer"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/punt"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/route"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/span"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/tap"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/trace"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/api/vhostuser"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/vppdb"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
 	"github.com/Billy99/user-space-net-plugin/usrsptypes"
 )
 
@@ -51,16 +69,46 @@ const (
 
 const defaultVPPSocketDir = "/var/run/vpp/cni/shared/"
 
+// Room needed in a memif buffer on top of the MTU for the L2 header
+// (Ethernet + VLAN tag).
+const memifL2Overhead = 18
+
+// Name of the kernel tap traffic is punted to, if not provided.
+const defaultPuntIfName = "punt0"
+
+// Interface the address of an unnumbered interface is borrowed from, if not
+// provided.
+const defaultUnnumberedParent = "loop0"
+
+// Range of the Bridge Domain Ids allocated for networks without a bridgeId,
+// above the Ids usually configured by hand. VPP Ids are 24 bits.
+const minAutoBridgeId = 1 << 16
+const maxAutoBridgeId = 1<<24 - 1
+
+// Time the link events of the host interface are waited for, with
+// reportLinkState. A memif is usually still down during the ADD, its peer
+// connects once the app of the container runs.
+const linkStateWait = 100 * time.Millisecond
+
 //
 // Types
 //
 type CniVpp struct {
 }
 
+// Configuration of the host interface of an attachment, as read back from
+// VPP, compared with the expected one by CHECK.
+type CniVppInterfaceConfig struct {
+	Mtu       int
+	Mac       string
+	Addresses []string
+	AdminUp   bool
+}
+
 //
 // API Functions
 //
-func (cniVpp CniVpp) AddOnHost(conf *usrsptypes.NetConf, containerID string, ipResult *current.Result) error {
+func (cniVpp CniVpp) AddOnHost(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
 	var vppCh vppinfra.ConnectionData
 	var err error
 	var data vppdb.VppSavedData
@@ -70,93 +118,87 @@ func (cniVpp CniVpp) AddOnHost(conf *usrsptypes.NetConf, containerID string, ipR
 	if err != nil {
 		return err
 	}
-	defer vppinfra.VppCloseCh(vppCh)
+	defer func() { vppinfra.VppCloseCh(vppCh) }()
 
-	// Make sure version of API structs used by CNI are same as used by local VPP Instance.
-	err = compatibilityChecks(vppCh)
+	// Configure VPP, replaying the configuration if VPP restarts (like
+	// during an upgrade) and the channel has to be reconnected.
+	err = vppinfra.VppRetry(&vppCh, func() error {
+		data = vppdb.VppSavedData{}
+		return addOnHostVpp(vppCh, conf, args, ipResult, &data)
+	})
 	if err != nil {
 		return err
 	}
 
 	//
-	// Create Local Interface
+	// Save Create Data for Delete
 	//
-	if conf.HostConf.IfType == "memif" {
-		err = addLocalDeviceMemif(vppCh, conf, containerID, &data)
-	} else if conf.HostConf.IfType == "vhostuser" {
-		err = fmt.Errorf("GOOD: Found HostConf.IfType:" + conf.HostConf.IfType)
-	} else {
-		err = fmt.Errorf("ERROR: Unknown HostConf.IfType:" + conf.HostConf.IfType)
-	}
+	err = vppdb.SaveVppConfig(conf, args.ContainerID, &data)
 
 	if err != nil {
 		return err
 	}
 
 	//
-	// Set interface to up (1)
+	// Save Attachment Data for other applications
 	//
-	err = vppinterface.SetState(vppCh.Ch, data.SwIfIndex, 1)
-	if err != nil {
-		if dbgInterface {
-			fmt.Println("Error bringing interface UP:", err)
-		}
-		return err
+	info := usrspdb.AttachmentInfo{
+		ContainerID:     args.ContainerID,
+		IfName:          args.IfName,
+		Network:         conf.Name,
+		Engine:          "vpp",
+		ContainerEngine: usrsptypes.GetContainerEngine(conf),
+		IfType:          conf.HostConf.IfType,
+		Tag:             usrsptypes.GetHostIfName(conf, args),
+		SwIfIndex:       data.SwIfIndex,
+		SocketPath:      data.SocketFile,
+		AdminState:      "up",
 	}
-
-	//
-	// Add Interface to Local Network
-	//
-
-	// Add L2 Network if supplied
+	if conf.HostConf.IfType == "memif" {
+		info.MemifId = getMemifId(conf)
+	}
+	if usrsptypes.IsAdminUp(&conf.HostConf) == false {
+		info.AdminState = "down"
+	}
+	setLinkState(vppCh, conf, args, &info)
 	if conf.HostConf.NetType == "bridge" {
-
-		var bridgeDomain uint32 = uint32(conf.HostConf.BridgeConf.BridgeId)
-
-		// Add Interface to Bridge. If Bridge does not exist, AddBridgeInterface()
-		// will create.
-		err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, data.SwIfIndex)
-		if err != nil {
-			if dbgBridge {
-				fmt.Println("Error:", err)
-			}
-			return err
-		} else {
-			if dbgBridge {
-				fmt.Printf("INTERFACE %d added to BRIDGE %d\n", data.SwIfIndex, bridgeDomain)
-				vppbridge.DumpBridge(vppCh.Ch, bridgeDomain)
-			}
-		}
-		// Add L3 Network if supplied
-	} else if conf.HostConf.NetType == "interface" {
-		if len(ipResult.IPs) != 0 {
-			err = vppinterface.AddDelIpAddress(vppCh.Ch, data.SwIfIndex, 1, ipResult)
-			if err != nil {
-				if dbgInterface {
-					fmt.Println("Error:", err)
-				}
-				return err
-			}
+		info.BridgeId = conf.HostConf.BridgeConf.BridgeId
+		if data.BridgeId != 0 {
+			info.BridgeId = int(data.BridgeId)
 		}
 	}
+	err = usrspdb.SaveAttachment(&info)
 
-	//
-	// Save Create Data for Delete
-	//
-	err = vppdb.SaveVppConfig(conf, containerID, &data)
+	return err
+}
 
-	if err != nil {
+func (cniVpp CniVpp) AddOnContainer(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
+	// The container NetType defaults to interface, see SaveRemoteConfig().
+	containerConf := conf.ContainerConf
+	if containerConf.NetType == "" {
+		containerConf.NetType = "interface"
+	}
+	if err := validateIpv6Conf(&containerConf, ipResult); err != nil {
 		return err
 	}
 
-	return err
-}
+	// The container names its interface after the requested name. The
+	// saved data of the host keeps the if0name provided.
+	remoteConf := *conf
+	remoteConf.If0name = usrsptypes.GetIfName(conf, args)
+
+	// The link state was read by the ADD on the host, which runs first.
+	var linkState *vppdb.LinkStateData
+	if conf.HostConf.ReportLinkState {
+		if info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName); err == nil && info.LinkState != "" {
+			linkState = &vppdb.LinkStateData{State: info.LinkState, Time: info.LinkStateTime}
+		}
+	}
 
-func (cniVpp CniVpp) AddOnContainer(conf *usrsptypes.NetConf, containerID string, ipResult *current.Result) error {
-	return vppdb.SaveRemoteConfig(conf, ipResult, containerID)
+	return vppdb.SaveRemoteConfig(&remoteConf, ipResult, args.ContainerID, linkState)
 }
 
-func (cniVpp CniVpp) DelFromHost(conf *usrsptypes.NetConf, containerID string) error {
+func (cniVpp CniVpp) DelFromHost(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
 	var vppCh vppinfra.ConnectionData
 	var data vppdb.VppSavedData
 	var err error
@@ -166,60 +208,90 @@ func (cniVpp CniVpp) DelFromHost(conf *usrsptypes.NetConf, containerID string) e
 	if err != nil {
 		return err
 	}
-	defer vppinfra.VppCloseCh(vppCh)
+	defer func() { vppinfra.VppCloseCh(vppCh) }()
 
 	// Retrieved squirreled away data needed for processing delete
-	err = vppdb.LoadVppConfig(conf, containerID, &data)
+	err = vppdb.LoadVppConfig(conf, args.ContainerID, &data)
 
 	if err != nil {
 		return err
 	}
 
-	//
-	// Remove L2 Network if supplied
-	//
-	if conf.HostConf.NetType == "bridge" {
-
-		// Validate and convert input data
-		var bridgeDomain uint32 = uint32(conf.HostConf.BridgeConf.BridgeId)
-
-		if dbgBridge {
-			fmt.Printf("INTERFACE %d retrieved from CONF - attempt to DELETE Bridge %d\n", data.SwIfIndex, bridgeDomain)
+	// Without saved data (a DEL repeated, or an ADD which failed before
+	// creating anything), the interface is looked up by its tag, in case
+	// the saved data was lost. If there is no interface, only the shared
+	// state is released.
+	if data.SwIfIndex == 0 {
+		if swIfIndex, found := vppinterface.FindInterfaceByTag(vppCh.Ch, usrsptypes.GetHostIfName(conf, args)); found {
+			data.SwIfIndex = swIfIndex
 		}
+	}
 
-		// Remove MemIf from Bridge. RemoveBridgeInterface() will delete Bridge if
-		// no more interfaces are associated with the Bridge.
-		err = vppbridge.RemoveBridgeInterface(vppCh.Ch, bridgeDomain, data.SwIfIndex)
-
-		if err != nil {
-			if dbgBridge {
-				fmt.Println("Error:", err)
-			}
+	// Only an interface of the attachment is deleted, whatever the saved
+	// data or the configuration point at.
+	if data.SwIfIndex != 0 {
+		tags := []string{usrsptypes.GetHostIfName(conf, args)}
+		if info, infoErr := usrspdb.GetAttachment(args.ContainerID, args.IfName); infoErr == nil {
+			tags = append(tags, info.Tag)
+		}
+		if err = checkManagedInterface(vppCh, data.SwIfIndex, tags); err != nil {
 			return err
-		} else {
-			if dbgBridge {
-				fmt.Printf("INTERFACE %d removed from BRIDGE %d\n", data.SwIfIndex, bridgeDomain)
-				vppbridge.DumpBridge(vppCh.Ch, bridgeDomain)
-			}
 		}
 	}
 
-	//
-	// Delete Local Interface
-	//
-	if conf.HostConf.IfType == "memif" {
-		return delLocalDeviceMemif(vppCh, conf, containerID, &data)
-	} else if conf.HostConf.IfType == "vhostuser" {
-		return fmt.Errorf("GOOD: Found HostConf.Type:" + conf.HostConf.IfType)
-	} else {
-		return fmt.Errorf("ERROR: Unknown HostConf.Type:" + conf.HostConf.IfType)
+	// Remove the interface, replaying the removal if VPP restarts and the
+	// channel has to be reconnected.
+	err = vppinfra.VppRetry(&vppCh, func() error {
+		return delFromHostVpp(vppCh, conf, &data, args.ContainerID)
+	})
+	err = journal(args, "delete", fmt.Sprintf("interface %d", data.SwIfIndex), err)
+	if err != nil {
+		return err
 	}
 
-	return err
+	return usrspdb.DeleteAttachment(args.ContainerID, args.IfName)
+}
+
+func (cniVpp CniVpp) DelFromContainer(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	vppdb.CleanupRemoteConfig(conf, args.ContainerID)
+	return nil
+}
+
+func (cniVpp CniVpp) Capabilities() []string {
+	return []string{
+		usrsptypes.CapabilityMemif,
+		usrsptypes.CapabilityBridge,
+		usrsptypes.CapabilityShg,
+		usrsptypes.CapabilityBvi,
+		usrsptypes.CapabilityAddress,
+		usrsptypes.CapabilityUnnumbered,
+		usrsptypes.CapabilityAdminDown,
+		usrsptypes.CapabilityRxMode,
+		usrsptypes.CapabilityIpv6,
+		usrsptypes.CapabilityVhostFeatures,
+		usrsptypes.CapabilityNat,
+		usrsptypes.CapabilityMirror,
+		usrsptypes.CapabilityPunt,
+		usrsptypes.CapabilityMtu,
+		usrsptypes.CapabilityBandwidth,
+		usrsptypes.CapabilityRoutes,
+		usrsptypes.CapabilityLinkState,
+	}
 }
 
-func (cniVpp CniVpp) DelFromContainer(conf *usrsptypes.NetConf, containerID string) error {
-	vppdb.CleanupRemoteConfig(conf, containerID)
+// Probe() - VPP is reachable when its API shared memory file exists and a
+//  channel can be opened.
+func (cniVpp CniVpp) Probe() error {
+	if err := vppinfra.VppApiExists(); err != nil {
+		return err
+	}
+
+	vppCh, err := vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	vppinfra.VppCloseCh(vppCh)
+
 	return nil
 }
 
@@ -236,7 +308,14 @@ func CniContainerConfig() (bool, error) {
 				fmt.Println(ipResult)
 			}
 
-			err = vpp.AddOnHost(&conf, containerId, &ipResult)
+			// Pod information is not passed into the container, so the
+			// interface description falls back to the ContainerId.
+			args := &skel.CmdArgs{
+				ContainerID: containerId,
+				IfName:      conf.If0name,
+			}
+
+			err = vpp.AddOnHost(&conf, args, &ipResult)
 
 			if err != nil {
 				if dbgInterface {
@@ -249,127 +328,2256 @@ func CniContainerConfig() (bool, error) {
 	return found, err
 }
 
-//
-// Local Functions
-//
-
-func compatibilityChecks(vppCh vppinfra.ConnectionData) (err error) {
+// CniVppAddAfPacket() - Attach the local VPP instance to a kernel interface
+//  (the host end of the kernel sidecar veth pair) with an af_packet interface.
+//  The af_packet interface is added to the same network as the host interface.
+func CniVppAddAfPacket(conf *usrsptypes.NetConf, hostIfName string) error {
+	var vppCh vppinfra.ConnectionData
+	var swIfIndex uint32
+	var err error
 
-	// Compatibility Checks
-	err = vppmemif.MemifCompatibilityCheck(vppCh.Ch)
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
 	if err != nil {
-		return
+		return err
 	}
+	defer vppinfra.VppCloseCh(vppCh)
 
-	err = vppbridge.BridgeCompatibilityCheck(vppCh.Ch)
+	err = vppafpacket.AfPacketCompatibilityCheck(vppCh.Ch)
 	if err != nil {
-		return
+		return err
 	}
 
-	err = vppvhostuser.VhostUserCompatibilityCheck(vppCh.Ch)
+	swIfIndex, err = vppafpacket.CreateAfPacketInterface(vppCh.Ch, hostIfName)
 	if err != nil {
-		return
+		return err
 	}
 
-	err = vppinterface.InterfaceCompatibilityCheck(vppCh.Ch)
+	err = vppinterface.SetState(vppCh.Ch, swIfIndex, 1)
 	if err != nil {
-		return
+		vppafpacket.DeleteAfPacketInterface(vppCh.Ch, hostIfName)
+		return err
 	}
 
-	return
-}
+	if conf.HostConf.NetType == "bridge" {
+		var bridgeDomain uint32
 
-func addLocalDeviceMemif(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, containerID string, data *vppdb.VppSavedData) (err error) {
-	var ok bool
+		bridgeDomain, err = getBridgeDomain(conf)
+		if err == nil {
+			err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, swIfIndex, 0, false)
+		}
+		if err != nil {
+			vppafpacket.DeleteAfPacketInterface(vppCh.Ch, hostIfName)
+			return err
+		}
+	}
 
-	// Validate and convert input data
-	var memifSocketFile string
-	var memifRole vppmemif.MemifRole
-	var memifMode vppmemif.MemifMode
+	return nil
+}
 
-	if memifSocketFile, ok = os.LookupEnv("USERSPACE_MEMIF_SOCKFILE"); ok == false {
-		fileName := fmt.Sprintf("memif-%s-%s.sock", containerID[:12], conf.If0name)
-		memifSocketFile = filepath.Join(defaultVPPSocketDir, fileName)
+// CniVppDelAfPacket() - Delete the af_packet interface attached to the given
+//  kernel interface. VPP removes the interface from any bridge on delete.
+func CniVppDelAfPacket(conf *usrsptypes.NetConf, hostIfName string) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
 	}
+	defer vppinfra.VppCloseCh(vppCh)
 
-	if conf.HostConf.MemifConf.Role == "master" {
-		memifRole = vppmemif.RoleMaster
-	} else if conf.HostConf.MemifConf.Role == "slave" {
-		memifRole = vppmemif.RoleSlave
-	} else {
-		return fmt.Errorf("ERROR: Invalid MEMIF Role:" + conf.HostConf.MemifConf.Role)
+	return vppafpacket.DeleteAfPacketInterface(vppCh.Ch, hostIfName)
+}
+
+// CniVppWaitForMemif() - Wait until the memif interface of the attachment is
+//  connected to its peer, or the timeout expires, polling VPP at the given
+//  interval.
+func CniVppWaitForMemif(swIfIndex uint32, timeout time.Duration, interval time.Duration) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
 	}
+	defer vppinfra.VppCloseCh(vppCh)
 
-	if conf.HostConf.MemifConf.Mode == "" {
-		conf.HostConf.MemifConf.Mode = "ethernet"
+	deadline := time.Now().Add(timeout)
+	for {
+		connected, err := vppmemif.IsMemifConnected(vppCh.Ch, swIfIndex)
+		if err != nil {
+			return err
+		}
+		if connected {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ERROR: memif INTERFACE %d not connected after %v", swIfIndex, timeout)
+		}
+		time.Sleep(interval)
 	}
-	if conf.HostConf.MemifConf.Mode == "ethernet" {
-		memifMode = vppmemif.ModeEthernet
-	} else if conf.HostConf.MemifConf.Mode == "ip" {
-		memifMode = vppmemif.ModeIP
-	} else if conf.HostConf.MemifConf.Mode == "inject-punt" {
-		memifMode = vppmemif.ModePuntInject
-	} else {
-		return fmt.Errorf("ERROR: Invalid MEMIF Mode:" + conf.HostConf.MemifConf.Mode)
+}
+
+// CniVppCaptureTrace() - Trace the next packets received by the input node
+//  of the host interface type, for the given time, and return the trace.
+//  Tracing is stopped before returning, even on error.
+func CniVppCaptureTrace(conf *usrsptypes.NetConf, count int, wait time.Duration) (string, error) {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	node := "memif-input"
+	if conf.HostConf.IfType == "vhostuser" {
+		node = "vhost-user-input"
 	}
 
-	// Create Memif Socket
-	data.MemifSocketId, err = vppmemif.CreateMemifSocket(vppCh.Ch, memifSocketFile)
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
 	if err != nil {
-		if dbgInterface {
-			fmt.Println("Error:", err)
-		}
-		return
-	} else {
-		if dbgInterface {
-			fmt.Println("MEMIF SOCKET", data.MemifSocketId, memifSocketFile, "created")
-			vppmemif.DumpMemifSocket(vppCh.Ch)
-		}
+		return "", err
 	}
+	defer vppinfra.VppCloseCh(vppCh)
 
-	// Create MemIf Interface
-	data.SwIfIndex, err = vppmemif.CreateMemifInterface(vppCh.Ch, data.MemifSocketId, memifRole, memifMode)
+	err = vpptrace.TraceCompatibilityCheck(vppCh.Ch)
 	if err != nil {
-		if dbgInterface {
-			fmt.Println("Error:", err)
-		}
-		return
-	} else {
-		if dbgInterface {
-			fmt.Println("MEMIF", data.SwIfIndex, "created", conf.If0name)
-			vppmemif.DumpMemif(vppCh.Ch)
-		}
+		return "", err
 	}
 
-	return
+	// Start from an empty trace, and stop tracing whatever happens.
+	if err = vpptrace.ClearTrace(vppCh.Ch); err != nil {
+		return "", err
+	}
+	defer vpptrace.ClearTrace(vppCh.Ch)
+
+	if err = vpptrace.AddTrace(vppCh.Ch, node, count); err != nil {
+		return "", err
+	}
+
+	time.Sleep(wait)
+
+	return vpptrace.ShowTrace(vppCh.Ch)
 }
 
-func delLocalDeviceMemif(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, containerID string, data *vppdb.VppSavedData) (err error) {
+// CniVppGetProbeTarget() - Address pinged by verifyConnectivity, the probe
+//  target or else the first IPAM gateway. nil if there is neither.
+func CniVppGetProbeTarget(conf *usrsptypes.NetConf, ipResult *current.Result) net.IP {
+	if conf.ProbeTarget != "" {
+		return net.ParseIP(conf.ProbeTarget)
+	}
+	if ipResult != nil {
+		for _, ipConfig := range ipResult.IPs {
+			if ipConfig.Gateway != nil {
+				return ipConfig.Gateway
+			}
+		}
+	}
+	return nil
+}
 
-	var ok bool
-	var memifSocketFile string
+// CniVppVerifyConnectivity() - Ping the probe target from the local VPP
+//  instance until it answers, or the timeout expires. The target defaults
+//  to the first IPAM gateway. On failure, the error includes the counters
+//  of the host interface.
+func CniVppVerifyConnectivity(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result, timeout time.Duration) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
 
-	if memifSocketFile, ok = os.LookupEnv("USERSPACE_MEMIF_SOCKFILE"); ok == false {
-		fileName := fmt.Sprintf("memif-%s-%s.sock", containerID[:12], conf.If0name)
-		memifSocketFile = filepath.Join(defaultVPPSocketDir, fileName)
+	target := CniVppGetProbeTarget(conf, ipResult)
+	if target == nil {
+		return fmt.Errorf("ERROR: verifyConnectivity requires a probeTarget or an IPAM gateway")
 	}
 
-	err = vppmemif.DeleteMemifInterface(vppCh.Ch, data.SwIfIndex)
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
 	if err != nil {
-		if dbgInterface {
-			fmt.Println("Error:", err)
-		}
-		return
-	} else {
-		if dbgInterface {
-			fmt.Printf("INTERFACE %d deleted\n", data.SwIfIndex)
-			vppmemif.DumpMemif(vppCh.Ch)
-			vppmemif.DumpMemifSocket(vppCh.Ch)
-		}
+		return err
 	}
+	defer vppinfra.VppCloseCh(vppCh)
 
-	// Remove file
-	err = vppdb.FileCleanup("", memifSocketFile)
+	err = vppping.PingCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
 
-	return
+	deadline := time.Now().Add(timeout)
+	for {
+		// Each ping waits for the reply, so no additional delay is needed.
+		received, err := vppping.Ping(vppCh.Ch, target, 1)
+		if err != nil {
+			return err
+		}
+		if received != 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ERROR: connectivity probe to %s not answered after %v%s",
+				target.String(), timeout, getHostCounters(vppCh, args))
+		}
+	}
+}
+
+// CniVppAddPortMappings() - Install a NAT44 static mapping on the NAT uplink
+//  for each port mapping passed by the runtime, forwarding to the IPv4
+//  address of the interface. The installed mappings are saved with the
+//  attachment data so CniVppDelPortMappings() removes exactly those.
+func CniVppAddPortMappings(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
+	var vppCh vppinfra.ConnectionData
+	var podIP net.IP
+	var err error
+
+	for _, ipConfig := range ipResult.IPs {
+		if ipConfig.Address.IP.To4() != nil {
+			podIP = ipConfig.Address.IP
+			break
+		}
+	}
+	if podIP == nil {
+		return fmt.Errorf("ERROR: portMappings require an IPv4 address on the interface")
+	}
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = vppnat.NatCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
+
+	uplinkSwIfIndex, found := vppinterface.FindInterfaceByName(vppCh.Ch, conf.HostConf.NatConf.Uplink)
+	if found == false {
+		return fmt.Errorf("ERROR: NAT uplink interface %s not found", conf.HostConf.NatConf.Uplink)
+	}
+
+	for _, portMap := range conf.RuntimeConfig.PortMaps {
+		mapping := usrspdb.PortMapping{
+			Protocol:      strings.ToLower(portMap.Protocol),
+			HostIP:        portMap.HostIP,
+			HostPort:      portMap.HostPort,
+			PodIP:         podIP.String(),
+			ContainerPort: portMap.ContainerPort,
+		}
+
+		err = addDelPortMapping(vppCh, 1, &mapping, uplinkSwIfIndex, info.Tag)
+		if err != nil {
+			return err
+		}
+
+		// Saved as soon as installed, so CniVppDelPortMappings() removes
+		// the mappings already installed if a later one fails.
+		info.PortMappings = append(info.PortMappings, mapping)
+		err = usrspdb.SaveAttachment(&info)
+		if err != nil {
+			addDelPortMapping(vppCh, 0, &mapping, uplinkSwIfIndex, info.Tag)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CniVppDelPortMappings() - Remove the NAT44 static mappings installed by
+//  CniVppAddPortMappings(), using the saved pod address. All the mappings
+//  are attempted, the first error is returned.
+func CniVppDelPortMappings(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	info, infoErr := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if infoErr != nil || len(info.PortMappings) == 0 {
+		return nil
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = vppnat.NatCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
+
+	uplinkSwIfIndex, found := vppinterface.FindInterfaceByName(vppCh.Ch, conf.HostConf.NatConf.Uplink)
+	if found == false {
+		return fmt.Errorf("ERROR: NAT uplink interface %s not found", conf.HostConf.NatConf.Uplink)
+	}
+
+	for i := range info.PortMappings {
+		if delErr := addDelPortMapping(vppCh, 0, &info.PortMappings[i], uplinkSwIfIndex, info.Tag); delErr != nil && err == nil {
+			err = delErr
+		}
+	}
+
+	if err == nil {
+		info.PortMappings = nil
+		err = usrspdb.SaveAttachment(&info)
+	}
+
+	return err
+}
+
+// CniVppAddHostAddress() - Program an address on the host interface, so it
+//  can be the gateway of the container for routed connectivity. The address
+//  is either configured, or the first address of each IPAM subnet ("auto").
+//  The addresses are saved with the attachment data for CniVppDelHostAddress().
+func CniVppAddHostAddress(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	hostResult, err := getHostAddressResult(conf.HostConf.Address, ipResult)
+	if err != nil {
+		return err
+	}
+	if len(hostResult.IPs) == 0 {
+		return nil
+	}
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = vppinterface.AddDelIpAddress(vppCh.Ch, info.SwIfIndex, 1, hostResult)
+	if err != nil {
+		return err
+	}
+
+	info.HostAddresses = nil
+	for _, ipConfig := range hostResult.IPs {
+		info.HostAddresses = append(info.HostAddresses, ipConfig.Address.String())
+	}
+	return usrspdb.SaveAttachment(&info)
+}
+
+// CniVppAddHostIpv6() - Apply the IPv6 options of the host section, once
+//  IPAM provided the IPv6 address they require. The host interface is
+//  removed with the attachment, so nothing is saved to undo them.
+func CniVppAddHostIpv6(conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	err = validateIpv6Conf(&conf.HostConf, ipResult)
+	if err != nil {
+		return err
+	}
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = configureIpv6(vppCh, &conf.HostConf, info.SwIfIndex, ipResult)
+	return journal(args, "ipv6", fmt.Sprintf("interface %d", info.SwIfIndex), err)
+}
+
+// CniVppDelHostAddress() - Remove the addresses programmed on the host
+//  interface by CniVppAddHostAddress().
+func CniVppDelHostAddress(args *skel.CmdArgs) error {
+	var vppCh vppinfra.ConnectionData
+	var hostResult current.Result
+	var err error
+
+	info, infoErr := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if infoErr != nil || len(info.HostAddresses) == 0 {
+		return nil
+	}
+
+	for _, address := range info.HostAddresses {
+		ipConfig, err := parseIpConfig(address)
+		if err != nil {
+			return err
+		}
+		hostResult.IPs = append(hostResult.IPs, ipConfig)
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = vppinterface.AddDelIpAddress(vppCh.Ch, info.SwIfIndex, 0, &hostResult)
+	if err != nil {
+		return err
+	}
+
+	info.HostAddresses = nil
+	return usrspdb.SaveAttachment(&info)
+}
+
+// CniVppGetPuntIfName() - Name of the punt tap in the container netns.
+func CniVppGetPuntIfName(puntConf *usrsptypes.PuntConf) string {
+	if puntConf.IfName != "" {
+		return puntConf.IfName
+	}
+	return defaultPuntIfName
+}
+
+// CniVppGetInterfaceConfig() - Read the MTU, MAC address, addresses and
+//  admin state of the host interface of the attachment from VPP.
+func CniVppGetInterfaceConfig(args *skel.CmdArgs) (*CniVppInterfaceConfig, error) {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return nil, err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = vppinterface.InterfaceCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return nil, err
+	}
+
+	details, found := vppinterface.GetInterfaceDetails(vppCh.Ch, info.SwIfIndex)
+	if found == false {
+		return nil, fmt.Errorf("ERROR: Host interface %d of the attachment not found in VPP", info.SwIfIndex)
+	}
+
+	addresses, err := vppinterface.GetIpAddresses(vppCh.Ch, info.SwIfIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CniVppInterfaceConfig{
+		Mtu:       int(details.Mtu),
+		Mac:       details.Mac,
+		Addresses: addresses,
+		AdminUp:   details.AdminUp,
+	}, nil
+}
+
+// CniVppCheckVhostFeatures() - Make sure the requested virtio features can
+//  be set on the vhost-user interface, before any interface is created.
+func CniVppCheckVhostFeatures(features *usrsptypes.VhostFeatures) error {
+	requested := []struct {
+		name  string
+		value string
+	}{
+		{"gso", features.Gso},
+		{"csum", features.Csum},
+		{"packedRing", features.PackedRing},
+	}
+
+	for _, feature := range requested {
+		if feature.value == "" {
+			continue
+		}
+		if feature.value != "on" && feature.value != "off" {
+			return fmt.Errorf("ERROR: Invalid vhost feature %s:%s", feature.name, feature.value)
+		}
+		if supported, minVersion := vppvhostuser.FeatureSupported(feature.name); supported == false {
+			return fmt.Errorf("ERROR: vhost feature %s requires VPP %s or newer", feature.name, minVersion)
+		}
+	}
+
+	return nil
+}
+
+// CniVppCheckBandwidth() - Make sure the bandwidth limit can be applied,
+//  before any interface is created. VPP only polices the traffic received
+//  on an interface, which is the traffic sent by the container (egress).
+func CniVppCheckBandwidth(bandwidth *usrsptypes.BandwidthConf) error {
+	if bandwidth.IngressRate != 0 || bandwidth.IngressBurst != 0 {
+		return usrsptypes.NewEngineNotSupportedError("vpp",
+			"bandwidth ingressRate, VPP only polices the traffic sent by the container (egressRate)")
+	}
+
+	if bandwidth.EgressRate == 0 || bandwidth.EgressBurst == 0 {
+		return fmt.Errorf("ERROR: bandwidth egressRate and egressBurst must both be set")
+	}
+	if bandwidth.EgressRate < 1000 || bandwidth.EgressRate/1000 > math.MaxUint32 {
+		return fmt.Errorf("ERROR: Invalid bandwidth egressRate %d, must be 1000 (1 kbit/s) or more", bandwidth.EgressRate)
+	}
+	if bandwidth.EgressBurst < 8 {
+		return fmt.Errorf("ERROR: Invalid bandwidth egressBurst %d, must be 8 (1 byte) or more", bandwidth.EgressBurst)
+	}
+
+	return nil
+}
+
+// CniVppCheckInterfaceConflict() - Make sure the interface of the
+//  attachment can be created, before any address is allocated. VPP names a
+//  memif interface after its socket, so an interface already on the socket
+//  file blocks the create. It is reported with its state, unless it carries
+//  the tag of the attachment, in which case it is reused.
+func CniVppCheckInterfaceConflict(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if conf.HostConf.IfType != "memif" {
+		return nil
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err := vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	tag := usrsptypes.GetHostIfName(conf, args)
+	if _, found := vppinterface.FindInterfaceByTag(vppCh.Ch, tag); found {
+		return nil
+	}
+
+	memifSocketFile := getMemifSocketFile(conf, args.ContainerID)
+	existing, found := vppmemif.FindMemifBySocket(vppCh.Ch, memifSocketFile, getMemifId(conf))
+	if found == false {
+		return nil
+	}
+
+	owner := "not owned by any attachment"
+	if existingTag, _ := vppinterface.GetInterfaceTag(vppCh.Ch, existing.IfName); existingTag != "" {
+		owner = "owned by " + existingTag
+	}
+
+	return fmt.Errorf("ERROR: Interface %s (swIfIndex %d, admin %s, link %s) already exists on memif socket %s, %s",
+		existing.IfName, existing.SwIfIndex, getStateStr(existing.AdminUp), getStateStr(existing.LinkUp),
+		memifSocketFile, owner)
+}
+
+// CniVppCheckMemifId() - Make sure no other attachment uses the memif id of
+//  the attachment on the same socket file. Ids only collide on a shared
+//  socket (socketFile, or USERSPACE_MEMIF_SOCKFILE), the generated socket
+//  files are never shared.
+func CniVppCheckMemifId(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if conf.HostConf.IfType != "memif" {
+		return nil
+	}
+
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+
+	memifSocketFile := getMemifSocketFile(conf, args.ContainerID)
+	memifId := getMemifId(conf)
+	for _, info := range attachments {
+		if info.ContainerID == args.ContainerID && info.IfName == args.IfName {
+			continue
+		}
+		if info.SocketPath == memifSocketFile && info.MemifId == memifId {
+			return fmt.Errorf("ERROR: memif id %d on socket %s already used by container %s interface %s",
+				memifId, memifSocketFile, info.ContainerID, info.IfName)
+		}
+	}
+
+	return nil
+}
+
+// CniVppAddUnmanaged() - Record the attachment of a host interface
+//  provisioned outside the plugin (managed false), found by hostIfName: the
+//  tag of the interface, or else its VPP name. The interface is not
+//  programmed, and is marked unmanaged so DEL never deletes it. The
+//  container connects to the socket the plugin would use, so a memif is
+//  recorded on that socket.
+func CniVppAddUnmanaged(conf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	var vppCh vppinfra.ConnectionData
+	var err error
+
+	// Create Channel to pass requests to VPP
+	vppCh, err = vppinfra.VppOpenCh()
+	if err != nil {
+		return err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	err = vppinterface.InterfaceCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
+
+	var tag string
+	swIfIndex, found := vppinterface.FindInterfaceByTag(vppCh.Ch, conf.HostIfName)
+	if found {
+		tag = conf.HostIfName
+	} else {
+		swIfIndex, found = vppinterface.FindInterfaceByName(vppCh.Ch, conf.HostIfName)
+	}
+	if found == false {
+		return fmt.Errorf("ERROR: Host interface %s not found in VPP (managed false), available interfaces: %s",
+			conf.HostIfName, strings.Join(vppinterface.GetInterfaceNames(vppCh.Ch), ", "))
+	}
+	logrus.Infof("Using unmanaged INTERFACE %d (%s)", swIfIndex, conf.HostIfName)
+
+	info := usrspdb.AttachmentInfo{
+		ContainerID:     args.ContainerID,
+		IfName:          args.IfName,
+		Network:         conf.Name,
+		Engine:          "vpp",
+		ContainerEngine: usrsptypes.GetContainerEngine(conf),
+		IfType:          conf.HostConf.IfType,
+		Tag:             tag,
+		SwIfIndex:       swIfIndex,
+		Unmanaged:       true,
+	}
+	if conf.HostConf.IfType == "memif" {
+		info.SocketPath = getMemifSocketFile(conf, args.ContainerID)
+		info.MemifId = getMemifId(conf)
+	}
+	setLinkState(vppCh, conf, args, &info)
+
+	return usrspdb.SaveAttachment(&info)
+}
+
+// ResolveAttachment() - Retrieve the attachment data for the given ContainerId
+//  and interface name. The swIfIndex is looked up in VPP by the interface tag,
+//  so the returned data is still valid if VPP was restarted and the interface
+//  was recreated. The stored attachment data is updated if it changed.
+func ResolveAttachment(containerID string, ifName string) (usrspdb.AttachmentInfo, error) {
+
+	info, err := usrspdb.GetAttachment(containerID, ifName)
+	if err != nil {
+		return info, err
+	}
+
+	if info.Engine != "vpp" || info.Tag == "" {
+		return info, nil
+	}
+
+	// Create Channel to pass requests to VPP
+	vppCh, err := vppinfra.VppOpenCh()
+	if err != nil {
+		return info, err
+	}
+	defer vppinfra.VppCloseCh(vppCh)
+
+	swIfIndex, found := vppinterface.FindInterfaceByTag(vppCh.Ch, info.Tag)
+	if found == false {
+		return info, fmt.Errorf("ERROR: Interface with tag %s not found in VPP", info.Tag)
+	}
+
+	if swIfIndex != info.SwIfIndex {
+		if dbgInterface {
+			fmt.Printf("INTERFACE %s moved from %d to %d\n", info.Tag, info.SwIfIndex, swIfIndex)
+		}
+		info.SwIfIndex = swIfIndex
+		err = usrspdb.SaveAttachment(&info)
+	}
+
+	return info, err
+}
+
+//
+// Local Functions
+//
+
+// addOnHostVpp() - Create and configure the interface in the local VPP
+//  instance. Any error, including a channel error, is returned as is.
+func addOnHostVpp(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, args *skel.CmdArgs, ipResult *current.Result, data *vppdb.VppSavedData) (err error) {
+	// Make sure version of API structs used by CNI are same as used by local VPP Instance.
+	err = compatibilityChecks(vppCh)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the IPv6 options are valid before creating anything. The
+	// IPv6 address they require is only known once IPAM ran, they are
+	// applied by CniVppAddHostIpv6().
+	err = validateIpv6Options(&conf.HostConf)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the mirror destination exists before creating anything.
+	var mirrorSwIfIndex uint32
+	if conf.HostConf.MirrorConf.Destination != "" {
+		mirrorSwIfIndex, err = findMirrorDestination(vppCh, conf.HostConf.MirrorConf.Destination)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// Create Local Interface
+	//
+	if conf.HostConf.IfType == "memif" {
+		err = addLocalDeviceMemif(vppCh, conf, args.ContainerID, data)
+	} else if conf.HostConf.IfType == "vhostuser" {
+		err = usrsptypes.NewEngineNotSupportedError("vpp", "iftype "+conf.HostConf.IfType)
+	} else {
+		err = fmt.Errorf("ERROR: Unknown HostConf.IfType: %s", conf.HostConf.IfType)
+	}
+	err = journal(args, "create", fmt.Sprintf("%s %s", conf.HostConf.IfType, data.SocketFile), err)
+	if err != nil {
+		return err
+	}
+
+	//
+	// Tag the interface with its owner so it can be identified in VPP
+	//
+	err = vppinterface.SetTag(vppCh.Ch, data.SwIfIndex, usrsptypes.GetHostIfName(conf, args))
+	err = journal(args, "tag", fmt.Sprintf("interface %d tag %s", data.SwIfIndex, usrsptypes.GetHostIfName(conf, args)), err)
+	if err != nil {
+		if dbgInterface {
+			fmt.Println("Error tagging interface:", err)
+		}
+		return err
+	}
+
+	//
+	// Set the rx mode, if not left to the VPP default
+	//
+	if conf.HostConf.RxMode != "" {
+		err = vppinterface.SetRxMode(vppCh.Ch, data.SwIfIndex, getRxMode(conf.HostConf.RxMode))
+		err = journal(args, "rxmode", fmt.Sprintf("interface %d %s", data.SwIfIndex, conf.HostConf.RxMode), err)
+		if err != nil {
+			if dbgInterface {
+				fmt.Println("Error setting rx mode:", err)
+			}
+			return err
+		}
+	}
+
+	//
+	// Set interface to up (1), unless it is left down for an external
+	// controller to bring up
+	//
+	if usrsptypes.IsAdminUp(&conf.HostConf) {
+		err = vppinterface.SetState(vppCh.Ch, data.SwIfIndex, 1)
+		err = journal(args, "state", fmt.Sprintf("interface %d up", data.SwIfIndex), err)
+		if err != nil {
+			if dbgInterface {
+				fmt.Println("Error bringing interface UP:", err)
+			}
+			return err
+		}
+	}
+
+	//
+	// Add Interface to Local Network
+	//
+
+	// Add L2 Network if supplied
+	if conf.HostConf.NetType == "bridge" {
+
+		var bridgeDomain uint32 = uint32(conf.HostConf.BridgeConf.BridgeId)
+
+		// Without a bridgeId, all the interfaces of the network share an
+		// allocated Bridge Domain.
+		bridgeUser := getBridgeUser(args.ContainerID, conf)
+		if bridgeDomain == 0 {
+			bridgeDomain, err = allocBridge(vppCh, conf.Name, bridgeUser)
+			err = journal(args, "bridge-alloc", "network "+conf.Name, err)
+			if err != nil {
+				return err
+			}
+			data.BridgeId = bridgeDomain
+		}
+
+		// Add Interface to Bridge. If Bridge does not exist, AddBridgeInterface()
+		// will create.
+		err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, data.SwIfIndex,
+			uint8(conf.HostConf.BridgeConf.Shg), conf.HostConf.BridgeConf.Bvi)
+		err = journal(args, "bridge", fmt.Sprintf("interface %d bridge %d", data.SwIfIndex, bridgeDomain), err)
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgBridge {
+				fmt.Println("Error:", err)
+			}
+			if data.BridgeId != 0 {
+				freeBridge(conf.Name, bridgeUser)
+			}
+			return err
+		} else {
+			if dbgBridge {
+				fmt.Printf("INTERFACE %d added to BRIDGE %d\n", data.SwIfIndex, bridgeDomain)
+				vppbridge.DumpBridge(vppCh.Ch, bridgeDomain)
+			}
+		}
+		// Add L3 Network if supplied
+	} else if conf.HostConf.NetType == "interface" {
+		if conf.HostConf.Unnumbered {
+			err = addUnnumbered(vppCh, &conf.HostConf, data.SwIfIndex, ipResult, data)
+			err = journal(args, "unnumbered", fmt.Sprintf("interface %d", data.SwIfIndex), err)
+			if err != nil {
+				err = usrsptypes.WithStack(err)
+				if dbgInterface {
+					fmt.Println("Error:", err)
+				}
+				return err
+			}
+		} else if len(ipResult.IPs) != 0 {
+			err = vppinterface.AddDelIpAddress(vppCh.Ch, data.SwIfIndex, 1, ipResult)
+			err = journal(args, "address", fmt.Sprintf("interface %d %d addresses", data.SwIfIndex, len(ipResult.IPs)), err)
+			if err != nil {
+				err = usrsptypes.WithStack(err)
+				if dbgInterface {
+					fmt.Println("Error:", err)
+				}
+				return err
+			}
+		}
+
+		if len(conf.HostConf.Routes) != 0 {
+			err = addStaticRoutes(vppCh, &conf.HostConf, data.SwIfIndex, data)
+			err = journal(args, "routes", fmt.Sprintf("interface %d %d routes", data.SwIfIndex, len(conf.HostConf.Routes)), err)
+			if err != nil {
+				err = usrsptypes.WithStack(err)
+				if dbgInterface {
+					fmt.Println("Error:", err)
+				}
+				return err
+			}
+		}
+	}
+
+	//
+	// NAT traffic from the interface onto the node network, if requested
+	//
+	if conf.HostConf.NatConf.Enable {
+		bondUser := getBondUser(args.ContainerID, conf)
+
+		err = addBond(vppCh, &conf.HostConf.NatConf, bondUser)
+		err = journal(args, "nat-uplink", "uplink "+conf.HostConf.NatConf.Uplink, err)
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgInterface {
+				fmt.Println("Error:", err)
+			}
+			return err
+		}
+
+		err = addNat(vppCh, &conf.HostConf.NatConf, data.SwIfIndex)
+		err = journal(args, "nat", fmt.Sprintf("interface %d", data.SwIfIndex), err)
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgInterface {
+				fmt.Println("Error:", err)
+			}
+			delBond(vppCh, &conf.HostConf.NatConf, bondUser)
+			return err
+		}
+	}
+
+	//
+	// Mirror the interface traffic, if requested
+	//
+	if conf.HostConf.MirrorConf.Destination != "" {
+		err = vppspan.SetSpan(vppCh.Ch, data.SwIfIndex, mirrorSwIfIndex, getSpanState(conf.HostConf.MirrorConf.Direction))
+		err = journal(args, "mirror", fmt.Sprintf("interface %d to %s", data.SwIfIndex, conf.HostConf.MirrorConf.Destination), err)
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgInterface {
+				fmt.Println("Error:", err)
+			}
+			return err
+		}
+	}
+
+	//
+	// Limit the bandwidth of the traffic from the container, if requested
+	//
+	if conf.HostConf.BandwidthConf.EgressRate != 0 {
+		err = addBandwidth(vppCh, &conf.HostConf, data)
+		err = journal(args, "bandwidth", fmt.Sprintf("interface %d %d bit/s", data.SwIfIndex, conf.HostConf.BandwidthConf.EgressRate), err)
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgInterface {
+				fmt.Println("Error:", err)
+			}
+			return err
+		}
+	}
+
+	//
+	// Punt control plane traffic to a kernel tap in the container, if requested
+	//
+	if len(conf.HostConf.PuntConf.Rules) != 0 {
+		err = addPunt(vppCh, &conf.HostConf.PuntConf, args.Netns, data)
+		err = journal(args, "punt", fmt.Sprintf("interface %d %d rules", data.SwIfIndex, len(conf.HostConf.PuntConf.Rules)), err)
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgInterface {
+				fmt.Println("Error:", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// journal() - Record a step programming the attachment in its journal, see
+//  usrspdb. The error of the step is returned as is.
+func journal(args *skel.CmdArgs, step string, request string, err error) error {
+	usrspdb.RecordJournal(args.ContainerID, args.IfName, "vpp", step, request, err)
+	return err
+}
+
+// setLinkState() - With reportLinkState, record the link state of the host
+//  interface in the attachment data, for the data of the container. The
+//  state is informational, the ADD does not fail if it can't be read.
+func setLinkState(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, args *skel.CmdArgs, info *usrspdb.AttachmentInfo) {
+	if conf.HostConf.ReportLinkState == false {
+		return
+	}
+
+	linkUp, err := vppinterface.GetLinkState(vppCh.Ch, info.SwIfIndex, linkStateWait)
+	journal(args, "linkstate", fmt.Sprintf("interface %d", info.SwIfIndex), err)
+	if err != nil {
+		logrus.Warningf("Link state of INTERFACE %d not reported: %v", info.SwIfIndex, err)
+		return
+	}
+
+	info.LinkState = "down"
+	if linkUp {
+		info.LinkState = "up"
+	}
+	info.LinkStateTime = time.Now().UTC().Format(time.RFC3339)
+	logrus.Infof("INTERFACE %d link %s", info.SwIfIndex, info.LinkState)
+}
+
+// delFromHostVpp() - Remove the interface and its configuration from the
+//  local VPP instance.
+func delFromHostVpp(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, data *vppdb.VppSavedData, containerID string) (err error) {
+	// The interface may already be gone (deleted by hand, lost in a VPP
+	// restart, or never created). DEL still succeeds, only the shared state
+	// (bond, bridge, socket file) is released.
+	exists := data.SwIfIndex != 0 && vppinterface.InterfaceExists(vppCh.Ch, data.SwIfIndex)
+	if exists == false {
+		logrus.Infof("INTERFACE %d already deleted", data.SwIfIndex)
+	}
+
+	//
+	// Stop mirroring the interface, if it was requested. Not fatal, the
+	// interface is still deleted below.
+	//
+	if conf.HostConf.MirrorConf.Destination != "" && exists {
+		mirrorSwIfIndex, mirrorErr := findMirrorDestination(vppCh, conf.HostConf.MirrorConf.Destination)
+		if mirrorErr == nil {
+			mirrorErr = vppspan.SetSpan(vppCh.Ch, data.SwIfIndex, mirrorSwIfIndex, vppspan.StateDisable)
+		}
+		if mirrorErr != nil {
+			logrus.Warningf("Failed to stop mirroring INTERFACE %d: %v", data.SwIfIndex, mirrorErr)
+		}
+	}
+
+	//
+	// Remove the bandwidth limit, if it was requested. Not fatal, the
+	// interface is still deleted below. The policer and its table are not
+	// deleted with the interface, so they are removed even without it.
+	//
+	if data.Policer != "" {
+		if bandwidthErr := delBandwidth(vppCh, &conf.HostConf, data, exists); bandwidthErr != nil {
+			logrus.Warningf("Failed to remove bandwidth limit from INTERFACE %d: %v", data.SwIfIndex, bandwidthErr)
+		}
+	}
+
+	//
+	// Remove the punt to the kernel tap, if it was requested. Not fatal, the
+	// interface is still deleted below.
+	//
+	if data.PuntSwIfIndex != 0 {
+		if puntErr := delPunt(vppCh, data); puntErr != nil {
+			logrus.Warningf("Failed to remove punt from INTERFACE %d: %v", data.SwIfIndex, puntErr)
+		}
+	}
+
+	//
+	// Remove NAT from the interface, if it was requested. Not fatal, the
+	// interface is still deleted below.
+	//
+	if conf.HostConf.NatConf.Enable {
+		if exists {
+			if natErr := delNat(vppCh, data.SwIfIndex); natErr != nil {
+				logrus.Warningf("Failed to remove NAT from INTERFACE %d: %v", data.SwIfIndex, natErr)
+			}
+		}
+		if bondErr := delBond(vppCh, &conf.HostConf.NatConf, getBondUser(containerID, conf)); bondErr != nil {
+			logrus.Warningf("Failed to release NAT uplink %s: %v", conf.HostConf.NatConf.Uplink, bondErr)
+		}
+	}
+
+	//
+	// Remove the static routes, if requested. Not fatal, the interface is
+	// still deleted below.
+	//
+	if len(data.StaticRoutes) != 0 && exists {
+		if routesErr := delStaticRoutes(vppCh, data.SwIfIndex, data); routesErr != nil {
+			logrus.Warningf("Failed to remove static routes from INTERFACE %d: %v", data.SwIfIndex, routesErr)
+		}
+	}
+
+	//
+	// Remove the routes and the unnumbered binding, if requested. Not fatal,
+	// the interface is still deleted below.
+	//
+	if conf.HostConf.Unnumbered && exists {
+		if unnumberedErr := delUnnumbered(vppCh, &conf.HostConf, data.SwIfIndex, data); unnumberedErr != nil {
+			logrus.Warningf("Failed to remove unnumbered from INTERFACE %d: %v", data.SwIfIndex, unnumberedErr)
+		}
+	}
+
+	//
+	// Remove L2 Network if supplied
+	//
+	if conf.HostConf.NetType == "bridge" {
+
+		// Validate and convert input data
+		var bridgeDomain uint32 = uint32(conf.HostConf.BridgeConf.BridgeId)
+		if bridgeDomain == 0 {
+			bridgeDomain = data.BridgeId
+		}
+
+		if dbgBridge {
+			fmt.Printf("INTERFACE %d retrieved from CONF - attempt to DELETE Bridge %d\n", data.SwIfIndex, bridgeDomain)
+		}
+
+		// Remove MemIf from Bridge. RemoveBridgeInterface() will delete Bridge if
+		// no more interfaces are associated with the Bridge.
+		if exists {
+			err = vppbridge.RemoveBridgeInterface(vppCh.Ch, bridgeDomain, data.SwIfIndex)
+		}
+
+		if err != nil {
+			err = usrsptypes.WithStack(err)
+			if dbgBridge {
+				fmt.Println("Error:", err)
+			}
+			return err
+		} else {
+			if dbgBridge {
+				fmt.Printf("INTERFACE %d removed from BRIDGE %d\n", data.SwIfIndex, bridgeDomain)
+				vppbridge.DumpBridge(vppCh.Ch, bridgeDomain)
+			}
+		}
+
+		// Not fatal, the interface is no longer in the Bridge Domain. Also
+		// done without saved data, in case a failed ADD allocated it, or
+		// without the interface.
+		if conf.HostConf.BridgeConf.BridgeId == 0 {
+			freeErr := freeBridge(conf.Name, getBridgeUser(containerID, conf))
+			if freeErr != nil {
+				logrus.Warningf("Failed to free BRIDGE %d: %v", bridgeDomain, freeErr)
+			}
+		}
+	}
+
+	//
+	// Delete Local Interface
+	//
+	if conf.HostConf.IfType == "memif" {
+		err = delLocalDeviceMemif(vppCh, conf, containerID, data)
+	} else if conf.HostConf.IfType == "vhostuser" {
+		err = usrsptypes.NewEngineNotSupportedError("vpp", "iftype "+conf.HostConf.IfType)
+	} else {
+		err = fmt.Errorf("ERROR: Unknown HostConf.Type: %s", conf.HostConf.IfType)
+	}
+
+	return err
+}
+
+func compatibilityChecks(vppCh vppinfra.ConnectionData) (err error) {
+
+	// Compatibility Checks
+	err = vppmemif.MemifCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppbridge.BridgeCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppvhostuser.VhostUserCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppinterface.InterfaceCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppafpacket.AfPacketCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppspan.SpanCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppip6nd.Ip6ndCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// hasIpv6Address() - Determine if the IPAM result contains an IPv6 address.
+func hasIpv6Address(ipResult *current.Result) bool {
+	if ipResult == nil {
+		return false
+	}
+	for _, ipConfig := range ipResult.IPs {
+		if ipConfig.Address.IP.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateIpv6Conf() - The IPv6 options only apply to an interface with an
+//  IPv6 address, so reject them for bridge and IPv4 only attachments.
+func validateIpv6Conf(usrSpConf *usrsptypes.UserSpaceConf, ipResult *current.Result) error {
+	err := validateIpv6Options(usrSpConf)
+	if err != nil || usrSpConf.Ipv6Conf == (usrsptypes.Ipv6Conf{}) {
+		return err
+	}
+
+	if hasIpv6Address(ipResult) == false {
+		return fmt.Errorf("ERROR: ipv6 options require an IPv6 address on the interface")
+	}
+	return nil
+}
+
+// validateIpv6Options() - The checks of validateIpv6Conf() which don't need
+//  the IPAM result, so they can run before anything is created.
+func validateIpv6Options(usrSpConf *usrsptypes.UserSpaceConf) error {
+	ipv6Conf := usrSpConf.Ipv6Conf
+
+	if ipv6Conf == (usrsptypes.Ipv6Conf{}) {
+		return nil
+	}
+
+	if usrSpConf.NetType != "interface" {
+		return fmt.Errorf("ERROR: ipv6 options require an IPv6 address on the interface")
+	}
+
+	if ipv6Conf.LinkLocal != "" {
+		linkLocal := net.ParseIP(ipv6Conf.LinkLocal)
+		if linkLocal == nil || linkLocal.To4() != nil || linkLocal.IsLinkLocalUnicast() == false {
+			return fmt.Errorf("ERROR: Invalid ipv6 linkLocal address: %s", ipv6Conf.LinkLocal)
+		}
+	}
+
+	return validateRaConf(&ipv6Conf)
+}
+
+// validateRaConf() - The RA parameters follow the bounds of RFC 4861, and
+//  are pointless when the RAs are suppressed.
+func validateRaConf(ipv6Conf *usrsptypes.Ipv6Conf) error {
+	ra := ipv6Conf.Ra
+
+	if ra == (usrsptypes.RaConf{}) {
+		return nil
+	}
+
+	if ipv6Conf.SuppressRa {
+		return fmt.Errorf("ERROR: ipv6 ra can't be combined with suppressRa")
+	}
+
+	if ra.MaxInterval != 0 && (ra.MaxInterval < 4 || ra.MaxInterval > 1800) {
+		return fmt.Errorf("ERROR: Invalid ipv6 ra maxInterval %d, must be 4-1800", ra.MaxInterval)
+	}
+
+	if ra.MinInterval != 0 {
+		if ra.MaxInterval == 0 {
+			return fmt.Errorf("ERROR: ipv6 ra minInterval requires maxInterval")
+		}
+		if ra.MinInterval < 3 || ra.MinInterval*4 > ra.MaxInterval*3 {
+			return fmt.Errorf("ERROR: Invalid ipv6 ra minInterval %d, must be 3 to 0.75 * maxInterval (%d)",
+				ra.MinInterval, ra.MaxInterval)
+		}
+	}
+
+	if ra.Lifetime < 0 || ra.Lifetime > 9000 {
+		return fmt.Errorf("ERROR: Invalid ipv6 ra lifetime %d, must be 1-9000", ra.Lifetime)
+	}
+	if ra.Lifetime != 0 && ra.Lifetime < ra.MaxInterval {
+		return fmt.Errorf("ERROR: ipv6 ra lifetime %d is lower than maxInterval %d", ra.Lifetime, ra.MaxInterval)
+	}
+
+	return nil
+}
+
+// configureIpv6() - Apply the IPv6 options once the addresses are configured.
+func configureIpv6(vppCh vppinfra.ConnectionData, usrSpConf *usrsptypes.UserSpaceConf, swIfIndex uint32, ipResult *current.Result) (err error) {
+	ipv6Conf := usrSpConf.Ipv6Conf
+
+	if hasIpv6Address(ipResult) == false {
+		return
+	}
+
+	if ipv6Conf.LinkLocal != "" {
+		err = vppip6nd.SetLinkLocalAddress(vppCh.Ch, swIfIndex, net.ParseIP(ipv6Conf.LinkLocal))
+		if err != nil {
+			return
+		}
+	}
+
+	if ipv6Conf.SuppressRa {
+		err = vppip6nd.SetRaSuppress(vppCh.Ch, swIfIndex, 1)
+		if err != nil {
+			return
+		}
+	}
+
+	if ipv6Conf.Ra != (usrsptypes.RaConf{}) {
+		err = vppip6nd.SetRaConfig(vppCh.Ch, swIfIndex, vppip6nd.RaConfig{
+			Managed:     ipv6Conf.Ra.Managed,
+			Other:       ipv6Conf.Ra.Other,
+			MaxInterval: uint32(ipv6Conf.Ra.MaxInterval),
+			MinInterval: uint32(ipv6Conf.Ra.MinInterval),
+			Lifetime:    uint32(ipv6Conf.Ra.Lifetime),
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func addLocalDeviceMemif(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, containerID string, data *vppdb.VppSavedData) (err error) {
+	// Validate and convert input data
+	var memifRole vppmemif.MemifRole
+	var memifMode vppmemif.MemifMode
+
+	memifSocketFile := getMemifSocketFile(conf, containerID)
+
+	// Sockets of a tenant never share a directory, or a VPP socket, with
+	// the sockets of another tenant.
+	if conf.Tenant != "" {
+		tenantDir := getMemifTenantDir(conf.Tenant)
+		if filepath.Dir(filepath.Clean(memifSocketFile)) != tenantDir {
+			return fmt.Errorf("ERROR: memif socket %s is not in the directory of tenant %s (%s)",
+				memifSocketFile, conf.Tenant, tenantDir)
+		}
+		if err = usrsptypes.CreateSharedDir(conf, tenantDir); err != nil {
+			return err
+		}
+	}
+
+	// The socket is owned by someone else, VPP only connects to it.
+	if conf.HostConf.MemifConf.AttachOnly {
+		if _, err = os.Stat(memifSocketFile); err != nil {
+			return fmt.Errorf("ERROR: memif attachOnly socket %s not found: %v", memifSocketFile, err)
+		}
+	}
+
+	if conf.HostConf.MemifConf.Role == "master" {
+		memifRole = vppmemif.RoleMaster
+	} else if conf.HostConf.MemifConf.Role == "slave" {
+		memifRole = vppmemif.RoleSlave
+	} else {
+		return fmt.Errorf("ERROR: Invalid MEMIF Role:" + conf.HostConf.MemifConf.Role)
+	}
+
+	if conf.HostConf.MemifConf.Mode == "" {
+		conf.HostConf.MemifConf.Mode = "ethernet"
+	}
+	if conf.HostConf.MemifConf.Mode == "ethernet" {
+		memifMode = vppmemif.ModeEthernet
+	} else if conf.HostConf.MemifConf.Mode == "ip" {
+		memifMode = vppmemif.ModeIP
+	} else if conf.HostConf.MemifConf.Mode == "inject-punt" {
+		memifMode = vppmemif.ModePuntInject
+	} else {
+		return fmt.Errorf("ERROR: Invalid MEMIF Mode:" + conf.HostConf.MemifConf.Mode)
+	}
+
+	memifBufferSize, err := getMemifBufferSize(conf)
+	if err != nil {
+		return
+	}
+
+	var memifHwAddr net.HardwareAddr
+	if conf.HostConf.Mac != "" {
+		if memifHwAddr, err = net.ParseMAC(conf.HostConf.Mac); err != nil {
+			return fmt.Errorf("ERROR: Invalid MAC address %s: %v", conf.HostConf.Mac, err)
+		}
+	}
+
+	data.SocketFile = memifSocketFile
+
+	// Create Memif Socket
+	data.MemifSocketId, err = vppmemif.CreateMemifSocket(vppCh.Ch, memifSocketFile)
+	if err != nil {
+		err = usrsptypes.WithStack(err)
+		if dbgInterface {
+			fmt.Println("Error:", err)
+		}
+		return
+	} else {
+		if dbgInterface {
+			fmt.Println("MEMIF SOCKET", data.MemifSocketId, memifSocketFile, "created")
+			vppmemif.DumpMemifSocket(vppCh.Ch)
+		}
+	}
+
+	// Create MemIf Interface
+	data.SwIfIndex, err = vppmemif.CreateMemifInterface(vppCh.Ch, data.MemifSocketId, getMemifId(conf), memifRole, memifMode, memifBufferSize, memifHwAddr)
+	if err != nil {
+		err = usrsptypes.WithStack(err)
+		if dbgInterface {
+			fmt.Println("Error:", err)
+		}
+		return
+	} else {
+		if dbgInterface {
+			fmt.Println("MEMIF", data.SwIfIndex, "created", conf.If0name)
+			vppmemif.DumpMemif(vppCh.Ch)
+		}
+	}
+
+	return
+}
+
+// findMirrorDestination() - Look up the VPP interface traffic is mirrored
+//  to. If it does not exist, the error lists the available interfaces.
+func findMirrorDestination(vppCh vppinfra.ConnectionData, destination string) (uint32, error) {
+	swIfIndex, found := vppinterface.FindInterfaceByName(vppCh.Ch, destination)
+	if found == false {
+		return 0, fmt.Errorf("ERROR: mirror destination %s not found, available interfaces: %s",
+			destination, strings.Join(vppinterface.GetInterfaceNames(vppCh.Ch), ", "))
+	}
+	return swIfIndex, nil
+}
+
+// checkManagedInterface() - The interface must carry the interface name
+//  prefix and one of the tags of the attachment, so a crafted configuration
+//  or state file can't direct a delete at an interface the plugin does not
+//  own. An interface already gone is left to the caller.
+func checkManagedInterface(vppCh vppinfra.ConnectionData, swIfIndex uint32, tags []string) error {
+	tag, found := vppinterface.GetInterfaceTagByIndex(vppCh.Ch, swIfIndex)
+	if found == false {
+		return nil
+	}
+
+	if strings.HasPrefix(tag, usrsptypes.GetIfNamePrefix()) {
+		for _, expected := range tags {
+			if len(expected) > vppinterface.MaxTagLength {
+				expected = expected[:vppinterface.MaxTagLength]
+			}
+			if expected != "" && tag == expected {
+				return nil
+			}
+		}
+	}
+
+	err := &usrsptypes.UnmanagedInterfaceError{
+		Interface: fmt.Sprintf("swIfIndex %d", swIfIndex),
+		Tag:       tag,
+	}
+	logrus.Warningf("%v", err)
+	return err
+}
+
+// getStateStr() - Admin or link state, as printed in errors.
+func getStateStr(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+// getRxMode() - VPP rx mode of the rxMode option, validated on load.
+func getRxMode(rxMode string) vppinterface.RxMode {
+	switch rxMode {
+	case "interrupt":
+		return vppinterface.RxModeInterrupt
+	case "adaptive":
+		return vppinterface.RxModeAdaptive
+	}
+	return vppinterface.RxModePolling
+}
+
+// getUnnumberedParent() - Name of the interface the address is borrowed from.
+func getUnnumberedParent(userSpaceConf *usrsptypes.UserSpaceConf) string {
+	if userSpaceConf.UnnumberedParent != "" {
+		return userSpaceConf.UnnumberedParent
+	}
+	return defaultUnnumberedParent
+}
+
+// addUnnumbered() - Make the interface unnumbered, borrowing the address of
+//  the parent interface, and install a host route to each IPAM address via
+//  the interface, in routeTable if provided. A missing table is created, and
+//  is left in place on delete since other interfaces may use it. The routes
+//  and their table are saved for delete.
+func addUnnumbered(vppCh vppinfra.ConnectionData, userSpaceConf *usrsptypes.UserSpaceConf, swIfIndex uint32, ipResult *current.Result, data *vppdb.VppSavedData) (err error) {
+
+	err = vpproute.RouteCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
+
+	parent := getUnnumberedParent(userSpaceConf)
+	parentSwIfIndex, found := vppinterface.FindInterfaceByName(vppCh.Ch, parent)
+	if found == false {
+		return fmt.Errorf("ERROR: unnumbered parent %s not found, available interfaces: %s",
+			parent, strings.Join(vppinterface.GetInterfaceNames(vppCh.Ch), ", "))
+	}
+
+	err = vppinterface.SetUnnumbered(vppCh.Ch, parentSwIfIndex, swIfIndex, 1)
+	if err != nil {
+		return err
+	}
+
+	data.RouteTable = userSpaceConf.RouteTable
+	if data.RouteTable != 0 {
+		for _, ipConfig := range ipResult.IPs {
+			var isIPv6 uint8
+			if ipConfig.Address.IP.To4() == nil {
+				isIPv6 = 1
+			}
+			err = vpproute.AddDelTable(vppCh.Ch, 1, isIPv6, data.RouteTable)
+			if err != nil {
+				delUnnumbered(vppCh, userSpaceConf, swIfIndex, data)
+				return err
+			}
+		}
+	}
+
+	for _, ipConfig := range ipResult.IPs {
+		err = vpproute.AddDelHostRoute(vppCh.Ch, 1, ipConfig.Address.IP, swIfIndex, data.RouteTable)
+		if err != nil {
+			delUnnumbered(vppCh, userSpaceConf, swIfIndex, data)
+			return err
+		}
+		data.Routes = append(data.Routes, ipConfig.Address.IP.String())
+	}
+
+	return nil
+}
+
+// delUnnumbered() - Remove the saved host routes, from the saved table, and
+//  the unnumbered binding of the interface.
+func delUnnumbered(vppCh vppinfra.ConnectionData, userSpaceConf *usrsptypes.UserSpaceConf, swIfIndex uint32, data *vppdb.VppSavedData) (err error) {
+
+	for _, route := range data.Routes {
+		if routeErr := vpproute.AddDelHostRoute(vppCh.Ch, 0, net.ParseIP(route), swIfIndex, data.RouteTable); routeErr != nil && err == nil {
+			err = routeErr
+		}
+	}
+	data.Routes = nil
+
+	parentSwIfIndex, found := vppinterface.FindInterfaceByName(vppCh.Ch, getUnnumberedParent(userSpaceConf))
+	if found {
+		if unnumberedErr := vppinterface.SetUnnumbered(vppCh.Ch, parentSwIfIndex, swIfIndex, 0); unnumberedErr != nil && err == nil {
+			err = unnumberedErr
+		}
+	}
+
+	return err
+}
+
+// addStaticRoutes() - Install the static routes via the interface, in the
+//  default table. The routes are validated on load. The routes installed
+//  are saved for delete.
+func addStaticRoutes(vppCh vppinfra.ConnectionData, userSpaceConf *usrsptypes.UserSpaceConf, swIfIndex uint32, data *vppdb.VppSavedData) (err error) {
+
+	err = vpproute.RouteCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
+
+	for _, route := range userSpaceConf.Routes {
+		err = addDelStaticRoute(vppCh, 1, route, swIfIndex)
+		if err != nil {
+			delStaticRoutes(vppCh, swIfIndex, data)
+			return err
+		}
+		data.StaticRoutes = append(data.StaticRoutes, route)
+	}
+
+	return nil
+}
+
+// delStaticRoutes() - Remove the saved static routes.
+func delStaticRoutes(vppCh vppinfra.ConnectionData, swIfIndex uint32, data *vppdb.VppSavedData) (err error) {
+
+	for _, route := range data.StaticRoutes {
+		if routeErr := addDelStaticRoute(vppCh, 0, route, swIfIndex); routeErr != nil && err == nil {
+			err = routeErr
+		}
+	}
+	data.StaticRoutes = nil
+
+	return err
+}
+
+// addDelStaticRoute() - Add or delete the path of a static route. A weight
+//  of 0 is a weight of 1.
+func addDelStaticRoute(vppCh vppinfra.ConnectionData, isAdd uint8, route usrsptypes.StaticRoute, swIfIndex uint32) error {
+	_, dst, err := net.ParseCIDR(route.Dst)
+	if err != nil {
+		return fmt.Errorf("ERROR: Invalid route dst %s: %v", route.Dst, err)
+	}
+
+	var gw net.IP
+	if route.Gw != "" {
+		gw = net.ParseIP(route.Gw)
+	}
+
+	weight := route.Weight
+	if weight == 0 {
+		weight = 1
+	}
+
+	return vpproute.AddDelRoute(vppCh.Ch, isAdd, dst, gw, swIfIndex, 0, uint8(route.Metric), uint8(weight))
+}
+
+// getSpanState() - Convert the mirror direction into the SPAN state.
+func getSpanState(direction string) vppspan.SpanState {
+	if direction == "rx" {
+		return vppspan.StateRx
+	} else if direction == "tx" {
+		return vppspan.StateTx
+	}
+	return vppspan.StateBoth
+}
+
+// addNat() - Set the interface as NAT44 inside and the uplink as outside,
+//  and add the outside addresses. The uplink and the addresses are shared
+//  by all the interfaces using NAT, so they are only added once.
+func addNat(vppCh vppinfra.ConnectionData, natConf *usrsptypes.NatConf, swIfIndex uint32) (err error) {
+
+	// The NAT plugin is optional in VPP, so only check it when used.
+	err = vppnat.NatCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	uplinkSwIfIndex, found := vppinterface.FindInterfaceByName(vppCh.Ch, natConf.Uplink)
+	if found == false {
+		return fmt.Errorf("ERROR: NAT uplink interface %s not found", natConf.Uplink)
+	}
+
+	if natConf.AddressPool != "" {
+		var first, last net.IP
+
+		addresses := strings.SplitN(natConf.AddressPool, "-", 2)
+		first = net.ParseIP(strings.TrimSpace(addresses[0]))
+		last = first
+		if len(addresses) == 2 {
+			last = net.ParseIP(strings.TrimSpace(addresses[1]))
+		}
+		if first == nil || last == nil {
+			return fmt.Errorf("ERROR: Invalid NAT addressPool: %s", natConf.AddressPool)
+		}
+
+		err = vppnat.AddAddressRange(vppCh.Ch, first, last)
+	} else {
+		err = vppnat.AddInterfaceAddress(vppCh.Ch, uplinkSwIfIndex)
+	}
+	if err != nil {
+		return
+	}
+
+	err = vppnat.SetInterfaceFeature(vppCh.Ch, uplinkSwIfIndex, vppnat.SideOutside, 1)
+	if err != nil {
+		return
+	}
+
+	err = vppnat.SetInterfaceFeature(vppCh.Ch, swIfIndex, vppnat.SideInside, 1)
+
+	return
+}
+
+// delNat() - Remove the NAT44 inside feature from the interface. The shared
+//  uplink and addresses are left in place for the other interfaces.
+func delNat(vppCh vppinfra.ConnectionData, swIfIndex uint32) (err error) {
+
+	err = vppnat.NatCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	err = vppnat.SetInterfaceFeature(vppCh.Ch, swIfIndex, vppnat.SideInside, 0)
+
+	return
+}
+
+// getBondUser() - Name the interface is recorded as in the bond users.
+func getBondUser(containerID string, conf *usrsptypes.NetConf) string {
+	return fmt.Sprintf("%s-%s", containerID, conf.If0name)
+}
+
+// getBridgeUser() - Name the interface is recorded as in the users of an
+//  allocated Bridge Domain.
+func getBridgeUser(containerID string, conf *usrsptypes.NetConf) string {
+	return fmt.Sprintf("%s-%s", containerID, conf.If0name)
+}
+
+// getBridgeDomain() - Bridge Domain of the network: the bridgeId if
+//  provided, otherwise the one allocated to the network.
+func getBridgeDomain(conf *usrsptypes.NetConf) (uint32, error) {
+	var state vppdb.BridgeState
+
+	if conf.HostConf.BridgeConf.BridgeId != 0 {
+		return uint32(conf.HostConf.BridgeConf.BridgeId), nil
+	}
+
+	found, err := vppdb.LoadBridgeState(conf.Name, &state)
+	if err != nil {
+		return 0, err
+	}
+	if found == false {
+		return 0, fmt.Errorf("ERROR: no Bridge Domain allocated for network %s", conf.Name)
+	}
+
+	return state.BridgeId, nil
+}
+
+// allocBridge() - Allocate a Bridge Domain Id to the network if it has none,
+//  and record the interface as a user of it. The Id is not used by another
+//  network nor by a Bridge Domain created outside of the UserSpace CNI.
+//  Repeating the allocation for the same user returns the same Id.
+func allocBridge(vppCh vppinfra.ConnectionData, network string, user string) (uint32, error) {
+	var state vppdb.BridgeState
+
+	if network == "" {
+		return 0, fmt.Errorf("ERROR: netType bridge without bridgeId requires the network name")
+	}
+
+	lockFile, err := vppdb.LockBridgeState()
+	if err != nil {
+		return 0, err
+	}
+	defer vppdb.UnlockBridgeState(lockFile)
+
+	found, err := vppdb.LoadBridgeState(network, &state)
+	if err != nil {
+		return 0, err
+	}
+
+	if found {
+		for _, existingUser := range state.Users {
+			if existingUser == user {
+				return state.BridgeId, nil
+			}
+		}
+		state.Users = append(state.Users, user)
+		return state.BridgeId, vppdb.SaveBridgeState(&state)
+	}
+
+	// Collect the Ids in use, allocated or not.
+	inUse := make(map[uint32]bool)
+
+	states, err := vppdb.ListBridgeStates()
+	if err != nil {
+		return 0, err
+	}
+	for _, otherState := range states {
+		inUse[otherState.BridgeId] = true
+	}
+
+	bridgeDomains, err := vppbridge.ListBridges(vppCh.Ch)
+	if err != nil {
+		return 0, err
+	}
+	for _, bridgeDomain := range bridgeDomains {
+		inUse[bridgeDomain] = true
+	}
+
+	for bridgeDomain := uint32(minAutoBridgeId); bridgeDomain <= maxAutoBridgeId; bridgeDomain++ {
+		if inUse[bridgeDomain] == false {
+			state = vppdb.BridgeState{
+				Network:  network,
+				BridgeId: bridgeDomain,
+				Users:    []string{user},
+			}
+			return bridgeDomain, vppdb.SaveBridgeState(&state)
+		}
+	}
+
+	return 0, fmt.Errorf("ERROR: no Bridge Domain Id available for network %s", network)
+}
+
+// freeBridge() - Remove the interface from the users of the Bridge Domain
+//  allocated to the network, and free the Id with the last user. The Bridge
+//  Domain itself is deleted by vppbridge.RemoveBridgeInterface().
+func freeBridge(network string, user string) error {
+	var state vppdb.BridgeState
+
+	lockFile, err := vppdb.LockBridgeState()
+	if err != nil {
+		return err
+	}
+	defer vppdb.UnlockBridgeState(lockFile)
+
+	found, err := vppdb.LoadBridgeState(network, &state)
+	if err != nil || found == false {
+		return err
+	}
+
+	var users []string
+	for _, existingUser := range state.Users {
+		if existingUser != user {
+			users = append(users, existingUser)
+		}
+	}
+
+	if len(users) == 0 {
+		return vppdb.DeleteBridgeState(network)
+	}
+
+	state.Users = users
+	return vppdb.SaveBridgeState(&state)
+}
+
+// getBondMode() - Convert the createBond mode into the VPP bond mode.
+func getBondMode(mode string) vppbond.BondMode {
+	switch mode {
+	case "round-robin":
+		return vppbond.ModeRoundRobin
+	case "active-backup":
+		return vppbond.ModeActiveBackup
+	case "xor":
+		return vppbond.ModeXor
+	case "broadcast":
+		return vppbond.ModeBroadcast
+	}
+	return vppbond.ModeLacp
+}
+
+// getBondLb() - Convert the createBond loadBalance into the VPP algorithm.
+func getBondLb(loadBalance string) vppbond.BondLb {
+	if loadBalance == "l23" {
+		return vppbond.LbL23
+	} else if loadBalance == "l34" {
+		return vppbond.LbL34
+	}
+	return vppbond.LbL2
+}
+
+// addBond() - Create the NAT uplink as a bond of the createBond members if
+//  it does not exist, and record the interface as a user of the bond. An
+//  uplink that was not created by the UserSpace CNI is used as is.
+func addBond(vppCh vppinfra.ConnectionData, natConf *usrsptypes.NatConf, user string) (err error) {
+	var state vppdb.BondState
+
+	found, err := vppdb.LoadBondState(natConf.Uplink, &state)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := vppinterface.FindInterfaceByName(vppCh.Ch, natConf.Uplink); exists {
+		if found == false || state.Created == false {
+			return nil
+		}
+		for _, existingUser := range state.Users {
+			if existingUser == user {
+				return nil
+			}
+		}
+		state.Users = append(state.Users, user)
+		return vppdb.SaveBondState(&state)
+	}
+
+	// Nothing to create, addNat() reports the missing uplink.
+	if len(natConf.CreateBond.Members) == 0 {
+		return nil
+	}
+
+	// The bond API is only checked when used, like NAT.
+	err = vppbond.BondCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the members can be used before creating anything.
+	for _, member := range natConf.CreateBond.Members {
+		swIfIndex, exists := vppinterface.FindInterfaceByName(vppCh.Ch, member)
+		if exists == false {
+			return fmt.Errorf("ERROR: bond member interface %s not found, available interfaces: %s",
+				member, strings.Join(vppinterface.GetInterfaceNames(vppCh.Ch), ", "))
+		}
+		if bondSwIfIndex, enslaved := vppbond.FindBondOfMember(vppCh.Ch, swIfIndex); enslaved {
+			return fmt.Errorf("ERROR: bond member interface %s is already a member of bond interface %d",
+				member, bondSwIfIndex)
+		}
+	}
+
+	bondSwIfIndex, err := vppbond.CreateBond(vppCh.Ch, getBondMode(natConf.CreateBond.Mode),
+		getBondLb(natConf.CreateBond.LoadBalance))
+	if err != nil {
+		return err
+	}
+
+	// VPP names the bond, so the uplink has to be the name VPP picks.
+	if swIfIndex, exists := vppinterface.FindInterfaceByName(vppCh.Ch, natConf.Uplink); exists == false || swIfIndex != bondSwIfIndex {
+		removeBond(vppCh, bondSwIfIndex, nil)
+		return fmt.Errorf("ERROR: NAT uplink %s does not match the name of the created bond, like BondEthernet0",
+			natConf.Uplink)
+	}
+
+	var members []string
+	for _, member := range natConf.CreateBond.Members {
+		swIfIndex, _ := vppinterface.FindInterfaceByName(vppCh.Ch, member)
+
+		err = vppbond.EnslaveInterface(vppCh.Ch, swIfIndex, bondSwIfIndex)
+		if err == nil {
+			members = append(members, member)
+			err = vppinterface.SetState(vppCh.Ch, swIfIndex, 1)
+		}
+		if err != nil {
+			removeBond(vppCh, bondSwIfIndex, members)
+			return err
+		}
+	}
+
+	err = vppinterface.SetState(vppCh.Ch, bondSwIfIndex, 1)
+	if err == nil {
+		state = vppdb.BondState{
+			Uplink:    natConf.Uplink,
+			SwIfIndex: bondSwIfIndex,
+			Created:   true,
+			Members:   members,
+			Users:     []string{user},
+		}
+		err = vppdb.SaveBondState(&state)
+	}
+	if err != nil {
+		removeBond(vppCh, bondSwIfIndex, members)
+		return err
+	}
+
+	if dbgInterface {
+		fmt.Printf("BOND %s (%d) created with members %v\n", natConf.Uplink, bondSwIfIndex, members)
+	}
+
+	return nil
+}
+
+// delBond() - Remove the interface from the users of the NAT uplink bond.
+//  The last user deletes the bond, only if it was created by the UserSpace
+//  CNI.
+func delBond(vppCh vppinfra.ConnectionData, natConf *usrsptypes.NatConf, user string) (err error) {
+	var state vppdb.BondState
+
+	found, err := vppdb.LoadBondState(natConf.Uplink, &state)
+	if err != nil || found == false {
+		return err
+	}
+
+	var users []string
+	for _, existingUser := range state.Users {
+		if existingUser != user {
+			users = append(users, existingUser)
+		}
+	}
+	state.Users = users
+
+	if len(state.Users) != 0 {
+		return vppdb.SaveBondState(&state)
+	}
+
+	// Only delete the bond if it was not since replaced.
+	swIfIndex, exists := vppinterface.FindInterfaceByName(vppCh.Ch, natConf.Uplink)
+	if state.Created && exists && swIfIndex == state.SwIfIndex {
+		// The outside feature is left on the shared uplink by delNat().
+		err = vppnat.SetInterfaceFeature(vppCh.Ch, swIfIndex, vppnat.SideOutside, 0)
+		if err != nil {
+			return err
+		}
+
+		err = removeBond(vppCh, swIfIndex, state.Members)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vppdb.DeleteBondState(natConf.Uplink)
+}
+
+// removeBond() - Detach the members from the bond and delete the bond.
+func removeBond(vppCh vppinfra.ConnectionData, bondSwIfIndex uint32, members []string) (err error) {
+
+	for _, member := range members {
+		if swIfIndex, exists := vppinterface.FindInterfaceByName(vppCh.Ch, member); exists {
+			if detachErr := vppbond.DetachInterface(vppCh.Ch, swIfIndex); detachErr != nil {
+				logrus.Warningf("Failed to remove %s from BOND %d: %v", member, bondSwIfIndex, detachErr)
+			}
+		}
+	}
+
+	return vppbond.DeleteBond(vppCh.Ch, bondSwIfIndex)
+}
+
+// addDelPortMapping() - Add or remove the NAT44 static mapping for a single
+//  port mapping.
+func addDelPortMapping(vppCh vppinfra.ConnectionData, isAdd uint8, mapping *usrspdb.PortMapping, uplinkSwIfIndex uint32, tag string) error {
+	var protocol uint8
+	var hostIP net.IP
+
+	if mapping.Protocol == "tcp" || mapping.Protocol == "" {
+		protocol = vppnat.ProtocolTcp
+	} else if mapping.Protocol == "udp" {
+		protocol = vppnat.ProtocolUdp
+	} else {
+		return fmt.Errorf("ERROR: Invalid portMappings protocol: %s", mapping.Protocol)
+	}
+
+	if mapping.HostIP != "" {
+		if hostIP = net.ParseIP(mapping.HostIP); hostIP == nil {
+			return fmt.Errorf("ERROR: Invalid portMappings hostIP: %s", mapping.HostIP)
+		}
+	}
+
+	return vppnat.AddDelStaticMapping(vppCh.Ch, isAdd, protocol,
+		net.ParseIP(mapping.PodIP), uint16(mapping.ContainerPort),
+		hostIP, uint16(mapping.HostPort), uplinkSwIfIndex, tag)
+}
+
+// getHostAddressResult() - Build the addresses of the host interface. With
+//  "auto", the first address of the subnet of each IPAM address is used,
+//  which must not be the address of the container.
+func getHostAddressResult(address string, ipResult *current.Result) (*current.Result, error) {
+	hostResult := &current.Result{}
+
+	if address != "auto" {
+		ipConfig, err := parseIpConfig(address)
+		if err != nil {
+			return nil, err
+		}
+		hostResult.IPs = append(hostResult.IPs, ipConfig)
+		return hostResult, nil
+	}
+
+	if len(ipResult.IPs) == 0 {
+		return nil, fmt.Errorf("ERROR: Host address auto requires an address from IPAM")
+	}
+
+	for _, ipConfig := range ipResult.IPs {
+		subnet := ipConfig.Address.IP.Mask(ipConfig.Address.Mask)
+		if subnet == nil {
+			continue
+		}
+
+		hostIP := make(net.IP, len(subnet))
+		copy(hostIP, subnet)
+		hostIP[len(hostIP)-1]++
+
+		if hostIP.Equal(ipConfig.Address.IP) {
+			return nil, fmt.Errorf("ERROR: Host address %s is the address of the container", hostIP.String())
+		}
+
+		hostResult.IPs = append(hostResult.IPs, &current.IPConfig{
+			Version: ipConfig.Version,
+			Address: net.IPNet{IP: hostIP, Mask: ipConfig.Address.Mask},
+		})
+	}
+
+	return hostResult, nil
+}
+
+// parseIpConfig() - Convert an address (CIDR) into an IPConfig.
+func parseIpConfig(address string) (*current.IPConfig, error) {
+	ipAddr, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Invalid address %s: %v", address, err)
+	}
+	ipNet.IP = ipAddr
+
+	ipVersion := "6"
+	if ipAddr.To4() != nil {
+		ipVersion = "4"
+	}
+
+	return &current.IPConfig{
+		Version: ipVersion,
+		Address: *ipNet,
+	}, nil
+}
+
+// getHostCounters() - Counters of the host interface of the attachment, to
+//  append to an error. The counters of the container end can't be read,
+//  the interface belongs to the application in the container.
+func getHostCounters(vppCh vppinfra.ConnectionData, args *skel.CmdArgs) string {
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err == nil {
+		err = vppinterface.InterfaceCompatibilityCheck(vppCh.Ch)
+	}
+
+	var counters string
+	if err == nil {
+		counters, err = vppinterface.GetCounters(vppCh.Ch, info.SwIfIndex)
+	}
+	if err != nil {
+		return fmt.Sprintf(" (host interface counters not available: %v)", err)
+	}
+
+	return "\nHost interface counters:\n" + counters
+}
+
+// addPunt() - Create a tap with its kernel end in the container netns, and
+//  redirect the traffic punted on the interface to it. UDP ports are
+//  registered for punt, they are dropped otherwise. VPP does not punt by
+//  TCP port, TCP traffic for the interface addresses is punted as long as
+//  the VPP host stack is not enabled.
+func addPunt(vppCh vppinfra.ConnectionData, puntConf *usrsptypes.PuntConf, netns string, data *vppdb.VppSavedData) (err error) {
+
+	err = vpppunt.PuntCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+	err = vpptap.TapCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	ifName := CniVppGetPuntIfName(puntConf)
+
+	data.PuntSwIfIndex, err = vpptap.CreateTapInterface(vppCh.Ch, netns, ifName)
+	if err != nil {
+		return
+	}
+
+	err = vppinterface.SetState(vppCh.Ch, data.PuntSwIfIndex, 1)
+
+	for _, rule := range puntConf.Rules {
+		if err != nil {
+			break
+		}
+		if strings.ToLower(rule.Protocol) == "udp" {
+			err = vpppunt.AddDelPunt(vppCh.Ch, 1, vpppunt.IpvBoth, vpppunt.ProtocolUdp, uint16(rule.Port))
+		}
+	}
+
+	if err == nil {
+		err = vpppunt.AddDelPuntRedirect(vppCh.Ch, data.SwIfIndex, data.PuntSwIfIndex, 1, 0)
+	}
+	if err == nil {
+		err = vpppunt.AddDelPuntRedirect(vppCh.Ch, data.SwIfIndex, data.PuntSwIfIndex, 1, 1)
+	}
+
+	if err != nil {
+		delPunt(vppCh, data)
+	}
+
+	return
+}
+
+// delPunt() - Remove the punt redirects and the tap created by addPunt().
+//  The UDP port registrations apply to all interfaces, so they are left in
+//  place for other attachments.
+func delPunt(vppCh vppinfra.ConnectionData, data *vppdb.VppSavedData) (err error) {
+
+	// Ignore redirect errors, they may not all have been added
+	vpppunt.AddDelPuntRedirect(vppCh.Ch, data.SwIfIndex, data.PuntSwIfIndex, 0, 0)
+	vpppunt.AddDelPuntRedirect(vppCh.Ch, data.SwIfIndex, data.PuntSwIfIndex, 0, 1)
+
+	err = vpptap.DeleteTapInterface(vppCh.Ch, data.PuntSwIfIndex)
+	if err == nil {
+		data.PuntSwIfIndex = 0
+	}
+
+	return
+}
+
+// addBandwidth() - Police the traffic received on the interface (sent by
+//  the container) with a policer, reached through a classify table matching
+//  every packet.
+func addBandwidth(vppCh vppinfra.ConnectionData, hostConf *usrsptypes.UserSpaceConf, data *vppdb.VppSavedData) (err error) {
+
+	err = vpppolicer.PolicerCompatibilityCheck(vppCh.Ch)
+	if err != nil {
+		return
+	}
+
+	bandwidth := &hostConf.BandwidthConf
+	name := fmt.Sprintf("%spolicer-%d", usrsptypes.GetIfNamePrefix(), data.SwIfIndex)
+
+	policerIndex, err := vpppolicer.AddPolicer(vppCh.Ch, name, uint32(bandwidth.EgressRate/1000), bandwidth.EgressBurst/8)
+	if err != nil {
+		return
+	}
+	data.Policer = name
+
+	data.PolicerTable, err = vpppolicer.AddMatchAllTable(vppCh.Ch, policerIndex)
+	if err == nil {
+		ip4Table, ip6Table, l2Table := getPolicerTables(hostConf, data.PolicerTable)
+		err = vpppolicer.SetInterface(vppCh.Ch, data.SwIfIndex, ip4Table, ip6Table, l2Table, 1)
+		if err != nil {
+			vpppolicer.DelTable(vppCh.Ch, data.PolicerTable)
+		}
+	}
+
+	if err != nil {
+		vpppolicer.DelPolicer(vppCh.Ch, name)
+		data.Policer = ""
+		data.PolicerTable = 0
+	}
+
+	return
+}
+
+// delBandwidth() - Stop policing the interface, if it still exists, then
+//  remove the classify table and the policer.
+func delBandwidth(vppCh vppinfra.ConnectionData, hostConf *usrsptypes.UserSpaceConf, data *vppdb.VppSavedData, exists bool) (err error) {
+
+	if exists {
+		ip4Table, ip6Table, l2Table := getPolicerTables(hostConf, data.PolicerTable)
+		vpppolicer.SetInterface(vppCh.Ch, data.SwIfIndex, ip4Table, ip6Table, l2Table, 0)
+	}
+
+	err = vpppolicer.DelTable(vppCh.Ch, data.PolicerTable)
+	if err != nil {
+		return
+	}
+
+	err = vpppolicer.DelPolicer(vppCh.Ch, data.Policer)
+	if err == nil {
+		data.Policer = ""
+		data.PolicerTable = 0
+	}
+
+	return
+}
+
+// getPolicerTables() - Classify tables of the policer, by the path the
+//  traffic takes: L2 input on a bridged interface, IPv4 and IPv6 input
+//  otherwise.
+func getPolicerTables(hostConf *usrsptypes.UserSpaceConf, table uint32) (ip4Table uint32, ip6Table uint32, l2Table uint32) {
+	if hostConf.NetType == "bridge" {
+		return vpppolicer.NoTable, vpppolicer.NoTable, table
+	}
+	return table, table, vpppolicer.NoTable
+}
+
+// getMemifBufferSize() - Use the provided memif buffer size. Otherwise derive
+//  it from the MTU, rounded up to a power of 2, so a jumbo MTU is not
+//  silently dropped by the default buffer size.
+func getMemifBufferSize(conf *usrsptypes.NetConf) (uint16, error) {
+	if conf.HostConf.MemifConf.BufferSize != 0 {
+		if conf.HostConf.MemifConf.BufferSize < 0 || conf.HostConf.MemifConf.BufferSize > vppmemif.MaxBufferSize {
+			return 0, fmt.Errorf("ERROR: Invalid MEMIF bufferSize:%d", conf.HostConf.MemifConf.BufferSize)
+		}
+		return uint16(conf.HostConf.MemifConf.BufferSize), nil
+	}
+
+	bufferSize := vppmemif.DefaultBufferSize
+	for bufferSize < conf.Mtu+memifL2Overhead {
+		bufferSize *= 2
+	}
+	if bufferSize > vppmemif.MaxBufferSize {
+		return 0, fmt.Errorf("ERROR: MTU %d is too large for a MEMIF buffer", conf.Mtu)
+	}
+
+	logrus.Infof("MEMIF bufferSize not provided, using %d for MTU %d", bufferSize, conf.Mtu)
+
+	return uint16(bufferSize), nil
+}
+
+func delLocalDeviceMemif(vppCh vppinfra.ConnectionData, conf *usrsptypes.NetConf, containerID string, data *vppdb.VppSavedData) (err error) {
+
+	memifSocketFile := getMemifSocketFile(conf, containerID)
+
+	// Already gone, only the socket file is left to remove.
+	if data.SwIfIndex == 0 || vppinterface.InterfaceExists(vppCh.Ch, data.SwIfIndex) == false {
+		if conf.HostConf.MemifConf.AttachOnly == false {
+			err = vppdb.FileCleanup("", memifSocketFile)
+		}
+		return
+	}
+
+	err = vppmemif.DeleteMemifInterface(vppCh.Ch, data.SwIfIndex)
+
+	// Make sure the interface is really gone, retrying the delete once, so
+	// a failed delete is not leaked.
+	if vppinterface.InterfaceExists(vppCh.Ch, data.SwIfIndex) {
+		logrus.Warningf("INTERFACE %d still present after delete (%v), retrying", data.SwIfIndex, err)
+
+		err = vppmemif.DeleteMemifInterface(vppCh.Ch, data.SwIfIndex)
+		if err == nil && vppinterface.InterfaceExists(vppCh.Ch, data.SwIfIndex) {
+			err = fmt.Errorf("ERROR: INTERFACE %d still present after delete", data.SwIfIndex)
+		}
+	}
+
+	if err != nil {
+		err = usrsptypes.WithStack(err)
+		if dbgInterface {
+			fmt.Println("Error:", err)
+		}
+		return
+	} else {
+		if dbgInterface {
+			fmt.Printf("INTERFACE %d deleted\n", data.SwIfIndex)
+			vppmemif.DumpMemif(vppCh.Ch)
+			vppmemif.DumpMemifSocket(vppCh.Ch)
+		}
+	}
+
+	// Remove file, unless it is owned by someone else
+	if conf.HostConf.MemifConf.AttachOnly == false {
+		err = vppdb.FileCleanup("", memifSocketFile)
+	}
+
+	return
+}
+
+// getMemifId() - Id of the memif interface on its socket, set in the
+//  container section since the container app has to use the same id. In
+//  the container, the container section is the host section of the remote
+//  configuration (see SaveRemoteConfig()).
+func getMemifId(conf *usrsptypes.NetConf) uint32 {
+	if conf.ContainerConf.MemifConf.Id != 0 {
+		return uint32(conf.ContainerConf.MemifConf.Id)
+	}
+	return uint32(conf.HostConf.MemifConf.Id)
+}
+
+// getMemifSocketFile() - Socket file of the memif interface: socketFile if
+//  provided, then the USERSPACE_MEMIF_SOCKFILE environment variable, then a
+//  file named after the ContainerId and interface, in the directory of the
+//  tenant if any.
+func getMemifSocketFile(conf *usrsptypes.NetConf, containerID string) string {
+	if conf.HostConf.MemifConf.SocketFile != "" {
+		return conf.HostConf.MemifConf.SocketFile
+	}
+	if memifSocketFile, ok := os.LookupEnv("USERSPACE_MEMIF_SOCKFILE"); ok {
+		return memifSocketFile
+	}
+
+	fileName := fmt.Sprintf("memif-%s-%s.sock", usrsptypes.GetContainerToken(containerID), conf.If0name)
+	if conf.Tenant != "" {
+		return filepath.Join(getMemifTenantDir(conf.Tenant), fileName)
+	}
+	return filepath.Join(defaultVPPSocketDir, fileName)
+}
+
+// getMemifTenantDir() - Directory of the memif sockets of a tenant.
+func getMemifTenantDir(tenant string) string {
+	return filepath.Join(defaultVPPSocketDir, "tenant-"+tenant)
 }
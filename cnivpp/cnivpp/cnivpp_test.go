@@ -0,0 +1,90 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnivpp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types/current"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func newIpResult(t *testing.T, addresses ...string) *current.Result {
+	result := &current.Result{}
+	for _, address := range addresses {
+		ip, ipNet, err := net.ParseCIDR(address)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%s): %v", address, err)
+		}
+		ipNet.IP = ip
+		version := "4"
+		if ip.To4() == nil {
+			version = "6"
+		}
+		result.IPs = append(result.IPs, &current.IPConfig{Version: version, Address: *ipNet})
+	}
+	return result
+}
+
+func TestValidateIpv6Conf(t *testing.T) {
+	tests := []struct {
+		name      string
+		netType   string
+		ipv6Conf  usrsptypes.Ipv6Conf
+		addresses []string
+		wantErr   bool
+	}{
+		{"no options, no address", "interface", usrsptypes.Ipv6Conf{}, nil, false},
+		{"no options, bridge", "bridge", usrsptypes.Ipv6Conf{}, nil, false},
+		{"suppressRa with IPv6", "interface", usrsptypes.Ipv6Conf{SuppressRa: true}, []string{"fd00::5/64"}, false},
+		{"linkLocal with dual stack", "interface", usrsptypes.Ipv6Conf{LinkLocal: "fe80::5"}, []string{"10.1.1.5/24", "fd00::5/64"}, false},
+		{"ra with IPv6", "interface", usrsptypes.Ipv6Conf{Ra: usrsptypes.RaConf{MaxInterval: 600}}, []string{"fd00::5/64"}, false},
+		{"suppressRa without address", "interface", usrsptypes.Ipv6Conf{SuppressRa: true}, nil, true},
+		{"suppressRa with IPv4 only", "interface", usrsptypes.Ipv6Conf{SuppressRa: true}, []string{"10.1.1.5/24"}, true},
+		{"suppressRa on bridge", "bridge", usrsptypes.Ipv6Conf{SuppressRa: true}, []string{"fd00::5/64"}, true},
+		{"linkLocal not link-local", "interface", usrsptypes.Ipv6Conf{LinkLocal: "fd00::1"}, []string{"fd00::5/64"}, true},
+		{"linkLocal IPv4", "interface", usrsptypes.Ipv6Conf{LinkLocal: "169.254.0.1"}, []string{"fd00::5/64"}, true},
+		{"ra with suppressRa", "interface", usrsptypes.Ipv6Conf{SuppressRa: true, Ra: usrsptypes.RaConf{Managed: true}}, []string{"fd00::5/64"}, true},
+	}
+
+	for _, test := range tests {
+		usrSpConf := usrsptypes.UserSpaceConf{NetType: test.netType, Ipv6Conf: test.ipv6Conf}
+		err := validateIpv6Conf(&usrSpConf, newIpResult(t, test.addresses...))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validateIpv6Conf() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+// The host interface is created before IPAM runs, so the options are only
+// checked against the IPv6 address once the IPAM result is known.
+func TestHostIpv6OptionsBeforeIpam(t *testing.T) {
+	hostConf := usrsptypes.UserSpaceConf{
+		NetType:  "interface",
+		Ipv6Conf: usrsptypes.Ipv6Conf{SuppressRa: true, LinkLocal: "fe80::1"},
+	}
+
+	if err := validateIpv6Options(&hostConf); err != nil {
+		t.Errorf("validateIpv6Options() before IPAM: %v", err)
+	}
+	if err := validateIpv6Conf(&hostConf, newIpResult(t, "fd00::5/64")); err != nil {
+		t.Errorf("validateIpv6Conf() with an IPv6 IPAM result: %v", err)
+	}
+	if err := validateIpv6Conf(&hostConf, newIpResult(t, "10.1.1.5/24")); err == nil {
+		t.Errorf("validateIpv6Conf() with an IPv4 IPAM result: no error")
+	}
+}
@@ -103,7 +103,7 @@ func main() {
 	}
 
 	// Create MemIf Interface
-	swIfIndex, err = vppmemif.CreateMemifInterface(vppCh.Ch, memifSocketId, memifRole, memifMode)
+	swIfIndex, err = vppmemif.CreateMemifInterface(vppCh.Ch, memifSocketId, 0, memifRole, memifMode, vppmemif.DefaultBufferSize, nil)
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
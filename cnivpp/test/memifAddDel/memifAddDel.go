@@ -101,7 +101,7 @@ func main() {
 	}
 
 	// Create MemIf Interface
-	swIfIndex, err = vppmemif.CreateMemifInterface(vppCh.Ch, memifSocketId, memifRole, memifMode)
+	swIfIndex, err = vppmemif.CreateMemifInterface(vppCh.Ch, memifSocketId, 0, memifRole, memifMode, vppmemif.DefaultBufferSize, nil)
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
@@ -114,7 +114,7 @@ func main() {
 
 	// Add MemIf to Bridge. If Bridge does not exist, AddBridgeInterface()
 	// will create.
-	err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, swIfIndex)
+	err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, swIfIndex, 0, false)
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
@@ -100,7 +100,7 @@ func main() {
 
 	// Add Vhost-User to Bridge. If Bridge does not exist, AddBridgeInterface()
 	// will create.
-	err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, swIfIndex)
+	err = vppbridge.AddBridgeInterface(vppCh.Ch, bridgeDomain, swIfIndex, 0, false)
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
@@ -27,11 +27,16 @@ package vppdb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/containernetworking/cni/pkg/types/current"
 
@@ -45,6 +50,9 @@ const defaultBaseCNIDir = "/var/run/vpp/cni"
 const defaultLocalCNIDir = "/var/run/vpp/cni/data"
 const debugVppDb = false
 
+// Lock file serializing the Bridge Domain allocations, in defaultLocalCNIDir.
+const bridgeLockFile = "bridge.lock"
+
 //
 // Types
 //
@@ -52,29 +60,103 @@ const debugVppDb = false
 // This structure is a union of all the VPP data (for all types of
 // interfaces) that need to be preserved for later use.
 type VppSavedData struct {
-	SwIfIndex     uint32 `json:"swIfIndex"`     // Software Index, used to access the created interface, needed to delete interface.
-	MemifSocketId uint32 `json:"memifSocketId"` // Memif SocketId, used to access the created memif Socket File, used for debug only.
+	SwIfIndex     uint32                   `json:"swIfIndex"`               // Software Index, used to access the created interface, needed to delete interface.
+	MemifSocketId uint32                   `json:"memifSocketId"`           // Memif SocketId, used to access the created memif Socket File, used for debug only.
+	SocketFile    string                   `json:"socketFile"`              // Socket File shared with the container.
+	PuntSwIfIndex uint32                   `json:"puntSwIfIndex,omitempty"` // Tap interface the traffic is punted to, if any.
+	Routes        []string                 `json:"routes,omitempty"`        // Host routes to the IPAM addresses, when the interface is unnumbered.
+	BridgeId      uint32                   `json:"bridgeId,omitempty"`      // Bridge Domain allocated for the network, when no bridgeId is provided.
+	RouteTable    uint32                   `json:"routeTable,omitempty"`    // FIB table of the host routes, when the interface is unnumbered.
+	Policer       string                   `json:"policer,omitempty"`       // Policer limiting the traffic from the container, if any.
+	PolicerTable  uint32                   `json:"policerTable,omitempty"`  // Classify table sending the traffic to the policer.
+	StaticRoutes  []usrsptypes.StaticRoute `json:"staticRoutes,omitempty"`  // Static routes installed via the interface.
+}
+
+// This structure is the state of a Bond Interface used as an uplink, shared
+// by all the interfaces using it. Users is a list of <ContainerId>-<IfName>.
+type BondState struct {
+	Uplink    string   `json:"uplink"`    // VPP name of the Bond Interface
+	SwIfIndex uint32   `json:"swIfIndex"` // Software Index of the Bond Interface
+	Created   bool     `json:"created"`   // Bond Interface was created by the UserSpace CNI
+	Members   []string `json:"members"`   // VPP names of the member interfaces added by the UserSpace CNI
+	Users     []string `json:"users"`     // Interfaces using the Bond Interface
+}
+
+// This structure is the state of a Bridge Domain allocated by the UserSpace
+// CNI for a network without a bridgeId, shared by all the interfaces of the
+// network. Users is a list of <ContainerId>-<IfName>.
+type BridgeState struct {
+	Network  string   `json:"network"`  // Name of the network the Bridge Domain is allocated to
+	BridgeId uint32   `json:"bridgeId"` // Allocated Bridge Domain Id
+	Users    []string `json:"users"`    // Interfaces in the Bridge Domain
 }
 
 // This structure is used to pass additional data outside of the usrsptypes date into the container.
 type additionalData struct {
-	ContainerId string         `json:"containerId"` // ContainerId used locally. Used in several place, namely in the socket filenames.
-	IPResult    current.Result `json:"ipResult"`    // Data structure returned from IPAM plugin.
+	ContainerId string         `json:"containerId"`         // ContainerId used locally. Used in several place, namely in the socket filenames.
+	IPResult    current.Result `json:"ipResult"`            // Data structure returned from IPAM plugin.
+	HostEngine  string         `json:"hostEngine"`          // Engine that created the host end of the interface.
+	IPs         []ipData       `json:"ips,omitempty"`       // Addresses of the interface, with subnet and gateway, from the IPAM result.
+	Routes      []routeData    `json:"routes,omitempty"`    // Routes from the IPAM result.
+	Hugepages   *hugepageData  `json:"hugepages,omitempty"` // Hugepage layout for the DPDK EAL of the app, if provided.
+	LinkState   *LinkStateData `json:"linkState,omitempty"` // Link state of the host interface, with reportLinkState.
+}
+
+// The link state of the host interface, read by the ADD, so the app does
+// not send into a memif whose peer is not connected.
+type LinkStateData struct {
+	State string `json:"state"` // up|down
+	Time  string `json:"time"`  // When the state was read, RFC 3339
+}
+
+// An address of the container interface, in a form easy to consume by apps
+// doing their own routing.
+type ipData struct {
+	Version string `json:"version"`           // 4 or 6
+	Address string `json:"address"`           // Address of the interface, in CIDR notation
+	Subnet  string `json:"subnet"`            // Subnet of the address, in CIDR notation
+	Gateway string `json:"gateway,omitempty"` // Gateway of the subnet, if provided by IPAM
+}
+
+// The hugepage layout of the container, for a DPDK app to initialize its
+// EAL without knowing the node.
+type hugepageData struct {
+	MountPath string `json:"mountPath"`           // Mount point of the hugetlbfs
+	SocketMem []int  `json:"socketMem,omitempty"` // Memory (MB) per NUMA socket
+	EalArgs   string `json:"ealArgs"`             // EAL arguments derived from the above
+}
+
+// A route of the container interface.
+type routeData struct {
+	Dst string `json:"dst"`          // Destination, in CIDR notation
+	Gw  string `json:"gw,omitempty"` // Next hop, the gateway of the subnet if not provided
 }
 
 //
 // API Functions
 //
 
+// GetStateDir() - Directory of the saved data and the bond and bridge
+//  state, for the cleanup of corrupt files.
+func GetStateDir() string {
+	return defaultLocalCNIDir
+}
+
+// GetContainerDir() - Directory of the data passed to the container,
+//  mapped into the container as its local data directory.
+func GetContainerDir(containerID string) string {
+	return filepath.Join(defaultBaseCNIDir, containerID)
+}
+
 // saveVppConfig() - Some data needs to be saved, like the swIfIndex, for cmdDel().
 //  This function squirrels the data away to be retrieved later.
 func SaveVppConfig(conf *usrsptypes.NetConf, containerID string, data *VppSavedData) error {
 
 	// Current implementation is to write data to a file with the name:
-	//   /var/run/vpp/cni/data/local-<ContainerId:12>-<If0name>.json
+	//   /var/run/vpp/cni/data/local-<ContainerToken>-<If0name>.json
 	//   OLD: /var/run/vpp/cni/<ContainerId>/local-<If0name>.json
 
-	fileName := fmt.Sprintf("local-%s-%s.json", containerID[:12], conf.If0name)
+	fileName := fmt.Sprintf("local-%s-%s.json", usrsptypes.GetContainerToken(containerID), conf.If0name)
 	if dataBytes, err := json.Marshal(data); err == nil {
 		sockDir := defaultLocalCNIDir
 
@@ -93,7 +175,7 @@ func SaveVppConfig(conf *usrsptypes.NetConf, containerID string, data *VppSavedD
 		if debugVppDb {
 			fmt.Printf("SAVE FILE: swIfIndex=%d path=%s dataBytes=%s\n", data.SwIfIndex, path, dataBytes)
 		}
-		return ioutil.WriteFile(path, dataBytes, 0644)
+		return usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
 	} else {
 		return fmt.Errorf("ERROR: serializing delegate VPP saved data: %v", err)
 	}
@@ -101,16 +183,15 @@ func SaveVppConfig(conf *usrsptypes.NetConf, containerID string, data *VppSavedD
 
 func LoadVppConfig(conf *usrsptypes.NetConf, containerID string, data *VppSavedData) error {
 
-	fileName := fmt.Sprintf("local-%s-%s.json", containerID[:12], conf.If0name)
+	fileName := fmt.Sprintf("local-%s-%s.json", usrsptypes.GetContainerToken(containerID), conf.If0name)
 	sockDir := defaultLocalCNIDir
 	path := filepath.Join(sockDir, fileName)
 
 	if _, err := os.Stat(path); err == nil {
-		if dataBytes, err := ioutil.ReadFile(path); err == nil {
-			if err = json.Unmarshal(dataBytes, data); err != nil {
-				return fmt.Errorf("ERROR: Failed to parse VPP saved data: %v", err)
-			}
-		} else {
+		err = usrsptypes.ReadStateFile(path, data)
+		if errors.Is(err, usrsptypes.ErrCorruptState) {
+			return err
+		} else if err != nil {
 			return fmt.Errorf("ERROR: Failed to read VPP saved data: %v", err)
 		}
 
@@ -124,6 +205,158 @@ func LoadVppConfig(conf *usrsptypes.NetConf, containerID string, data *VppSavedD
 	return nil
 }
 
+//
+// Functions for processing Bond State (shared by all the interfaces on the host)
+//
+
+// SaveBondState() - Write the state of a Bond Interface, replacing any
+//  previous state. The file is named:
+//   /var/run/vpp/cni/data/bond-<Uplink>.json
+func SaveBondState(state *BondState) error {
+
+	dataBytes, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("ERROR: serializing bond state: %v", err)
+	}
+
+	if _, err := os.Stat(defaultLocalCNIDir); err != nil {
+		if os.IsNotExist(err) {
+			if err := os.MkdirAll(defaultLocalCNIDir, 0700); err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+	}
+
+	path := getBondStatePath(state.Uplink)
+
+	if debugVppDb {
+		fmt.Printf("SAVE FILE: path=%s dataBytes=%s\n", path, dataBytes)
+	}
+	return usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
+}
+
+// LoadBondState() - Read the state of a Bond Interface. Returns false if
+//  no state was saved for the uplink.
+func LoadBondState(uplink string, state *BondState) (bool, error) {
+
+	err := usrsptypes.ReadStateFile(getBondStatePath(uplink), state)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if errors.Is(err, usrsptypes.ErrCorruptState) {
+		return false, err
+	} else if err != nil {
+		return false, fmt.Errorf("ERROR: Failed to read bond state: %v", err)
+	}
+
+	return true, nil
+}
+
+// DeleteBondState() - Remove the state of a Bond Interface.
+func DeleteBondState(uplink string) error {
+	return FileCleanup(defaultLocalCNIDir, getBondStatePath(uplink))
+}
+
+//
+// Functions for processing Bridge State (shared by all the interfaces of a network)
+//
+
+// LockBridgeState() - Take the lock serializing the Bridge Domain
+//  allocations on the node, across plugin instances. Release it with
+//  UnlockBridgeState().
+func LockBridgeState() (*os.File, error) {
+
+	if err := os.MkdirAll(defaultLocalCNIDir, 0700); err != nil {
+		return nil, err
+	}
+
+	lockFile, err := os.OpenFile(filepath.Join(defaultLocalCNIDir, bridgeLockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to open bridge lock: %v", err)
+	}
+
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("ERROR: Failed to take bridge lock: %v", err)
+	}
+
+	return lockFile, nil
+}
+
+// UnlockBridgeState() - Release the lock taken by LockBridgeState().
+func UnlockBridgeState(lockFile *os.File) {
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	lockFile.Close()
+}
+
+// SaveBridgeState() - Write the state of an allocated Bridge Domain,
+//  replacing any previous state. The file is named:
+//   /var/run/vpp/cni/data/bridge-<Network>.json
+func SaveBridgeState(state *BridgeState) error {
+
+	dataBytes, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("ERROR: serializing bridge state: %v", err)
+	}
+
+	if err := os.MkdirAll(defaultLocalCNIDir, 0700); err != nil {
+		return err
+	}
+
+	path := getBridgeStatePath(state.Network)
+
+	if debugVppDb {
+		fmt.Printf("SAVE FILE: path=%s dataBytes=%s\n", path, dataBytes)
+	}
+	return usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
+}
+
+// LoadBridgeState() - Read the state of the Bridge Domain allocated to a
+//  network. Returns false if no Bridge Domain is allocated to the network.
+func LoadBridgeState(network string, state *BridgeState) (bool, error) {
+
+	err := usrsptypes.ReadStateFile(getBridgeStatePath(network), state)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if errors.Is(err, usrsptypes.ErrCorruptState) {
+		return false, err
+	} else if err != nil {
+		return false, fmt.Errorf("ERROR: Failed to read bridge state: %v", err)
+	}
+
+	return true, nil
+}
+
+// ListBridgeStates() - Read the state of all the allocated Bridge Domains.
+func ListBridgeStates() ([]BridgeState, error) {
+	var states []BridgeState
+
+	matches, err := filepath.Glob(filepath.Join(defaultLocalCNIDir, "bridge-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range matches {
+		var state BridgeState
+
+		err = usrsptypes.ReadStateFile(path, &state)
+		if errors.Is(err, usrsptypes.ErrCorruptState) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("ERROR: Failed to read bridge state: %v", err)
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// DeleteBridgeState() - Remove the state of an allocated Bridge Domain.
+func DeleteBridgeState(network string) error {
+	return FileCleanup("", getBridgeStatePath(network))
+}
+
 //
 // Functions for processing Remote Configs (configs for within a Container)
 //
@@ -132,7 +365,7 @@ func LoadVppConfig(conf *usrsptypes.NetConf, containerID string, data *VppSavedD
 //      flip the location and write the data to a file. When the Container
 //      comes up, it will read the file via () and delete the file. This function
 //      writes the file.
-func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, containerID string) error {
+func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, containerID string, linkState *LinkStateData) error {
 
 	var dataCopy usrsptypes.NetConf
 	var addData additionalData
@@ -163,6 +396,9 @@ func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, contai
 	// IPAM is processed by the host and sent to the Container. So blank out what was already processed.
 	dataCopy.IPAM.Type = ""
 
+	// The host interface name only applies to the interface on the host.
+	dataCopy.HostIfName = ""
+
 	// Convert empty variables to valid data based on the original HostConf
 	if dataCopy.HostConf.Engine == "" {
 		dataCopy.HostConf.Engine = conf.HostConf.Engine
@@ -185,6 +421,9 @@ func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, contai
 		if dataCopy.HostConf.MemifConf.Mode == "" {
 			dataCopy.HostConf.MemifConf.Mode = conf.HostConf.MemifConf.Mode
 		}
+		if dataCopy.HostConf.MemifConf.BufferSize == 0 {
+			dataCopy.HostConf.MemifConf.BufferSize = conf.HostConf.MemifConf.BufferSize
+		}
 	} else if dataCopy.HostConf.IfType == "vhostuser" {
 		if dataCopy.HostConf.VhostConf.Mode == "" {
 			if conf.HostConf.VhostConf.Mode == "client" {
@@ -200,6 +439,10 @@ func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, contai
 	//
 	addData.ContainerId = containerID
 	addData.IPResult = *ipResult
+	addData.HostEngine = conf.HostConf.Engine
+	addData.IPs, addData.Routes = getIpData(ipResult)
+	addData.Hugepages = getHugepageData(&conf.Hugepages)
+	addData.LinkState = linkState
 
 	//
 	// Marshall data and write to file
@@ -213,7 +456,7 @@ func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, contai
 		if debugVppDb {
 			fmt.Printf("SAVE FILE: path=%s dataBytes=%s", path, dataBytes)
 		}
-		err = ioutil.WriteFile(path, dataBytes, 0644)
+		err = usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
 	} else {
 		return fmt.Errorf("ERROR: serializing REMOTE NetConf data: %v", err)
 	}
@@ -228,7 +471,7 @@ func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, contai
 			if debugVppDb {
 				fmt.Printf("SAVE FILE: path=%s dataBytes=%s", path, dataBytes)
 			}
-			err = ioutil.WriteFile(path, dataBytes, 0644)
+			err = usrsptypes.WriteFileAtomic(path, dataBytes, 0644)
 		} else {
 			return fmt.Errorf("ERROR: serializing ADDDATA NetConf data: %v", err)
 		}
@@ -237,6 +480,61 @@ func SaveRemoteConfig(conf *usrsptypes.NetConf, ipResult *current.Result, contai
 	return err
 }
 
+// getIpData() - Addresses, subnets, gateways and routes of the IPAM result,
+//  with the addresses and prefixes as strings.
+func getIpData(ipResult *current.Result) (ips []ipData, routes []routeData) {
+	for _, ipConfig := range ipResult.IPs {
+		subnet := net.IPNet{
+			IP:   ipConfig.Address.IP.Mask(ipConfig.Address.Mask),
+			Mask: ipConfig.Address.Mask,
+		}
+		ip := ipData{
+			Version: ipConfig.Version,
+			Address: ipConfig.Address.String(),
+			Subnet:  subnet.String(),
+		}
+		if ipConfig.Gateway != nil {
+			ip.Gateway = ipConfig.Gateway.String()
+		}
+		ips = append(ips, ip)
+	}
+
+	for _, route := range ipResult.Routes {
+		r := routeData{
+			Dst: route.Dst.String(),
+		}
+		if route.GW != nil {
+			r.Gw = route.GW.String()
+		}
+		routes = append(routes, r)
+	}
+
+	return
+}
+
+// getHugepageData() - Hugepage layout of the configuration, with the EAL
+//  arguments to apply it, or nil if not provided.
+func getHugepageData(hugepageConf *usrsptypes.HugepageConf) *hugepageData {
+	if hugepageConf.MountPath == "" {
+		return nil
+	}
+
+	data := &hugepageData{
+		MountPath: hugepageConf.MountPath,
+		SocketMem: hugepageConf.SocketMem,
+		EalArgs:   "--huge-dir " + hugepageConf.MountPath,
+	}
+	if len(hugepageConf.SocketMem) != 0 {
+		socketMem := make([]string, len(hugepageConf.SocketMem))
+		for i, mem := range hugepageConf.SocketMem {
+			socketMem[i] = strconv.Itoa(mem)
+		}
+		data.EalArgs += " --socket-mem " + strings.Join(socketMem, ",")
+	}
+
+	return data
+}
+
 func FindRemoteConfig() (bool, usrsptypes.NetConf, current.Result, string, error) {
 	var conf usrsptypes.NetConf
 	var addData additionalData
@@ -280,9 +578,7 @@ func CleanupRemoteConfig(conf *usrsptypes.NetConf, containerID string) {
 	// Current implementation is to write data to a file with the name:
 	//   /var/run/vpp/cni/<ContainerId>/remote-<If0name>.json
 
-	sockDir := filepath.Join(defaultBaseCNIDir, containerID)
-
-	if err := os.RemoveAll(sockDir); err != nil {
+	if err := usrsptypes.RemoveContainerDir(defaultBaseCNIDir, containerID); err != nil {
 		fmt.Println(err)
 	}
 }
@@ -299,12 +595,14 @@ func CleanupRemoteConfig(conf *usrsptypes.NetConf, containerID string) {
 //    only the directory should be deleted.
 func FileCleanup(directory string, filepath string) (err error) {
 
-	// If File is provided, delete it.
+	// If File is provided, delete it. A file already gone is not an error,
+	// so a repeated DEL succeeds.
 	if filepath != "" {
 		err = os.Remove(filepath)
-		if err != nil {
+		if err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("ERROR: Failed to delete file: %v", err)
 		}
+		err = nil
 	}
 
 	// If Directory is provided and it is empty, delete it.
@@ -322,6 +620,16 @@ func FileCleanup(directory string, filepath string) (err error) {
 	return
 }
 
+func getBondStatePath(uplink string) string {
+	fileName := fmt.Sprintf("bond-%s.json", strings.Replace(uplink, "/", "_", -1))
+	return filepath.Join(defaultLocalCNIDir, fileName)
+}
+
+func getBridgeStatePath(network string) string {
+	fileName := fmt.Sprintf("bridge-%s.json", strings.Replace(network, "/", "_", -1))
+	return filepath.Join(defaultLocalCNIDir, fileName)
+}
+
 func findFile(filePath string) (bool, []byte, error) {
 	var found bool = false
 
@@ -0,0 +1,62 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vppdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCleanup(t *testing.T) {
+	tests := []struct {
+		name          string
+		createFile    bool
+		createOther   bool
+		wantDirExists bool
+	}{
+		{"file and directory", true, false, false},
+		// A repeated DEL, the socket file is already gone.
+		{"file gone", false, false, false},
+		{"directory in use", true, true, true},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "vppdb")
+		if err != nil {
+			t.Fatalf("TempDir(): %v", err)
+		}
+		file := filepath.Join(dir, "memif-net1.sock")
+		if test.createFile {
+			ioutil.WriteFile(file, nil, 0600)
+		}
+		if test.createOther {
+			ioutil.WriteFile(filepath.Join(dir, "memif-net2.sock"), nil, 0600)
+		}
+
+		if err = FileCleanup(dir, file); err != nil {
+			t.Errorf("%s: FileCleanup() error = %v", test.name, err)
+		}
+		if _, err = os.Stat(file); os.IsNotExist(err) == false {
+			t.Errorf("%s: FileCleanup() left the file", test.name)
+		}
+		if _, err = os.Stat(dir); (err == nil) != test.wantDirExists {
+			t.Errorf("%s: directory exists = %v, want %v", test.name, err == nil, test.wantDirExists)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
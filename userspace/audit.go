@@ -0,0 +1,154 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Audit: With auditLog set in the configuration, each ADD and DEL appends
+// a record to that file, one JSON object per line, whether the command
+// succeeds or fails. The file is only ever appended to, and each record is
+// a single write, so records of concurrent commands are not interleaved.
+// Failing to write the record is logged, the command is not failed for it.
+// The audit log is separate from the logging, whatever the log level.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Types
+//
+
+// A record of the audit log.
+type auditRecord struct {
+	Time         string `json:"time"`    // Start of the command, RFC 3339
+	Command      string `json:"command"` // ADD or DEL
+	ContainerID  string `json:"containerId"`
+	IfName       string `json:"ifName"`
+	PodName      string `json:"podName,omitempty"`
+	PodNamespace string `json:"podNamespace,omitempty"`
+	Network      string `json:"network,omitempty"`
+	Engine       string `json:"engine,omitempty"` // Host engine, as resolved for the attachment
+	Result       string `json:"result"`           // "success" or "failure"
+	Error        string `json:"error,omitempty"`
+	DurationMs   int64  `json:"durationMs"`
+
+	path  string
+	start time.Time
+}
+
+//
+// Local functions
+//
+
+// validateAuditLog() - The audit log is a file on the host.
+func validateAuditLog(netConf *usrsptypes.NetConf) error {
+	if netConf.AuditLog == "" {
+		return nil
+	}
+	return usrsptypes.ValidatePath("auditLog", netConf.AuditLog)
+}
+
+// startAudit() - Start the record of a command, written by finish(). The
+//  configuration is read from the arguments, or else from the attachment
+//  data (like DEL does), nil is returned without an audit log. The engine
+//  is read from the attachment data, before DEL removes it.
+func startAudit(command string, args *skel.CmdArgs) *auditRecord {
+	info, infoErr := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+
+	netConf, err := loadNetConf(args.StdinData)
+	if err != nil && infoErr == nil && len(info.AddConf) != 0 {
+		netConf, err = loadNetConf(info.AddConf)
+	}
+	if err != nil || netConf.AuditLog == "" || validateAuditLog(netConf) != nil {
+		return nil
+	}
+
+	record := &auditRecord{
+		Command:     command,
+		ContainerID: args.ContainerID,
+		IfName:      args.IfName,
+		Network:     netConf.Name,
+		Engine:      netConf.HostConf.Engine,
+		path:        netConf.AuditLog,
+		start:       time.Now(),
+	}
+	record.Time = record.start.UTC().Format(time.RFC3339Nano)
+
+	if k8sArgs, err := usrsptypes.LoadK8sArgs(args); err == nil {
+		record.PodName = string(k8sArgs.K8S_POD_NAME)
+		record.PodNamespace = string(k8sArgs.K8S_POD_NAMESPACE)
+	}
+
+	if infoErr == nil && info.Engine != "" {
+		record.Engine = info.Engine
+	}
+
+	return record
+}
+
+// finish() - Complete the record with the result of the command and append
+//  it to the audit log. Deferred by cmdAdd() and cmdDel(), after the panic
+//  is recovered.
+func (record *auditRecord) finish(cmdErr *error) {
+	if record == nil {
+		return
+	}
+
+	record.DurationMs = int64(time.Since(record.start) / time.Millisecond)
+	record.Result = "success"
+	if *cmdErr != nil {
+		record.Result = "failure"
+		record.Error = (*cmdErr).Error()
+	}
+
+	// The engine resolved by ADD (like with engine auto).
+	if info, err := usrspdb.GetAttachment(record.ContainerID, record.IfName); err == nil && info.Engine != "" {
+		record.Engine = info.Engine
+	}
+
+	if err := record.write(); err != nil {
+		logrus.WithField("step", "audit").Errorf("Failed to write the audit record of %s to %s: %v",
+			record.Command, record.path, err)
+	}
+}
+
+// write() - Append the record to the audit log, as a single write.
+func (record *auditRecord) write() error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("ERROR: serializing audit record: %v", err)
+	}
+
+	file, err := os.OpenFile(record.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Engine capabilities: Each engine lists the features of the host section
+// it implements. The features requested by the configuration are checked
+// against the host engine before anything is created, and all the
+// unsupported ones are reported at once, with the engines supporting them.
+// Running the plugin with the "capabilities" argument prints the matrix of
+// the features supported by each engine.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Billy99/user-space-net-plugin/cniovs/cniovs"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Types
+//
+
+type engineEntry struct {
+	name   string
+	engine usrsptypes.UsrSpCni
+}
+
+//
+// Constants
+//
+
+// Engines of the host section, in the order they are listed.
+var engines = []engineEntry{
+	{"vpp", cnivpp.CniVpp{}},
+	{"ovs-dpdk", cniovs.CniOvs{}},
+}
+
+//
+// Local Functions
+//
+
+// findEngine() - Engine with the given name, or nil if unknown.
+func findEngine(name string) usrsptypes.UsrSpCni {
+	for _, entry := range engines {
+		if entry.name == name {
+			return entry.engine
+		}
+	}
+	return nil
+}
+
+// hasCapability() - Whether the engine implements the feature.
+func hasCapability(engine usrsptypes.UsrSpCni, capability string) bool {
+	for _, supported := range engine.Capabilities() {
+		if supported == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// getSupportingEngines() - Names of the engines implementing the feature.
+func getSupportingEngines(capability string) []string {
+	var names []string
+	for _, entry := range engines {
+		if hasCapability(entry.engine, capability) {
+			names = append(names, entry.name)
+		}
+	}
+	return names
+}
+
+// validateCapabilities() - Make sure the host engine implements all the
+//  features requested in the host section. The error lists each missing
+//  feature with the engines implementing it. An unknown engine is reported
+//  later, when the interface is added.
+func validateCapabilities(netConf *usrsptypes.NetConf) error {
+	engine := findEngine(netConf.HostConf.Engine)
+	if engine == nil {
+		return nil
+	}
+
+	var unsupported []string
+	for _, capability := range usrsptypes.GetRequestedCapabilities(netConf) {
+		if hasCapability(engine, capability) {
+			continue
+		}
+
+		if names := getSupportingEngines(capability); len(names) != 0 {
+			unsupported = append(unsupported,
+				fmt.Sprintf("%s (supported by %s)", capability, strings.Join(names, ", ")))
+		} else {
+			unsupported = append(unsupported,
+				fmt.Sprintf("%s (not supported by any engine)", capability))
+		}
+	}
+
+	if len(unsupported) != 0 {
+		return usrsptypes.NewEngineNotSupportedError(netConf.HostConf.Engine, strings.Join(unsupported, "; "))
+	}
+
+	return nil
+}
+
+// printCapabilities() - Print the matrix of the features supported by each
+//  engine, one feature per line.
+func printCapabilities(w io.Writer) {
+	width := 0
+	for _, capability := range usrsptypes.Capabilities {
+		if len(capability) > width {
+			width = len(capability)
+		}
+	}
+
+	fmt.Fprintf(w, "%-*s", width, "FEATURE")
+	for _, entry := range engines {
+		fmt.Fprintf(w, "  %-*s", len(entry.name), entry.name)
+	}
+	fmt.Fprintln(w)
+
+	for _, capability := range usrsptypes.Capabilities {
+		fmt.Fprintf(w, "%-*s", width, capability)
+		for _, entry := range engines {
+			mark := "-"
+			if hasCapability(entry.engine, capability) {
+				mark = "x"
+			}
+			fmt.Fprintf(w, "  %-*s", len(entry.name), mark)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestValidateCapabilities(t *testing.T) {
+	tests := []struct {
+		name        string
+		engine      string
+		ifType      string
+		netType     string
+		shg         int
+		wantErr     bool
+		wantMessage string
+	}{
+		{"vpp memif", "vpp", "memif", "interface", 0, false, ""},
+		{"vpp shg", "vpp", "memif", "bridge", 3, false, ""},
+		{"ovs vhostuser", "ovs-dpdk", "vhostuser", "", 0, false, ""},
+		{"ovs memif", "ovs-dpdk", "memif", "", 0, true, "memif (supported by vpp)"},
+		// All the missing features are reported at once.
+		{"ovs shg", "ovs-dpdk", "vhostuser", "bridge", 3, true, "bridge (supported by vpp); shg (supported by vpp)"},
+		{"unknown engine", "linux", "memif", "", 0, false, ""},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = test.engine
+		netConf.HostConf.IfType = test.ifType
+		netConf.HostConf.NetType = test.netType
+		netConf.HostConf.BridgeConf.Shg = test.shg
+
+		err := validateCapabilities(netConf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validateCapabilities() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil && strings.Contains(err.Error(), test.wantMessage) == false {
+			t.Errorf("%s: validateCapabilities() error = %v, want %q", test.name, err, test.wantMessage)
+		}
+	}
+}
+
+func TestPrintCapabilities(t *testing.T) {
+	var output bytes.Buffer
+	printCapabilities(&output)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != len(usrsptypes.Capabilities)+1 {
+		t.Fatalf("printCapabilities() printed %d lines, want %d", len(lines), len(usrsptypes.Capabilities)+1)
+	}
+
+	header := strings.Fields(lines[0])
+	if len(header) != len(engines)+1 || header[0] != "FEATURE" {
+		t.Errorf("printCapabilities() header = %q", lines[0])
+	}
+
+	for i, capability := range usrsptypes.Capabilities {
+		fields := strings.Fields(lines[i+1])
+		if len(fields) != len(engines)+1 || fields[0] != capability {
+			t.Errorf("printCapabilities() line of %s = %q", capability, lines[i+1])
+			continue
+		}
+		for j, entry := range engines {
+			if want := hasCapability(entry.engine, capability); (fields[j+1] == "x") != want {
+				t.Errorf("printCapabilities() %s of %s = %s, want %v", capability, entry.name, fields[j+1], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// CHECK: The vendored skel predates the CHECK command, so main() runs it
+// before handing the other commands to skel. CHECK fails if the attachment
+// was not added. With the vpp engine, the host interface is read back from
+// VPP and compared with the configuration: the admin state, the MAC address
+// (of a memif, if set in the configuration) and the addresses programmed on the host
+// interface. The error lists every mismatch. The MTU is read but not
+// compared, the vpp engine only uses it to size the memif buffers.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Local functions
+//
+
+func cmdCheck(args *skel.CmdArgs) (err error) {
+	defer recoverPanic("CHECK", &err, nil)
+
+	err = checkAttachment(args)
+	if err != nil {
+		logError("CHECK", err)
+	}
+	return err
+}
+
+// checkAttachment() - Make sure the attachment exists and, with the vpp
+//  engine, that its host interface matches the configuration.
+func checkAttachment(args *skel.CmdArgs) error {
+	netConf, err := loadNetConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	err = setupLogging(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = resolveEngine(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = applyEngineDefaults(netConf)
+	if err != nil {
+		return err
+	}
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return fmt.Errorf("ERROR: Attachment %s/%s not found: %v", args.ContainerID, args.IfName, err)
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		logrus.WithField("step", "CHECK").Debugf("Engine %s, only the attachment is checked", netConf.HostConf.Engine)
+		return nil
+	}
+
+	actual, err := cnivpp.CniVppGetInterfaceConfig(args)
+	if err != nil {
+		return err
+	}
+
+	// The plugin does not program an unmanaged interface, only its presence
+	// is checked.
+	if info.Unmanaged {
+		return nil
+	}
+
+	mismatches := diffInterfaceConfig(getExpectedInterfaceConfig(netConf, &info), actual)
+	if len(mismatches) != 0 {
+		return fmt.Errorf("ERROR: Host interface %d does not match the configuration: %s",
+			info.SwIfIndex, strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+// getExpectedInterfaceConfig() - Configuration of the host interface derived
+//  from the NetConf and the addresses saved by ADD. An empty Mac, Mtu 0 or
+//  nil Addresses are not compared.
+func getExpectedInterfaceConfig(netConf *usrsptypes.NetConf, info *usrspdb.AttachmentInfo) *cnivpp.CniVppInterfaceConfig {
+	expected := &cnivpp.CniVppInterfaceConfig{
+		Addresses: info.HostAddresses,
+		AdminUp:   usrsptypes.IsAdminUp(&netConf.HostConf),
+	}
+
+	// The vpp engine only sets the MAC address of a memif.
+	if netConf.HostConf.IfType == "memif" && netConf.HostConf.Mac != "" {
+		if hwAddr, err := net.ParseMAC(netConf.HostConf.Mac); err == nil {
+			expected.Mac = hwAddr.String()
+		}
+	}
+
+	return expected
+}
+
+// diffInterfaceConfig() - List the differences between the expected and the
+//  actual configuration of the host interface.
+func diffInterfaceConfig(expected *cnivpp.CniVppInterfaceConfig, actual *cnivpp.CniVppInterfaceConfig) []string {
+	var mismatches []string
+
+	if expected.AdminUp != actual.AdminUp {
+		mismatches = append(mismatches, fmt.Sprintf("admin up %t, expected %t", actual.AdminUp, expected.AdminUp))
+	}
+	if expected.Mac != "" && expected.Mac != actual.Mac {
+		mismatches = append(mismatches, fmt.Sprintf("mac %s, expected %s", actual.Mac, expected.Mac))
+	}
+	if expected.Mtu != 0 && expected.Mtu != actual.Mtu {
+		mismatches = append(mismatches, fmt.Sprintf("mtu %d, expected %d", actual.Mtu, expected.Mtu))
+	}
+	for _, address := range expected.Addresses {
+		if containsString(actual.Addresses, address) == false {
+			mismatches = append(mismatches, fmt.Sprintf("address %s missing", address))
+		}
+	}
+
+	return mismatches
+}
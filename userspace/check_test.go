@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestGetExpectedInterfaceConfig(t *testing.T) {
+	adminDown := false
+
+	tests := []struct {
+		name        string
+		ifType      string
+		mac         string
+		adminUp     *bool
+		wantMac     string
+		wantAdminUp bool
+	}{
+		{"memif", "memif", "", nil, "", true},
+		// The MAC address is normalized as VPP reports it.
+		{"memif mac", "memif", "02:FE:01:02:03:04", nil, "02:fe:01:02:03:04", true},
+		{"vhostuser mac", "vhostuser", "02:fe:01:02:03:04", nil, "", true},
+		{"invalid mac", "memif", "02:fe", nil, "", true},
+		{"admin down", "memif", "", &adminDown, "", false},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.IfType = test.ifType
+		netConf.HostConf.Mac = test.mac
+		netConf.HostConf.AdminUp = test.adminUp
+		info := &usrspdb.AttachmentInfo{HostAddresses: []string{"10.1.1.1/24"}}
+
+		expected := getExpectedInterfaceConfig(netConf, info)
+		if expected.Mac != test.wantMac || expected.AdminUp != test.wantAdminUp || expected.Mtu != 0 {
+			t.Errorf("%s: getExpectedInterfaceConfig() = %+v, want mac %q admin up %v", test.name, expected, test.wantMac, test.wantAdminUp)
+		}
+		if len(expected.Addresses) != 1 || expected.Addresses[0] != "10.1.1.1/24" {
+			t.Errorf("%s: getExpectedInterfaceConfig() addresses = %v", test.name, expected.Addresses)
+		}
+	}
+}
+
+func TestDiffInterfaceConfig(t *testing.T) {
+	expected := &cnivpp.CniVppInterfaceConfig{
+		Mac:       "02:fe:01:02:03:04",
+		Addresses: []string{"10.1.1.1/24", "2001:db8::1/64"},
+		AdminUp:   true,
+	}
+
+	tests := []struct {
+		name   string
+		actual cnivpp.CniVppInterfaceConfig
+		want   []string
+	}{
+		{"match", cnivpp.CniVppInterfaceConfig{Mtu: 9000, Mac: "02:fe:01:02:03:04",
+			Addresses: []string{"2001:db8::1/64", "10.1.1.1/24", "10.9.9.9/32"}, AdminUp: true}, nil},
+		{"admin down", cnivpp.CniVppInterfaceConfig{Mac: "02:fe:01:02:03:04",
+			Addresses: []string{"10.1.1.1/24", "2001:db8::1/64"}}, []string{"admin up false, expected true"}},
+		// Every mismatch is listed.
+		{"all", cnivpp.CniVppInterfaceConfig{Mac: "02:fe:0a:0b:0c:0d", Addresses: []string{"10.1.1.1/24"}},
+			[]string{"admin up false, expected true", "mac 02:fe:0a:0b:0c:0d, expected 02:fe:01:02:03:04",
+				"address 2001:db8::1/64 missing"}},
+	}
+
+	for _, test := range tests {
+		got := diffInterfaceConfig(expected, &test.actual)
+		if strings.Join(got, "; ") != strings.Join(test.want, "; ") {
+			t.Errorf("%s: diffInterfaceConfig() = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// The MTU is only compared when expected.
+	mtu := &cnivpp.CniVppInterfaceConfig{Mtu: 1500}
+	if got := diffInterfaceConfig(mtu, &cnivpp.CniVppInterfaceConfig{Mtu: 9000}); len(got) != 1 {
+		t.Errorf("diffInterfaceConfig() of the MTU = %q, want one mismatch", got)
+	}
+}
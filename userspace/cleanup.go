@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Cleanup: Running the plugin as "userspace cleanup" lists the state files
+// which are corrupt (empty, or not valid JSON), which make the commands
+// needing them fail with CNI error code 104. With --force, they are
+// removed: what they described has to be cleaned up by hand.
+//
+// The attachments written by another build of the plugin (see
+// usrsptypes/version.go) are listed too, after an upgrade or when builds
+// are mixed on a node. They are valid and never removed.
+//
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+
+	"github.com/Billy99/user-space-net-plugin/cniovs/ovsdb"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/vppdb"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Local Functions
+//
+
+// runCleanup() - Print the corrupt state files, and remove them with
+//  --force.
+func runCleanup(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	force := flags.Bool("force", false, "remove the corrupt state files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dirs := append(usrspdb.GetStateDirs(), vppdb.GetStateDir(), ovsdb.GetStateDir())
+	for _, dir := range dirs {
+		corrupt, err := usrsptypes.FindCorruptStateFiles(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range corrupt {
+			if *force == false {
+				fmt.Fprintf(w, "corrupt: %s\n", path)
+				continue
+			}
+			if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			fmt.Fprintf(w, "removed: %s\n", path)
+		}
+	}
+
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+	for _, info := range attachments {
+		if info.PluginVersion == usrsptypes.Version {
+			continue
+		}
+		version := info.PluginVersion
+		if version == "" {
+			version = "unknown"
+		}
+		fmt.Fprintf(w, "other version: %s-%s (network %s) written by %s\n",
+			info.ContainerID, info.IfName, getListValue(info.Network), version)
+	}
+
+	return nil
+}
+
+// checkCorruptState() - A corrupt state file fails the command with its
+//  own CNI error code, pointing at the cleanup.
+func checkCorruptState(err error) error {
+	if errors.Is(err, usrsptypes.ErrCorruptState) == false {
+		return err
+	}
+
+	return &cnitypes.Error{
+		Code:    errCodeCorruptState,
+		Msg:     err.Error(),
+		Details: "run \"userspace cleanup --force\" to remove the corrupt state files",
+	}
+}
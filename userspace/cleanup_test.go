@@ -0,0 +1,53 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestCheckCorruptState(t *testing.T) {
+	corrupt := &usrsptypes.CorruptStateError{Path: "/var/lib/cni/usrspcni/data/c1-net1.json"}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode uint
+	}{
+		{"no error", nil, 0},
+		{"other error", errors.New("ERROR: failed"), 0},
+		{"corrupt", corrupt, errCodeCorruptState},
+		{"corrupt with stack", &usrsptypes.StackError{Err: corrupt}, errCodeCorruptState},
+	}
+
+	for _, test := range tests {
+		err := checkCorruptState(test.err)
+		cniErr, ok := err.(*cnitypes.Error)
+		if test.wantCode == 0 {
+			if err != test.err {
+				t.Errorf("%s: checkCorruptState() = %v, want %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if ok == false || cniErr.Code != test.wantCode || cniErr.Msg != corrupt.Error() {
+			t.Errorf("%s: checkCorruptState() = %#v, want code %d", test.name, err, test.wantCode)
+		}
+	}
+}
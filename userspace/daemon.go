@@ -0,0 +1,328 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Daemon: Running the plugin as "userspace daemon --socket <path>" starts
+// a long running helper, which keeps the connection to VPP open between
+// commands. When its socket exists, each invocation of the plugin forwards
+// the command (the skel.CmdArgs and the environment) as JSON over the unix
+// socket, and prints what the daemon returns. If the daemon can't be
+// reached, or the command can't be sent, the command is executed in the
+// invocation itself, so a daemon that is down never breaks pod networking.
+// Once sent, the command is never executed again in process, as the daemon
+// may still execute it: without an answer, the invocation fails.
+//
+// The daemon executes one command at a time, in its main thread, with the
+// environment of the invocation. A DEL abandoned on delTimeout is waited
+// for before the next command.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+)
+
+//
+// Constants
+//
+
+// Socket of the daemon, if USERSPACE_DAEMON_SOCKET is not set.
+const defaultDaemonSocket = "/run/usrspcni.sock"
+
+// Time to connect to the daemon before executing the command in process.
+const daemonDialTimeout = time.Second
+
+// Time the daemon waits for a request once connected.
+const daemonRequestTimeout = 10 * time.Second
+
+// Time an invocation waits for the answer of the daemon on top of the
+// longest the command may take, see getDaemonReplyTimeout().
+const daemonReplyMargin = 30 * time.Second
+
+//
+// Types
+//
+
+// Command forwarded to the daemon, the skel.CmdArgs of the invocation.
+type daemonRequest struct {
+	Command     string   `json:"command"` // CNI_COMMAND {ADD|DEL}
+	ContainerID string   `json:"containerId"`
+	Netns       string   `json:"netns"`
+	IfName      string   `json:"ifName"`
+	Args        string   `json:"args"`
+	Path        string   `json:"path"`
+	StdinData   []byte   `json:"stdinData"`
+	Env         []string `json:"env"` // Environment of the invocation, for the IPAM plugin and USERSPACE_* settings
+}
+
+// Answer of the daemon, what the invocation prints.
+type daemonResponse struct {
+	Output []byte          `json:"output"`          // Written to stdout by the command, the Result
+	Error  *cnitypes.Error `json:"error,omitempty"` // Error of the command
+}
+
+//
+// Local Functions
+//
+
+// getDaemonSocket() - Socket of the daemon, set with the
+//  USERSPACE_DAEMON_SOCKET environment variable.
+func getDaemonSocket() string {
+	if socket, ok := os.LookupEnv("USERSPACE_DAEMON_SOCKET"); ok && socket != "" {
+		return socket
+	}
+	return defaultDaemonSocket
+}
+
+// forwardToDaemon() - Have the daemon execute the command of the
+//  invocation. Returns false if the command must be executed in process:
+//  the command is not ADD or DEL, there is no daemon, or the command could
+//  not be sent. Otherwise, the output of the command is printed and its
+//  error returned, an error too if the daemon did not answer.
+func forwardToDaemon(stdinData []byte) (bool, *cnitypes.Error) {
+	command := os.Getenv("CNI_COMMAND")
+	if command != "ADD" && command != "DEL" {
+		return false, nil
+	}
+
+	socket := getDaemonSocket()
+	if _, err := os.Stat(socket); err != nil {
+		return false, nil
+	}
+
+	conn, err := net.DialTimeout("unix", socket, daemonDialTimeout)
+	if err != nil {
+		logrus.Warningf("Daemon %s not reachable, executing %s in process: %v", socket, command, err)
+		return false, nil
+	}
+	defer conn.Close()
+
+	// A daemon that is stuck must not hang the runtime, the command then
+	// fails.
+	conn.SetDeadline(time.Now().Add(getDaemonReplyTimeout(command, stdinData)))
+
+	args := getCmdArgsFromEnv(stdinData)
+	req := daemonRequest{
+		Command:     command,
+		ContainerID: args.ContainerID,
+		Netns:       args.Netns,
+		IfName:      args.IfName,
+		Args:        args.Args,
+		Path:        args.Path,
+		StdinData:   args.StdinData,
+		Env:         os.Environ(),
+	}
+	if err = json.NewEncoder(conn).Encode(&req); err != nil {
+		logrus.Warningf("Failed to send %s to daemon %s, executing in process: %v", command, socket, err)
+		return false, nil
+	}
+
+	var resp daemonResponse
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		logrus.Warningf("No answer to %s from daemon %s: %v", command, socket, err)
+		return true, &cnitypes.Error{
+			Code:    errCodeCommandFailed,
+			Msg:     fmt.Sprintf("ERROR: No answer to %s from daemon %s", command, socket),
+			Details: err.Error(),
+		}
+	}
+
+	os.Stdout.Write(resp.Output)
+	return true, resp.Error
+}
+
+// getDaemonReplyTimeout() - Time to wait for the daemon to answer: the
+//  longest the command may take, from the timeouts of the configuration,
+//  plus daemonReplyMargin. ADD may wait on each IPAM attempt, the socket,
+//  the memif link and the connectivity probe. DEL waits for delTimeout, or
+//  on the IPAM plugin without it.
+func getDaemonReplyTimeout(command string, stdinData []byte) time.Duration {
+	netConf, err := loadNetConf(stdinData)
+	if err != nil {
+		// The command fails in the daemon as in process.
+		return daemonReplyMargin
+	}
+
+	if command == "DEL" {
+		if netConf.DelTimeout > 0 {
+			return time.Duration(netConf.DelTimeout)*time.Second + daemonReplyMargin
+		}
+		return getIpamTimeout(netConf) + daemonReplyMargin
+	}
+
+	timeout := time.Duration(netConf.IPAM.Retries+1) * getIpamTimeout(netConf)
+	timeout += time.Duration(netConf.WaitForSocket) * time.Second
+	timeout += getLinkWaitTimeout(netConf)
+	if netConf.VerifyConnectivity {
+		timeout += getProbeTimeout(netConf)
+	}
+	return timeout + daemonReplyMargin
+}
+
+// runDaemon() - Serve the commands forwarded on the socket until the
+//  daemon is terminated.
+func runDaemon(args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	socket := flags.String("socket", getDaemonSocket(), "unix socket the commands are forwarded on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// The connections to VPP and to the API Server are the reason to be of
+	// the daemon.
+	vppinfra.SetPersistent(true)
+	cacheKubeClients = true
+
+	// Left by a daemon that did not exit cleanly.
+	if info, err := os.Stat(*socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(*socket)
+	}
+
+	listener, err := net.Listen("unix", *socket)
+	if err != nil {
+		return fmt.Errorf("ERROR: Failed to listen on %s: %v", *socket, err)
+	}
+	if err = os.Chmod(*socket, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	// Closing the listener removes the socket, so invocations stop
+	// forwarding to the daemon.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	stopping := make(chan struct{})
+	go func() {
+		<-signals
+		close(stopping)
+		listener.Close()
+	}()
+
+	logrus.Infof("Daemon listening on %s", *socket)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stopping:
+				return nil
+			default:
+				return err
+			}
+		}
+		serveDaemonConn(conn)
+	}
+}
+
+// serveDaemonConn() - Read the command on the connection, execute it and
+//  send the answer.
+func serveDaemonConn(conn net.Conn) {
+	defer conn.Close()
+
+	var req daemonRequest
+	conn.SetReadDeadline(time.Now().Add(daemonRequestTimeout))
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		logrus.Warningf("Daemon failed to read request: %v", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	savedEnv := os.Environ()
+	setEnv(req.Env)
+	defer setEnv(savedEnv)
+	defer clearRequestFields()
+
+	resp := executeDaemonRequest(&req)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logrus.Warningf("Daemon failed to answer %s for %s: %v", req.Command, req.ContainerID, err)
+	}
+
+	// A DEL abandoned on delTimeout still runs in the environment of the
+	// request, the next command must not change it under the cleanup.
+	pendingDels.Wait()
+}
+
+// executeDaemonRequest() - Execute the command as skel would, capturing
+//  what it writes to stdout. The environment of the invocation is set by
+//  serveDaemonConn().
+func executeDaemonRequest(req *daemonRequest) *daemonResponse {
+	resp := &daemonResponse{}
+
+	args := &skel.CmdArgs{
+		ContainerID: req.ContainerID,
+		Netns:       req.Netns,
+		IfName:      req.IfName,
+		Args:        req.Args,
+		Path:        req.Path,
+		StdinData:   req.StdinData,
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		resp.Error = &cnitypes.Error{Code: errCodeCommandFailed, Msg: err.Error()}
+		return resp
+	}
+	output := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		output <- data
+	}()
+
+	savedStdout := os.Stdout
+	os.Stdout = writer
+	switch req.Command {
+	case "ADD":
+		err = cmdAdd(args)
+	case "DEL":
+		err = cmdDel(args)
+	default:
+		err = fmt.Errorf("unknown CNI_COMMAND: %v", req.Command)
+	}
+	os.Stdout = savedStdout
+	writer.Close()
+	resp.Output = <-output
+	reader.Close()
+
+	if err != nil {
+		resp.Error = toCniError(err)
+	}
+
+	return resp
+}
+
+// setEnv() - Replace the environment of the process.
+func setEnv(env []string) {
+	os.Clearenv()
+	for _, entry := range env {
+		if kv := strings.SplitN(entry, "=", 2); len(kv) == 2 {
+			os.Setenv(kv[0], kv[1])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDaemonReplyTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		conf    string
+		want    time.Duration
+	}{
+		{"ADD defaults", "ADD", `{"name":"net1","type":"userspace"}`,
+			defaultIpamTimeout*time.Second + defaultLinkWaitTimeout*time.Millisecond + daemonReplyMargin},
+		{"ADD retries and waits", "ADD", `{"name":"net1","type":"userspace","ipam":{"type":"host-local","timeout":10,"retries":2},"waitForSocket":20,"verifyConnectivity":true,"probeTimeout":3}`,
+			3*10*time.Second + 20*time.Second + defaultLinkWaitTimeout*time.Millisecond + 3*time.Second + daemonReplyMargin},
+		{"DEL delTimeout", "DEL", `{"name":"net1","type":"userspace","delTimeout":15}`,
+			15*time.Second + daemonReplyMargin},
+		{"DEL without delTimeout", "DEL", `{"name":"net1","type":"userspace","ipam":{"type":"host-local","timeout":10}}`,
+			10*time.Second + daemonReplyMargin},
+		{"invalid config", "ADD", `{`, daemonReplyMargin},
+	}
+
+	for _, test := range tests {
+		got := getDaemonReplyTimeout(test.command, []byte(test.conf))
+		if got != test.want {
+			t.Errorf("%s: getDaemonReplyTimeout() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Engine auto: In a cluster where some nodes run VPP and others OVS-DPDK,
+// one configuration can set the host engine to "auto". The engines of
+// engineOrder (vpp, then ovs-dpdk, by default) are probed in order, and
+// the first one reachable on the node is used. The engine is saved with
+// the attachment, so a repeated ADD and the DEL use the same engine even
+// if another one has become reachable since.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+
+// Host Engine selecting the engine reachable on the node.
+const autoEngine = "auto"
+
+// Engines probed with engine auto if engineOrder is not provided.
+var defaultEngineOrder = []string{"vpp", "ovs-dpdk"}
+
+//
+// Local Functions
+//
+
+// resolveEngine() - With engine auto, replace the host engine by the engine
+//  saved with the attachment, or else by the first engine of engineOrder
+//  which is reachable. A container engine auto follows the host engine.
+func resolveEngine(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	err := validateEngineOrder(netConf)
+	if err != nil {
+		return err
+	}
+
+	if netConf.HostConf.Engine != autoEngine {
+		if netConf.ContainerConf.Engine == autoEngine {
+			return fmt.Errorf("ERROR: Container Engine auto requires Host Engine auto, not %s", netConf.HostConf.Engine)
+		}
+		return nil
+	}
+
+	if info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName); err == nil && info.Engine != "" {
+		netConf.HostConf.Engine = info.Engine
+		logrus.Infof("Engine auto, using engine %s of the attachment", info.Engine)
+	} else {
+		netConf.HostConf.Engine, err = probeEngines(getEngineOrder(netConf))
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Engine auto, using engine %s reachable on the node", netConf.HostConf.Engine)
+	}
+
+	if netConf.ContainerConf.Engine == autoEngine {
+		netConf.ContainerConf.Engine = netConf.HostConf.Engine
+	}
+
+	return nil
+}
+
+// applyEngineDefaults() - Once the engines are resolved, merge the engines
+//  section into the host and container sections. The options checked when
+//  loading the configuration are checked again.
+func applyEngineDefaults(netConf *usrsptypes.NetConf) error {
+	for name := range netConf.Engines {
+		if findEngine(name) == nil {
+			return fmt.Errorf("ERROR: Unknown engine %s in engines", name)
+		}
+	}
+
+	err := netConf.ApplyEngineDefaults()
+	if err != nil {
+		return err
+	}
+
+	err = validateRxMode(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateLinkState(netConf)
+	if err != nil {
+		return err
+	}
+
+	return validateStaticRoutes(netConf)
+}
+
+// validateEngineOrder() - engineOrder lists known engines, once each, and
+//  is only used with engine auto.
+func validateEngineOrder(netConf *usrsptypes.NetConf) error {
+	if len(netConf.ContainerConf.EngineOrder) != 0 {
+		return fmt.Errorf("ERROR: engineOrder is only supported in the host section")
+	}
+
+	engineOrder := netConf.HostConf.EngineOrder
+	if len(engineOrder) == 0 {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != autoEngine {
+		return fmt.Errorf("ERROR: engineOrder requires Host Engine auto, not %s", netConf.HostConf.Engine)
+	}
+
+	for i, name := range engineOrder {
+		if findEngine(name) == nil {
+			return fmt.Errorf("ERROR: Unknown engine %s in engineOrder", name)
+		}
+		for _, previous := range engineOrder[:i] {
+			if previous == name {
+				return fmt.Errorf("ERROR: engine %s listed twice in engineOrder", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getEngineOrder() - Engines probed with engine auto, in order.
+func getEngineOrder(netConf *usrsptypes.NetConf) []string {
+	if len(netConf.HostConf.EngineOrder) != 0 {
+		return netConf.HostConf.EngineOrder
+	}
+	return defaultEngineOrder
+}
+
+// probeEngines() - First engine of the list which is reachable. If none
+//  is, the error lists the probe error of each engine.
+func probeEngines(names []string) (string, error) {
+	var probeErrs []string
+
+	for _, name := range names {
+		err := findEngine(name).Probe()
+		if err == nil {
+			return name, nil
+		}
+		logrus.Debugf("Engine auto, %s not reachable: %v", name, err)
+		probeErrs = append(probeErrs, fmt.Sprintf("%s: %v", name, err))
+	}
+
+	return "", fmt.Errorf("ERROR: Engine auto, no engine reachable on the node: %s", strings.Join(probeErrs, "; "))
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+// fakeEngine - Engine whose probe returns probeErr, or panics. The other
+//  methods are not implemented.
+type fakeEngine struct {
+	usrsptypes.UsrSpCni
+	probeErr   error
+	probePanic bool
+}
+
+func (e fakeEngine) Probe() error {
+	if e.probePanic {
+		panic("fake engine probe")
+	}
+	return e.probeErr
+}
+
+// useFakeEngines() - Replace the engines by fake ones, reachable unless
+//  listed in unreachable. The returned function restores them.
+func useFakeEngines(unreachable ...string) func() {
+	savedEngines := engines
+
+	engines = nil
+	for _, name := range []string{"vpp", "ovs-dpdk"} {
+		engine := fakeEngine{}
+		for _, down := range unreachable {
+			if down == name {
+				engine.probeErr = errors.New(name + " down")
+			}
+		}
+		engines = append(engines, engineEntry{name, engine})
+	}
+
+	return func() {
+		engines = savedEngines
+	}
+}
+
+func TestProbeEngines(t *testing.T) {
+	tests := []struct {
+		name        string
+		unreachable []string
+		order       []string
+		wantEngine  string
+		wantErr     string
+	}{
+		{"both reachable", nil, defaultEngineOrder, "vpp", ""},
+		{"vpp down", []string{"vpp"}, defaultEngineOrder, "ovs-dpdk", ""},
+		{"ovs first", nil, []string{"ovs-dpdk", "vpp"}, "ovs-dpdk", ""},
+		{"only vpp probed", []string{"vpp"}, []string{"vpp"}, "", "vpp: vpp down"},
+		{"none reachable", []string{"vpp", "ovs-dpdk"}, defaultEngineOrder, "", "vpp: vpp down; ovs-dpdk: ovs-dpdk down"},
+	}
+
+	for _, test := range tests {
+		restore := useFakeEngines(test.unreachable...)
+
+		engine, err := probeEngines(test.order)
+		if (err != nil) != (test.wantErr != "") {
+			t.Errorf("%s: probeEngines() error = %v, want %q", test.name, err, test.wantErr)
+		} else if err != nil && strings.HasSuffix(err.Error(), test.wantErr) == false {
+			t.Errorf("%s: probeEngines() error = %v, want %q", test.name, err, test.wantErr)
+		}
+		if engine != test.wantEngine {
+			t.Errorf("%s: probeEngines() = %q, want %q", test.name, engine, test.wantEngine)
+		}
+
+		restore()
+	}
+}
+
+func TestResolveEngine(t *testing.T) {
+	restore := useFakeEngines("vpp")
+	defer restore()
+
+	tests := []struct {
+		name                string
+		hostEngine          string
+		containerEngine     string
+		engineOrder         []string
+		wantHostEngine      string
+		wantContainerEngine string
+		wantErr             bool
+	}{
+		{"vpp", "vpp", "vpp", nil, "vpp", "vpp", false},
+		{"auto", "auto", "", nil, "ovs-dpdk", "", false},
+		{"container auto", "auto", "auto", nil, "ovs-dpdk", "ovs-dpdk", false},
+		{"container auto only", "vpp", "auto", nil, "", "", true},
+		{"engine order", "auto", "", []string{"ovs-dpdk"}, "ovs-dpdk", "", false},
+		{"engine order without auto", "vpp", "", []string{"vpp"}, "", "", true},
+		{"unknown engine in order", "auto", "", []string{"dpdk"}, "", "", true},
+		{"engine twice in order", "auto", "", []string{"ovs-dpdk", "ovs-dpdk"}, "", "", true},
+		{"none reachable", "auto", "", []string{"vpp"}, "", "", true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = test.hostEngine
+		netConf.HostConf.EngineOrder = test.engineOrder
+		netConf.ContainerConf.Engine = test.containerEngine
+
+		// No attachment saved, the engine is probed.
+		args := &skel.CmdArgs{ContainerID: "usrsp-test-unknown", IfName: "net1"}
+
+		err := resolveEngine(netConf, args)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: resolveEngine() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if netConf.HostConf.Engine != test.wantHostEngine || netConf.ContainerConf.Engine != test.wantContainerEngine {
+			t.Errorf("%s: resolveEngine() engines = %q/%q, want %q/%q", test.name,
+				netConf.HostConf.Engine, netConf.ContainerConf.Engine, test.wantHostEngine, test.wantContainerEngine)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Kernel interfaces: The kernel sidecar (veth) and the punt tap are created
+// in the container netns. A link left with the same name (by a crashed ADD
+// or another plugin) makes the create fail once VPP is configured, so the
+// names are checked before anything is created. The links created by the
+// plugin carry the attachment in their alias: a link with that alias, or
+// recorded in the state of the attachment, is left over from an earlier
+// ADD of the same attachment and is replaced. Any other link fails the ADD.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+
+// Attributes of RTM_NEWLINK holding the alternative names of a link (Linux
+// 5.5), not known to the vendored netlink.
+const iflaPropList = 52
+const iflaAltIfName = 53
+const nlaTypeMask = 0x3fff
+
+//
+// Local functions
+//
+
+// getKernelIfAlias() - Alias marking the kernel links of the attachment.
+func getKernelIfAlias(args *skel.CmdArgs) string {
+	return usrsptypes.GetIfNamePrefix() + args.ContainerID + "/" + args.IfName
+}
+
+// getKernelIfNames() - Kernel interfaces ADD creates in the container netns.
+func getKernelIfNames(netConf *usrsptypes.NetConf, args *skel.CmdArgs) []string {
+	var names []string
+
+	if netConf.KernelSidecar.Enable {
+		names = append(names, getSidecarIfName(netConf, args))
+	}
+	if netConf.HostConf.Engine == "vpp" && len(netConf.HostConf.PuntConf.Rules) != 0 {
+		names = append(names, cnivpp.CniVppGetPuntIfName(&netConf.HostConf.PuntConf))
+	}
+
+	return names
+}
+
+// checkKernelIfNames() - Before anything is created, make sure the kernel
+//  interfaces can be created in the container netns. A link of the
+//  attachment is deleted, to be created again, any other link fails.
+func checkKernelIfNames(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	names := getKernelIfNames(netConf, args)
+	if len(names) == 0 || args.Netns == "" {
+		return nil
+	}
+
+	// A crashed ADD may have saved the sidecar before the alias was set.
+	var savedNames []string
+	if info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName); err == nil && info.SidecarIfName != "" {
+		savedNames = append(savedNames, info.SidecarIfName)
+	}
+
+	alias := getKernelIfAlias(args)
+
+	err := ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		for _, name := range names {
+			link, err := netlink.LinkByName(name)
+			if err != nil {
+				// Not found, free to create
+				continue
+			}
+
+			if link.Attrs().Alias != alias && containsString(savedNames, name) == false {
+				altNames := "none"
+				if list := getLinkAltNames(link.Attrs().Index); len(list) != 0 {
+					altNames = strings.Join(list, ",")
+				}
+				return fmt.Errorf("ERROR: Interface %s already exists in the container netns (type %s, altname %s, alias %q), not created by this attachment",
+					name, link.Type(), altNames, link.Attrs().Alias)
+			}
+
+			logrus.Warningf("Replacing interface %s left in the container netns by an earlier ADD", name)
+			if err = netlink.LinkDel(link); err != nil {
+				return fmt.Errorf("ERROR: Failed to delete interface %s left by an earlier ADD: %v", name, err)
+			}
+		}
+		return nil
+	})
+
+	// Gone with the netns, the create fails with its own error.
+	if _, ok := err.(ns.NSPathNotExistErr); ok {
+		return nil
+	}
+	return err
+}
+
+// getLinkAltNames() - Alternative names (altname) of a link of the current
+//  netns. None when they can't be read, or on kernels without them.
+func getLinkAltNames(index int) []string {
+	var names []string
+
+	req := nl.NewNetlinkRequest(syscall.RTM_GETLINK, syscall.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(syscall.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, 0)
+	if err != nil || len(msgs) != 1 || len(msgs[0]) < msg.Len() {
+		return nil
+	}
+
+	attrs, err := nl.ParseRouteAttr(msgs[0][msg.Len():])
+	if err != nil {
+		return nil
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type&nlaTypeMask != iflaPropList {
+			continue
+		}
+		props, err := nl.ParseRouteAttr(attr.Value)
+		if err != nil {
+			return names
+		}
+		for _, prop := range props {
+			if prop.Attr.Type&nlaTypeMask == iflaAltIfName {
+				names = append(names, nl.BytesToString(prop.Value))
+			}
+		}
+	}
+
+	return names
+}
+
+// setKernelIfAlias() - Mark the punt tap, created in the container netns by
+//  VPP, as a link of the attachment. Best effort, a link without alias is
+//  only reported as a conflict by a later ADD.
+func setKernelIfAlias(args *skel.CmdArgs, name string) {
+	err := ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			return err
+		}
+		return netlink.LinkSetAlias(link, getKernelIfAlias(args))
+	})
+	if err != nil {
+		logrus.Warningf("Failed to set the alias of interface %s: %v", name, err)
+	}
+}
+
+// containsString() - Whether the list contains the string.
+func containsString(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+// newTestNetns() - Scratch netns for the tests creating links, skipped
+//  when not root. The returned function removes it.
+func newTestNetns(t *testing.T) (ns.NetNS, func()) {
+	if os.Getuid() != 0 {
+		t.Skip("creating a netns needs root")
+	}
+
+	netns, err := ns.NewNS()
+	if err != nil {
+		t.Skipf("NewNS(): %v", err)
+	}
+	return netns, func() { netns.Close() }
+}
+
+// addTestLink() - Create a dummy link in the netns, with the alias if not
+//  empty. Kernels without the dummy driver get an ifb link instead.
+func addTestLink(t *testing.T, netns ns.NetNS, name string, alias string) {
+	err := netns.Do(func(_ ns.NetNS) error {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		if err := netlink.LinkAdd(&netlink.Dummy{LinkAttrs: attrs}); err != nil {
+			if err = netlink.LinkAdd(&netlink.Ifb{LinkAttrs: attrs}); err != nil {
+				return err
+			}
+		}
+		if alias == "" {
+			return nil
+		}
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			return err
+		}
+		return netlink.LinkSetAlias(link, alias)
+	})
+	if err != nil {
+		t.Fatalf("addTestLink(%s): %v", name, err)
+	}
+}
+
+// delTestLink() - Delete the link from the netns, if it exists.
+func delTestLink(netns ns.NetNS, name string) {
+	netns.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			return err
+		}
+		return netlink.LinkDel(link)
+	})
+}
+
+// hasTestLink() - Whether the link exists in the netns.
+func hasTestLink(netns ns.NetNS, name string) bool {
+	err := netns.Do(func(_ ns.NetNS) error {
+		_, err := netlink.LinkByName(name)
+		return err
+	})
+	return err == nil
+}
+
+func TestGetKernelIfNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		engine        string
+		sidecar       bool
+		sidecarIfName string
+		puntIfName    string
+		puntRules     int
+		ifName        string
+		want          []string
+	}{
+		{"none", "vpp", false, "", "", 0, "net1", nil},
+		{"sidecar", "vpp", true, "", "", 0, "net1", []string{"net1-k"}},
+		{"sidecar name", "vpp", true, "side0", "", 0, "net1", []string{"side0"}},
+		// The sidecar name is kept within the kernel limit.
+		{"long ifname", "ovs-dpdk", true, "", "", 0, "net123456789abc", []string{"net123456789a-k"}},
+		{"punt", "vpp", false, "", "", 1, "net1", []string{"punt0"}},
+		{"punt name", "vpp", true, "", "bgp0", 2, "net1", []string{"net1-k", "bgp0"}},
+		{"punt without rules", "vpp", false, "", "bgp0", 0, "net1", nil},
+		{"punt not vpp", "ovs-dpdk", false, "", "", 1, "net1", nil},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = test.engine
+		netConf.KernelSidecar.Enable = test.sidecar
+		netConf.KernelSidecar.IfName = test.sidecarIfName
+		netConf.HostConf.PuntConf.IfName = test.puntIfName
+		netConf.HostConf.PuntConf.Rules = make([]usrsptypes.PuntRule, test.puntRules)
+		args := &skel.CmdArgs{ContainerID: "c1", IfName: test.ifName}
+
+		got := getKernelIfNames(netConf, args)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: getKernelIfNames() = %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: getKernelIfNames() = %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCheckKernelIfNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		sidecar bool
+		netns   string
+	}{
+		{"no interface", false, "/var/run/netns/usrsp-test-gone"},
+		{"no netns", true, ""},
+		// Gone with the netns, the create reports it.
+		{"netns gone", true, "/var/run/netns/usrsp-test-gone"},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = "vpp"
+		netConf.KernelSidecar.Enable = test.sidecar
+		args := &skel.CmdArgs{ContainerID: "usrsp-test-unknown", IfName: "net1", Netns: test.netns}
+
+		if err := checkKernelIfNames(netConf, args); err != nil {
+			t.Errorf("%s: checkKernelIfNames() error = %v", test.name, err)
+		}
+	}
+}
+
+func TestCheckKernelIfNamesExisting(t *testing.T) {
+	netns, cleanup := newTestNetns(t)
+	defer cleanup()
+
+	args := &skel.CmdArgs{ContainerID: "usrsp-test-unknown", IfName: "net1", Netns: netns.Path()}
+	netConf := &usrsptypes.NetConf{}
+	netConf.HostConf.Engine = "vpp"
+	netConf.KernelSidecar.Enable = true
+
+	// Left by an earlier ADD of the attachment, replaced.
+	addTestLink(t, netns, "net1-k", getKernelIfAlias(args))
+	if err := checkKernelIfNames(netConf, args); err != nil {
+		t.Errorf("link of the attachment: checkKernelIfNames() error = %v", err)
+	}
+	if hasTestLink(netns, "net1-k") {
+		t.Errorf("link of the attachment: not deleted")
+	}
+
+	// Of someone else, reported with its altname when it can be set.
+	addTestLink(t, netns, "net1-k", "")
+	altName := ""
+	cmd := exec.Command("ip", "-n", filepath.Base(netns.Path()), "link", "property", "add", "dev", "net1-k", "altname", "usrsp-test-alt")
+	if output, err := cmd.CombinedOutput(); err == nil {
+		altName = "usrsp-test-alt"
+	} else {
+		t.Logf("altname not set: %v %s", err, output)
+	}
+
+	err := checkKernelIfNames(netConf, args)
+	if err == nil {
+		t.Errorf("other link: checkKernelIfNames() no error")
+	} else if altName != "" && strings.Contains(err.Error(), "altname "+altName) == false {
+		t.Errorf("other link: checkKernelIfNames() error = %v, want altname %s", err, altName)
+	}
+	if hasTestLink(netns, "net1-k") == false {
+		t.Errorf("other link: deleted")
+	}
+}
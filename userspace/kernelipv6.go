@@ -0,0 +1,173 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Kernel IPv6: A new netns may have IPv6 disabled on its links
+// (net.ipv6.conf.default.disable_ipv6), so the kernel interfaces created in
+// the container netns (the kernel sidecar and the punt tap) get IPv6
+// enabled, with DAD, before an IPv6 address is added. The address can't be
+// used while it is tentative, so the ADD waits for DAD to complete, and
+// fails with the address if it does not in time or if it is a duplicate.
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+//
+// Constants
+//
+
+// Time to wait for DAD if dadTimeout is not provided, in seconds.
+const defaultDadTimeout = 5
+
+const dadPollInterval = 100 * time.Millisecond
+
+//
+// Local functions
+//
+
+// enableKernelIPv6() - Enable IPv6 on a link of the current netns, with
+//  DAD of its addresses.
+func enableKernelIPv6(ifName string) error {
+	settings := []struct {
+		name  string
+		value string
+	}{
+		{"disable_ipv6", "0"},
+		{"accept_dad", "1"},
+	}
+
+	// Written by path, interface names may contain dots.
+	for _, setting := range settings {
+		path := filepath.Join("/proc/sys/net/ipv6/conf", ifName, setting.name)
+		if err := ioutil.WriteFile(path, []byte(setting.value), 0644); err != nil {
+			return fmt.Errorf("failed to set %s to %s: %v", path, setting.value, err)
+		}
+	}
+
+	return nil
+}
+
+// addKernelAddress() - Add an address to a link of the current netns. For
+//  an IPv6 address, IPv6 is enabled on the link first, and DAD has to
+//  complete within the timeout.
+func addKernelAddress(link netlink.Link, ipNet *net.IPNet, dadTimeout time.Duration) error {
+	ifName := link.Attrs().Name
+	isIPv6 := ipNet.IP.To4() == nil
+
+	if isIPv6 {
+		if err := enableKernelIPv6(ifName); err != nil {
+			return err
+		}
+	}
+
+	if err := netlink.AddrAdd(link, &netlink.Addr{IPNet: ipNet}); err != nil {
+		return fmt.Errorf("failed to add address %s to %q: %v", ipNet.String(), ifName, err)
+	}
+
+	if isIPv6 {
+		return waitDad(link, ipNet, dadTimeout)
+	}
+	return nil
+}
+
+// waitDad() - Wait for the IPv6 address to no longer be tentative.
+func waitDad(link netlink.Link, ipNet *net.IPNet, timeout time.Duration) error {
+	ifName := link.Attrs().Name
+	deadline := time.Now().Add(timeout)
+
+	for {
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V6)
+		if err != nil {
+			return fmt.Errorf("failed to list the addresses of %q: %v", ifName, err)
+		}
+
+		tentative := false
+		for _, addr := range addrs {
+			if addr.IP.Equal(ipNet.IP) == false {
+				continue
+			}
+			if addr.Flags&syscall.IFA_F_DADFAILED != 0 {
+				return fmt.Errorf("ERROR: DAD failed for address %s on %q, duplicate address on the link", ipNet.String(), ifName)
+			}
+			tentative = addr.Flags&syscall.IFA_F_TENTATIVE != 0
+		}
+
+		if tentative == false {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ERROR: DAD did not complete within %v on %q, address %s still tentative", timeout, ifName, ipNet.String())
+		}
+		time.Sleep(dadPollInterval)
+	}
+}
+
+// addKernelGateway() - Add a default route via the gateway on a link of the
+//  current netns, IPv4 or IPv6 as the gateway.
+func addKernelGateway(link netlink.Link, gw net.IP) error {
+	dst := &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	if gw.To4() == nil {
+		dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+
+	err := netlink.RouteAdd(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       dst,
+		Gw:        gw,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add route via %s on %q: %v", gw.String(), link.Attrs().Name, err)
+	}
+
+	return nil
+}
+
+// getDadTimeout() - Time to wait for the DAD of the kernel sidecar address.
+func getDadTimeout(dadTimeout int) time.Duration {
+	if dadTimeout > 0 {
+		return time.Duration(dadTimeout) * time.Second
+	}
+	return defaultDadTimeout * time.Second
+}
+
+// enablePuntIPv6() - Enable IPv6 on the punt tap, created in the container
+//  netns by VPP, so the IPv6 control plane traffic punted to it is received.
+//  Best effort, nodes without IPv6 are left as they are.
+func enablePuntIPv6(args *skel.CmdArgs, name string) {
+	if _, err := os.Stat("/proc/sys/net/ipv6"); err != nil {
+		return
+	}
+
+	err := ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return enableKernelIPv6(name)
+	})
+	if err != nil {
+		logrus.Warningf("Failed to enable IPv6 on interface %s: %v", name, err)
+	}
+}
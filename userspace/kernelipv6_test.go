@@ -0,0 +1,99 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+func TestGetDadTimeout(t *testing.T) {
+	tests := []struct {
+		dadTimeout int
+		want       time.Duration
+	}{
+		{0, defaultDadTimeout * time.Second},
+		{1, time.Second},
+		{30, 30 * time.Second},
+		{-1, defaultDadTimeout * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := getDadTimeout(test.dadTimeout); got != test.want {
+			t.Errorf("getDadTimeout(%d) = %v, want %v", test.dadTimeout, got, test.want)
+		}
+	}
+}
+
+func TestAddKernelAddressIPv6(t *testing.T) {
+	if _, err := os.Stat("/proc/sys/net/ipv6"); err != nil {
+		t.Skip("no IPv6 on the node")
+	}
+	netns, cleanup := newTestNetns(t)
+	defer cleanup()
+
+	// The sidecar veth, as addKernelSidecar() creates it, with both ends in
+	// the scratch netns and IPv6 disabled on new links.
+	err := netns.Do(func(_ ns.NetNS) error {
+		err := ioutil.WriteFile("/proc/sys/net/ipv6/conf/default/disable_ipv6", []byte("1"), 0644)
+		if err != nil {
+			return err
+		}
+		if _, _, err = ip.SetupVeth("net1-k", 0, netns); err != nil {
+			return err
+		}
+
+		link, err := netlink.LinkByName("net1-k")
+		if err != nil {
+			return err
+		}
+		ipNet, err := parseSidecarAddress("fd00:10::2/64")
+		if err != nil {
+			return err
+		}
+		if err = addKernelAddress(link, ipNet, getDadTimeout(0)); err != nil {
+			t.Errorf("addKernelAddress() error = %v", err)
+		}
+
+		settings := []struct {
+			name string
+			want string
+		}{
+			{"disable_ipv6", "0"},
+			{"accept_dad", "1"},
+		}
+		for _, setting := range settings {
+			data, err := ioutil.ReadFile(filepath.Join("/proc/sys/net/ipv6/conf/net1-k", setting.name))
+			if err != nil {
+				return err
+			}
+			if got := strings.TrimSpace(string(data)); got != setting.want {
+				t.Errorf("%s = %s, want %s", setting.name, got, setting.want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("sidecar link: %v", err)
+	}
+}
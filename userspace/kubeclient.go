@@ -0,0 +1,262 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Kubernetes client: The daemon (see daemon.go) keeps a client to the
+// Kubernetes API Server per kubeconfig, so reading a pod reuses the
+// connection instead of running kubectl, which reads the kubeconfig and
+// connects again on each call. The kubeconfig is read once with
+// "kubectl config view", and again when the file changes. Credentials that
+// only kubectl can obtain (exec and auth-provider plugins) are not
+// supported, the pod is then read with kubectl as without the daemon.
+//
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//
+// Types
+//
+
+// Client to the API Server of a kubeconfig.
+type kubeClient struct {
+	modTime    time.Time // Of the kubeconfig the client was built from
+	server     string
+	token      string
+	tokenFile  string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// The part of "kubectl config view --minify --flatten" used, the cluster
+// and the user of the current context.
+type kubeConfigView struct {
+	Clusters []struct {
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthorityData []byte `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		User struct {
+			ClientCertificateData []byte          `json:"client-certificate-data"`
+			ClientKeyData         []byte          `json:"client-key-data"`
+			Token                 string          `json:"token"`
+			TokenFile             string          `json:"tokenFile"`
+			Username              string          `json:"username"`
+			Password              string          `json:"password"`
+			Exec                  json.RawMessage `json:"exec"`
+			AuthProvider          json.RawMessage `json:"auth-provider"`
+		} `json:"user"`
+	} `json:"users"`
+}
+
+//
+// Variables
+//
+
+// Set by the daemon, a single invocation reads the pod with kubectl.
+var cacheKubeClients = false
+
+var kubeClientsMu sync.Mutex
+var kubeClients = make(map[string]*kubeClient)
+
+// Credentials only kubectl can use, the pod is read with kubectl.
+var errKubeClientUnsupported = errors.New("kubeconfig credentials not supported")
+
+//
+// Local functions
+//
+
+// getPodJson() - Read a pod from the API Server, with the cached client of
+//  the kubeconfig if the daemon caches them, with kubectl otherwise.
+func getPodJson(kubeconfig string, namespace string, name string) ([]byte, error) {
+	if cacheKubeClients {
+		client, err := getKubeClient(kubeconfig)
+		if err == nil {
+			var output []byte
+			if output, err = client.getPod(namespace, name); err == nil {
+				return output, nil
+			}
+			forgetKubeClient(kubeconfig)
+		}
+		if err != errKubeClientUnsupported {
+			logrus.Warningf("Kubernetes client of %s failed, using kubectl: %v", kubeconfig, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubectlTimeout)
+	defer cancel()
+
+	return exec.CommandContext(ctx, "kubectl", "--kubeconfig", kubeconfig,
+		"get", "pod", name,
+		"--namespace", namespace,
+		"--output", "json").Output()
+}
+
+// getKubeClient() - Client of the kubeconfig, built again if the kubeconfig
+//  changed since.
+func getKubeClient(kubeconfig string) (*kubeClient, error) {
+	fileInfo, err := os.Stat(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClientsMu.Lock()
+	defer kubeClientsMu.Unlock()
+
+	if client, ok := kubeClients[kubeconfig]; ok && client.modTime.Equal(fileInfo.ModTime()) {
+		return client, nil
+	}
+
+	client, err := newKubeClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	client.modTime = fileInfo.ModTime()
+	kubeClients[kubeconfig] = client
+
+	return client, nil
+}
+
+// forgetKubeClient() - Drop the client of the kubeconfig after a failure,
+//  it is built again on next use.
+func forgetKubeClient(kubeconfig string) {
+	kubeClientsMu.Lock()
+	delete(kubeClients, kubeconfig)
+	kubeClientsMu.Unlock()
+}
+
+// newKubeClient() - Build the client of the current context of the
+//  kubeconfig, as resolved by kubectl.
+func newKubeClient(kubeconfig string) (*kubeClient, error) {
+	var view kubeConfigView
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubectlTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "kubectl", "--kubeconfig", kubeconfig,
+		"config", "view", "--raw", "--minify", "--flatten", "--output", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to read kubeconfig %s: %v", kubeconfig, err)
+	}
+
+	if err = json.Unmarshal(output, &view); err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to parse kubeconfig %s: %v", kubeconfig, err)
+	}
+
+	return newKubeClientFromView(&view)
+}
+
+// newKubeClientFromView() - Build the client of the cluster and the user of
+//  the kubeconfig.
+func newKubeClientFromView(view *kubeConfigView) (*kubeClient, error) {
+	if len(view.Clusters) != 1 || len(view.Users) != 1 {
+		return nil, errKubeClientUnsupported
+	}
+	cluster := view.Clusters[0].Cluster
+	user := view.Users[0].User
+
+	if user.Exec != nil || user.AuthProvider != nil || cluster.Server == "" {
+		return nil, errKubeClientUnsupported
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster.InsecureSkipTLSVerify}
+	if len(cluster.CertificateAuthorityData) != 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if tlsConfig.RootCAs.AppendCertsFromPEM(cluster.CertificateAuthorityData) == false {
+			return nil, fmt.Errorf("ERROR: Invalid certificate-authority-data in kubeconfig")
+		}
+	}
+	if len(user.ClientCertificateData) != 0 {
+		cert, err := tls.X509KeyPair(user.ClientCertificateData, user.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("ERROR: Invalid client certificate in kubeconfig: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &kubeClient{
+		server:    strings.TrimSuffix(cluster.Server, "/"),
+		token:     user.Token,
+		tokenFile: user.TokenFile,
+		username:  user.Username,
+		password:  user.Password,
+		httpClient: &http.Client{
+			Timeout:   kubectlTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// getPod() - Read the pod, as "kubectl get pod --output json" prints it.
+func (c *kubeClient) getPod(namespace string, name string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.server+"/api/v1/namespaces/"+url.PathEscape(namespace)+
+		"/pods/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token file may be rotated, it is read on each request.
+	token := c.token
+	if c.tokenFile != "" {
+		tokenBytes, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ERROR: API Server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
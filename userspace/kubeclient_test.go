@@ -0,0 +1,84 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewKubeClientFromView(t *testing.T) {
+	tests := []struct {
+		name    string
+		view    string
+		wantErr error
+	}{
+		{"token", `{"clusters":[{"cluster":{"server":"https://10.0.0.1:6443/"}}],"users":[{"user":{"token":"abc"}}]}`, nil},
+		{"exec", `{"clusters":[{"cluster":{"server":"https://10.0.0.1:6443"}}],"users":[{"user":{"exec":{"command":"aws"}}}]}`, errKubeClientUnsupported},
+		{"auth-provider", `{"clusters":[{"cluster":{"server":"https://10.0.0.1:6443"}}],"users":[{"user":{"auth-provider":{"name":"gcp"}}}]}`, errKubeClientUnsupported},
+		{"no context", `{"clusters":[],"users":[]}`, errKubeClientUnsupported},
+		{"no server", `{"clusters":[{"cluster":{}}],"users":[{"user":{}}]}`, errKubeClientUnsupported},
+	}
+
+	for _, test := range tests {
+		var view kubeConfigView
+		if err := json.Unmarshal([]byte(test.view), &view); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		client, err := newKubeClientFromView(&view)
+		if err != test.wantErr {
+			t.Errorf("%s: newKubeClientFromView() error = %v, want %v", test.name, err, test.wantErr)
+		}
+		if err == nil && client.server != "https://10.0.0.1:6443" {
+			t.Errorf("%s: server = %s", test.name, client.server)
+		}
+	}
+}
+
+func TestKubeClientGetPod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/namespaces/ns1/pods/pod1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"metadata":{"annotations":{"userspace/ip-address":"10.1.1.5/24"}}}`))
+	}))
+	defer server.Close()
+
+	client := &kubeClient{server: server.URL, token: "abc", httpClient: server.Client()}
+
+	output, err := client.getPod("ns1", "pod1")
+	if err != nil {
+		t.Fatalf("getPod(): %v", err)
+	}
+	if string(output) != `{"metadata":{"annotations":{"userspace/ip-address":"10.1.1.5/24"}}}` {
+		t.Errorf("getPod() = %s", output)
+	}
+
+	if _, err = client.getPod("ns1", "pod2"); err == nil {
+		t.Errorf("getPod() of a missing pod: no error")
+	}
+
+	client.token = "wrong"
+	if _, err = client.getPod("ns1", "pod1"); err == nil {
+		t.Errorf("getPod() unauthorized: no error")
+	}
+}
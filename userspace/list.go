@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// List: Running the plugin as "userspace list" prints the attachments of
+// the node, from the saved attachment data, one per line. With several
+// networks (configuration names) on the node, --network <name> only prints
+// the attachments of that network. --output json prints them as a JSON
+// list instead of a table, to reconcile with the state of VPP or OVS.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+)
+
+//
+// Types
+//
+
+// An attachment, as printed by the list command.
+type listEntry struct {
+	ContainerID string   `json:"containerId"`
+	IfName      string   `json:"ifName"`
+	Network     string   `json:"network,omitempty"`
+	Engine      string   `json:"engine"`
+	IfType      string   `json:"ifType,omitempty"`
+	Interface   string   `json:"interface,omitempty"` // VPP swIfIndex or OVS port
+	SocketPath  string   `json:"socketPath,omitempty"`
+	IPs         []string `json:"ips,omitempty"`
+}
+
+//
+// Local Functions
+//
+
+// runList() - Print the attachments of the node, of the network given
+//  with --network if any, as a table or as JSON (--output).
+func runList(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	network := flags.String("network", "", "only list the attachments of the network")
+	output := flags.String("output", "text", "output format, text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("ERROR: Invalid output %s, must be text or json", *output)
+	}
+
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+
+	entries := []listEntry{}
+	for _, info := range attachments {
+		if *network != "" && info.Network != *network {
+			continue
+		}
+		entries = append(entries, getListEntry(&info))
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tIFNAME\tNETWORK\tENGINE\tTYPE\tINTERFACE\tSOCKET\tIP")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.ContainerID, entry.IfName,
+			getListValue(entry.Network), entry.Engine, getListValue(entry.IfType),
+			getListValue(entry.Interface), getListValue(entry.SocketPath),
+			getListValue(strings.Join(entry.IPs, ",")))
+	}
+
+	return tw.Flush()
+}
+
+// getListEntry() - Attachment as printed, the interface identified by its
+//  engine and the addresses taken from the saved result.
+func getListEntry(info *usrspdb.AttachmentInfo) listEntry {
+	entry := listEntry{
+		ContainerID: info.ContainerID,
+		IfName:      info.IfName,
+		Network:     info.Network,
+		Engine:      info.Engine,
+		IfType:      info.IfType,
+		SocketPath:  info.SocketPath,
+	}
+
+	if info.Engine == "vpp" {
+		entry.Interface = fmt.Sprintf("%d", info.SwIfIndex)
+	} else {
+		entry.Interface = info.PortName
+	}
+
+	if info.Result != nil {
+		for _, ipConfig := range info.Result.IPs {
+			entry.IPs = append(entry.IPs, ipConfig.Address.String())
+		}
+	}
+
+	return entry
+}
+
+// getListValue() - Value of a column, "-" if empty.
+func getListValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
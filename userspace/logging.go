@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Logging: The plugin logs to stderr (stdout is reserved for the CNI
+// result). The level and format are set from the configuration. In json
+// format each log line is a single JSON object, and every entry carries
+// the containerID, engine and interface of the request, and the version of
+// the plugin, see usrsptypes/version.go.
+//
+
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Types
+//
+
+// requestFieldsHook adds the fields identifying the request being executed
+// (those of requestEntry) to every entry. It is installed once, the daemon
+// executes many requests. logrus reuses its entries without clearing their
+// fields, so the fields of an earlier request are always replaced.
+type requestFieldsHook struct{}
+
+func (hook *requestFieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *requestFieldsHook) Fire(entry *logrus.Entry) error {
+	request, _ := requestEntry.Load().(*logrus.Entry)
+	for _, key := range requestFieldKeys {
+		if request != nil {
+			entry.Data[key] = request.Data[key]
+		} else {
+			delete(entry.Data, key)
+		}
+	}
+	return nil
+}
+
+//
+// Variables
+//
+
+// The *logrus.Entry carrying the fields of the request being executed,
+// replaced by setupLogging() and cleared by clearRequestFields().
+var requestEntry atomic.Value
+
+var requestFieldsHookOnce sync.Once
+
+// Fields set by requestFieldsHook.
+var requestFieldKeys = []string{"containerID", "engine", "interface", "version"}
+
+//
+// Local functions
+//
+
+// logError() - Log the error of a command. With the debug option, the stack
+//  recorded with the error, or the current one, is logged as well.
+func logError(command string, err error) {
+	entry := logrus.WithField("step", command)
+
+	if usrsptypes.IsDebug() == false {
+		entry.Errorf("%v", err)
+		return
+	}
+
+	stack := usrsptypes.GetErrorStack(err)
+	if stack == "" {
+		stack = string(debug.Stack())
+	}
+	entry.Errorf("%v\n%s", err, stack)
+}
+
+// clearRequestFields() - Stop tagging the entries with the fields of the
+//  request, once it is executed.
+func clearRequestFields() {
+	requestEntry.Store((*logrus.Entry)(nil))
+}
+
+// setupLogging() - Apply the logging options of the configuration and tag
+//  all further entries with the request fields.
+func setupLogging(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if netConf.LogLevel != "" {
+		level, err := logrus.ParseLevel(netConf.LogLevel)
+		if err != nil {
+			return fmt.Errorf("ERROR: Invalid logLevel: %s", netConf.LogLevel)
+		}
+		logrus.SetLevel(level)
+	}
+
+	if netConf.LogFormat == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else if netConf.LogFormat == "text" || netConf.LogFormat == "" {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	} else {
+		return fmt.Errorf("ERROR: Invalid logFormat: %s", netConf.LogFormat)
+	}
+
+	requestFieldsHookOnce.Do(func() {
+		logrus.AddHook(&requestFieldsHook{})
+	})
+	requestEntry.Store(logrus.WithFields(logrus.Fields{
+		"containerID": args.ContainerID,
+		"engine":      netConf.HostConf.Engine,
+		"interface":   args.IfName,
+		"version":     usrsptypes.Version,
+	}))
+
+	logrus.Infof("UserSpace CNI plugin %s", usrsptypes.GetVersionString())
+
+	usrsptypes.SetDebug(netConf.Debug)
+
+	for _, deprecatedKey := range netConf.DeprecatedKeys {
+		logrus.Warningf("Deprecated configuration: %s", deprecatedKey)
+	}
+
+	return nil
+}
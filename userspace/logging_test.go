@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestSetupLoggingOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		logLevel  string
+		logFormat string
+		wantErr   bool
+	}{
+		{"defaults", "", "", false},
+		{"debug json", "debug", "json", false},
+		{"warning text", "warning", "text", false},
+		{"invalid level", "verbose", "", true},
+		{"invalid format", "", "xml", true},
+	}
+
+	logrus.SetOutput(ioutil.Discard)
+	defer logrus.SetLevel(logrus.InfoLevel)
+	defer clearRequestFields()
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{LogLevel: test.logLevel, LogFormat: test.logFormat}
+		err := setupLogging(netConf, &skel.CmdArgs{ContainerID: "c1", IfName: "net1"})
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: setupLogging() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+// The daemon executes many requests in one process, each entry must carry
+// the fields of the request being executed.
+func TestSetupLoggingRequestFields(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	logrus.SetLevel(logrus.InfoLevel)
+	defer clearRequestFields()
+
+	// Installs the request fields hook, which fires before the test hook.
+	if err := setupLogging(&usrsptypes.NetConf{}, &skel.CmdArgs{ContainerID: "c0"}); err != nil {
+		t.Fatalf("setupLogging(): %v", err)
+	}
+	hook := test.NewGlobal()
+
+	requests := []skel.CmdArgs{
+		{ContainerID: "c1", IfName: "net1"},
+		{ContainerID: "c2", IfName: "net2"},
+	}
+	for _, args := range requests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = "vpp"
+		if err := setupLogging(netConf, &args); err != nil {
+			t.Fatalf("setupLogging(): %v", err)
+		}
+
+		logrus.Infof("request")
+		entry := hook.LastEntry()
+		if entry.Data["containerID"] != args.ContainerID || entry.Data["interface"] != args.IfName {
+			t.Errorf("entry of %s/%s tagged with %v/%v", args.ContainerID, args.IfName,
+				entry.Data["containerID"], entry.Data["interface"])
+		}
+	}
+
+	count := 0
+	for _, installed := range logrus.StandardLogger().Hooks[logrus.InfoLevel] {
+		if _, ok := installed.(*requestFieldsHook); ok {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("%d request fields hooks installed, want 1", count)
+	}
+
+	clearRequestFields()
+	logrus.Infof("no request")
+	if _, ok := hook.LastEntry().Data["containerID"]; ok {
+		t.Errorf("entry tagged after clearRequestFields()")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Container MAC: The MAC address of the container interface is taken from,
+// in order of precedence:
+//   MAC=<mac> in CNI_ARGS, passed by the runtime
+//   userspace/mac-address: "<mac>" pod annotation (requires kubeconfig)
+//   mac in the container section of the configuration
+// The runtime and the annotation must agree if both are provided.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+const podMacAnnotation = "userspace/mac-address"
+
+//
+// Local functions
+//
+
+// parseMac() - Parse a MAC address, which must be a unicast Ethernet address.
+func parseMac(mac string, source string) (net.HardwareAddr, error) {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Invalid %s MAC address %s: %v", source, mac, err)
+	}
+	if len(hwAddr) != 6 {
+		return nil, fmt.Errorf("ERROR: Invalid %s MAC address %s: not an Ethernet address", source, mac)
+	}
+	if hwAddr[0]&0x01 != 0 {
+		return nil, fmt.Errorf("ERROR: Invalid %s MAC address %s: multicast address", source, mac)
+	}
+
+	return hwAddr, nil
+}
+
+// resolveContainerMac() - Determine the MAC address of the container interface
+//  and store it in the container section of the configuration, overriding the
+//  configured value.
+func resolveContainerMac(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	var runtimeMac, annotationMac net.HardwareAddr
+
+	k8sArgs, err := usrsptypes.LoadK8sArgs(args)
+	if err != nil {
+		return err
+	}
+	if k8sArgs.MAC != "" {
+		if runtimeMac, err = parseMac(string(k8sArgs.MAC), "CNI_ARGS"); err != nil {
+			return err
+		}
+	}
+
+	if netConf.Kubeconfig != "" {
+		annotation, err := getPodAnnotation(netConf, args, podMacAnnotation)
+		if err != nil {
+			return err
+		}
+		if annotation != "" {
+			if annotationMac, err = parseMac(annotation, podMacAnnotation); err != nil {
+				return err
+			}
+		}
+	}
+
+	if runtimeMac != nil && annotationMac != nil && bytes.Equal(runtimeMac, annotationMac) == false {
+		return fmt.Errorf("ERROR: CNI_ARGS MAC %s does not match %s annotation %s",
+			runtimeMac.String(), podMacAnnotation, annotationMac.String())
+	}
+
+	if runtimeMac != nil {
+		netConf.ContainerConf.Mac = runtimeMac.String()
+	} else if annotationMac != nil {
+		netConf.ContainerConf.Mac = annotationMac.String()
+	} else if netConf.ContainerConf.Mac != "" {
+		hwAddr, err := parseMac(netConf.ContainerConf.Mac, "container")
+		if err != nil {
+			return err
+		}
+		netConf.ContainerConf.Mac = hwAddr.String()
+	}
+
+	if netConf.HostConf.Mac != "" {
+		hwAddr, err := parseMac(netConf.HostConf.Mac, "host")
+		if err != nil {
+			return err
+		}
+		netConf.HostConf.Mac = hwAddr.String()
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestParseMac(t *testing.T) {
+	tests := []struct {
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{"02:fe:01:02:03:04", "02:fe:01:02:03:04", false},
+		{"02-FE-01-02-03-04", "02:fe:01:02:03:04", false},
+		{"02:fe:01:02", "", true},
+		{"00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01", "", true},
+		{"01:00:5e:00:00:01", "", true},
+	}
+
+	for _, test := range tests {
+		hwAddr, err := parseMac(test.mac, "container")
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseMac(%s) error = %v, wantErr %v", test.mac, err, test.wantErr)
+			continue
+		}
+		if err == nil && hwAddr.String() != test.want {
+			t.Errorf("parseMac(%s) = %s, want %s", test.mac, hwAddr.String(), test.want)
+		}
+	}
+}
+
+func TestResolveContainerMac(t *testing.T) {
+	tests := []struct {
+		name          string
+		cniArgs       string
+		containerMac  string
+		hostMac       string
+		wantContainer string
+		wantHost      string
+		wantErr       bool
+	}{
+		{"none", "", "", "", "", "", false},
+		{"configured", "", "02:FE:01:02:03:04", "02-fe-0a-0b-0c-0d", "02:fe:01:02:03:04", "02:fe:0a:0b:0c:0d", false},
+		// The runtime overrides the configuration.
+		{"runtime", "IgnoreUnknown=1;MAC=02:fe:05:06:07:08", "02:fe:01:02:03:04", "", "02:fe:05:06:07:08", "", false},
+		{"invalid runtime", "MAC=01:00:5e:00:00:01", "", "", "", "", true},
+		{"invalid container", "", "02:fe", "", "", "", true},
+		{"invalid host", "", "", "ff:ff:ff:ff:ff:ff", "", "", true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.ContainerConf.Mac = test.containerMac
+		netConf.HostConf.Mac = test.hostMac
+		args := &skel.CmdArgs{ContainerID: "c1", IfName: "net1", Args: test.cniArgs}
+
+		err := resolveContainerMac(netConf, args)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: resolveContainerMac() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && (netConf.ContainerConf.Mac != test.wantContainer || netConf.HostConf.Mac != test.wantHost) {
+			t.Errorf("%s: resolveContainerMac() macs = %q/%q, want %q/%q", test.name,
+				netConf.ContainerConf.Mac, netConf.HostConf.Mac, test.wantContainer, test.wantHost)
+		}
+	}
+}
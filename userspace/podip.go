@@ -0,0 +1,108 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Pod IP Annotation: When no IPAM is configured, a pod can request a fixed
+// address for the UserSpace interface with an annotation:
+//   userspace/ip-address: "192.168.210.45/24"
+// The pod is read from the Kubernetes API Server (with kubectl, or the
+// client cached by the daemon, see kubeclient.go, and the kubeconfig from
+// the configuration) using the pod name and namespace passed in CNI_ARGS.
+// If the annotation is not set, no address is used.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types/current"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+const podIpAnnotation = "userspace/ip-address"
+const kubectlTimeout = 10 * time.Second
+
+//
+// Local functions
+//
+
+// getPodAnnotation() - Read the given annotation of the pod. An empty string
+//  is returned if the annotation is not set, or if Kubernetes did not pass
+//  the pod information.
+func getPodAnnotation(netConf *usrsptypes.NetConf, args *skel.CmdArgs, name string) (string, error) {
+	var pod struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+
+	k8sArgs, err := usrsptypes.LoadK8sArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if k8sArgs.K8S_POD_NAME == "" || k8sArgs.K8S_POD_NAMESPACE == "" {
+		return "", nil
+	}
+
+	output, err := getPodJson(netConf.Kubeconfig, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
+	if err != nil {
+		return "", fmt.Errorf("ERROR: Failed to get pod %s/%s: %v",
+			k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, err)
+	}
+
+	if err = json.Unmarshal(output, &pod); err != nil {
+		return "", fmt.Errorf("ERROR: Failed to parse pod %s/%s: %v",
+			k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, err)
+	}
+
+	return strings.TrimSpace(pod.Metadata.Annotations[name]), nil
+}
+
+// getPodIpResult() - Build the result from the pod IP annotation, used in
+//  place of IPAM. The result is empty if the annotation is not set.
+func getPodIpResult(netConf *usrsptypes.NetConf, args *skel.CmdArgs) (*current.Result, error) {
+	result := &current.Result{}
+
+	annotation, err := getPodAnnotation(netConf, args, podIpAnnotation)
+	if err != nil || annotation == "" {
+		return result, err
+	}
+
+	ipAddr, ipNet, err := net.ParseCIDR(annotation)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Invalid %s annotation %s: %v", podIpAnnotation, annotation, err)
+	}
+	ipNet.IP = ipAddr
+
+	ipVersion := "6"
+	if ipAddr.To4() != nil {
+		ipVersion = "4"
+	}
+	result.IPs = append(result.IPs, &current.IPConfig{
+		Version: ipVersion,
+		Address: *ipNet,
+	})
+
+	return result, nil
+}
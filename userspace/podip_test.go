@@ -0,0 +1,103 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+// Fake kubectl, printing the pod named by "kubectl --kubeconfig <file> get
+// pod <name> ...".
+const testKubectl = `#!/bin/sh
+case "$5" in
+pod-v4) echo '{"metadata":{"annotations":{"userspace/ip-address":"10.1.1.5/24"}}}' ;;
+pod-v6) echo '{"metadata":{"annotations":{"userspace/ip-address":" 2001:db8::5/64 "}}}' ;;
+pod-none) echo '{"metadata":{}}' ;;
+pod-invalid) echo '{"metadata":{"annotations":{"userspace/ip-address":"10.1.1.5"}}}' ;;
+pod-garbled) echo '{"metadata":' ;;
+*) echo "pods \"$5\" not found" >&2; exit 1 ;;
+esac
+`
+
+// useTestKubectl() - Put the fake kubectl first in PATH. The returned
+//  function restores PATH.
+func useTestKubectl(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "usrsp-kubectl")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(testKubectl), 0755); err != nil {
+		t.Fatalf("writing kubectl: %v", err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetPodIpResult(t *testing.T) {
+	defer useTestKubectl(t)()
+
+	tests := []struct {
+		name        string
+		cniArgs     string
+		wantAddress string
+		wantVersion string
+		wantErr     bool
+	}{
+		{"ipv4", "K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod-v4", "10.1.1.5/24", "4", false},
+		{"ipv6", "K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod-v6", "2001:db8::5/64", "6", false},
+		{"no annotation", "K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod-none", "", "", false},
+		// Without the pod, as outside of Kubernetes, there is no address.
+		{"no pod", "", "", "", false},
+		{"invalid annotation", "K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod-invalid", "", "", true},
+		{"invalid pod", "K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod-garbled", "", "", true},
+		{"missing pod", "K8S_POD_NAMESPACE=ns1;K8S_POD_NAME=pod-missing", "", "", true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{Kubeconfig: "/etc/kubernetes/kubelet.conf"}
+		args := &skel.CmdArgs{ContainerID: "c1", IfName: "net1", Args: test.cniArgs}
+
+		result, err := getPodIpResult(netConf, args)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: getPodIpResult() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if test.wantAddress == "" {
+			if len(result.IPs) != 0 {
+				t.Errorf("%s: getPodIpResult() = %v, want no address", test.name, result.IPs)
+			}
+			continue
+		}
+		if len(result.IPs) != 1 || result.IPs[0].Address.String() != test.wantAddress || result.IPs[0].Version != test.wantVersion {
+			t.Errorf("%s: getPodIpResult() = %v, want %s", test.name, result.IPs, test.wantAddress)
+		}
+	}
+}
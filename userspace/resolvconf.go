@@ -0,0 +1,186 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// resolv.conf: A pod whose only interfaces are UserSpace interfaces does
+// not get the DNS settings of the network from the runtime. With
+// writeResolvConf, the DNS settings of the configuration and of IPAM are
+// written to resolv.conf in the directory shared with the container, for
+// the pod to mount or copy. The file of a container holds the settings of
+// all its attachments writing to it, merged in the order of the interface
+// names, and is rewritten when one of them is added or deleted. The
+// /etc/resolv.conf of the pod is never touched.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Billy99/user-space-net-plugin/cniovs/cniovs"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/vppdb"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+
+const resolvConfFileName = "resolv.conf"
+
+//
+// Local functions
+//
+
+// getResolvConfPath() - resolv.conf in the directory of the container shared
+//  by the host engine: the data directory for vpp, the directory of the
+//  vhost-user sockets for ovs-dpdk.
+func getResolvConfPath(netConf *usrsptypes.NetConf, args *skel.CmdArgs) string {
+	if netConf.HostConf.Engine == "ovs-dpdk" {
+		return filepath.Join(cniovs.GetContainerDir(args.ContainerID), resolvConfFileName)
+	}
+	return filepath.Join(vppdb.GetContainerDir(args.ContainerID), resolvConfFileName)
+}
+
+// addResolvConf() - Record the DNS settings of the attachment, the settings
+//  of the configuration followed by the ones from IPAM, and rewrite the
+//  resolv.conf of the container.
+func addResolvConf(netConf *usrsptypes.NetConf, args *skel.CmdArgs, result *current.Result) error {
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	dns := mergeDNS([]types.DNS{netConf.DNS, result.DNS})
+	info.DNS = &dns
+	info.ResolvConf = getResolvConfPath(netConf, args)
+
+	err = usrspdb.SaveAttachment(&info)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(info.ResolvConf), 0700); err != nil {
+		return err
+	}
+	return writeResolvConf(info.ResolvConf, "")
+}
+
+// delResolvConf() - Rewrite the resolv.conf of the container without the
+//  DNS settings of the attachment, or remove it with the last attachment
+//  writing to it.
+func delResolvConf(args *skel.CmdArgs) error {
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil || info.ResolvConf == "" {
+		return nil
+	}
+
+	return writeResolvConf(info.ResolvConf, args.IfName)
+}
+
+// writeResolvConf() - Write the DNS settings of the attachments of the
+//  file, except the one of the excluded interface, merged in the order of
+//  the interface names. Without settings left, the file is removed.
+func writeResolvConf(path string, excludeIfName string) error {
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+
+	var sources []usrspdb.AttachmentInfo
+	for _, info := range attachments {
+		if info.ResolvConf == path && info.DNS != nil && info.IfName != excludeIfName {
+			sources = append(sources, info)
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].IfName < sources[j].IfName
+	})
+
+	var settings []types.DNS
+	for _, info := range sources {
+		settings = append(settings, *info.DNS)
+	}
+	dns := mergeDNS(settings)
+
+	if len(dns.Nameservers) == 0 && dns.Domain == "" && len(dns.Search) == 0 && len(dns.Options) == 0 {
+		logrus.WithField("step", "resolvconf").Debugf("No DNS settings left, removing %s", path)
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("ERROR: Failed to remove %s: %v", path, err)
+		}
+		return nil
+	}
+
+	logrus.WithField("step", "resolvconf").Debugf("Writing %s with the DNS settings of %d attachments", path, len(sources))
+	return usrsptypes.WriteFileAtomic(path, renderResolvConf(&dns), 0644)
+}
+
+// mergeDNS() - Merge DNS settings in order: nameservers, search domains and
+//  options are appended once each, the first domain is kept.
+func mergeDNS(settings []types.DNS) types.DNS {
+	var merged types.DNS
+
+	for _, dns := range settings {
+		if merged.Domain == "" {
+			merged.Domain = dns.Domain
+		}
+		merged.Nameservers = appendUnique(merged.Nameservers, dns.Nameservers)
+		merged.Search = appendUnique(merged.Search, dns.Search)
+		merged.Options = appendUnique(merged.Options, dns.Options)
+	}
+
+	return merged
+}
+
+// appendUnique() - Append the values not in the list yet.
+func appendUnique(list []string, values []string) []string {
+	for _, value := range values {
+		if value != "" && containsString(list, value) == false {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// renderResolvConf() - Content of resolv.conf for the DNS settings.
+func renderResolvConf(dns *types.DNS) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by the UserSpace CNI (writeResolvConf)\n")
+	if dns.Domain != "" {
+		fmt.Fprintf(&buf, "domain %s\n", dns.Domain)
+	}
+	if len(dns.Search) != 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(dns.Search, " "))
+	}
+	for _, nameserver := range dns.Nameservers {
+		fmt.Fprintf(&buf, "nameserver %s\n", nameserver)
+	}
+	if len(dns.Options) != 0 {
+		fmt.Fprintf(&buf, "options %s\n", strings.Join(dns.Options, " "))
+	}
+
+	return buf.Bytes()
+}
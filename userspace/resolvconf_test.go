@@ -0,0 +1,78 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+func TestMergeDNS(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []types.DNS
+		want     types.DNS
+	}{
+		{"none", nil, types.DNS{}},
+		{"configuration only", []types.DNS{{Nameservers: []string{"10.0.0.10"}, Domain: "cluster.local"}, {}},
+			types.DNS{Nameservers: []string{"10.0.0.10"}, Domain: "cluster.local"}},
+		// The first domain is kept, the rest is appended once each.
+		{"configuration and ipam", []types.DNS{
+			{Nameservers: []string{"10.0.0.10"}, Domain: "cluster.local", Search: []string{"ns1.svc.cluster.local"}},
+			{Nameservers: []string{"10.0.0.10", "10.0.0.11"}, Domain: "example.com",
+				Search: []string{"svc.cluster.local", "ns1.svc.cluster.local"}, Options: []string{"ndots:5", ""}},
+		}, types.DNS{Nameservers: []string{"10.0.0.10", "10.0.0.11"}, Domain: "cluster.local",
+			Search: []string{"ns1.svc.cluster.local", "svc.cluster.local"}, Options: []string{"ndots:5"}}},
+		{"domain of ipam", []types.DNS{{Nameservers: []string{"10.0.0.10"}}, {Domain: "example.com"}},
+			types.DNS{Nameservers: []string{"10.0.0.10"}, Domain: "example.com"}},
+	}
+
+	for _, test := range tests {
+		got := mergeDNS(test.settings)
+		if got.Domain != test.want.Domain ||
+			strings.Join(got.Nameservers, " ") != strings.Join(test.want.Nameservers, " ") ||
+			strings.Join(got.Search, " ") != strings.Join(test.want.Search, " ") ||
+			strings.Join(got.Options, " ") != strings.Join(test.want.Options, " ") {
+			t.Errorf("%s: mergeDNS() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRenderResolvConf(t *testing.T) {
+	tests := []struct {
+		name string
+		dns  types.DNS
+		want string
+	}{
+		{"nameserver", types.DNS{Nameservers: []string{"10.0.0.10"}},
+			"nameserver 10.0.0.10\n"},
+		{"all", types.DNS{Nameservers: []string{"10.0.0.10", "2001:db8::10"}, Domain: "cluster.local",
+			Search: []string{"ns1.svc.cluster.local", "svc.cluster.local"}, Options: []string{"ndots:5", "timeout:2"}},
+			"domain cluster.local\n" +
+				"search ns1.svc.cluster.local svc.cluster.local\n" +
+				"nameserver 10.0.0.10\n" +
+				"nameserver 2001:db8::10\n" +
+				"options ndots:5 timeout:2\n"},
+	}
+
+	for _, test := range tests {
+		want := "# Generated by the UserSpace CNI (writeResolvConf)\n" + test.want
+		if got := string(renderResolvConf(&test.dns)); got != want {
+			t.Errorf("%s: renderResolvConf() = %q, want %q", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Show: Running the plugin as "userspace show <ContainerId> <IfName>"
+// prints an attachment of the node, from the saved attachment data, along
+// with its journal: the steps the engine ran programming the attachment,
+// see usrspdb/journal.go. --output json prints the attachment data as is.
+// A failed ADD or DEL only reports the last entries of the journal.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+)
+
+//
+// Local Functions
+//
+
+// runShow() - Print an attachment and its journal, as text or as JSON
+//  (--output).
+func runShow(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("show", flag.ContinueOnError)
+	output := flags.String("output", "text", "output format, text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("ERROR: Invalid output %s, must be text or json", *output)
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("ERROR: Usage: userspace show [--output text|json] <ContainerId> <IfName>")
+	}
+
+	info, err := usrspdb.GetAttachment(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	entry := getListEntry(&info)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Container:\t%s\n", entry.ContainerID)
+	fmt.Fprintf(tw, "IfName:\t%s\n", entry.IfName)
+	fmt.Fprintf(tw, "Network:\t%s\n", getListValue(entry.Network))
+	fmt.Fprintf(tw, "Engine:\t%s\n", entry.Engine)
+	fmt.Fprintf(tw, "Type:\t%s\n", getListValue(entry.IfType))
+	fmt.Fprintf(tw, "Interface:\t%s\n", getListValue(entry.Interface))
+	fmt.Fprintf(tw, "Socket:\t%s\n", getListValue(entry.SocketPath))
+	if info.Result == nil {
+		fmt.Fprintf(tw, "Completed:\tno\n")
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nJournal (%d entries, last %d kept):\n", len(info.Journal), usrspdb.MaxJournalEntries)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tENGINE\tSTEP\tREQUEST\tRESULT")
+	for _, step := range info.Journal {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", step.Time, step.Engine, step.Step,
+			getListValue(step.Request), step.Result)
+	}
+
+	return tw.Flush()
+}
+
+// withJournal() - Error of a failed command along with the tail of the
+//  journal of the attachment. A CNI error keeps its code, the tail is added
+//  to its message.
+func withJournal(args *skel.CmdArgs, err error) error {
+	if cniErr, ok := err.(*cnitypes.Error); ok {
+		journalErr := usrspdb.WithJournal(args.ContainerID, args.IfName, errors.New(cniErr.Msg))
+		withTail := *cniErr
+		withTail.Msg = journalErr.Error()
+		return &withTail
+	}
+
+	return usrspdb.WithJournal(args.ContainerID, args.IfName, err)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Kernel Sidecar: Kubelet liveness probes can't traverse a UserSpace
+// interface, so a kernel interface (veth pair) can optionally be added
+// in the container in addition to the UserSpace interface. The host end
+// of the veth pair is attached to the host VPP instance (af_packet) or
+// to a host Linux bridge.
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/plugins/pkg/ip"
+	"github.com/containernetworking/plugins/pkg/ns"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+
+	"github.com/vishvananda/netlink"
+)
+
+//
+// Constants
+//
+
+// Suffix of the name of the kernel sidecar interface, appended to CNI_IFNAME
+// if ifName is not provided, so it does not collide with the UserSpace
+// interface.
+const sidecarIfNameSuffix = "-k"
+
+// Maximum length of a Linux interface name (IFNAMSIZ - 1).
+const maxKernelIfNameLength = 15
+
+//
+// Local functions
+//
+
+// getUserSpaceIfName() - Name the UserSpace interface is reported as.
+func getUserSpaceIfName(netConf *usrsptypes.NetConf, args *skel.CmdArgs) string {
+	return usrsptypes.GetIfName(netConf, args)
+}
+
+// getSidecarIfName() - Name of the kernel sidecar interface in the container,
+//  CNI_IFNAME with sidecarIfNameSuffix if ifName is not provided. CNI_IFNAME
+//  is shortened if needed to fit in a Linux interface name.
+func getSidecarIfName(netConf *usrsptypes.NetConf, args *skel.CmdArgs) string {
+	if netConf.KernelSidecar.IfName != "" {
+		return netConf.KernelSidecar.IfName
+	}
+
+	name := args.IfName
+	if len(name)+len(sidecarIfNameSuffix) > maxKernelIfNameLength {
+		name = name[:maxKernelIfNameLength-len(sidecarIfNameSuffix)]
+	}
+	return name + sidecarIfNameSuffix
+}
+
+// parseSidecarAddress() - Parse the static address of the kernel sidecar.
+//  An address without a prefix is treated as a host address.
+func parseSidecarAddress(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") == false {
+		if parsedIP := net.ParseIP(address); parsedIP != nil && parsedIP.To4() != nil {
+			address = address + "/32"
+		} else {
+			address = address + "/128"
+		}
+	}
+
+	ipAddr, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Invalid kernelSidecar address %s: %v", address, err)
+	}
+	ipNet.IP = ipAddr
+
+	return ipNet, nil
+}
+
+// validateKernelSidecar() - Make sure the kernel sidecar options are usable
+//  before any interface is created.
+func validateKernelSidecar(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if netConf.KernelSidecar.Enable == false {
+		return nil
+	}
+
+	if args.Netns == "" {
+		return fmt.Errorf("ERROR: kernelSidecar requires a network namespace")
+	}
+
+	if len(netConf.KernelSidecar.IfName) > maxKernelIfNameLength {
+		return fmt.Errorf("ERROR: kernelSidecar ifName %s is longer than %d characters",
+			netConf.KernelSidecar.IfName, maxKernelIfNameLength)
+	}
+
+	if getSidecarIfName(netConf, args) == getUserSpaceIfName(netConf, args) {
+		return fmt.Errorf("ERROR: kernelSidecar ifName must differ from the UserSpace interface name %s",
+			getUserSpaceIfName(netConf, args))
+	}
+
+	if netConf.KernelSidecar.Attach == "af_packet" {
+		if netConf.HostConf.Engine != "vpp" {
+			return fmt.Errorf("ERROR: kernelSidecar attach af_packet requires Host Engine vpp, not %s",
+				netConf.HostConf.Engine)
+		}
+	} else if netConf.KernelSidecar.Attach == "bridge" {
+		if netConf.KernelSidecar.Bridge == "" {
+			return fmt.Errorf("ERROR: kernelSidecar attach bridge requires a bridge name")
+		}
+	} else {
+		return fmt.Errorf("ERROR: Invalid kernelSidecar attach: %s", netConf.KernelSidecar.Attach)
+	}
+
+	if netConf.KernelSidecar.Address == "" {
+		return fmt.Errorf("ERROR: kernelSidecar requires an address")
+	}
+	ipNet, err := parseSidecarAddress(netConf.KernelSidecar.Address)
+	if err != nil {
+		return err
+	}
+
+	if netConf.KernelSidecar.Gateway != "" {
+		gw := net.ParseIP(netConf.KernelSidecar.Gateway)
+		if gw == nil {
+			return fmt.Errorf("ERROR: Invalid kernelSidecar gateway: %s", netConf.KernelSidecar.Gateway)
+		}
+		if (gw.To4() == nil) != (ipNet.IP.To4() == nil) {
+			return fmt.Errorf("ERROR: kernelSidecar gateway %s and address %s must be of the same family",
+				netConf.KernelSidecar.Gateway, netConf.KernelSidecar.Address)
+		}
+	}
+
+	if netConf.KernelSidecar.DadTimeout < 0 {
+		return fmt.Errorf("ERROR: Invalid kernelSidecar dadTimeout %d, must not be negative", netConf.KernelSidecar.DadTimeout)
+	}
+
+	return nil
+}
+
+// addKernelSidecar() - Create the veth pair, configure the container end and
+//  attach the host end. Both interfaces are added to the result.
+func addKernelSidecar(netConf *usrsptypes.NetConf, args *skel.CmdArgs, result *current.Result) error {
+	var hostVeth net.Interface
+
+	sidecarIfName := getSidecarIfName(netConf, args)
+
+	ipNet, err := parseSidecarAddress(netConf.KernelSidecar.Address)
+	if err != nil {
+		return err
+	}
+	gw := net.ParseIP(netConf.KernelSidecar.Gateway)
+
+	netns, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+	}
+	defer netns.Close()
+
+	hostNS, err := ns.GetCurrentNS()
+	if err != nil {
+		return err
+	}
+	defer hostNS.Close()
+
+	//
+	// Create the veth pair and configure the container end.
+	//
+	err = netns.Do(func(_ ns.NetNS) error {
+		var contVeth net.Interface
+		var err error
+
+		hostVeth, contVeth, err = ip.SetupVeth(sidecarIfName, 0, hostNS)
+		if err != nil {
+			return err
+		}
+
+		link, err := netlink.LinkByName(contVeth.Name)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q: %v", contVeth.Name, err)
+		}
+
+		// IPv6 is enabled on the link, and DAD has to complete, see
+		// kernelipv6.go.
+		err = addKernelAddress(link, ipNet, getDadTimeout(netConf.KernelSidecar.DadTimeout))
+		if err != nil {
+			return err
+		}
+
+		if gw != nil {
+			if err = addKernelGateway(link, gw); err != nil {
+				return err
+			}
+		}
+
+		// Mark the link as created by the attachment, see kernelif.go.
+		if err = netlink.LinkSetAlias(link, getKernelIfAlias(args)); err != nil {
+			return fmt.Errorf("failed to set the alias of %q: %v", contVeth.Name, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		delKernelSidecarLink(args.Netns, sidecarIfName)
+		return err
+	}
+
+	//
+	// Attach the host end.
+	//
+	if netConf.KernelSidecar.Attach == "af_packet" {
+		err = cnivpp.CniVppAddAfPacket(netConf, hostVeth.Name)
+	} else {
+		err = attachHostBridge(netConf.KernelSidecar.Bridge, hostVeth.Name)
+	}
+	if err != nil {
+		delKernelSidecarLink(args.Netns, sidecarIfName)
+		return err
+	}
+
+	//
+	// Save the sidecar names for Delete.
+	//
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err == nil {
+		info.SidecarIfName = sidecarIfName
+		info.SidecarHostIfName = hostVeth.Name
+		err = usrspdb.SaveAttachment(&info)
+	}
+	if err != nil {
+		if netConf.KernelSidecar.Attach == "af_packet" {
+			cnivpp.CniVppDelAfPacket(netConf, hostVeth.Name)
+		}
+		delKernelSidecarLink(args.Netns, sidecarIfName)
+		return err
+	}
+
+	//
+	// Report the sidecar after the UserSpace interface, with its address.
+	//
+	result.Interfaces = append(result.Interfaces, &current.Interface{
+		Name:    sidecarIfName,
+		Sandbox: args.Netns,
+	})
+	sidecarIndex := len(result.Interfaces) - 1
+
+	ipVersion := "6"
+	if ipNet.IP.To4() != nil {
+		ipVersion = "4"
+	}
+	result.IPs = append(result.IPs, &current.IPConfig{
+		Version:   ipVersion,
+		Interface: &sidecarIndex,
+		Address:   *ipNet,
+		Gateway:   gw,
+	})
+
+	return nil
+}
+
+// delKernelSidecar() - Remove the host attachment and the veth pair. Deleting
+//  the container end of the veth pair also deletes the host end.
+func delKernelSidecar(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	var err error
+
+	sidecarIfName := getSidecarIfName(netConf, args)
+
+	info, infoErr := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if infoErr == nil && info.SidecarIfName != "" {
+		sidecarIfName = info.SidecarIfName
+	}
+
+	if netConf.KernelSidecar.Attach == "af_packet" && infoErr == nil && info.SidecarHostIfName != "" {
+		err = cnivpp.CniVppDelAfPacket(netConf, info.SidecarHostIfName)
+	}
+
+	if linkErr := delKernelSidecarLink(args.Netns, sidecarIfName); err == nil {
+		err = linkErr
+	}
+
+	return err
+}
+
+// delKernelSidecarLink() - Remove the container end of the veth pair, if it
+//  still exists.
+func delKernelSidecarLink(netnsPath string, sidecarIfName string) error {
+	if netnsPath == "" {
+		return nil
+	}
+
+	err := ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(sidecarIfName)
+		if err != nil {
+			// Already gone
+			return nil
+		}
+		return netlink.LinkDel(link)
+	})
+
+	// Gone with the netns
+	if _, ok := err.(ns.NSPathNotExistErr); ok {
+		return nil
+	}
+	return err
+}
+
+// attachHostBridge() - Add the host end of the veth pair to a Linux bridge.
+func attachHostBridge(bridgeName string, hostIfName string) error {
+	link, err := netlink.LinkByName(bridgeName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup bridge %q: %v", bridgeName, err)
+	}
+	bridge, ok := link.(*netlink.Bridge)
+	if !ok {
+		return fmt.Errorf("%q is not a bridge", bridgeName)
+	}
+
+	hostLink, err := netlink.LinkByName(hostIfName)
+	if err != nil {
+		return fmt.Errorf("failed to lookup %q: %v", hostIfName, err)
+	}
+
+	if err = netlink.LinkSetMaster(hostLink, bridge); err != nil {
+		return fmt.Errorf("failed to attach %q to bridge %q: %v", hostIfName, bridgeName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestDelKernelSidecarLink(t *testing.T) {
+	tests := []struct {
+		name      string
+		netnsPath string
+	}{
+		{"no netns", ""},
+		// The netns is removed with the container, and the link with it.
+		{"netns gone", "/var/run/netns/usrsp-test-gone"},
+	}
+
+	for _, test := range tests {
+		if err := delKernelSidecarLink(test.netnsPath, "net1-k"); err != nil {
+			t.Errorf("%s: delKernelSidecarLink() error = %v", test.name, err)
+		}
+	}
+}
+
+func TestValidateKernelSidecar(t *testing.T) {
+	tests := []struct {
+		name       string
+		address    string
+		gateway    string
+		dadTimeout int
+		wantErr    bool
+	}{
+		{"ipv4", "192.168.1.10/24", "192.168.1.1", 0, false},
+		{"ipv6", "2001:db8::10/64", "2001:db8::1", 0, false},
+		{"ipv6 host address", "2001:db8::10", "", 3, false},
+		{"ipv6 link local gateway", "2001:db8::10/64", "fe80::1", 0, false},
+		{"invalid address", "2001:db8::zz/64", "", 0, true},
+		{"invalid gateway", "192.168.1.10/24", "192.168.1", 0, true},
+		// The default route is added in the family of the address.
+		{"gateway family", "2001:db8::10/64", "192.168.1.1", 0, true},
+		{"negative dad timeout", "2001:db8::10/64", "", -1, true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = "vpp"
+		netConf.KernelSidecar.Enable = true
+		netConf.KernelSidecar.Attach = "af_packet"
+		netConf.KernelSidecar.Address = test.address
+		netConf.KernelSidecar.Gateway = test.gateway
+		netConf.KernelSidecar.DadTimeout = test.dadTimeout
+		args := &skel.CmdArgs{ContainerID: "c1", IfName: "net1", Netns: "/var/run/netns/c1"}
+
+		if err := validateKernelSidecar(netConf, args); (err != nil) != test.wantErr {
+			t.Errorf("%s: validateKernelSidecar() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseSidecarAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.1.10/24", "192.168.1.10/24", false},
+		{"192.168.1.10", "192.168.1.10/32", false},
+		{"2001:db8::10/64", "2001:db8::10/64", false},
+		{"2001:db8::10", "2001:db8::10/128", false},
+		{"net1", "", true},
+	}
+
+	for _, test := range tests {
+		ipNet, err := parseSidecarAddress(test.address)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSidecarAddress(%s) error = %v, wantErr %v", test.address, err, test.wantErr)
+			continue
+		}
+		if err == nil && ipNet.String() != test.want {
+			t.Errorf("parseSidecarAddress(%s) = %s, want %s", test.address, ipNet.String(), test.want)
+		}
+	}
+}
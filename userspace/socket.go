@@ -0,0 +1,148 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Socket Readiness: When the host side is the client of the socket (memif
+// slave, vhost-user client), the socket is created by the peer. With
+// waitForSocket set, ADD waits for the socket to appear (and, for memif, the
+// interface to connect) instead of returning a link that is not usable.
+// The memif link is polled every linkWaitInterval, up to linkWaitTimeout,
+// so the load on the VPP API can be traded against responsiveness.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/cniovs/cniovs"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+const socketPollInterval = 100 * time.Millisecond
+
+// Poll interval and maximum wait of the memif link, in milliseconds, if not
+// provided.
+const defaultLinkWaitInterval = 100
+const defaultLinkWaitTimeout = 5000
+
+//
+// Local functions
+//
+
+// isSocketClient() - Determine if the peer creates the socket of the host
+//  interface.
+func isSocketClient(netConf *usrsptypes.NetConf) bool {
+	if netConf.HostConf.Engine == "vpp" {
+		return netConf.HostConf.IfType == "memif" && netConf.HostConf.MemifConf.Role == "slave"
+	} else if netConf.HostConf.Engine == "ovs-dpdk" {
+		return cniovs.GetOvsVhostMode(netConf) == "client"
+	}
+	return false
+}
+
+// waitForSocket() - Wait, up to waitForSocket seconds, for the peer to create
+//  the socket of the attachment. For memif, also wait for the interface to
+//  connect. Does nothing if waitForSocket is 0 or the host side creates the
+//  socket.
+func waitForSocket(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if netConf.WaitForSocket == 0 || isSocketClient(netConf) == false {
+		return nil
+	}
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	err = waitForSocketFile(info.SocketPath, time.Duration(netConf.WaitForSocket)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	// A memif left admin down can't connect, so only the socket is waited for.
+	if netConf.HostConf.Engine == "vpp" && usrsptypes.IsAdminUp(&netConf.HostConf) {
+		return cnivpp.CniVppWaitForMemif(info.SwIfIndex, getLinkWaitTimeout(netConf), getLinkWaitInterval(netConf))
+	}
+
+	return nil
+}
+
+// waitForSocketFile() - Poll for the socket file until the timeout.
+func waitForSocketFile(socketPath string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if _, err := os.Stat(socketPath); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ERROR: Socket %s not created by the peer after %v", socketPath, timeout)
+		}
+		time.Sleep(socketPollInterval)
+	}
+}
+
+// getLinkWaitInterval() - Interval between polls of the memif link.
+func getLinkWaitInterval(netConf *usrsptypes.NetConf) time.Duration {
+	if netConf.LinkWaitInterval != 0 {
+		return time.Duration(netConf.LinkWaitInterval) * time.Millisecond
+	}
+	return defaultLinkWaitInterval * time.Millisecond
+}
+
+// getLinkWaitTimeout() - Maximum wait of the memif link, once the socket is
+//  created.
+func getLinkWaitTimeout(netConf *usrsptypes.NetConf) time.Duration {
+	if netConf.LinkWaitTimeout != 0 {
+		return time.Duration(netConf.LinkWaitTimeout) * time.Millisecond
+	}
+	return defaultLinkWaitTimeout * time.Millisecond
+}
+
+// validateLinkWait() - The memif link is only waited for along with the
+//  socket, by the VPP engine.
+func validateLinkWait(netConf *usrsptypes.NetConf) error {
+	if netConf.LinkWaitInterval == 0 && netConf.LinkWaitTimeout == 0 {
+		return nil
+	}
+
+	if netConf.LinkWaitInterval < 0 {
+		return fmt.Errorf("ERROR: Invalid linkWaitInterval %d", netConf.LinkWaitInterval)
+	}
+	if netConf.LinkWaitTimeout < 0 {
+		return fmt.Errorf("ERROR: Invalid linkWaitTimeout %d", netConf.LinkWaitTimeout)
+	}
+	if getLinkWaitInterval(netConf) > getLinkWaitTimeout(netConf) {
+		return fmt.Errorf("ERROR: linkWaitInterval %d larger than linkWaitTimeout %d",
+			netConf.LinkWaitInterval, netConf.LinkWaitTimeout)
+	}
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: linkWaitInterval and linkWaitTimeout require Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.WaitForSocket == 0 {
+		return fmt.Errorf("ERROR: linkWaitInterval and linkWaitTimeout require waitForSocket")
+	}
+
+	return nil
+}
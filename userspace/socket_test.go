@@ -0,0 +1,180 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+func TestIsSocketClient(t *testing.T) {
+	tests := []struct {
+		name          string
+		engine        string
+		ifType        string
+		memifRole     string
+		hostMode      string
+		containerMode string
+		want          bool
+	}{
+		{"vpp memif slave", "vpp", "memif", "slave", "", "", true},
+		{"vpp memif master", "vpp", "memif", "master", "", "", false},
+		{"vpp vhostuser", "vpp", "vhostuser", "", "", "", false},
+		{"ovs client", "ovs-dpdk", "vhostuser", "", "client", "", true},
+		{"ovs container server", "ovs-dpdk", "vhostuser", "", "", "server", true},
+		{"ovs server", "ovs-dpdk", "vhostuser", "", "", "", false},
+		{"unknown engine", "linux", "", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = test.engine
+		netConf.HostConf.IfType = test.ifType
+		netConf.HostConf.MemifConf.Role = test.memifRole
+		netConf.HostConf.VhostConf.Mode = test.hostMode
+		netConf.ContainerConf.VhostConf.Mode = test.containerMode
+
+		if got := isSocketClient(netConf); got != test.want {
+			t.Errorf("%s: isSocketClient() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Without waitForSocket, or when the host side creates the socket, ADD does
+// not wait or even read the attachment data.
+func TestWaitForSocketDisabled(t *testing.T) {
+	tests := []struct {
+		name          string
+		waitForSocket int
+		memifRole     string
+	}{
+		{"disabled", 0, "slave"},
+		{"host creates the socket", 10, "master"},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{WaitForSocket: test.waitForSocket}
+		netConf.HostConf.Engine = "vpp"
+		netConf.HostConf.IfType = "memif"
+		netConf.HostConf.MemifConf.Role = test.memifRole
+
+		if err := waitForSocket(netConf, &skel.CmdArgs{ContainerID: "unknown", IfName: "net1"}); err != nil {
+			t.Errorf("%s: waitForSocket() error = %v", test.name, err)
+		}
+	}
+}
+
+func TestWaitForSocketFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usrsp-socket")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		create  bool
+		wantErr bool
+	}{
+		{"created by the peer", true, false},
+		{"never created", false, true},
+	}
+
+	for _, test := range tests {
+		socketPath := filepath.Join(dir, test.name+".sock")
+
+		// The peer creates the socket once the wait started.
+		listeners := make(chan net.Listener, 1)
+		go func(create bool) {
+			var listener net.Listener
+			if create {
+				time.Sleep(3 * socketPollInterval)
+				listener, _ = net.Listen("unix", socketPath)
+			}
+			listeners <- listener
+		}(test.create)
+
+		err := waitForSocketFile(socketPath, 500*time.Millisecond)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: waitForSocketFile() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+
+		if listener := <-listeners; listener != nil {
+			listener.Close()
+		}
+	}
+}
+
+func TestValidateLinkWait(t *testing.T) {
+	tests := []struct {
+		name          string
+		engine        string
+		waitForSocket int
+		interval      int
+		timeout       int
+		wantErr       bool
+	}{
+		{"unset", "ovs-dpdk", 0, 0, 0, false},
+		{"interval and timeout", "vpp", 10, 50, 2000, false},
+		{"interval only", "vpp", 10, 50, 0, false},
+		{"interval above default timeout", "vpp", 10, 6000, 0, true},
+		{"interval above timeout", "vpp", 10, 500, 100, true},
+		{"negative interval", "vpp", 10, -1, 0, true},
+		{"negative timeout", "vpp", 10, 0, -1, true},
+		{"ovs", "ovs-dpdk", 10, 50, 2000, true},
+		{"without waitForSocket", "vpp", 0, 50, 2000, true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{
+			WaitForSocket:    test.waitForSocket,
+			LinkWaitInterval: test.interval,
+			LinkWaitTimeout:  test.timeout,
+		}
+		netConf.HostConf.Engine = test.engine
+
+		err := validateLinkWait(netConf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validateLinkWait() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestGetLinkWait(t *testing.T) {
+	netConf := &usrsptypes.NetConf{}
+	if got := getLinkWaitInterval(netConf); got != defaultLinkWaitInterval*time.Millisecond {
+		t.Errorf("default getLinkWaitInterval() = %v", got)
+	}
+	if got := getLinkWaitTimeout(netConf); got != defaultLinkWaitTimeout*time.Millisecond {
+		t.Errorf("default getLinkWaitTimeout() = %v", got)
+	}
+
+	netConf.LinkWaitInterval = 20
+	netConf.LinkWaitTimeout = 300
+	if got := getLinkWaitInterval(netConf); got != 20*time.Millisecond {
+		t.Errorf("getLinkWaitInterval() = %v, want 20ms", got)
+	}
+	if got := getLinkWaitTimeout(netConf); got != 300*time.Millisecond {
+		t.Errorf("getLinkWaitTimeout() = %v, want 300ms", got)
+	}
+}
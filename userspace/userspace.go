@@ -15,22 +15,41 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
+	types020 "github.com/containernetworking/cni/pkg/types/020"
 	"github.com/containernetworking/cni/pkg/types/current"
 	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
-	"github.com/containernetworking/plugins/pkg/ipam"
 	"github.com/containernetworking/plugins/pkg/ns"
 
 	"github.com/Billy99/user-space-net-plugin/cniovs/cniovs"
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
 	"github.com/Billy99/user-space-net-plugin/cnivpp/cnivpp"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
 	"github.com/Billy99/user-space-net-plugin/usrsptypes"
 
+	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 )
 
@@ -41,21 +60,1396 @@ func init() {
 	runtime.LockOSThread()
 }
 
+//
+// Constants
+//
+
+// CNI version of the Result if cniVersion is not provided in the config.
+const defaultCniVersion = "0.2.0"
+
+// Host Engine used if not provided in the config. It can be overridden on
+// a node with the USERSPACE_DEFAULT_ENGINE environment variable.
+const defaultEngine = "vpp"
+
+// Default number of seconds to wait on the IPAM plugin if not provided.
+const defaultIpamTimeout = 60
+
+// Default number of milliseconds before the first IPAM retry if not provided.
+const defaultIpamRetryDelay = 100
+
+// Default number of seconds verifyConnectivity waits for a reply if not provided.
+const defaultProbeTimeout = 5
+
+// Steps of DEL, in order, reported when the cleanup times out.
+var delSteps = []string{"config", "ipam", "portmap", "hostaddr", "sidecar", "resolvconf", "host", "container", "netns"}
+
+// Cleanups of DEL still running, abandoned ones included, waited for by the
+// daemon before the next command changes the environment and stdout.
+var pendingDels sync.WaitGroup
+
+// Maximum number of packets of debugTrace, and time they are traced for,
+// so a failed ADD is only delayed by debugTraceWait.
+const maxDebugTrace = 1000
+const debugTraceWait = 2 * time.Second
+
+// Keys of the config passed to the IPAM plugin with ipamStrictConf, the
+// standard CNI keys. The ipam section is passed without the keys used by
+// the UserSpace CNI (see usrsptypes.IpamConf).
+var ipamStrictConfKeys = []string{"cniVersion", "name", "type", "args", "ipMasq", "ipam", "dns", "runtimeConfig", "prevResult"}
+var ipamLocalKeys = []string{"timeout", "retries", "retryDelay"}
+
+// Tenant names, used as a directory name for the memif sockets.
+var tenantRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// OVS port prefixes, the start of a device and socket file name.
+var ovsPortPrefixRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// CNI error code skel returns for a failed command. Codes below 100 are
+// reserved by the CNI spec.
+const errCodeCommandFailed = 100
+
+// CNI error code returned when the node has no room for another attachment,
+// see USERSPACE_MAX_ATTACHMENTS.
+const errCodeResourcesExhausted = 101
+
+// CNI error code returned when the configuration can't be read, see
+// USERSPACE_MAX_CONF_SIZE.
+const errCodeInvalidConf = 102
+
+// CNI error code returned by DEL when neither the configuration nor the
+// saved state of the attachment can be read, so nothing can be removed.
+const errCodeStateUnknown = 103
+
+// CNI error code returned when a state file of the plugin is corrupt, see
+// cleanup.go.
+const errCodeCorruptState = 104
+
+// CNI error code returned when a panic is recovered, see recoverPanic().
+const errCodePanic = 105
+
+// IPAM errors that are worth retrying, besides a timeout (see
+// ipamTimeoutError). Anything else, like address exhaustion, fails
+// immediately.
+var retryableIpamErrors = []string{
+	"resource temporarily unavailable",
+	"try again",
+	"connection refused",
+	"text file busy",
+}
+
 //
 // Local functions
 //
 
-// loadNetConf() - Unmarshall the inputdata into the NetConf Structure
-func loadNetConf(bytes []byte) (*usrsptypes.NetConf, error) {
-	n := &usrsptypes.NetConf{}
-	if err := json.Unmarshal(bytes, n); err != nil {
-		return nil, fmt.Errorf("failed to load netconf: %v", err)
+// loadNetConf() - Unmarshall the inputdata into the NetConf Structure
+func loadNetConf(bytes []byte) (*usrsptypes.NetConf, error) {
+	maxConfSize, err := getMaxConfSize()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := usrsptypes.ParseNetConf(bytes, maxConfSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.CNIVersion == "" {
+		n.CNIVersion = defaultCniVersion
+	}
+
+	if n.HostConf.Engine == "" {
+		n.HostConf.Engine = getDefaultEngine()
+		logrus.Infof("No host engine provided, using default engine %s", n.HostConf.Engine)
+	}
+
+	err = validateRxMode(n)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateLinkState(n)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateStaticRoutes(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// getMaxConfSize() - Maximum size of the configuration, in bytes, set with
+//  the USERSPACE_MAX_CONF_SIZE environment variable.
+func getMaxConfSize() (int, error) {
+	value, ok := os.LookupEnv("USERSPACE_MAX_CONF_SIZE")
+	if ok == false || value == "" {
+		return usrsptypes.DefaultMaxConfSize, nil
+	}
+
+	maxConfSize, err := strconv.Atoi(value)
+	if err != nil || maxConfSize <= 0 {
+		return 0, fmt.Errorf("ERROR: Invalid USERSPACE_MAX_CONF_SIZE: %s", value)
+	}
+	return maxConfSize, nil
+}
+
+// limitStdin() - Read the configuration from stdin before skel does, up to
+//  the maximum configuration size, so a huge input is never read in full.
+//  skel then reads the configuration back from a pipe. The configuration is
+//  returned for forwardToDaemon().
+func limitStdin() ([]byte, error) {
+	maxConfSize, err := getMaxConfSize()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(os.Stdin, int64(maxConfSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to read the configuration: %v", err)
+	}
+	if len(data) > maxConfSize {
+		return nil, fmt.Errorf("ERROR: configuration is larger than the maximum of %d bytes", maxConfSize)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		writer.Write(data)
+		writer.Close()
+	}()
+	os.Stdin = reader
+
+	return data, nil
+}
+
+// getDefaultEngine() - Return the Host Engine to use if not provided.
+func getDefaultEngine() string {
+	if engine, ok := os.LookupEnv("USERSPACE_DEFAULT_ENGINE"); ok && engine != "" {
+		return engine
+	}
+	return defaultEngine
+}
+
+// setVppRetryPolicy() - Apply the retry policy of the VPP requests answered
+//  with a transient retval, set with the USERSPACE_VPP_RETRY_ATTEMPTS (1 for
+//  no retry) and USERSPACE_VPP_RETRY_BACKOFF (like 50ms) environment
+//  variables.
+func setVppRetryPolicy() error {
+	attempts := vppinfra.DefaultRetryAttempts
+	backoff := vppinfra.DefaultRetryBackoff
+
+	if value, ok := os.LookupEnv("USERSPACE_VPP_RETRY_ATTEMPTS"); ok && value != "" {
+		var err error
+		attempts, err = strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return fmt.Errorf("ERROR: Invalid USERSPACE_VPP_RETRY_ATTEMPTS: %s", value)
+		}
+	}
+
+	if value, ok := os.LookupEnv("USERSPACE_VPP_RETRY_BACKOFF"); ok && value != "" {
+		var err error
+		backoff, err = time.ParseDuration(value)
+		if err != nil || backoff < 0 {
+			return fmt.Errorf("ERROR: Invalid USERSPACE_VPP_RETRY_BACKOFF: %s", value)
+		}
+	}
+
+	vppinfra.SetRetryPolicy(attempts, backoff)
+	return nil
+}
+
+// checkMaxAttachments() - Refuse a new attachment if the node already has
+//  the maximum number of attachments, set with the USERSPACE_MAX_ATTACHMENTS
+//  environment variable (unset or 0 for no limit). The attachments are
+//  counted from the saved attachment data, which a failed ADD removes on
+//  rollback. An ADD repeated for an existing attachment is not refused.
+func checkMaxAttachments(args *skel.CmdArgs) error {
+	value, ok := os.LookupEnv("USERSPACE_MAX_ATTACHMENTS")
+	if ok == false || value == "" {
+		return nil
+	}
+
+	maxAttachments, err := strconv.Atoi(value)
+	if err != nil || maxAttachments < 0 {
+		return fmt.Errorf("ERROR: Invalid USERSPACE_MAX_ATTACHMENTS: %s", value)
+	}
+	if maxAttachments == 0 {
+		return nil
+	}
+
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, info := range attachments {
+		if info.ContainerID == args.ContainerID && info.IfName == args.IfName {
+			return nil
+		}
+		count++
+	}
+
+	logrus.Debugf("%d of %d attachments in use on the node", count, maxAttachments)
+
+	if count >= maxAttachments {
+		return &cnitypes.Error{
+			Code:    errCodeResourcesExhausted,
+			Msg:     "resources exhausted",
+			Details: fmt.Sprintf("%d of %d attachments in use on the node", count, maxAttachments),
+		}
+	}
+
+	return nil
+}
+
+// validateCniVersion() - Make sure a Result can be produced in the requested
+//  CNI version, before any work is done. Otherwise a typo in cniVersion is
+//  only found when the Result is printed, after the interfaces are created.
+func validateCniVersion(netConf *usrsptypes.NetConf) error {
+	if _, err := (&current.Result{}).GetAsVersion(netConf.CNIVersion); err != nil {
+		return &cnitypes.Error{
+			Code: cnitypes.ErrIncompatibleCNIVersion,
+			Msg:  "incompatible CNI versions",
+			Details: fmt.Sprintf("config is %q, plugin supports %q",
+				netConf.CNIVersion, cniSpecVersion.All.SupportedVersions()),
+		}
+	}
+
+	return nil
+}
+
+// validateNat() - NAT is only implemented by the VPP engine, on the host
+//  interface, and needs a routed (L3) interface. Members already in use
+//  by another bond can only be detected once connected to VPP.
+func validateNat(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.NatConf.Enable {
+		return fmt.Errorf("ERROR: nat is only supported in the host section")
+	}
+
+	if netConf.HostConf.NatConf.Enable == false {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: nat requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.NetType != "interface" {
+		return fmt.Errorf("ERROR: nat requires Host netType interface, not %s", netConf.HostConf.NetType)
+	}
+	if netConf.HostConf.NatConf.Uplink == "" {
+		return fmt.Errorf("ERROR: nat requires an uplink interface")
+	}
+
+	bondConf := netConf.HostConf.NatConf.CreateBond
+	if len(bondConf.Members) == 0 {
+		if bondConf.Mode != "" || bondConf.LoadBalance != "" {
+			return fmt.Errorf("ERROR: nat createBond requires members")
+		}
+		return nil
+	}
+
+	mode := bondConf.Mode
+	if mode != "" && mode != "round-robin" && mode != "active-backup" &&
+		mode != "xor" && mode != "broadcast" && mode != "lacp" {
+		return fmt.Errorf("ERROR: Invalid nat createBond mode: %s", mode)
+	}
+	if lb := bondConf.LoadBalance; lb != "" {
+		if lb != "l2" && lb != "l23" && lb != "l34" {
+			return fmt.Errorf("ERROR: Invalid nat createBond loadBalance: %s", lb)
+		}
+		if mode != "" && mode != "xor" && mode != "lacp" {
+			return fmt.Errorf("ERROR: nat createBond loadBalance requires mode xor or lacp, not %s", mode)
+		}
+	}
+	for i, member := range bondConf.Members {
+		if member == "" || member == netConf.HostConf.NatConf.Uplink {
+			return fmt.Errorf("ERROR: Invalid nat createBond member: %s", member)
+		}
+		for _, other := range bondConf.Members[:i] {
+			if other == member {
+				return fmt.Errorf("ERROR: nat createBond member %s listed twice", member)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePortMappings() - Port mappings (hostPort) are installed as NAT44
+//  static mappings, so they require the VPP engine with nat enabled. They
+//  are rejected instead of being silently ignored.
+func validatePortMappings(netConf *usrsptypes.NetConf) error {
+	if len(netConf.RuntimeConfig.PortMaps) == 0 {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return usrsptypes.NewEngineNotSupportedError(netConf.HostConf.Engine, "portMappings")
+	}
+	if netConf.HostConf.NatConf.Enable == false {
+		return fmt.Errorf("ERROR: portMappings require nat to be enabled")
+	}
+
+	for _, portMap := range netConf.RuntimeConfig.PortMaps {
+		protocol := strings.ToLower(portMap.Protocol)
+		if protocol != "" && protocol != "tcp" && protocol != "udp" {
+			return fmt.Errorf("ERROR: portMappings protocol %s not supported", portMap.Protocol)
+		}
+		if portMap.HostPort <= 0 || portMap.HostPort > 65535 ||
+			portMap.ContainerPort <= 0 || portMap.ContainerPort > 65535 {
+			return fmt.Errorf("ERROR: Invalid portMappings port %d:%d", portMap.HostPort, portMap.ContainerPort)
+		}
+	}
+
+	return nil
+}
+
+// validateHostAddress() - An address on the host interface is only
+//  programmed by the VPP engine, and needs a routed (L3) interface.
+func validateHostAddress(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.Address != "" {
+		return fmt.Errorf("ERROR: address is only supported in the host section")
+	}
+
+	if netConf.HostConf.Address == "" {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: address requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.NetType != "interface" {
+		return fmt.Errorf("ERROR: address requires Host netType interface, not %s", netConf.HostConf.NetType)
+	}
+	if netConf.HostConf.Address != "auto" {
+		if _, _, err := net.ParseCIDR(netConf.HostConf.Address); err != nil {
+			return fmt.Errorf("ERROR: Invalid address %s: %v", netConf.HostConf.Address, err)
+		}
+	}
+
+	return nil
+}
+
+// validateUnnumbered() - Unnumbered interfaces are only implemented by the
+//  VPP engine, on the host interface, and need a routed (L3) interface. The
+//  interface borrows its address, so it can't also be given a gateway
+//  address. routeTable only applies to the host routes of an unnumbered
+//  interface.
+func validateUnnumbered(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.Unnumbered {
+		return fmt.Errorf("ERROR: unnumbered is only supported in the host section")
+	}
+	if netConf.ContainerConf.RouteTable != 0 {
+		return fmt.Errorf("ERROR: routeTable is only supported in the host section")
+	}
+
+	if netConf.HostConf.Unnumbered == false {
+		if netConf.HostConf.UnnumberedParent != "" {
+			return fmt.Errorf("ERROR: unnumberedParent requires unnumbered")
+		}
+		if netConf.HostConf.RouteTable != 0 {
+			return fmt.Errorf("ERROR: routeTable requires unnumbered")
+		}
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: unnumbered requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.NetType != "interface" {
+		return fmt.Errorf("ERROR: unnumbered requires Host netType interface, not %s", netConf.HostConf.NetType)
+	}
+	if netConf.HostConf.Address != "" {
+		return fmt.Errorf("ERROR: unnumbered can't be used with a host address")
+	}
+
+	return nil
+}
+
+// validateMemif() - socketFile and attachOnly are only implemented by the
+//  VPP engine, on the host interface. An attached memif connects to a socket
+//  owned by someone else, so it has to be the slave.
+func validateMemif(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.MemifConf.SocketFile != "" || netConf.ContainerConf.MemifConf.AttachOnly {
+		return fmt.Errorf("ERROR: memif socketFile and attachOnly are only supported in the host section")
+	}
+
+	memifConf := netConf.HostConf.MemifConf
+	if memifConf.SocketFile == "" && memifConf.AttachOnly == false {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: memif socketFile requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.IfType != "memif" {
+		return fmt.Errorf("ERROR: memif socketFile requires Host type memif, not %s", netConf.HostConf.IfType)
+	}
+	if memifConf.SocketFile != "" && filepath.IsAbs(memifConf.SocketFile) == false {
+		return fmt.Errorf("ERROR: memif socketFile %s is not an absolute path", memifConf.SocketFile)
+	}
+
+	if memifConf.AttachOnly {
+		if memifConf.SocketFile == "" {
+			return fmt.Errorf("ERROR: memif attachOnly requires socketFile")
+		}
+		if memifConf.Role != "slave" {
+			return fmt.Errorf("ERROR: memif attachOnly requires role slave, not %s", memifConf.Role)
+		}
+	}
+
+	return nil
+}
+
+// validateMemifId() - The memif id is set in the container section, for the
+//  container app, and used by the VPP engine for the host end. It must be
+//  unique on the socket.
+func validateMemifId(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if netConf.HostConf.MemifConf.Id != 0 {
+		return fmt.Errorf("ERROR: memif id is only supported in the container section")
+	}
+
+	memifId := netConf.ContainerConf.MemifConf.Id
+	if memifId == 0 {
+		return nil
+	}
+
+	if memifId < 0 || int64(memifId) > math.MaxUint32 {
+		return fmt.Errorf("ERROR: Invalid memif id %d", memifId)
+	}
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: memif id requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.IfType != "memif" {
+		return fmt.Errorf("ERROR: memif id requires Host type memif, not %s", netConf.HostConf.IfType)
+	}
+
+	return cnivpp.CniVppCheckMemifId(netConf, args)
+}
+
+// validateAdminUp() - Leaving the interface admin down is only implemented
+//  by the VPP engine, and can't be combined with verifyConnectivity, which
+//  needs the link up.
+func validateAdminUp(netConf *usrsptypes.NetConf) error {
+	containerEngine := netConf.ContainerConf.Engine
+	if containerEngine == "" {
+		containerEngine = netConf.HostConf.Engine
+	}
+
+	if usrsptypes.IsAdminUp(&netConf.HostConf) == false {
+		if netConf.HostConf.Engine != "vpp" {
+			return fmt.Errorf("ERROR: adminUp false requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+		}
+		if netConf.VerifyConnectivity {
+			return fmt.Errorf("ERROR: verifyConnectivity can't be used with Host adminUp false")
+		}
+	}
+	if usrsptypes.IsAdminUp(&netConf.ContainerConf) == false && containerEngine != "vpp" {
+		return fmt.Errorf("ERROR: adminUp false requires Container Engine vpp, not %s", containerEngine)
+	}
+
+	return nil
+}
+
+// validateRxMode() - rxMode is one of the rx modes of VPP, and is only
+//  applied to the host interface.
+func validateRxMode(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.RxMode != "" {
+		return fmt.Errorf("ERROR: rxMode is only supported in the host section")
+	}
+
+	switch netConf.HostConf.RxMode {
+	case "", "polling", "interrupt", "adaptive":
+		return nil
+	}
+	return fmt.Errorf("ERROR: Invalid rxMode %s, must be polling, interrupt or adaptive", netConf.HostConf.RxMode)
+}
+
+// validateLinkState() - reportLinkState reads the link state of the host
+//  memif, the container reads it from its data.
+func validateLinkState(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.ReportLinkState {
+		return fmt.Errorf("ERROR: reportLinkState is only supported in the host section")
+	}
+
+	if netConf.HostConf.ReportLinkState && netConf.HostConf.IfType != "memif" {
+		return fmt.Errorf("ERROR: reportLinkState requires iftype memif, not %s", netConf.HostConf.IfType)
+	}
+	return nil
+}
+
+// validateStaticRoutes() - Each route has a destination (CIDR), an optional
+//  gateway of the same family, and a metric and weight VPP can hold. Routes
+//  are only installed on an interface of netType interface.
+func validateStaticRoutes(netConf *usrsptypes.NetConf) error {
+	sections := []struct {
+		name          string
+		userSpaceConf *usrsptypes.UserSpaceConf
+	}{
+		{"Host", &netConf.HostConf},
+		{"Container", &netConf.ContainerConf},
+	}
+
+	for _, section := range sections {
+		if len(section.userSpaceConf.Routes) == 0 {
+			continue
+		}
+
+		netType := section.userSpaceConf.NetType
+		if netType == "" {
+			netType = netConf.HostConf.NetType
+		}
+		if netType != "interface" {
+			return fmt.Errorf("ERROR: routes require %s netType interface, not %s", section.name, netType)
+		}
+
+		for _, route := range section.userSpaceConf.Routes {
+			_, dst, err := net.ParseCIDR(route.Dst)
+			if err != nil {
+				return fmt.Errorf("ERROR: Invalid %s route dst %s, must be in CIDR notation", section.name, route.Dst)
+			}
+			if route.Gw != "" {
+				gw := net.ParseIP(route.Gw)
+				if gw == nil {
+					return fmt.Errorf("ERROR: Invalid %s route gw %s", section.name, route.Gw)
+				}
+				if (gw.To4() == nil) != (dst.IP.To4() == nil) {
+					return fmt.Errorf("ERROR: %s route gw %s is not of the family of dst %s", section.name, route.Gw, route.Dst)
+				}
+			}
+			if route.Metric < 0 || route.Metric > math.MaxUint8 {
+				return fmt.Errorf("ERROR: Invalid %s route metric %d for dst %s, must be 0-255", section.name, route.Metric, route.Dst)
+			}
+			if route.Weight < 0 || route.Weight > math.MaxUint8 {
+				return fmt.Errorf("ERROR: Invalid %s route weight %d for dst %s, must be 1-255 (0 for the default of 1)", section.name, route.Weight, route.Dst)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateContainerRoutes() - Routes of the container section are installed
+//  by the VPP of the container. The engine of the host section is checked
+//  with its capabilities.
+func validateContainerRoutes(netConf *usrsptypes.NetConf) error {
+	containerEngine := netConf.ContainerConf.Engine
+	if containerEngine == "" {
+		containerEngine = netConf.HostConf.Engine
+	}
+
+	if len(netConf.ContainerConf.Routes) != 0 && containerEngine != "vpp" {
+		return fmt.Errorf("ERROR: Container routes require Container Engine vpp, not %s", containerEngine)
+	}
+	return nil
+}
+
+// validateSocketType() - socketType is filesystem or abstract, and is only
+//  set on the host interface, which owns the socket. Whether the engine
+//  supports abstract sockets is checked with its capabilities.
+func validateSocketType(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.SocketType != "" {
+		return fmt.Errorf("ERROR: socketType is only supported in the host section")
+	}
+
+	switch netConf.HostConf.SocketType {
+	case "", "filesystem", "abstract":
+		return nil
+	}
+	return fmt.Errorf("ERROR: Invalid socketType %s, must be filesystem or abstract", netConf.HostConf.SocketType)
+}
+
+// validateHugepages() - The hugepage layout is only passed to the container
+//  by the vpp container engine. The mount path must exist on the node.
+func validateHugepages(netConf *usrsptypes.NetConf) error {
+	hugepages := &netConf.Hugepages
+	if hugepages.MountPath == "" {
+		if len(hugepages.SocketMem) != 0 {
+			return fmt.Errorf("ERROR: hugepages socketMem requires mountPath")
+		}
+		return nil
+	}
+
+	if containerEngine := usrsptypes.GetContainerEngine(netConf); containerEngine != "vpp" {
+		return fmt.Errorf("ERROR: hugepages requires Container Engine vpp, not %s", containerEngine)
+	}
+	if filepath.IsAbs(hugepages.MountPath) == false {
+		return fmt.Errorf("ERROR: hugepages mountPath %s must be an absolute path", hugepages.MountPath)
+	}
+	if info, err := os.Stat(hugepages.MountPath); err != nil {
+		return fmt.Errorf("ERROR: hugepages mountPath %s not found: %v", hugepages.MountPath, err)
+	} else if info.IsDir() == false {
+		return fmt.Errorf("ERROR: hugepages mountPath %s is not a directory", hugepages.MountPath)
+	}
+	for socket, mem := range hugepages.SocketMem {
+		if mem < 0 {
+			return fmt.Errorf("ERROR: hugepages socketMem %d of socket %d must not be negative", mem, socket)
+		}
+	}
+
+	return nil
+}
+
+// validateTenant() - The tenant names a directory of memif sockets, so it
+//  is limited to characters safe in a file name.
+func validateTenant(netConf *usrsptypes.NetConf) error {
+	if netConf.Tenant == "" {
+		return nil
+	}
+
+	if tenantRegexp.MatchString(netConf.Tenant) == false {
+		return fmt.Errorf("ERROR: Invalid tenant %s, must be letters, digits, '-', '_' or '.' and start with a letter or digit", netConf.Tenant)
+	}
+
+	return nil
+}
+
+// validateSharedDirMode() - sharedDirMode must be an octal permission mode.
+func validateSharedDirMode(netConf *usrsptypes.NetConf) error {
+	_, err := usrsptypes.GetSharedDirMode(netConf)
+	return err
+}
+
+// validateBridge() - The split horizon group and BVI options of a bridge
+//  are only implemented by the VPP engine, in either section.
+func validateBridge(netConf *usrsptypes.NetConf) error {
+	err := validateBridgeConf("host", &netConf.HostConf, netConf.HostConf.Engine)
+	if err != nil {
+		return err
+	}
+
+	return validateBridgeConf("container", &netConf.ContainerConf, netConf.HostConf.Engine)
+}
+
+func validateBridgeConf(section string, userSpaceConf *usrsptypes.UserSpaceConf, defaultEngine string) error {
+	bridgeConf := userSpaceConf.BridgeConf
+	if bridgeConf.Shg == 0 && bridgeConf.Bvi == false {
+		return nil
+	}
+
+	engine := userSpaceConf.Engine
+	if engine == "" {
+		engine = defaultEngine
+	}
+	if engine != "vpp" {
+		return fmt.Errorf("ERROR: bridge shg and bvi require %s Engine vpp, not %s", section, engine)
+	}
+	if userSpaceConf.NetType != "bridge" {
+		return fmt.Errorf("ERROR: bridge shg and bvi require %s netType bridge, not %s", section, userSpaceConf.NetType)
+	}
+	if bridgeConf.Shg < 0 || bridgeConf.Shg > 255 {
+		return fmt.Errorf("ERROR: Invalid %s bridge shg %d, must be 0-255", section, bridgeConf.Shg)
+	}
+
+	return nil
+}
+
+// validatePunt() - Punt to a kernel tap is only implemented by the VPP
+//  engine, on the host interface, and needs a routed (L3) interface and
+//  the container netns.
+func validatePunt(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if len(netConf.ContainerConf.PuntConf.Rules) != 0 {
+		return fmt.Errorf("ERROR: punt is only supported in the host section")
+	}
+
+	if len(netConf.HostConf.PuntConf.Rules) == 0 {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: punt requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.NetType != "interface" {
+		return fmt.Errorf("ERROR: punt requires Host netType interface, not %s", netConf.HostConf.NetType)
+	}
+	if args.Netns == "" {
+		return fmt.Errorf("ERROR: punt requires a network namespace")
+	}
+
+	for _, rule := range netConf.HostConf.PuntConf.Rules {
+		protocol := strings.ToLower(rule.Protocol)
+		if protocol != "tcp" && protocol != "udp" {
+			return fmt.Errorf("ERROR: punt protocol %s not supported", rule.Protocol)
+		}
+		if rule.Port <= 0 || rule.Port > 65535 {
+			return fmt.Errorf("ERROR: Invalid punt port %d", rule.Port)
+		}
+	}
+
+	return nil
+}
+
+// validateVhostFeatures() - Virtio features are set by the VPP engine when
+//  the host vhost-user interface is created, so the features supported by
+//  the VPP API are checked before anything is created.
+func validateVhostFeatures(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.VhostConf.Features != (usrsptypes.VhostFeatures{}) {
+		return fmt.Errorf("ERROR: vhost features are only supported in the host section")
+	}
+
+	if netConf.HostConf.VhostConf.Features == (usrsptypes.VhostFeatures{}) {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: vhost features require Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.HostConf.IfType != "vhostuser" {
+		return fmt.Errorf("ERROR: vhost features require Host ifType vhostuser, not %s", netConf.HostConf.IfType)
+	}
+
+	return cnivpp.CniVppCheckVhostFeatures(&netConf.HostConf.VhostConf.Features)
+}
+
+// validateConnectivityProbe() - The connectivity probe is sent by the host
+//  VPP instance.
+func validateConnectivityProbe(netConf *usrsptypes.NetConf) error {
+	if netConf.VerifyConnectivity == false {
+		if netConf.VerifyStrict != nil {
+			return fmt.Errorf("ERROR: verifyStrict requires verifyConnectivity")
+		}
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: verifyConnectivity requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.ProbeTarget != "" && net.ParseIP(netConf.ProbeTarget) == nil {
+		return fmt.Errorf("ERROR: Invalid probeTarget: %s", netConf.ProbeTarget)
+	}
+	if netConf.ProbeTimeout < 0 {
+		return fmt.Errorf("ERROR: Invalid probeTimeout %d", netConf.ProbeTimeout)
+	}
+
+	return nil
+}
+
+// validateDebugTrace() - The packet trace is captured in the host VPP
+//  instance, when the memif link wait or the connectivity probe fails.
+func validateDebugTrace(netConf *usrsptypes.NetConf) error {
+	if netConf.DebugTrace == 0 {
+		return nil
+	}
+
+	if netConf.DebugTrace < 0 || netConf.DebugTrace > maxDebugTrace {
+		return fmt.Errorf("ERROR: Invalid debugTrace %d, must be 1-%d", netConf.DebugTrace, maxDebugTrace)
+	}
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: debugTrace requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+	if netConf.VerifyConnectivity == false && netConf.WaitForSocket == 0 {
+		return fmt.Errorf("ERROR: debugTrace requires verifyConnectivity or waitForSocket")
+	}
+
+	return nil
+}
+
+// captureDebugTrace() - With debugTrace, trace the packets VPP receives for
+//  debugTraceWait after a failed link or connectivity check, and log the
+//  trace. The error of the check is returned, pointing at the trace.
+func captureDebugTrace(netConf *usrsptypes.NetConf, checkErr error) error {
+	if netConf.DebugTrace == 0 || netConf.HostConf.Engine != "vpp" {
+		return checkErr
+	}
+
+	trace, err := cnivpp.CniVppCaptureTrace(netConf, netConf.DebugTrace, debugTraceWait)
+	if err != nil {
+		logrus.WithField("step", "trace").Warningf("Failed to capture the packet trace: %v", err)
+		return checkErr
+	}
+
+	logrus.WithField("step", "trace").Warningf("Packet trace after the failure:\n%s", trace)
+	return fmt.Errorf("%v (packet trace logged with step trace)", checkErr)
+}
+
+// validateDelTimeout() - delTimeout is in seconds, 0 waits forever.
+func validateDelTimeout(netConf *usrsptypes.NetConf) error {
+	if netConf.DelTimeout < 0 {
+		return fmt.Errorf("ERROR: Invalid delTimeout %d", netConf.DelTimeout)
+	}
+	if netConf.DelTimeoutFail && netConf.DelTimeout == 0 {
+		return fmt.Errorf("ERROR: delTimeoutFail requires delTimeout")
+	}
+	return nil
+}
+
+// getProbeTimeout() - Return the time verifyConnectivity waits for a reply.
+func getProbeTimeout(netConf *usrsptypes.NetConf) time.Duration {
+	if netConf.ProbeTimeout > 0 {
+		return time.Duration(netConf.ProbeTimeout) * time.Second
+	}
+	return defaultProbeTimeout * time.Second
+}
+
+// validateHostIfName() - The host interface name is the VPP tag used to
+//  find the interface again (see cnivpp.ResolveAttachment()), so it has to
+//  be unique on the node, and carry the interface name prefix.
+func validateHostIfName(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if netConf.HostIfName == "" {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: hostIfName requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+
+	// An unmanaged interface is named by whoever provisioned it.
+	if prefix := usrsptypes.GetIfNamePrefix(); usrsptypes.IsManaged(&netConf.HostConf) && strings.HasPrefix(netConf.HostIfName, prefix) == false {
+		return fmt.Errorf("ERROR: hostIfName %s does not start with the interface name prefix %s", netConf.HostIfName, prefix)
+	}
+
+	attachments, err := usrspdb.ListAttachments()
+	if err != nil {
+		return err
+	}
+	for _, info := range attachments {
+		if info.Tag == netConf.HostIfName && (info.ContainerID != args.ContainerID || info.IfName != args.IfName) {
+			return fmt.Errorf("ERROR: hostIfName %s already used by container %s interface %s",
+				netConf.HostIfName, info.ContainerID, info.IfName)
+		}
+	}
+
+	return nil
+}
+
+// validateOvsPortPrefix() - The OVS port prefix only applies to the ports
+//  created by the ovs-dpdk engine. It is short enough to leave room for the
+//  suffix of the port name, and only uses characters valid in a device and
+//  file name.
+func validateOvsPortPrefix(netConf *usrsptypes.NetConf) error {
+	if netConf.OvsPortPrefix == "" {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "ovs-dpdk" {
+		return fmt.Errorf("ERROR: ovsPortPrefix requires Host Engine ovs-dpdk, not %s", netConf.HostConf.Engine)
+	}
+	if len(netConf.OvsPortPrefix) > usrsptypes.MaxOvsPortPrefix {
+		return fmt.Errorf("ERROR: ovsPortPrefix %s is longer than %d characters", netConf.OvsPortPrefix, usrsptypes.MaxOvsPortPrefix)
+	}
+	if ovsPortPrefixRegexp.MatchString(netConf.OvsPortPrefix) == false {
+		return fmt.Errorf("ERROR: Invalid ovsPortPrefix %s, only letters, digits, - and _ are allowed", netConf.OvsPortPrefix)
+	}
+
+	return nil
+}
+
+// validateManaged() - With managed false, the host interface is provisioned
+//  outside the plugin and found by hostIfName, in the host VPP. The host
+//  options programming the interface would be ignored, so they are refused.
+func validateManaged(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.Managed != nil {
+		return fmt.Errorf("ERROR: managed is only supported in the host section")
+	}
+
+	if usrsptypes.IsManaged(&netConf.HostConf) {
+		return nil
+	}
+
+	if netConf.HostIfName == "" {
+		return fmt.Errorf("ERROR: managed false requires hostIfName")
+	}
+	if netConf.HostConf.Engine != "vpp" {
+		return fmt.Errorf("ERROR: managed false requires Host Engine vpp, not %s", netConf.HostConf.Engine)
+	}
+
+	var programmed []string
+	for _, capability := range usrsptypes.GetRequestedCapabilities(netConf) {
+		switch capability {
+		case usrsptypes.CapabilityMemif, usrsptypes.CapabilityVhostUser, usrsptypes.CapabilityMtu:
+			// The type and MTU also apply to the container side.
+		default:
+			programmed = append(programmed, capability)
+		}
+	}
+	if len(programmed) != 0 {
+		return fmt.Errorf("ERROR: managed false can't be combined with host options %s, the host interface is not programmed",
+			strings.Join(programmed, ", "))
+	}
+
+	return nil
+}
+
+// isUnmanagedHost() - Whether the host interface was provisioned outside the
+//  plugin, as configured or as recorded by the ADD, in which case DEL never
+//  deletes it.
+func isUnmanagedHost(netConf *usrsptypes.NetConf, args *skel.CmdArgs) bool {
+	if usrsptypes.IsManaged(&netConf.HostConf) == false {
+		return true
+	}
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	return err == nil && info.Unmanaged
+}
+
+// validateInterfaceConflict() - An interface left in VPP on the socket of
+//  the attachment makes the create fail half way, so it is looked up before
+//  anything is created or any address allocated.
+func validateInterfaceConflict(netConf *usrsptypes.NetConf, args *skel.CmdArgs) error {
+	if netConf.HostConf.Engine != "vpp" || usrsptypes.IsManaged(&netConf.HostConf) == false {
+		return nil
+	}
+
+	return cnivpp.CniVppCheckInterfaceConflict(netConf, args)
+}
+
+// validateMirror() - Mirroring is configured on the host interface, by the
+//  vpp and ovs-dpdk engines.
+func validateMirror(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.MirrorConf.Destination != "" {
+		return fmt.Errorf("ERROR: mirror is only supported in the host section")
+	}
+
+	if netConf.HostConf.MirrorConf.Destination == "" {
+		return nil
+	}
+
+	direction := netConf.HostConf.MirrorConf.Direction
+	if direction != "" && direction != "rx" && direction != "tx" && direction != "both" {
+		return fmt.Errorf("ERROR: Invalid mirror direction: %s", direction)
+	}
+
+	return nil
+}
+
+// validateContainerPaths() - A path of the container section is set once,
+//  on the host or in the container (see usrsptypes/path.go), and can't
+//  escape its root.
+func validateContainerPaths(netConf *usrsptypes.NetConf) error {
+	ovsConf := &netConf.ContainerConf.OvsConf
+
+	paths := []struct {
+		field string
+		value string
+	}{
+		{"ovs dbSocket", ovsConf.DbSocket},
+		{"ovs dbSocketHostPath", ovsConf.DbSocketHostPath},
+		{"ovs dbSocketContainerPath", ovsConf.DbSocketContainerPath},
+	}
+
+	var set []string
+	for _, path := range paths {
+		if path.value == "" {
+			continue
+		}
+		if err := usrsptypes.ValidatePath(path.field, path.value); err != nil {
+			return err
+		}
+		set = append(set, path.field)
+	}
+
+	if len(set) > 1 {
+		return fmt.Errorf("ERROR: Only one of %s can be set", strings.Join(set, ", "))
+	}
+
+	return nil
+}
+
+// validateBandwidth() - The bandwidth limit is applied by the VPP engine on
+//  the host interface, so what VPP can police is checked before anything
+//  is created.
+func validateBandwidth(netConf *usrsptypes.NetConf) error {
+	if netConf.ContainerConf.BandwidthConf != (usrsptypes.BandwidthConf{}) {
+		return fmt.Errorf("ERROR: bandwidth is only supported in the host section")
+	}
+
+	if netConf.HostConf.BandwidthConf == (usrsptypes.BandwidthConf{}) {
+		return nil
+	}
+
+	if netConf.HostConf.Engine != "vpp" {
+		return usrsptypes.NewEngineNotSupportedError(netConf.HostConf.Engine, "bandwidth")
+	}
+
+	return cnivpp.CniVppCheckBandwidth(&netConf.HostConf.BandwidthConf)
+}
+
+// validateIpamType() - The IPAM plugin must be one of the types allowed on
+//  the node, set with the USERSPACE_ALLOWED_IPAM_TYPES environment variable
+//  (comma separated, unset or empty to allow any), so a configuration can't
+//  run any plugin of the CNI path. Checked on ADD only.
+func validateIpamType(netConf *usrsptypes.NetConf) error {
+	if netConf.IPAM.Type == "" {
+		return nil
+	}
+
+	allowedIpamTypes := getAllowedIpamTypes()
+	if len(allowedIpamTypes) == 0 {
+		return nil
+	}
+
+	for _, allowed := range allowedIpamTypes {
+		if netConf.IPAM.Type == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("ERROR: IPAM type %s not allowed on the node, allowed types: %s",
+		netConf.IPAM.Type, strings.Join(allowedIpamTypes, ", "))
+}
+
+// getAllowedIpamTypes() - IPAM types allowed on the node, none if any type
+//  is allowed.
+func getAllowedIpamTypes() []string {
+	var allowedIpamTypes []string
+
+	for _, ipamType := range strings.Split(os.Getenv("USERSPACE_ALLOWED_IPAM_TYPES"), ",") {
+		if ipamType = strings.TrimSpace(ipamType); ipamType != "" {
+			allowedIpamTypes = append(allowedIpamTypes, ipamType)
+		}
+	}
+
+	return allowedIpamTypes
+}
+
+// getIpamTimeout() - Return the time to wait on the IPAM plugin.
+func getIpamTimeout(netConf *usrsptypes.NetConf) time.Duration {
+	if netConf.IPAM.Timeout > 0 {
+		return time.Duration(netConf.IPAM.Timeout) * time.Second
+	}
+	return defaultIpamTimeout * time.Second
+}
+
+// getIpamConf() - Return the config passed to the IPAM plugin. The entire
+//  config is passed unless ipamStrictConf is set.
+func getIpamConf(netConf *usrsptypes.NetConf, stdinData []byte) ([]byte, error) {
+	if netConf.IpamStrictConf == false {
+		return stdinData, nil
+	}
+
+	var conf map[string]json.RawMessage
+	var ipamConf map[string]json.RawMessage
+
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to parse config for IPAM: %v", err)
+	}
+	if err := json.Unmarshal(conf["ipam"], &ipamConf); err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to parse ipam section: %v", err)
+	}
+	for _, key := range ipamLocalKeys {
+		delete(ipamConf, key)
+	}
+
+	ipamBytes, err := json.Marshal(ipamConf)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to build ipam section: %v", err)
+	}
+	conf["ipam"] = ipamBytes
+
+	strictConf := make(map[string]json.RawMessage)
+	for _, key := range ipamStrictConfKeys {
+		if value, ok := conf[key]; ok {
+			strictConf[key] = value
+		}
+	}
+
+	confBytes, err := json.Marshal(strictConf)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to build config for IPAM: %v", err)
+	}
+
+	logrus.WithField("step", "ipam").Debugf("Config passed to IPAM plugin: %s", confBytes)
+
+	return confBytes, nil
+}
+
+// ipamTimeoutError - The IPAM plugin did not return in time. The plugin has
+//  been killed and waited on, so the call can be retried.
+type ipamTimeoutError struct {
+	plugin  string
+	timeout time.Duration
+}
+
+func (e *ipamTimeoutError) Error() string {
+	return fmt.Sprintf("IPAM plugin %s timed out after %v", e.plugin, e.timeout)
+}
+
+// execIpamAdd() - Same as ipam.ExecAdd(), but the output of the IPAM plugin
+//  is kept so the result can be converted from the version the plugin
+//  actually returned, and shown if it can't be.
+func execIpamAdd(netConf *usrsptypes.NetConf, stdinData []byte) (*current.Result, error) {
+	output, err := execIpamPlugin(netConf, stdinData)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIpamResult(output)
+}
+
+// execIpamPlugin() - Run the IPAM plugin like invoke.RawExec, but don't wait
+//  on it forever. If the IPAM plugin does not return in time, it is killed
+//  and an ipamTimeoutError returned.
+func execIpamPlugin(netConf *usrsptypes.NetConf, stdinData []byte) ([]byte, error) {
+	pluginPath, err := invoke.FindInPath(netConf.IPAM.Type, filepath.SplitList(os.Getenv("CNI_PATH")))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := getIpamTimeout(netConf)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, pluginPath)
+	cmd.Env = invoke.ArgsFromEnv().AsEnv()
+	cmd.Stdin = bytes.NewReader(stdinData)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, &ipamTimeoutError{plugin: netConf.IPAM.Type, timeout: timeout}
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		// The plugin prints a CNI error on failure, as with invoke.RawExec.
+		pluginErr := &cnitypes.Error{}
+		if jsonErr := json.Unmarshal(stdout.Bytes(), pluginErr); jsonErr != nil {
+			pluginErr.Msg = fmt.Sprintf("IPAM plugin %s failed: %v: %s", netConf.IPAM.Type, err,
+				strings.TrimSpace(stdout.String()))
+		}
+		return nil, pluginErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// parseIpamResult() - Convert the output of the IPAM plugin into the current
+//  Result type. The version is taken from the fields of the output instead
+//  of the cniVersion of the config, since legacy IPAM plugins return 0.1.0
+//  or 0.2.0 results (ip4/ip6) whatever the config asks for.
+func parseIpamResult(output []byte) (*current.Result, error) {
+	var fields struct {
+		IPs json.RawMessage `json:"ips"`
+		IP4 json.RawMessage `json:"ip4"`
+		IP6 json.RawMessage `json:"ip6"`
+	}
+	var ipamResult cnitypes.Result
+
+	err := json.Unmarshal(output, &fields)
+	if err == nil {
+		if fields.IPs == nil && (fields.IP4 != nil || fields.IP6 != nil) {
+			ipamResult, err = types020.NewResult(output)
+		} else {
+			ipamResult, err = current.NewResult(output)
+		}
+	}
+
+	var result *current.Result
+	if err == nil {
+		result, err = current.NewResultFromResult(ipamResult)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Unable to convert IPAM result %s: %v", strings.TrimSpace(string(output)), err)
+	}
+
+	return result, nil
+}
+
+// isRetryableIpamError() - Determine if an IPAM failure is transient.
+func isRetryableIpamError(err error) bool {
+	if _, ok := err.(*ipamTimeoutError); ok {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, retryable := range retryableIpamErrors {
+		if strings.Contains(msg, retryable) {
+			return true
+		}
+	}
+	return false
+}
+
+// allocateIpam() - Call the IPAM plugin, retrying transient failures with
+//  a backoff if retries are configured.
+func allocateIpam(netConf *usrsptypes.NetConf, stdinData []byte) (*current.Result, error) {
+	delay := time.Duration(defaultIpamRetryDelay) * time.Millisecond
+	if netConf.IPAM.RetryDelay > 0 {
+		delay = time.Duration(netConf.IPAM.RetryDelay) * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		ipamResult, err := execIpamAdd(netConf, stdinData)
+		if err == nil || attempt >= netConf.IPAM.Retries || !isRetryableIpamError(err) {
+			return ipamResult, err
+		}
+
+		logrus.WithField("step", "ipam").Warningf("IPAM plugin %s failed (attempt %d of %d), retrying in %v: %v",
+			netConf.IPAM.Type, attempt+1, netConf.IPAM.Retries+1, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// execIpamDel() - Same as ipam.ExecDel(), but the IPAM plugin is killed if
+//  it does not return in time.
+func execIpamDel(netConf *usrsptypes.NetConf, stdinData []byte) error {
+	_, err := execIpamPlugin(netConf, stdinData)
+	return err
+}
+
+// recoverPanic() - Deferred by cmdAdd() and cmdDel() to convert a panic into
+//  a CNI error, so the runtime still gets a parsable error on stdout. The
+//  stack trace is logged to stderr and returned in the error details. The
+//  rollback function, if provided, is called to undo any partial work.
+func recoverPanic(command string, err *error, rollback func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := string(debug.Stack())
+	logrus.WithField("step", command).Errorf("recovered from panic: %v\n%s", r, stack)
+
+	if rollback != nil {
+		rollback()
 	}
 
-	return n, nil
+	*err = &cnitypes.Error{
+		Code:    errCodePanic,
+		Msg:     fmt.Sprintf("%s failed: panic: %v", command, r),
+		Details: stack,
+	}
+}
+
+// rollbackAdd() - Best effort cleanup of a failed ADD. Errors (and panics)
+//  are logged and otherwise ignored, since not everything may have been
+//  created.
+func rollbackAdd(args *skel.CmdArgs) {
+	var err error
+
+	func() {
+		defer recoverPanic("ROLLBACK", &err, nil)
+		var netConf *usrsptypes.NetConf
+		netConf, err = loadDelNetConf(args)
+		if err == nil {
+			err = delAttachment(args, netConf, nil)
+		}
+	}()
+
+	if err != nil {
+		logrus.WithField("step", "ROLLBACK").Warningf("ADD rollback incomplete: %v", err)
+	}
+}
+
+func cmdAdd(args *skel.CmdArgs) (err error) {
+	defer startAudit("ADD", args).finish(&err)
+	defer usrspdb.ForgetJournal(args.ContainerID, args.IfName)
+	defer recoverPanic("ADD", &err, func() { rollbackAdd(args) })
+
+	err = addAttachment(args)
+	if err != nil {
+		err = withJournal(args, err)
+		logError("ADD", err)
+	}
+	return checkCorruptState(err)
+}
+
+func cmdDel(args *skel.CmdArgs) (err error) {
+	defer startAudit("DEL", args).finish(&err)
+	defer usrspdb.ForgetJournal(args.ContainerID, args.IfName)
+	defer recoverPanic("DEL", &err, nil)
+
+	err = delAttachmentWithTimeout(args)
+	if err != nil {
+		err = withJournal(args, err)
+		logError("DEL", err)
+	}
+	return checkCorruptState(err)
+}
+
+// delProgress - Step of delAttachment() being run, read by
+//  delAttachmentWithTimeout() when the cleanup times out. A nil
+//  delProgress is not tracked.
+type delProgress struct {
+	mu   sync.Mutex
+	step string
+}
+
+func (p *delProgress) set(step string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.step = step
+	p.mu.Unlock()
+}
+
+func (p *delProgress) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.step
+}
+
+// getDelTimeout() - Return the deadline of DEL and whether to fail on it.
+func getDelTimeout(netConf *usrsptypes.NetConf) (time.Duration, bool) {
+	if netConf.DelTimeout <= 0 {
+		return 0, false
+	}
+	return time.Duration(netConf.DelTimeout) * time.Second, netConf.DelTimeoutFail
+}
+
+// delAttachmentWithTimeout() - Run delAttachment(), but with delTimeout
+//  don't wait on it forever. If the cleanup does not return in time, the
+//  steps not done are logged and the cleanup is abandoned: DEL is best
+//  effort, so it succeeds unless delTimeoutFail is set. An abandoned cleanup
+//  keeps running, see pendingDels.
+func delAttachmentWithTimeout(args *skel.CmdArgs) error {
+	netConf, err := loadDelNetConf(args)
+	if err != nil {
+		return err
+	}
+
+	timeout, failOnTimeout := getDelTimeout(netConf)
+	if timeout == 0 {
+		return delAttachment(args, netConf, nil)
+	}
+
+	progress := &delProgress{step: delSteps[0]}
+	ch := make(chan error, 1)
+	pendingDels.Add(1)
+	go func() {
+		var err error
+		defer pendingDels.Done()
+		defer func() { ch <- err }()
+		defer recoverPanic("DEL", &err, nil)
+		err = delAttachment(args, netConf, progress)
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(timeout):
+	}
+
+	step := progress.get()
+	var pending []string
+	for i, name := range delSteps {
+		if name == step {
+			pending = delSteps[i:]
+			break
+		}
+	}
+
+	err = fmt.Errorf("DEL timed out after %v in step %s, not cleaned: %s", timeout, step, strings.Join(pending, ", "))
+	if failOnTimeout {
+		return err
+	}
+	logrus.WithField("step", "DEL").Warningf("%v", err)
+	return nil
 }
 
-func cmdAdd(args *skel.CmdArgs) error {
+// addAttachment() - Add the UserSpace interface on the host and in the
+//  container, for cmdAdd().
+func addAttachment(args *skel.CmdArgs) error {
 	var result *current.Result
 	var netConf *usrsptypes.NetConf
 	var containerEngine string
@@ -63,92 +1457,767 @@ func cmdAdd(args *skel.CmdArgs) error {
 	vpp := cnivpp.CniVpp{}
 	ovs := cniovs.CniOvs{}
 
-	// Convert the input bytestream into local NetConf structure
-	netConf, err := loadNetConf(args.StdinData)
+	// Convert the input bytestream into local NetConf structure
+	netConf, err := loadNetConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	err = validateCniVersion(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = setupLogging(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = resolveEngine(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = applyEngineDefaults(netConf)
+	if err != nil {
+		return err
+	}
+
+	// The runtime may repeat an ADD for an attachment that already exists.
+	// Return the Result of the first one instead of adding it again, after
+	// applying what may have changed.
+	if result = getPreviousResult(args); result != nil {
+		logrus.Infof("Attachment already added, returning its previous result")
+		if netConf.HostConf.Engine == "ovs-dpdk" {
+			if err = ovs.UpdateOnHost(netConf, args); err != nil {
+				return err
+			}
+		}
+		return printResult(netConf, result)
+	}
+
+	err = validateSocketType(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateCapabilities(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateKernelSidecar(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = validateNat(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validatePortMappings(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateMirror(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateBandwidth(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateIpamType(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateAuditLog(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateContainerPaths(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateDelTimeout(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateHostAddress(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateUnnumbered(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateTenant(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateHugepages(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateSharedDirMode(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateAdminUp(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateContainerRoutes(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateMemif(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateMemifId(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = validateBridge(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validatePunt(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = validateVhostFeatures(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateConnectivityProbe(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateLinkWait(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateDebugTrace(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateManaged(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateHostIfName(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = validateOvsPortPrefix(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = validateInterfaceConflict(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = resolveContainerMac(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = checkKernelIfNames(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = checkMaxAttachments(args)
+	if err != nil {
+		return err
+	}
+
+	// Engines always receive a result, even if IPAM is not used.
+	result = &current.Result{}
+
+	//
+	// HOST:
+	//
+
+	// Add the requested interface and network
+	logrus.WithField("step", "host").Debugf("Adding interface on host")
+	if usrsptypes.IsManaged(&netConf.HostConf) == false {
+		err = cnivpp.CniVppAddUnmanaged(netConf, args)
+	} else if netConf.HostConf.Engine == "vpp" {
+		err = vpp.AddOnHost(netConf, args, result)
+	} else if netConf.HostConf.Engine == "ovs-dpdk" {
+		err = ovs.AddOnHost(netConf, args, result)
+	} else {
+		return fmt.Errorf("ERROR: Unknown Host Engine:" + netConf.HostConf.Engine)
+	}
+	if err != nil {
+		return err
+	}
+	if netConf.HostConf.Engine == "vpp" && len(netConf.HostConf.PuntConf.Rules) != 0 {
+		setKernelIfAlias(args, cnivpp.CniVppGetPuntIfName(&netConf.HostConf.PuntConf))
+		enablePuntIPv6(args, cnivpp.CniVppGetPuntIfName(&netConf.HostConf.PuntConf))
+	}
+
+	//
+	// CONTAINER:
+	//
+
+	// Get IPAM data for Container Interface, if provided.
+	if netConf.IPAM.Type != "" {
+
+		// Save the configuration first, so DEL (or the rollback) releases
+		// the allocation with the same IPAM configuration.
+		err = saveAddConf(args)
+		if err != nil {
+			rollbackAdd(args)
+			return err
+		}
+
+		// run the IPAM plugin and get back the config to apply
+		logrus.WithField("step", "ipam").Debugf("Allocating address from IPAM plugin %s", netConf.IPAM.Type)
+		// The result is converted into the current Result type, whatever
+		// version the IPAM plugin returned. The host interface already
+		// exists, so it is removed if no address is allocated.
+		var ipamConf []byte
+		ipamConf, err = getIpamConf(netConf, netConf.GetExpandedConf())
+		if err == nil {
+			result, err = allocateIpam(netConf, ipamConf)
+		}
+		if err == nil && len(result.IPs) == 0 {
+			err = fmt.Errorf("ERROR: Unable to get IP Address")
+		}
+		if err != nil {
+			rollbackAdd(args)
+			return err
+		}
+
+		// Clear out the Gateway if set by IPAM, unless requested. The dhcp
+		// IPAM plugin returns the gateway from the lease (router option)
+		// along with routes using it, so keep it intact.
+		if netConf.IPAM.Type != "dhcp" && netConf.KeepGateway == false {
+			for _, ip := range result.IPs {
+				if ip.Gateway != nil {
+					logrus.WithField("step", "ipam").Infof("Removing gateway %s from the result, set keepGateway to keep it", ip.Gateway)
+				}
+				ip.Gateway = nil
+			}
+		}
+
+	} else if netConf.Kubeconfig != "" {
+
+		// Without IPAM, use the address from the pod annotation, if set.
+		result, err = getPodIpResult(netConf, args)
+		if err != nil {
+			rollbackAdd(args)
+			return err
+		}
+	}
+
+	// Determine the Engine that will process the request. Default to host
+	// if not provided.
+	if netConf.ContainerConf.Engine != "" {
+		containerEngine = netConf.ContainerConf.Engine
+	} else {
+		containerEngine = netConf.HostConf.Engine
+	}
+
+	// Add the requested interface and network
+	logrus.WithField("step", "container").Debugf("Adding interface on container with engine %s", containerEngine)
+	if containerEngine == "vpp" {
+		err = vpp.AddOnContainer(netConf, args, result)
+	} else if containerEngine == "ovs-dpdk" {
+		err = ovs.AddOnContainer(netConf, args, result)
+	} else {
+		err = fmt.Errorf("ERROR: Unknown Container Engine:" + containerEngine)
+	}
 	if err != nil {
+		rollbackAdd(args)
 		return err
 	}
 
 	//
-	// HOST:
+	// SOCKET: Wait for the peer to create the socket, if requested. Everything
+	// created so far is removed if it never does.
 	//
-
-	// Add the requested interface and network
-	if netConf.HostConf.Engine == "vpp" {
-		err = vpp.AddOnHost(netConf, args.ContainerID, result)
-	} else if netConf.HostConf.Engine == "ovs-dpdk" {
-		err = ovs.AddOnHost(netConf, args.ContainerID, result)
-	} else {
-		return fmt.Errorf("ERROR: Unknown Host Engine:" + netConf.HostConf.Engine)
-	}
+	err = waitForSocket(netConf, args)
 	if err != nil {
+		err = captureDebugTrace(netConf, err)
+		rollbackAdd(args)
 		return err
 	}
 
 	//
-	// CONTAINER:
+	// HOST ADDRESS: Needs the subnet from IPAM.
 	//
+	if netConf.HostConf.Address != "" {
+		err = cnivpp.CniVppAddHostAddress(netConf, args, result)
+		if err != nil {
+			rollbackAdd(args)
+			return err
+		}
+	}
 
-	// Get IPAM data for Container Interface, if provided.
-	if netConf.IPAM.Type != "" {
+	//
+	// HOST IPV6: Needs the IPv6 address from IPAM.
+	//
+	if netConf.HostConf.Engine == "vpp" && usrsptypes.IsManaged(&netConf.HostConf) &&
+		netConf.HostConf.Ipv6Conf != (usrsptypes.Ipv6Conf{}) {
+		err = cnivpp.CniVppAddHostIpv6(netConf, args, result)
+		if err != nil {
+			rollbackAdd(args)
+			return err
+		}
+	}
 
-		// run the IPAM plugin and get back the config to apply
-		ipamResult, err := ipam.ExecAdd(netConf.IPAM.Type, args.StdinData)
+	//
+	// PROBE: Make sure the dataplane works, if requested. Everything created
+	// so far is removed if it does not.
+	//
+	// An L2 attachment without a target has nothing to ping.
+	if netConf.VerifyConnectivity && netConf.HostConf.NetType != "interface" &&
+		cnivpp.CniVppGetProbeTarget(netConf, result) == nil {
+		logrus.WithField("step", "probe").Infof("No probeTarget or gateway for netType %s, skipping verifyConnectivity",
+			netConf.HostConf.NetType)
+	} else if netConf.VerifyConnectivity {
+		logrus.WithField("step", "probe").Debugf("Verifying connectivity")
+		err = cnivpp.CniVppVerifyConnectivity(netConf, args, result, getProbeTimeout(netConf))
+		if err != nil && usrsptypes.IsVerifyStrict(netConf) == false {
+			logrus.WithField("step", "probe").Warningf("verifyStrict false, ADD continues: %v", err)
+		} else if err != nil {
+			err = captureDebugTrace(netConf, err)
+			rollbackAdd(args)
+			return err
+		}
+	}
+
+	//
+	// PORT MAPPINGS: Needs the address from IPAM.
+	//
+	if len(netConf.RuntimeConfig.PortMaps) != 0 {
+		err = cnivpp.CniVppAddPortMappings(netConf, args, result)
 		if err != nil {
+			rollbackAdd(args)
 			return err
 		}
+	}
 
-		// Convert whatever the IPAM result was into the current Result type
-		result, err = current.NewResultFromResult(ipamResult)
+	//
+	// RESULT INTERFACE: The UserSpace interface, with the IPAM addresses.
+	//
+	addResultInterface(netConf, args, result)
+
+	//
+	// KERNEL SIDECAR:
+	//
+	if netConf.KernelSidecar.Enable {
+		err = addKernelSidecar(netConf, args, result)
+		if err != nil {
+			rollbackAdd(args)
+			return err
+		}
+	}
+
+	//
+	// RESOLV.CONF: Needs the DNS settings from IPAM.
+	//
+	if netConf.WriteResolvConf {
+		err = addResolvConf(netConf, args, result)
 		if err != nil {
-			// TBD: CLEAN-UP
+			rollbackAdd(args)
 			return err
 		}
+	}
+
+	//
+	// RESULT: Saved with the attachment, for a repeated ADD.
+	//
+	err = saveResult(args, result)
+	if err != nil {
+		rollbackAdd(args)
+		return err
+	}
+
+	return printResult(netConf, result)
+}
+
+// addResultInterface() - Report the UserSpace interface in the Result, in
+//  the sandbox of the container, under the requested name (see
+//  usrsptypes.GetIfName()), and point the IPAM addresses at it.
+func addResultInterface(netConf *usrsptypes.NetConf, args *skel.CmdArgs, result *current.Result) {
+	result.Interfaces = append(result.Interfaces, &current.Interface{
+		Name:    getUserSpaceIfName(netConf, args),
+		Sandbox: args.Netns,
+	})
+
+	usrSpIndex := len(result.Interfaces) - 1
+	for _, ipConfig := range result.IPs {
+		if ipConfig.Interface == nil {
+			ipConfig.Interface = &usrSpIndex
+		}
+	}
+}
 
-		if len(result.IPs) == 0 {
-			// TBD: CLEAN-UP
-			return fmt.Errorf("ERROR: Unable to get IP Address")
+// printResult() - Print the Result of the ADD in the requested CNI version.
+//  When chained, the Result is merged into the Result of the previous
+//  plugins. With suppressResult, only the previous Result, or a minimal
+//  Result if not chained, is printed.
+func printResult(netConf *usrsptypes.NetConf, result *current.Result) error {
+	var prevResult *current.Result
+
+	if netConf.RawPrevResult != nil {
+		prevBytes, err := json.Marshal(netConf.RawPrevResult)
+		if err != nil {
+			return fmt.Errorf("ERROR: serializing prevResult: %v", err)
+		}
+		res, err := cniSpecVersion.NewResult(netConf.CNIVersion, prevBytes)
+		if err != nil {
+			return fmt.Errorf("ERROR: Failed to parse prevResult: %v", err)
+		}
+		prevResult, err = current.NewResultFromResult(res)
+		if err != nil {
+			return fmt.Errorf("ERROR: Failed to convert prevResult: %v", err)
 		}
+	}
 
-		// Clear out the Gateway if set by IPAM, not being used.
-		for _, ip := range result.IPs {
-			ip.Gateway = nil
+	if netConf.SuppressResult {
+		if prevResult != nil {
+			return cnitypes.PrintResult(prevResult, netConf.CNIVersion)
+		}
+		// A 0.1.0 or 0.2.0 Result is converted from its first address, the
+		// minimal Result of these versions is printed as is.
+		for _, version := range types020.SupportedVersions {
+			if netConf.CNIVersion == version {
+				return (&types020.Result{CNIVersion: netConf.CNIVersion}).Print()
+			}
 		}
+		return cnitypes.PrintResult(&current.Result{}, netConf.CNIVersion)
+	}
 
+	if prevResult != nil {
+		result = mergeResult(prevResult, result)
 	}
 
-	// Determine the Engine that will process the request. Default to host
-	// if not provided.
-	if netConf.ContainerConf.Engine != "" {
-		containerEngine = netConf.ContainerConf.Engine
-	} else {
-		containerEngine = netConf.HostConf.Engine
+	return cnitypes.PrintResult(result, netConf.CNIVersion)
+}
+
+// mergeResult() - Append the interfaces, addresses and routes of the Result
+//  to the previous Result. The interface indexes of the addresses are moved
+//  past the interfaces of the previous Result. The DNS of the previous Result
+//  is kept, if any.
+func mergeResult(prevResult *current.Result, result *current.Result) *current.Result {
+	merged := *prevResult
+	offset := len(prevResult.Interfaces)
+
+	merged.Interfaces = append(append([]*current.Interface{}, prevResult.Interfaces...), result.Interfaces...)
+	merged.IPs = append([]*current.IPConfig{}, prevResult.IPs...)
+	for _, ipConfig := range result.IPs {
+		ipCopy := *ipConfig
+		if ipCopy.Interface != nil {
+			index := *ipCopy.Interface + offset
+			ipCopy.Interface = &index
+		}
+		merged.IPs = append(merged.IPs, &ipCopy)
 	}
+	merged.Routes = append(append([]*cnitypes.Route{}, prevResult.Routes...), result.Routes...)
 
-	// Add the requested interface and network
-	if containerEngine == "vpp" {
-		err = vpp.AddOnContainer(netConf, args.ContainerID, result)
-	} else if containerEngine == "ovs-dpdk" {
-		err = ovs.AddOnContainer(netConf, args.ContainerID, result)
-	} else {
-		return fmt.Errorf("ERROR: Unknown Container Engine:" + containerEngine)
+	if len(merged.DNS.Nameservers) == 0 && merged.DNS.Domain == "" &&
+		len(merged.DNS.Search) == 0 && len(merged.DNS.Options) == 0 {
+		merged.DNS = result.DNS
+	}
+
+	return &merged
+}
+
+// getPreviousResult() - The Result of a completed ADD of the attachment
+//  (ContainerId and IfName), or nil if there is none. An attachment saved
+//  by an ADD that did not complete has no Result.
+func getPreviousResult(args *skel.CmdArgs) *current.Result {
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return nil
 	}
+	return info.Result
+}
+
+// saveAddConf() - Save the configuration of the ADD with the attachment
+//  data, to release the IPAM allocation on DEL.
+func saveAddConf(args *skel.CmdArgs) error {
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
 	if err != nil {
 		return err
 	}
 
-	return cnitypes.PrintResult(result, netConf.CNIVersion)
+	info.AddConf = args.StdinData
+	return usrspdb.SaveAttachment(&info)
 }
 
-func cmdDel(args *skel.CmdArgs) error {
-	var netConf *usrsptypes.NetConf
+// getDelIpamNetConf() - The configuration DEL releases the IPAM allocation
+//  with: the one saved by ADD, unless ignoreAddIpamConf is set, else the one
+//  of the DEL.
+func getDelIpamNetConf(netConf *usrsptypes.NetConf, info *usrspdb.AttachmentInfo, infoErr error) *usrsptypes.NetConf {
+	if netConf.IgnoreAddIpamConf || infoErr != nil || len(info.AddConf) == 0 {
+		return netConf
+	}
+
+	addNetConf, err := loadNetConf(info.AddConf)
+	if err != nil {
+		logrus.WithField("step", "ipam").Warningf("Ignoring the saved ADD configuration: %v", err)
+		return netConf
+	}
+	return addNetConf
+}
+
+// getNetnsCleanupIfName() - The kernel interface DEL removes from the
+//  container netns: the one created by ADD, as saved in the attachment data,
+//  or CNI_IFNAME with forceNetnsCleanup. Empty if none.
+func getNetnsCleanupIfName(netConf *usrsptypes.NetConf, args *skel.CmdArgs, info *usrspdb.AttachmentInfo, infoErr error) string {
+	if infoErr == nil && info.KernelIfName != "" {
+		return info.KernelIfName
+	}
+	if netConf.ForceNetnsCleanup {
+		return args.IfName
+	}
+	return ""
+}
+
+// delNetnsKernelIf() - Delete the kernel interface from the container
+//  netns, see getNetnsCleanupIfName(). Nothing is deleted without name.
+func delNetnsKernelIf(args *skel.CmdArgs, kernelIfName string) error {
+	if args.Netns == "" || kernelIfName == "" {
+		return nil
+	}
+
+	err := ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		var err error
+		_, err = ip.DelLinkByNameAddr(kernelIfName, netlink.FAMILY_V4)
+		if err != nil && err == ip.ErrLinkNotFound {
+			return nil
+		}
+		return err
+	})
+
+	// The netns is removed with the container, and the interface with it.
+	if _, ok := err.(ns.NSPathNotExistErr); ok {
+		return nil
+	}
+	return err
+}
+
+// loadDelNetConf() - Convert the input bytestream into local NetConf
+//  structure, for delAttachment(). Runtimes may send an empty or truncated
+//  configuration on DEL, the teardown then uses the configuration saved by
+//  ADD, which replaces the StdinData of the arguments.
+func loadDelNetConf(args *skel.CmdArgs) (*usrsptypes.NetConf, error) {
+	netConf, err := loadNetConf(args.StdinData)
+	if err != nil {
+		return loadSavedNetConf(args, err)
+	}
+	return netConf, nil
+}
+
+// loadSavedNetConf() - The configuration saved by ADD for the attachment
+//  (ContainerId and IfName), used by DEL when the configuration passed can't
+//  be loaded. The StdinData of the arguments is replaced by it. Without
+//  saved configuration, the state of the attachment is unknown.
+func loadSavedNetConf(args *skel.CmdArgs, loadErr error) (*usrsptypes.NetConf, error) {
+	logrus.Warningf("Failed to load the DEL configuration, using the one saved by ADD: %v", loadErr)
+
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err == nil && len(info.AddConf) == 0 {
+		err = fmt.Errorf("no configuration saved")
+	}
+	if err != nil {
+		return nil, &cnitypes.Error{
+			Code:    errCodeStateUnknown,
+			Msg:     fmt.Sprintf("ERROR: State of %s/%s unknown, nothing removed", args.ContainerID, args.IfName),
+			Details: fmt.Sprintf("configuration: %v, saved state: %v", loadErr, err),
+		}
+	}
+
+	netConf, err := loadNetConf(info.AddConf)
+	if err != nil {
+		return nil, &cnitypes.Error{
+			Code:    errCodeStateUnknown,
+			Msg:     fmt.Sprintf("ERROR: State of %s/%s unknown, nothing removed", args.ContainerID, args.IfName),
+			Details: fmt.Sprintf("configuration: %v, saved configuration: %v", loadErr, err),
+		}
+	}
+
+	args.StdinData = info.AddConf
+	return netConf, nil
+}
+
+// getCmdArgsFromEnv() - The arguments of the command, as skel reads them.
+func getCmdArgsFromEnv(stdinData []byte) *skel.CmdArgs {
+	return &skel.CmdArgs{
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		IfName:      os.Getenv("CNI_IFNAME"),
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+		StdinData:   stdinData,
+	}
+}
+
+// isVersionDecodable() - Whether skel can decode the cniVersion of the
+//  configuration. skel fails the command before calling the plugin if not.
+func isVersionDecodable(stdinData []byte) bool {
+	var conf struct {
+		CNIVersion string `json:"cniVersion"`
+	}
+	return json.Unmarshal(stdinData, &conf) == nil
+}
+
+// toCniError() - The error of a command, as skel prints it, without
+//  wrapping an Error in an Error.
+func toCniError(err error) *cnitypes.Error {
+	if cniErr, ok := err.(*cnitypes.Error); ok {
+		return cniErr
+	}
+	return &cnitypes.Error{Code: errCodeCommandFailed, Msg: err.Error()}
+}
+
+// saveResult() - Save the Result of the ADD with the attachment data, which
+//  marks the ADD as completed.
+func saveResult(args *skel.CmdArgs, result *current.Result) error {
+	info, err := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	info.Result = result
+	return usrspdb.SaveAttachment(&info)
+}
+
+// delAttachment() - Remove the UserSpace interface from the host and the
+//  container, for cmdDel(). netConf is loaded by loadDelNetConf().
+func delAttachment(args *skel.CmdArgs, netConf *usrsptypes.NetConf, progress *delProgress) error {
 	var containerEngine string
 
 	vpp := cnivpp.CniVpp{}
 	ovs := cniovs.CniOvs{}
 
-	// Convert the input bytestream into local NetConf structure
-	netConf, err := loadNetConf(args.StdinData)
+	err := validateCniVersion(netConf)
+	if err != nil {
+		return err
+	}
+
+	err = setupLogging(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = resolveEngine(netConf, args)
+	if err != nil {
+		return err
+	}
+
+	err = applyEngineDefaults(netConf)
+	if err != nil {
+		return err
+	}
+
+	// Determine if a kernel interface was created in the netns, before the
+	// host interface removes the saved attachment data.
+	info, infoErr := usrspdb.GetAttachment(args.ContainerID, args.IfName)
+	kernelIfName := getNetnsCleanupIfName(netConf, args, &info, infoErr)
+
+	// Runtimes occasionally rename networks, the attachment is still removed.
+	if infoErr == nil && info.Network != "" && info.Network != netConf.Name {
+		logrus.Warningf("Attachment added for network %s, deleted for network %s", info.Network, netConf.Name)
+	}
+
+	//
+	// Cleanup IPAM data, if provided. Done first so the address (or DHCP
+	// lease) is released even if the interface cleanup below fails. The
+	// configuration of the ADD is used if saved, in case the network was
+	// updated since.
+	//
+	progress.set("ipam")
+	ipamNetConf := getDelIpamNetConf(netConf, &info, infoErr)
+	if ipamNetConf.IPAM.Type != "" {
+		// The allowlist is only enforced on ADD, so an allocation made
+		// before the allowlist changed is still released.
+		var ipamConf []byte
+		ipamConf, err = getIpamConf(ipamNetConf, ipamNetConf.GetExpandedConf())
+		if err == nil {
+			err = execIpamDel(ipamNetConf, ipamConf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// PORT MAPPINGS: Removed using the saved mappings, not the ones passed
+	// on DEL, before the host interface removes the saved attachment data.
+	//
+	progress.set("portmap")
+	if netConf.HostConf.Engine == "vpp" {
+		err = cnivpp.CniVppDelPortMappings(netConf, args)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// HOST ADDRESS: Removed using the saved addresses.
+	//
+	progress.set("hostaddr")
+	if netConf.HostConf.Engine == "vpp" {
+		err = cnivpp.CniVppDelHostAddress(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// KERNEL SIDECAR: Removed before the host interface, which removes the
+	// saved attachment data.
+	//
+	progress.set("sidecar")
+	if netConf.KernelSidecar.Enable {
+		err = delKernelSidecar(netConf, args)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// RESOLV.CONF: Rewritten without the attachment, using the saved
+	// settings, before the host interface removes the saved attachment data.
+	//
+	progress.set("resolvconf")
+	err = delResolvConf(args)
 	if err != nil {
 		return err
 	}
@@ -158,10 +2227,15 @@ func cmdDel(args *skel.CmdArgs) error {
 	//
 
 	// Delete the requested interface
-	if netConf.HostConf.Engine == "vpp" {
-		err = vpp.DelFromHost(netConf, args.ContainerID)
+	progress.set("host")
+	logrus.WithField("step", "host").Debugf("Deleting interface on host")
+	if isUnmanagedHost(netConf, args) {
+		logrus.WithField("step", "host").Infof("Host interface not managed by the plugin, not deleted")
+		err = usrspdb.DeleteAttachment(args.ContainerID, args.IfName)
+	} else if netConf.HostConf.Engine == "vpp" {
+		err = vpp.DelFromHost(netConf, args)
 	} else if netConf.HostConf.Engine == "ovs-dpdk" {
-		err = ovs.DelFromHost(netConf, args.ContainerID)
+		err = ovs.DelFromHost(netConf, args)
 	} else {
 		return fmt.Errorf("ERROR: Unknown Host Engine:" + netConf.HostConf.Engine)
 	}
@@ -182,10 +2256,12 @@ func cmdDel(args *skel.CmdArgs) error {
 	}
 
 	// Delete the requested interface
+	progress.set("container")
+	logrus.WithField("step", "container").Debugf("Deleting interface on container with engine %s", containerEngine)
 	if containerEngine == "vpp" {
-		err = vpp.DelFromContainer(netConf, args.ContainerID)
+		err = vpp.DelFromContainer(netConf, args)
 	} else if containerEngine == "ovs-dpdk" {
-		err = ovs.DelFromContainer(netConf, args.ContainerID)
+		err = ovs.DelFromContainer(netConf, args)
 	} else {
 		return fmt.Errorf("ERROR: Unknown Container Engine:" + containerEngine)
 	}
@@ -194,38 +2270,117 @@ func cmdDel(args *skel.CmdArgs) error {
 	}
 
 	//
-	// Cleanup IPAM data, if provided.
+	// Cleanup Namespace: Only delete the kernel interface if it was created
+	// by this plugin. Otherwise it may belong to another plugin in the chain
+	// (like the default eth0 when this is a secondary attachment).
 	//
-	if netConf.IPAM.Type != "" {
-		err = ipam.ExecDel(netConf.IPAM.Type, args.StdinData)
-		if err != nil {
-			return err
+	if args.Netns == "" || kernelIfName == "" {
+		return nil
+	}
+
+	progress.set("netns")
+	return delNetnsKernelIf(args, kernelIfName)
+}
+
+func main() {
+	if err := setVppRetryPolicy(); err != nil {
+		e := &cnitypes.Error{
+			Code: errCodeInvalidConf,
+			Msg:  err.Error(),
 		}
+		e.Print()
+		os.Exit(1)
 	}
 
-	//
-	// Cleanup Namespace
-	//
-	if args.Netns == "" {
-		return nil
+	// Not a CNI command, for operators
+	if len(os.Args) > 1 && os.Args[1] == "capabilities" {
+		printCapabilities(os.Stdout)
+		return
 	}
 
-	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
-		var err error
-		_, err = ip.DelLinkByNameAddr(args.IfName, netlink.FAMILY_V4)
-		if err != nil && err == ip.ErrLinkNotFound {
-			return nil
+	// Long running helper, see daemon.go
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		if err := runDaemon(os.Args[2:]); err != nil {
+			logrus.Errorf("Daemon failed: %v", err)
+			os.Exit(1)
 		}
-		return err
-	})
+		return
+	}
+
+	// Attachments of the node, see list.go
+	if len(os.Args) > 1 && os.Args[1] == "list" {
+		if err := runList(os.Args[2:], os.Stdout); err != nil {
+			logrus.Errorf("List failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Build and engines of the plugin, see version.go
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		if err := runVersion(os.Args[2:], os.Stdout); err != nil {
+			logrus.Errorf("Version failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Attachment and its journal, see show.go
+	if len(os.Args) > 1 && os.Args[1] == "show" {
+		if err := runShow(os.Args[2:], os.Stdout); err != nil {
+			logrus.Errorf("Show failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
 
+	// Corrupt state files, see cleanup.go
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		if err := runCleanup(os.Args[2:], os.Stdout); err != nil {
+			logrus.Errorf("Cleanup failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	stdinData, err := limitStdin()
 	if err != nil {
-		return err
+		e := &cnitypes.Error{
+			Code: errCodeInvalidConf,
+			Msg:  err.Error(),
+		}
+		e.Print()
+		os.Exit(1)
 	}
 
-	return nil
-}
+	// Let the daemon execute the command if it is running, otherwise (or if
+	// the daemon fails to answer) execute it here.
+	if handled, cniErr := forwardToDaemon(stdinData); handled {
+		if cniErr != nil {
+			cniErr.Print()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// skel does not know CHECK, see check.go
+	if os.Getenv("CNI_COMMAND") == "CHECK" {
+		if err = cmdCheck(getCmdArgsFromEnv(stdinData)); err != nil {
+			toCniError(err).Print()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// skel fails a DEL it can't decode the configuration of, the plugin
+	// tears down from the saved state instead.
+	if os.Getenv("CNI_COMMAND") == "DEL" && isVersionDecodable(stdinData) == false {
+		if err = cmdDel(getCmdArgsFromEnv(stdinData)); err != nil {
+			toCniError(err).Print()
+			os.Exit(1)
+		}
+		return
+	}
 
-func main() {
 	skel.PluginMain(cmdAdd, cmdDel, cniSpecVersion.All)
 }
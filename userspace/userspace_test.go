@@ -0,0 +1,875 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/current"
+	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+
+	"github.com/Billy99/user-space-net-plugin/cnivpp/api/infra"
+	"github.com/Billy99/user-space-net-plugin/usrspdb"
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+const testIpamResult = `{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.1.1.5/24"}]}`
+
+// writeTestIpamPlugin() - Write a fake IPAM plugin into dir.
+func writeTestIpamPlugin(t *testing.T, dir string, name string, script string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("writing IPAM plugin %s: %v", name, err)
+	}
+}
+
+func TestAllocateIpam(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usrsp-ipam")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CNI_PATH", dir)
+	defer os.Unsetenv("CNI_PATH")
+
+	marker := filepath.Join(dir, "attempted")
+	writeTestIpamPlugin(t, dir, "ipam-ok", "echo '"+testIpamResult+"'\n")
+	writeTestIpamPlugin(t, dir, "ipam-exhausted",
+		"echo '{\"code\":11,\"msg\":\"no IP addresses available\"}'\nexit 1\n")
+	writeTestIpamPlugin(t, dir, "ipam-hang", "exec sleep 30\n")
+	// Hangs on the first call only, the retry must not wait on it.
+	writeTestIpamPlugin(t, dir, "ipam-hang-once",
+		"if [ ! -e "+marker+" ]; then touch "+marker+"; exec sleep 30; fi\necho '"+testIpamResult+"'\n")
+
+	tests := []struct {
+		name        string
+		ipam        usrsptypes.IpamConf
+		wantErr     bool
+		wantTimeout bool
+	}{
+		{"success", usrsptypes.IpamConf{Type: "ipam-ok"}, false, false},
+		{"plugin error", usrsptypes.IpamConf{Type: "ipam-exhausted", Retries: 2, RetryDelay: 1}, true, false},
+		{"timeout", usrsptypes.IpamConf{Type: "ipam-hang", Timeout: 1}, true, true},
+		{"timeout retried", usrsptypes.IpamConf{Type: "ipam-hang-once", Timeout: 1, Retries: 1, RetryDelay: 1}, false, false},
+		{"missing plugin", usrsptypes.IpamConf{Type: "ipam-missing"}, true, false},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.IPAM = test.ipam
+
+		start := time.Now()
+		result, err := allocateIpam(netConf, []byte(`{"name":"net1"}`))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: allocateIpam() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if _, ok := err.(*ipamTimeoutError); ok != test.wantTimeout {
+			t.Errorf("%s: allocateIpam() error = %v, want timeout %v", test.name, err, test.wantTimeout)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("%s: allocateIpam() waited %v on the plugin", test.name, elapsed)
+		}
+		if err == nil && (len(result.IPs) != 1 || result.IPs[0].Address.String() != "10.1.1.5/24") {
+			t.Errorf("%s: allocateIpam() = %v", test.name, result)
+		}
+	}
+
+	netConf := &usrsptypes.NetConf{}
+	netConf.IPAM.Type = "ipam-exhausted"
+	_, err = allocateIpam(netConf, []byte(`{"name":"net1"}`))
+	if pluginErr, ok := err.(*cnitypes.Error); ok == false || pluginErr.Code != 11 {
+		t.Errorf("allocateIpam() error = %#v, want the CNI error of the plugin", err)
+	}
+}
+
+func TestIsRetryableIpamError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", &ipamTimeoutError{plugin: "host-local", timeout: time.Second}, true},
+		{"busy", &cnitypes.Error{Msg: "Resource temporarily unavailable"}, true},
+		{"exhausted", &cnitypes.Error{Code: 11, Msg: "no IP addresses available"}, false},
+		// Only the typed error is a timeout, not any message saying so.
+		{"plugin message", &cnitypes.Error{Msg: "request timed out"}, false},
+	}
+
+	for _, test := range tests {
+		if got := isRetryableIpamError(test.err); got != test.want {
+			t.Errorf("%s: isRetryableIpamError() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetDelTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     usrsptypes.NetConf
+		want     time.Duration
+		wantFail bool
+	}{
+		{"unset", usrsptypes.NetConf{}, 0, false},
+		{"timeout", usrsptypes.NetConf{DelTimeout: 15}, 15 * time.Second, false},
+		{"timeout fail", usrsptypes.NetConf{DelTimeout: 15, DelTimeoutFail: true}, 15 * time.Second, true},
+		{"negative", usrsptypes.NetConf{DelTimeout: -1, DelTimeoutFail: true}, 0, false},
+	}
+
+	for _, test := range tests {
+		got, gotFail := getDelTimeout(&test.conf)
+		if got != test.want || gotFail != test.wantFail {
+			t.Errorf("%s: getDelTimeout() = %v, %v, want %v, %v", test.name, got, gotFail, test.want, test.wantFail)
+		}
+	}
+}
+
+func TestValidateStaticRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		netType string
+		route   usrsptypes.StaticRoute
+		wantErr bool
+	}{
+		{"attached", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16"}, false},
+		{"gateway", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Gw: "10.1.1.1", Metric: 10, Weight: 255}, false},
+		{"ipv6 gateway", "interface", usrsptypes.StaticRoute{Dst: "2001:db8::/32", Gw: "fe80::1"}, false},
+		{"default weight", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Weight: 0}, false},
+		{"not interface", "vhostuser", usrsptypes.StaticRoute{Dst: "10.2.0.0/16"}, true},
+		{"dst not cidr", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0"}, true},
+		{"invalid gw", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Gw: "10.1.1"}, true},
+		{"gw family", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Gw: "fe80::1"}, true},
+		{"metric range", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Metric: 256}, true},
+		{"negative weight", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Weight: -1}, true},
+		{"weight range", "interface", usrsptypes.StaticRoute{Dst: "10.2.0.0/16", Weight: 256}, true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.NetType = test.netType
+		netConf.ContainerConf.Routes = []usrsptypes.StaticRoute{test.route}
+
+		err := validateStaticRoutes(netConf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validateStaticRoutes() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	tests := []struct {
+		name         string
+		panicValue   interface{}
+		wantErr      bool
+		wantRollback bool
+	}{
+		{"no panic", nil, false, false},
+		{"panic", "boom", true, true},
+		{"error value", &os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist}, true, true},
+	}
+
+	for _, test := range tests {
+		rolledBack := false
+		var err error
+		func() {
+			defer recoverPanic("ADD", &err, func() { rolledBack = true })
+			if test.panicValue != nil {
+				panic(test.panicValue)
+			}
+		}()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: recoverPanic() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+		if rolledBack != test.wantRollback {
+			t.Errorf("%s: rollback called = %v, want %v", test.name, rolledBack, test.wantRollback)
+		}
+		if err != nil {
+			cniErr, ok := err.(*cnitypes.Error)
+			if ok == false || cniErr.Code != errCodePanic || cniErr.Details == "" {
+				t.Errorf("%s: recoverPanic() error = %#v, want code %d with the stack", test.name, err, errCodePanic)
+			}
+		}
+	}
+
+	// The runtime must be able to tell a panic from a failed command.
+	if errCodePanic == errCodeCommandFailed {
+		t.Errorf("errCodePanic is the code of a failed command, %d", errCodePanic)
+	}
+}
+
+// A panic in ADD is printed by skel as a CNI error, not a crash.
+func TestCmdAddPanic(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	defer clearRequestFields()
+
+	savedEngines := engines
+	engines = []engineEntry{{"vpp", fakeEngine{probePanic: true}}}
+	defer func() { engines = savedEngines }()
+
+	conf := `{"cniVersion":"0.3.1","name":"net1","type":"userspace","host":{"engine":"auto","engineOrder":["vpp"]}}`
+	stdin, err := ioutil.TempFile("", "usrsp-stdin")
+	if err != nil {
+		t.Fatalf("TempFile(): %v", err)
+	}
+	defer os.Remove(stdin.Name())
+	defer stdin.Close()
+	stdin.WriteString(conf)
+	stdin.Seek(0, 0)
+
+	savedStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = savedStdin }()
+
+	env := map[string]string{
+		"CNI_COMMAND":     "ADD",
+		"CNI_CONTAINERID": "usrsp-test-panic",
+		"CNI_NETNS":       "/var/run/netns/usrsp-test-gone",
+		"CNI_IFNAME":      "net1",
+		"CNI_PATH":        "/opt/cni/bin",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	// As skel.PluginMain() prints the error.
+	output, err := captureStdout(t, func() error {
+		if cniErr := skel.PluginMainWithError(cmdAdd, cmdDel, cniSpecVersion.All); cniErr != nil {
+			return cniErr.Print()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("printing the error: %v", err)
+	}
+
+	var cniErr cnitypes.Error
+	if err = json.Unmarshal([]byte(output), &cniErr); err != nil {
+		t.Fatalf("stdout is not a CNI error: %v\n%s", err, output)
+	}
+	if cniErr.Code != errCodePanic || strings.Contains(cniErr.Msg, "fake engine probe") == false || cniErr.Details == "" {
+		t.Errorf("CNI error = %+v, want code %d with the panic and the stack", cniErr, errCodePanic)
+	}
+}
+
+func TestLoadNetConfDefaultEngine(t *testing.T) {
+	defer os.Unsetenv("USERSPACE_DEFAULT_ENGINE")
+
+	tests := []struct {
+		name       string
+		envEngine  string
+		conf       string
+		wantEngine string
+	}{
+		{"default", "", `{"name":"net1","type":"userspace"}`, defaultEngine},
+		{"empty engine", "", `{"name":"net1","type":"userspace","host":{"engine":""}}`, defaultEngine},
+		{"node default", "ovs-dpdk", `{"name":"net1","type":"userspace"}`, "ovs-dpdk"},
+		{"configured", "ovs-dpdk", `{"name":"net1","type":"userspace","host":{"engine":"vpp"}}`, "vpp"},
+	}
+
+	for _, test := range tests {
+		os.Setenv("USERSPACE_DEFAULT_ENGINE", test.envEngine)
+
+		netConf, err := loadNetConf([]byte(test.conf))
+		if err != nil {
+			t.Errorf("%s: loadNetConf() error = %v", test.name, err)
+			continue
+		}
+		if netConf.HostConf.Engine != test.wantEngine {
+			t.Errorf("%s: host engine = %q, want %q", test.name, netConf.HostConf.Engine, test.wantEngine)
+		}
+	}
+}
+
+func TestGetNetnsCleanupIfName(t *testing.T) {
+	tests := []struct {
+		name         string
+		force        bool
+		kernelIfName string
+		infoErr      error
+		want         string
+	}{
+		{"created by ADD", false, "net1", nil, "net1"},
+		{"created under another name", false, "eth9", nil, "eth9"},
+		{"not created", false, "", nil, ""},
+		// May belong to another plugin of the chain.
+		{"no attachment data", false, "", errors.New("not found"), ""},
+		{"forced", true, "", nil, "net1"},
+		{"forced without attachment data", true, "", errors.New("not found"), "net1"},
+	}
+
+	args := &skel.CmdArgs{ContainerID: "c1", IfName: "net1"}
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{ForceNetnsCleanup: test.force}
+		info := &usrspdb.AttachmentInfo{KernelIfName: test.kernelIfName}
+
+		if got := getNetnsCleanupIfName(netConf, args, info, test.infoErr); got != test.want {
+			t.Errorf("%s: getNetnsCleanupIfName() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDelNetnsKernelIf(t *testing.T) {
+	netns, cleanup := newTestNetns(t)
+	defer cleanup()
+
+	tests := []struct {
+		name         string
+		force        bool
+		kernelIfName string
+		wantDeleted  bool
+	}{
+		// eth0 of another plugin of the chain, a memif only attachment
+		// does not touch it.
+		{"memif only", false, "", false},
+		{"created by ADD", false, "eth0", true},
+		{"forced", true, "", true},
+	}
+
+	args := &skel.CmdArgs{ContainerID: "c1", IfName: "eth0", Netns: netns.Path()}
+	for _, test := range tests {
+		// Addressed, like the interfaces DEL removes.
+		addTestLink(t, netns, "eth0", "")
+		err := netns.Do(func(_ ns.NetNS) error {
+			link, err := netlink.LinkByName("eth0")
+			if err != nil {
+				return err
+			}
+			addr, _ := netlink.ParseAddr("10.10.0.2/24")
+			return netlink.AddrAdd(link, addr)
+		})
+		if err != nil {
+			t.Fatalf("%s: AddrAdd(): %v", test.name, err)
+		}
+
+		netConf := &usrsptypes.NetConf{ForceNetnsCleanup: test.force}
+		info := &usrspdb.AttachmentInfo{ContainerID: "c1", IfName: "eth0", KernelIfName: test.kernelIfName}
+		kernelIfName := getNetnsCleanupIfName(netConf, args, info, nil)
+		if err := delNetnsKernelIf(args, kernelIfName); err != nil {
+			t.Errorf("%s: delNetnsKernelIf() error = %v", test.name, err)
+		}
+
+		if deleted := hasTestLink(netns, "eth0") == false; deleted != test.wantDeleted {
+			t.Errorf("%s: eth0 deleted = %v, want %v", test.name, deleted, test.wantDeleted)
+		}
+		delTestLink(netns, "eth0")
+	}
+}
+
+func TestParseIpamResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantIPs []string
+		wantGw  string
+		wantErr bool
+	}{
+		{"current", `{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.1.1.5/24","gateway":"10.1.1.1"}]}`,
+			[]string{"10.1.1.5/24"}, "10.1.1.1", false},
+		{"dual stack", `{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.1.1.5/24"},{"version":"6","address":"2001:db8::5/64"}]}`,
+			[]string{"10.1.1.5/24", "2001:db8::5/64"}, "", false},
+		// Legacy plugins return 0.2.0 results whatever the config asks for.
+		{"legacy ip4", `{"cniVersion":"0.2.0","ip4":{"ip":"10.1.1.5/24","gateway":"10.1.1.1"}}`,
+			[]string{"10.1.1.5/24"}, "10.1.1.1", false},
+		{"legacy without version", `{"ip4":{"ip":"10.1.1.5/24"},"ip6":{"ip":"2001:db8::5/64"}}`,
+			[]string{"10.1.1.5/24", "2001:db8::5/64"}, "", false},
+		{"not json", `Error: lease not found`, nil, "", true},
+	}
+
+	for _, test := range tests {
+		result, err := parseIpamResult([]byte(test.output))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: parseIpamResult() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(result.IPs) != len(test.wantIPs) {
+			t.Errorf("%s: parseIpamResult() = %d addresses, want %d", test.name, len(result.IPs), len(test.wantIPs))
+			continue
+		}
+		for i, ipConfig := range result.IPs {
+			if ipConfig.Address.String() != test.wantIPs[i] {
+				t.Errorf("%s: address %d = %s, want %s", test.name, i, ipConfig.Address.String(), test.wantIPs[i])
+			}
+		}
+		if test.wantGw != "" && result.IPs[0].Gateway.String() != test.wantGw {
+			t.Errorf("%s: gateway = %v, want %s", test.name, result.IPs[0].Gateway, test.wantGw)
+		}
+	}
+}
+
+func TestGetIpamConf(t *testing.T) {
+	stdinData := `{"cniVersion":"0.3.1","name":"net1","type":"userspace","host":{"engine":"vpp"},` +
+		`"ipam":{"type":"host-local","subnet":"10.1.1.0/24","timeout":10,"retries":2},"dns":{"nameservers":["10.1.1.1"]}}`
+
+	tests := []struct {
+		name      string
+		strict    bool
+		stdinData string
+		want      string
+		wantErr   bool
+	}{
+		{"entire config", false, stdinData, stdinData, false},
+		{"strict", true, stdinData,
+			`{"cniVersion":"0.3.1","dns":{"nameservers":["10.1.1.1"]},"ipam":{"subnet":"10.1.1.0/24","type":"host-local"},"name":"net1","type":"userspace"}`, false},
+		{"strict without ipam", true, `{"name":"net1"}`, "", true},
+		{"strict invalid", true, `{`, "", true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{IpamStrictConf: test.strict}
+
+		got, err := getIpamConf(netConf, []byte(test.stdinData))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: getIpamConf() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && string(got) != test.want {
+			t.Errorf("%s: getIpamConf() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateBridge(t *testing.T) {
+	tests := []struct {
+		name            string
+		hostEngine      string
+		containerEngine string
+		netType         string
+		shg             int
+		bvi             bool
+		wantErr         bool
+	}{
+		{"unset", "ovs-dpdk", "", "interface", 0, false, false},
+		{"shg", "vpp", "", "bridge", 3, false, false},
+		{"bvi", "vpp", "", "bridge", 0, true, false},
+		{"container engine", "ovs-dpdk", "vpp", "bridge", 3, false, false},
+		{"ovs", "ovs-dpdk", "", "bridge", 3, false, true},
+		{"interface", "vpp", "", "interface", 0, true, true},
+		{"shg range", "vpp", "", "bridge", 256, false, true},
+		{"negative shg", "vpp", "", "bridge", -1, false, true},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		netConf.HostConf.Engine = test.hostEngine
+		netConf.ContainerConf.Engine = test.containerEngine
+		netConf.ContainerConf.NetType = test.netType
+		netConf.ContainerConf.BridgeConf.Shg = test.shg
+		netConf.ContainerConf.BridgeConf.Bvi = test.bvi
+
+		err := validateBridge(netConf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validateBridge() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestMergeResult(t *testing.T) {
+	parseResult := func(conf string) *current.Result {
+		result, err := current.NewResult([]byte(conf))
+		if err != nil {
+			t.Fatalf("NewResult(%s): %v", conf, err)
+		}
+		return result.(*current.Result)
+	}
+
+	tests := []struct {
+		name           string
+		prevResult     string
+		result         string
+		wantInterfaces int
+		wantIfIndexes  []int
+		wantRoutes     int
+		wantDNS        string
+	}{
+		{"empty previous", `{"cniVersion":"0.3.1"}`,
+			`{"cniVersion":"0.3.1","interfaces":[{"name":"net1"}],"ips":[{"version":"4","interface":0,"address":"10.1.1.5/24"}],"dns":{"nameservers":["10.1.1.1"]}}`,
+			1, []int{0}, 0, "10.1.1.1"},
+		{"after eth0", `{"cniVersion":"0.3.1","interfaces":[{"name":"eth0"},{"name":"veth0"}],"ips":[{"version":"4","interface":0,"address":"10.244.0.5/24"}],"routes":[{"dst":"0.0.0.0/0"}],"dns":{"nameservers":["10.96.0.10"]}}`,
+			`{"cniVersion":"0.3.1","interfaces":[{"name":"net1"}],"ips":[{"version":"4","interface":0,"address":"10.1.1.5/24"}],"routes":[{"dst":"10.2.0.0/16"}],"dns":{"nameservers":["10.1.1.1"]}}`,
+			3, []int{0, 2}, 2, "10.96.0.10"},
+		{"address without interface", `{"cniVersion":"0.3.1","interfaces":[{"name":"eth0"}]}`,
+			`{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.1.1.5/24"}]}`,
+			1, []int{-1}, 0, ""},
+	}
+
+	for _, test := range tests {
+		prevResult := parseResult(test.prevResult)
+		prevIPs := len(prevResult.IPs)
+
+		merged := mergeResult(prevResult, parseResult(test.result))
+		if len(merged.Interfaces) != test.wantInterfaces || len(merged.Routes) != test.wantRoutes {
+			t.Errorf("%s: mergeResult() = %d interfaces %d routes, want %d %d", test.name,
+				len(merged.Interfaces), len(merged.Routes), test.wantInterfaces, test.wantRoutes)
+		}
+		if len(merged.IPs) != len(test.wantIfIndexes) {
+			t.Errorf("%s: mergeResult() = %d addresses, want %d", test.name, len(merged.IPs), len(test.wantIfIndexes))
+			continue
+		}
+		for i, ipConfig := range merged.IPs {
+			index := -1
+			if ipConfig.Interface != nil {
+				index = *ipConfig.Interface
+			}
+			if index != test.wantIfIndexes[i] {
+				t.Errorf("%s: address %d on interface %d, want %d", test.name, i, index, test.wantIfIndexes[i])
+			}
+		}
+		dns := ""
+		if len(merged.DNS.Nameservers) != 0 {
+			dns = merged.DNS.Nameservers[0]
+		}
+		if dns != test.wantDNS {
+			t.Errorf("%s: nameserver = %q, want %q", test.name, dns, test.wantDNS)
+		}
+		if len(prevResult.IPs) != prevIPs {
+			t.Errorf("%s: mergeResult() modified the previous Result", test.name)
+		}
+	}
+}
+
+func TestGetDelIpamNetConf(t *testing.T) {
+	addConf := `{"name":"net1","type":"userspace","ipam":{"type":"host-local","subnet":"10.1.1.0/24"}}`
+
+	tests := []struct {
+		name       string
+		ignore     bool
+		addConf    string
+		infoErr    error
+		wantSubnet string
+	}{
+		{"saved", false, addConf, nil, "10.1.1.0/24"},
+		{"ignored", true, addConf, nil, "10.2.2.0/24"},
+		{"not saved", false, "", nil, "10.2.2.0/24"},
+		{"no attachment data", false, "", errors.New("not found"), "10.2.2.0/24"},
+		{"saved invalid", false, `{`, nil, "10.2.2.0/24"},
+	}
+
+	for _, test := range tests {
+		delConf := `{"name":"net1","type":"userspace","ipam":{"type":"host-local","subnet":"10.2.2.0/24"}}`
+		if test.ignore {
+			delConf = `{"name":"net1","type":"userspace","ignoreAddIpamConf":true,"ipam":{"type":"host-local","subnet":"10.2.2.0/24"}}`
+		}
+		netConf, err := loadNetConf([]byte(delConf))
+		if err != nil {
+			t.Fatalf("%s: loadNetConf(): %v", test.name, err)
+		}
+		info := &usrspdb.AttachmentInfo{AddConf: []byte(test.addConf)}
+
+		ipamNetConf := getDelIpamNetConf(netConf, info, test.infoErr)
+		if strings.Contains(string(ipamNetConf.GetExpandedConf()), test.wantSubnet) == false {
+			t.Errorf("%s: getDelIpamNetConf() = %s, want subnet %s", test.name, ipamNetConf.GetExpandedConf(), test.wantSubnet)
+		}
+	}
+}
+
+func TestLoadDelNetConf(t *testing.T) {
+	tests := []struct {
+		name      string
+		stdinData string
+		wantErr   bool
+	}{
+		{"valid", `{"cniVersion":"0.3.1","name":"net1","type":"userspace"}`, false},
+		// Nothing was saved for the attachment, so its state is unknown.
+		{"empty", "", true},
+		{"truncated", `{"cniVersion":"0.3.1","name":"ne`, true},
+	}
+
+	for _, test := range tests {
+		args := &skel.CmdArgs{ContainerID: "usrsp-test-unknown", IfName: "net1", StdinData: []byte(test.stdinData)}
+
+		netConf, err := loadDelNetConf(args)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: loadDelNetConf() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil {
+			if netConf.Name != "net1" {
+				t.Errorf("%s: loadDelNetConf() name = %q, want net1", test.name, netConf.Name)
+			}
+			continue
+		}
+		if cniErr, ok := err.(*cnitypes.Error); ok == false || cniErr.Code != errCodeStateUnknown {
+			t.Errorf("%s: loadDelNetConf() error = %#v, want code %d", test.name, err, errCodeStateUnknown)
+		}
+	}
+}
+
+func TestIsVersionDecodable(t *testing.T) {
+	tests := []struct {
+		name      string
+		stdinData string
+		want      bool
+	}{
+		{"valid", `{"cniVersion":"0.3.1","name":"net1"}`, true},
+		{"no version", `{"name":"net1"}`, true},
+		{"empty", "", false},
+		{"truncated", `{"cniVersion":"0.3`, false},
+	}
+
+	for _, test := range tests {
+		if got := isVersionDecodable([]byte(test.stdinData)); got != test.want {
+			t.Errorf("%s: isVersionDecodable() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestToCniError(t *testing.T) {
+	stateUnknown := &cnitypes.Error{Code: errCodeStateUnknown, Msg: "ERROR: State unknown"}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode uint
+		wantMsg  string
+	}{
+		{"cni error", stateUnknown, errCodeStateUnknown, "ERROR: State unknown"},
+		{"other error", errors.New("ERROR: failed"), errCodeCommandFailed, "ERROR: failed"},
+	}
+
+	for _, test := range tests {
+		got := toCniError(test.err)
+		if got.Code != test.wantCode || got.Msg != test.wantMsg {
+			t.Errorf("%s: toCniError() = %d %q, want %d %q", test.name, got.Code, got.Msg, test.wantCode, test.wantMsg)
+		}
+	}
+}
+
+func TestAddResultInterface(t *testing.T) {
+	sandboxIndex := 0
+
+	tests := []struct {
+		name      string
+		if0name   string
+		previous  int
+		ips       []*current.IPConfig
+		wantName  string
+		wantIndex []int
+	}{
+		{"no address", "", 0, nil, "net1", nil},
+		{"requested name", "", 0, []*current.IPConfig{{Version: "4"}, {Version: "6"}}, "net1", []int{0, 0}},
+		{"if0name", "memif1", 0, []*current.IPConfig{{Version: "4"}}, "memif1", []int{0}},
+		// Addresses of previous plugins keep their interface.
+		{"chained", "", 1, []*current.IPConfig{{Version: "4", Interface: &sandboxIndex}, {Version: "4"}}, "net1", []int{0, 1}},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{If0name: test.if0name}
+		args := &skel.CmdArgs{ContainerID: "c1", IfName: "net1", Netns: "/var/run/netns/c1"}
+		result := &current.Result{IPs: test.ips}
+		for i := 0; i < test.previous; i++ {
+			result.Interfaces = append(result.Interfaces, &current.Interface{Name: "eth0"})
+		}
+
+		addResultInterface(netConf, args, result)
+
+		usrSp := result.Interfaces[len(result.Interfaces)-1]
+		if len(result.Interfaces) != test.previous+1 || usrSp.Name != test.wantName || usrSp.Sandbox != args.Netns {
+			t.Errorf("%s: addResultInterface() interfaces = %+v, want %s last", test.name, result.Interfaces, test.wantName)
+		}
+		for i, ipConfig := range result.IPs {
+			if ipConfig.Interface == nil || *ipConfig.Interface != test.wantIndex[i] {
+				t.Errorf("%s: addResultInterface() IP %d interface = %v, want %d", test.name, i, ipConfig.Interface, test.wantIndex[i])
+			}
+		}
+	}
+}
+
+func TestSetVppRetryPolicy(t *testing.T) {
+	defer os.Unsetenv("USERSPACE_VPP_RETRY_ATTEMPTS")
+	defer os.Unsetenv("USERSPACE_VPP_RETRY_BACKOFF")
+	defer vppinfra.SetRetryPolicy(vppinfra.DefaultRetryAttempts, vppinfra.DefaultRetryBackoff)
+
+	tests := []struct {
+		name     string
+		attempts string
+		backoff  string
+		wantErr  bool
+	}{
+		{"default", "", "", false},
+		{"no retry", "1", "", false},
+		{"policy", "3", "10ms", false},
+		{"zero attempts", "0", "", true},
+		{"invalid attempts", "three", "", true},
+		{"invalid backoff", "", "fast", true},
+		{"negative backoff", "", "-1s", true},
+	}
+
+	for _, test := range tests {
+		os.Setenv("USERSPACE_VPP_RETRY_ATTEMPTS", test.attempts)
+		os.Setenv("USERSPACE_VPP_RETRY_BACKOFF", test.backoff)
+
+		if err := setVppRetryPolicy(); (err != nil) != test.wantErr {
+			t.Errorf("%s: setVppRetryPolicy() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+// captureStdout() - What f writes to stdout.
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe(): %v", err)
+	}
+	output := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		output <- data
+	}()
+
+	savedStdout := os.Stdout
+	os.Stdout = writer
+	err = f()
+	os.Stdout = savedStdout
+	writer.Close()
+	data := <-output
+	reader.Close()
+
+	return string(data), err
+}
+
+func TestPrintResult(t *testing.T) {
+	const result031 = `{"cniVersion":"0.3.1","interfaces":[{"name":"net1","sandbox":"/var/run/netns/c1"}],"ips":[{"version":"4","interface":0,"address":"10.1.1.5/24","gateway":"10.1.1.1"}]}`
+
+	tests := []struct {
+		name string
+		conf string
+		want string
+	}{
+		{"merged 0.3.1",
+			`{"cniVersion":"0.3.1","prevResult":{"cniVersion":"0.3.1","interfaces":[{"name":"eth0","sandbox":"/var/run/netns/c1"}],"ips":[{"version":"4","interface":0,"address":"10.244.0.5/24"}],"dns":{"nameservers":["10.96.0.10"]}}}`,
+			`{
+    "cniVersion": "0.3.1",
+    "interfaces": [
+        {
+            "name": "eth0",
+            "sandbox": "/var/run/netns/c1"
+        },
+        {
+            "name": "net1",
+            "sandbox": "/var/run/netns/c1"
+        }
+    ],
+    "ips": [
+        {
+            "version": "4",
+            "interface": 0,
+            "address": "10.244.0.5/24"
+        },
+        {
+            "version": "4",
+            "interface": 1,
+            "address": "10.1.1.5/24",
+            "gateway": "10.1.1.1"
+        }
+    ],
+    "dns": {
+        "nameservers": [
+            "10.96.0.10"
+        ]
+    }
+}`},
+		{"merged 0.2.0",
+			`{"cniVersion":"0.2.0","prevResult":{"cniVersion":"0.2.0","ip4":{"ip":"10.244.0.5/24"},"dns":{"nameservers":["10.96.0.10"]}}}`,
+			`{
+    "cniVersion": "0.2.0",
+    "ip4": {
+        "ip": "10.244.0.5/24"
+    },
+    "dns": {
+        "nameservers": [
+            "10.96.0.10"
+        ]
+    }
+}`},
+		{"suppressed 0.3.1",
+			`{"cniVersion":"0.3.1","suppressResult":true}`,
+			`{
+    "cniVersion": "0.3.1",
+    "dns": {}
+}`},
+		{"suppressed 0.2.0",
+			`{"cniVersion":"0.2.0","suppressResult":true}`,
+			`{
+    "cniVersion": "0.2.0",
+    "dns": {}
+}`},
+		{"suppressed chained 0.3.1",
+			`{"cniVersion":"0.3.1","suppressResult":true,"prevResult":{"cniVersion":"0.3.1","interfaces":[{"name":"eth0"}],"ips":[{"version":"4","interface":0,"address":"10.244.0.5/24"}]}}`,
+			`{
+    "cniVersion": "0.3.1",
+    "interfaces": [
+        {
+            "name": "eth0"
+        }
+    ],
+    "ips": [
+        {
+            "version": "4",
+            "interface": 0,
+            "address": "10.244.0.5/24"
+        }
+    ],
+    "dns": {}
+}`},
+		{"suppressed chained 0.2.0",
+			`{"cniVersion":"0.2.0","suppressResult":true,"prevResult":{"cniVersion":"0.2.0","ip4":{"ip":"10.244.0.5/24"}}}`,
+			`{
+    "cniVersion": "0.2.0",
+    "ip4": {
+        "ip": "10.244.0.5/24"
+    },
+    "dns": {}
+}`},
+	}
+
+	for _, test := range tests {
+		netConf := &usrsptypes.NetConf{}
+		if err := json.Unmarshal([]byte(test.conf), netConf); err != nil {
+			t.Fatalf("%s: Unmarshal(): %v", test.name, err)
+		}
+		result, err := current.NewResult([]byte(result031))
+		if err != nil {
+			t.Fatalf("%s: NewResult(): %v", test.name, err)
+		}
+
+		got, err := captureStdout(t, func() error {
+			return printResult(netConf, result.(*current.Result))
+		})
+		if err != nil {
+			t.Errorf("%s: printResult() error = %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: printResult() printed\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Version: Running the plugin as "userspace version" prints the build of
+// the plugin (see usrsptypes/version.go), the CNI versions it supports and
+// the engines with their capabilities. --json prints the same as a JSON
+// object. The CNI VERSION command is left to skel, as the CNI spec defines
+// its output.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Types
+//
+
+// The build of the plugin, as printed by the version command.
+type versionInfo struct {
+	Version     string          `json:"version"`
+	Commit      string          `json:"commit"`
+	BuildDate   string          `json:"buildDate"`
+	CniVersions []string        `json:"cniVersions"`
+	Engines     []versionEngine `json:"engines"`
+}
+
+type versionEngine struct {
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+}
+
+//
+// Local Functions
+//
+
+// runVersion() - Print the build of the plugin and its engines, as text or
+//  as JSON (--json).
+func runVersion(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJson := flags.Bool("json", false, "print as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	info := versionInfo{
+		Version:     usrsptypes.Version,
+		Commit:      usrsptypes.Commit,
+		BuildDate:   usrsptypes.BuildDate,
+		CniVersions: cniSpecVersion.All.SupportedVersions(),
+	}
+	for _, entry := range engines {
+		info.Engines = append(info.Engines, versionEngine{
+			Name:         entry.name,
+			Capabilities: entry.engine.Capabilities(),
+		})
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	fmt.Fprintf(w, "userspace %s\n", usrsptypes.GetVersionString())
+	fmt.Fprintf(w, "CNI versions: %s\n", strings.Join(info.CniVersions, ", "))
+	for _, engine := range info.Engines {
+		fmt.Fprintf(w, "engine %s: %s\n", engine.Name, strings.Join(engine.Capabilities, ", "))
+	}
+
+	return nil
+}
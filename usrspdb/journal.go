@@ -0,0 +1,195 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Journal: The engines record each step programming an attachment (step,
+// summary of the request, result) in the journal of the attachment, saved
+// with the attachment data, so a failed ADD or DEL can be followed up even
+// if its rollback failed too. The journal is bounded to MaxJournalEntries,
+// the oldest entries are dropped.
+//
+// The steps run before the engine saves the attachment (the interface is
+// created first) are kept by the process, and saved with the attachment
+// once it is. They are also used for the error of the command when the
+// attachment is removed by a rollback. The journal is only part of the
+// attachment data, it is not passed to the container.
+//
+
+package usrspdb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Constants
+//
+
+// Entries kept in the journal of an attachment.
+const MaxJournalEntries = 32
+
+// Entries of the journal added to the error of a failed command.
+const JournalTailEntries = 5
+
+// Longest result recorded, errors are truncated.
+const maxJournalResult = 256
+
+//
+// Types
+//
+
+// A step of the journal of an attachment.
+type JournalEntry struct {
+	Time    string `json:"time"`              // When the step ended, RFC 3339
+	Engine  string `json:"engine"`            // Engine running the step {vpp|ovs-dpdk}
+	Step    string `json:"step"`              // Name of the step, like create or bridge
+	Request string `json:"request,omitempty"` // Summary of the request of the step
+	Result  string `json:"result"`            // "ok", or the error of the step
+}
+
+// JournalError is the error of a command along with the last entries of the
+// journal of the attachment, which are part of the message.
+type JournalError struct {
+	Err  error
+	Tail []JournalEntry
+}
+
+func (e *JournalError) Error() string {
+	return fmt.Sprintf("%v; journal: %s", e.Err, FormatJournal(e.Tail, "; "))
+}
+
+func (e *JournalError) Unwrap() error {
+	return e.Err
+}
+
+//
+// Variables
+//
+
+// Journal of the attachments handled by the process, by attachment key.
+var processJournal = struct {
+	sync.Mutex
+	entries map[string][]JournalEntry
+}{entries: make(map[string][]JournalEntry)}
+
+//
+// API Functions
+//
+
+// RecordJournal() - Append a step to the journal of the attachment. The
+//  journal is saved with the attachment if it exists, failing to save it is
+//  not an error of the step.
+func RecordJournal(containerID string, ifName string, engine string, step string, request string, stepErr error) {
+	entry := JournalEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Engine:  engine,
+		Step:    step,
+		Request: request,
+		Result:  "ok",
+	}
+	if stepErr != nil {
+		entry.Result = stepErr.Error()
+		if len(entry.Result) > maxJournalResult {
+			entry.Result = entry.Result[:maxJournalResult] + "..."
+		}
+	}
+
+	key := getAttachmentKey(containerID, ifName)
+	processJournal.Lock()
+	processJournal.entries[key] = trimJournal(append(processJournal.entries[key], entry))
+	processJournal.Unlock()
+
+	info, err := defaultStore.Get(containerID, ifName)
+	if err != nil {
+		return
+	}
+	info.Journal = trimJournal(append(info.Journal, entry))
+	defaultStore.Put(&info)
+}
+
+// GetJournal() - Journal of the attachment: the steps of the process if
+//  any, otherwise the journal saved with the attachment.
+func GetJournal(containerID string, ifName string) []JournalEntry {
+	if journal := getProcessJournal(containerID, ifName); len(journal) != 0 {
+		return journal
+	}
+
+	info, err := defaultStore.Get(containerID, ifName)
+	if err != nil {
+		return nil
+	}
+	return info.Journal
+}
+
+// WithJournal() - The error of a command on the attachment along with the
+//  tail of its journal, see JournalError. The error is returned as is if
+//  there is no journal.
+func WithJournal(containerID string, ifName string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	journal := GetJournal(containerID, ifName)
+	if len(journal) == 0 {
+		return err
+	}
+	if len(journal) > JournalTailEntries {
+		journal = journal[len(journal)-JournalTailEntries:]
+	}
+
+	return &JournalError{Err: err, Tail: journal}
+}
+
+// ForgetJournal() - Drop the steps of the attachment kept by the process,
+//  once its command is done. The journal saved with the attachment is kept.
+func ForgetJournal(containerID string, ifName string) {
+	processJournal.Lock()
+	delete(processJournal.entries, getAttachmentKey(containerID, ifName))
+	processJournal.Unlock()
+}
+
+// FormatJournal() - Entries of a journal, one per line or separated by sep.
+func FormatJournal(journal []JournalEntry, sep string) string {
+	var lines []string
+	for _, entry := range journal {
+		line := fmt.Sprintf("%s %s %s", entry.Time, entry.Engine, entry.Step)
+		if entry.Request != "" {
+			line += " (" + entry.Request + ")"
+		}
+		lines = append(lines, line+": "+entry.Result)
+	}
+	return strings.Join(lines, sep)
+}
+
+//
+// Local Functions
+//
+
+func getProcessJournal(containerID string, ifName string) []JournalEntry {
+	processJournal.Lock()
+	defer processJournal.Unlock()
+
+	return append([]JournalEntry(nil), processJournal.entries[getAttachmentKey(containerID, ifName)]...)
+}
+
+// trimJournal() - Drop the oldest entries beyond MaxJournalEntries.
+func trimJournal(journal []JournalEntry) []JournalEntry {
+	if len(journal) > MaxJournalEntries {
+		journal = journal[len(journal)-MaxJournalEntries:]
+	}
+	return journal
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrspdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRecordJournal(t *testing.T) {
+	_, cleanup := useTestStore(t)
+	defer cleanup()
+
+	tests := []struct {
+		name         string
+		saved        bool
+		steps        int
+		stepErr      error
+		wantProcess  int
+		wantSaved    int
+		wantLastStep string
+	}{
+		// Steps run before the attachment is saved are kept by the process.
+		{"not saved", false, 3, nil, 3, 0, "step-2"},
+		{"saved", true, 2, nil, 2, 2, "step-1"},
+		{"bounded", true, MaxJournalEntries + 5, nil, MaxJournalEntries, MaxJournalEntries, fmt.Sprintf("step-%d", MaxJournalEntries+4)},
+		{"failed step", true, 1, errors.New("ERROR: VPP API returned -2"), 1, 1, "step-0"},
+	}
+
+	for _, test := range tests {
+		ifName := strings.Replace(test.name, " ", "-", -1)
+		if test.saved {
+			if err := SaveAttachment(&AttachmentInfo{ContainerID: "c1", IfName: ifName, Engine: "vpp"}); err != nil {
+				t.Fatalf("%s: SaveAttachment(): %v", test.name, err)
+			}
+		}
+
+		for i := 0; i < test.steps; i++ {
+			RecordJournal("c1", ifName, "vpp", fmt.Sprintf("step-%d", i), "interface 3", test.stepErr)
+		}
+
+		journal := GetJournal("c1", ifName)
+		if len(journal) != test.wantProcess || journal[len(journal)-1].Step != test.wantLastStep {
+			t.Errorf("%s: GetJournal() = %d entries, want %d ending with %s", test.name, len(journal), test.wantProcess, test.wantLastStep)
+			continue
+		}
+		wantResult := "ok"
+		if test.stepErr != nil {
+			wantResult = test.stepErr.Error()
+		}
+		if journal[0].Result != wantResult || journal[0].Engine != "vpp" || journal[0].Request != "interface 3" {
+			t.Errorf("%s: GetJournal() entry = %+v, want result %q", test.name, journal[0], wantResult)
+		}
+
+		// Once the process forgot it, the saved journal is left.
+		ForgetJournal("c1", ifName)
+		if saved := GetJournal("c1", ifName); len(saved) != test.wantSaved {
+			t.Errorf("%s: saved journal = %d entries, want %d", test.name, len(saved), test.wantSaved)
+		}
+	}
+}
+
+func TestWithJournal(t *testing.T) {
+	_, cleanup := useTestStore(t)
+	defer cleanup()
+
+	cmdErr := errors.New("ERROR: Failed to create memif")
+
+	tests := []struct {
+		name     string
+		steps    int
+		err      error
+		wantTail int
+	}{
+		{"no error", 2, nil, 0},
+		{"no journal", 0, cmdErr, 0},
+		{"short journal", 2, cmdErr, 2},
+		{"tail", JournalTailEntries + 3, cmdErr, JournalTailEntries},
+	}
+
+	for _, test := range tests {
+		ifName := strings.Replace(test.name, " ", "-", -1)
+		for i := 0; i < test.steps; i++ {
+			RecordJournal("c2", ifName, "ovs-dpdk", fmt.Sprintf("step-%d", i), "", nil)
+		}
+
+		err := WithJournal("c2", ifName, test.err)
+		ForgetJournal("c2", ifName)
+
+		journalErr, ok := err.(*JournalError)
+		if test.wantTail == 0 {
+			if err != test.err {
+				t.Errorf("%s: WithJournal() = %v, want %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if ok == false || len(journalErr.Tail) != test.wantTail || errors.Is(err, cmdErr) == false {
+			t.Errorf("%s: WithJournal() = %v, want %d entries of journal", test.name, err, test.wantTail)
+			continue
+		}
+
+		// The most recent steps are reported.
+		last := fmt.Sprintf("ovs-dpdk step-%d: ok", test.steps-1)
+		if strings.HasSuffix(err.Error(), last) == false {
+			t.Errorf("%s: WithJournal() = %q, want it to end with %q", test.name, err.Error(), last)
+		}
+	}
+}
+
+func TestFormatJournal(t *testing.T) {
+	journal := []JournalEntry{
+		{Time: "2018-06-01T10:00:00Z", Engine: "vpp", Step: "create", Request: "memif /var/run/vpp/memif.sock", Result: "ok"},
+		{Time: "2018-06-01T10:00:01Z", Engine: "vpp", Step: "state", Result: "ERROR: VPP API returned -2"},
+	}
+
+	tests := []struct {
+		name string
+		sep  string
+		want string
+	}{
+		{"lines", "\n", "2018-06-01T10:00:00Z vpp create (memif /var/run/vpp/memif.sock): ok\n" +
+			"2018-06-01T10:00:01Z vpp state: ERROR: VPP API returned -2"},
+		{"error", "; ", "2018-06-01T10:00:00Z vpp create (memif /var/run/vpp/memif.sock): ok; " +
+			"2018-06-01T10:00:01Z vpp state: ERROR: VPP API returned -2"},
+	}
+
+	for _, test := range tests {
+		if got := FormatJournal(journal, test.sep); got != test.want {
+			t.Errorf("%s: FormatJournal() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Store: The attachments are kept in a directory per network, so no
+// directory holds every attachment of the node. index.json maps each
+// attachment (<ContainerId>-<IfName>) to the directory of its network, so
+// an attachment is found without knowing its network, and listed without
+// reading the directories. The index is written atomically, under a lock
+// (flock of .lock) shared by the writers, and only when an attachment is
+// added, moves to another network or is removed.
+//
+// The attachments of the former flat layout (<ContainerId>-<IfName>.json
+// in the state directory) are moved to the directory of their network when
+// the index does not exist yet, which also rebuilds a removed index.
+// Corrupt files are left where they are, for "userspace cleanup".
+//
+
+package usrspdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+
+const indexFileName = "index.json"
+const lockFileName = ".lock"
+
+//
+// Types
+//
+
+// Store of the attachment data of the node.
+type Store interface {
+	Get(containerID string, ifName string) (AttachmentInfo, error)
+	Put(info *AttachmentInfo) error
+	Delete(containerID string, ifName string) error
+	List() ([]AttachmentInfo, error)
+}
+
+// Store in a directory, see the top of this file.
+type fileStore struct {
+	dir string
+}
+
+// Content of index.json.
+type storeIndex struct {
+	Attachments map[string]string `json:"attachments"` // <ContainerId>-<IfName> to the directory of its network
+}
+
+//
+// Variables
+//
+
+var defaultStore Store = NewFileStore(DefaultStateDir)
+
+//
+// API Functions
+//
+
+// NewFileStore() - Store of the attachments in the given state directory.
+func NewFileStore(dir string) Store {
+	return &fileStore{dir: dir}
+}
+
+// GetStateDirs() - The state directory and the directories of the networks,
+//  to look for corrupt state files.
+func GetStateDirs() []string {
+	dirs := []string{DefaultStateDir}
+
+	files, err := ioutil.ReadDir(DefaultStateDir)
+	if err != nil {
+		return dirs
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			dirs = append(dirs, filepath.Join(DefaultStateDir, file.Name()))
+		}
+	}
+
+	return dirs
+}
+
+func (s *fileStore) Get(containerID string, ifName string) (AttachmentInfo, error) {
+	var info AttachmentInfo
+
+	index, err := s.loadIndex()
+	if err != nil {
+		return info, err
+	}
+
+	key := getAttachmentKey(containerID, ifName)
+	networkDir, ok := index.Attachments[key]
+	if ok == false {
+		return info, fmt.Errorf("ERROR: Failed to read attachment data: attachment %s not found", key)
+	}
+
+	err = usrsptypes.ReadStateFile(s.getAttachmentPath(networkDir, key), &info)
+	if errors.Is(err, usrsptypes.ErrCorruptState) {
+		return info, err
+	} else if err != nil {
+		return info, fmt.Errorf("ERROR: Failed to read attachment data: %v", err)
+	}
+
+	return info, nil
+}
+
+func (s *fileStore) Put(info *AttachmentInfo) error {
+
+	dataBytes, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("ERROR: serializing attachment data: %v", err)
+	}
+
+	lock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock(lock)
+
+	index, err := s.loadIndexLocked()
+	if err != nil {
+		return err
+	}
+
+	key := getAttachmentKey(info.ContainerID, info.IfName)
+	networkDir := getNetworkDir(info.Network)
+
+	if err = os.MkdirAll(filepath.Join(s.dir, networkDir), 0700); err != nil {
+		return err
+	}
+
+	path := s.getAttachmentPath(networkDir, key)
+
+	if debugUsrSpDb {
+		fmt.Printf("SAVE FILE: path=%s dataBytes=%s\n", path, dataBytes)
+	}
+	if err = usrsptypes.WriteFileAtomic(path, dataBytes, 0644); err != nil {
+		return err
+	}
+
+	previousDir, ok := index.Attachments[key]
+	if ok && previousDir == networkDir {
+		return nil
+	}
+	if ok {
+		s.removeAttachmentFile(previousDir, key)
+	}
+
+	index.Attachments[key] = networkDir
+	return s.writeIndex(index)
+}
+
+func (s *fileStore) Delete(containerID string, ifName string) error {
+
+	lock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock(lock)
+
+	index, err := s.loadIndexLocked()
+	if err != nil {
+		return err
+	}
+
+	key := getAttachmentKey(containerID, ifName)
+	networkDir, ok := index.Attachments[key]
+	if ok == false {
+		return nil
+	}
+
+	if err = s.removeAttachmentFile(networkDir, key); err != nil {
+		return fmt.Errorf("ERROR: Failed to delete attachment data: %v", err)
+	}
+
+	delete(index.Attachments, key)
+	return s.writeIndex(index)
+}
+
+func (s *fileStore) List() ([]AttachmentInfo, error) {
+	var attachments []AttachmentInfo
+
+	if _, err := os.Stat(s.dir); os.IsNotExist(err) {
+		return attachments, nil
+	}
+
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	// In the order of the former flat layout, sorted by file name.
+	keys := make([]string, 0, len(index.Attachments))
+	for key := range index.Attachments {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var info AttachmentInfo
+		if err = usrsptypes.ReadStateFile(s.getAttachmentPath(index.Attachments[key], key), &info); err != nil {
+			continue
+		}
+		attachments = append(attachments, info)
+	}
+
+	return attachments, nil
+}
+
+//
+// Local Functions
+//
+
+// loadIndex() - Read the index. Readers don't take the lock, the index is
+//  replaced atomically. Without index, it is built under the lock.
+func (s *fileStore) loadIndex() (*storeIndex, error) {
+	index, err := s.readIndex()
+	if os.IsNotExist(err) == false {
+		return index, err
+	}
+
+	lock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(lock)
+
+	return s.loadIndexLocked()
+}
+
+// loadIndexLocked() - Read the index, or build it from the files if it does
+//  not exist. The lock must be held.
+func (s *fileStore) loadIndexLocked() (*storeIndex, error) {
+	index, err := s.readIndex()
+	if os.IsNotExist(err) == false {
+		return index, err
+	}
+
+	index, err = s.rebuildIndex()
+	if err != nil {
+		return nil, err
+	}
+	return index, s.writeIndex(index)
+}
+
+// readIndex() - Read index.json, the error of the read is returned as is.
+func (s *fileStore) readIndex() (*storeIndex, error) {
+	index := &storeIndex{}
+
+	if err := usrsptypes.ReadStateFile(filepath.Join(s.dir, indexFileName), index); err != nil {
+		return nil, err
+	}
+	if index.Attachments == nil {
+		index.Attachments = make(map[string]string)
+	}
+
+	return index, nil
+}
+
+// writeIndex() - Replace index.json.
+func (s *fileStore) writeIndex(index *storeIndex) error {
+	dataBytes, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("ERROR: serializing attachment index: %v", err)
+	}
+
+	return usrsptypes.WriteFileAtomic(filepath.Join(s.dir, indexFileName), dataBytes, 0644)
+}
+
+// rebuildIndex() - Index the files of the network directories, and move the
+//  files of the flat layout into the directory of their network.
+func (s *fileStore) rebuildIndex() (*storeIndex, error) {
+	index := &storeIndex{Attachments: make(map[string]string)}
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to read attachment directory: %v", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			matches, _ := filepath.Glob(filepath.Join(s.dir, file.Name(), "*.json"))
+			for _, path := range matches {
+				index.Attachments[strings.TrimSuffix(filepath.Base(path), ".json")] = file.Name()
+			}
+			continue
+		}
+
+		if filepath.Ext(file.Name()) != ".json" || file.Name() == indexFileName {
+			continue
+		}
+
+		// Flat layout, corrupt files are left for the cleanup.
+		var info AttachmentInfo
+		path := filepath.Join(s.dir, file.Name())
+		if err = usrsptypes.ReadStateFile(path, &info); err != nil {
+			continue
+		}
+
+		key := strings.TrimSuffix(file.Name(), ".json")
+		networkDir := getNetworkDir(info.Network)
+		if err = os.MkdirAll(filepath.Join(s.dir, networkDir), 0700); err != nil {
+			return nil, err
+		}
+		if err = os.Rename(path, s.getAttachmentPath(networkDir, key)); err != nil {
+			return nil, err
+		}
+		index.Attachments[key] = networkDir
+	}
+
+	return index, nil
+}
+
+// lock() - Take the lock of the writers of the store, creating the state
+//  directory if needed.
+func (s *fileStore) lock() (*os.File, error) {
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	lockFile, err := os.OpenFile(filepath.Join(s.dir, lockFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Failed to open attachment lock: %v", err)
+	}
+
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("ERROR: Failed to take attachment lock: %v", err)
+	}
+
+	return lockFile, nil
+}
+
+func unlock(lockFile *os.File) {
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	lockFile.Close()
+}
+
+// removeAttachmentFile() - Remove the file of an attachment, and the
+//  directory of its network once empty.
+func (s *fileStore) removeAttachmentFile(networkDir string, key string) error {
+	if err := os.Remove(s.getAttachmentPath(networkDir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Fails while other attachments of the network remain.
+	os.Remove(filepath.Join(s.dir, networkDir))
+	return nil
+}
+
+func (s *fileStore) getAttachmentPath(networkDir string, key string) string {
+	return filepath.Join(s.dir, networkDir, key+".json")
+}
+
+func getAttachmentKey(containerID string, ifName string) string {
+	return fmt.Sprintf("%s-%s", containerID, ifName)
+}
+
+// getNetworkDir() - Directory of the attachments of a network. Names that
+//  can't be a directory, or could be mistaken for a file of the store, are
+//  prefixed with "_", "_" alone is used for attachments without network.
+func getNetworkDir(network string) string {
+	name := strings.Replace(network, "/", "_", -1)
+	if name == "" || strings.HasPrefix(name, ".") || name == indexFileName {
+		return "_" + name
+	}
+	return name
+}
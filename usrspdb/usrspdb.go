@@ -0,0 +1,140 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// This module provides the database library functions for the state of
+// each attachment (ContainerId + IfName) created by the UserSpace CNI,
+// independent of the engine that created it. Unlike the engine specific
+// databases (vppdb, ovsdb), this data is intended to be read by other
+// applications, like chained plugins, that need to act on the interfaces
+// created by the UserSpace CNI.
+//
+// The location of the data is part of the API. Each attachment is written
+// to a file with the name:
+//   /var/run/usrsp/cni/state/<Network>/<ContainerId>-<IfName>.json
+// and /var/run/usrsp/cni/state/index.json maps each attachment to its
+// network, see store.go.
+//
+
+package usrspdb
+
+import (
+	"encoding/json"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/current"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+//
+// Constants
+//
+const DefaultStateDir = "/var/run/usrsp/cni/state"
+const debugUsrSpDb = false
+
+//
+// Types
+//
+
+// This structure contains the identifiers of an attachment. Engine specific
+// fields are only filled in by the engine they apply to.
+type AttachmentInfo struct {
+	ContainerID     string `json:"containerId"`               // ContainerId the interface was added for
+	IfName          string `json:"ifName"`                    // Interface name (CNI_IFNAME) of the attachment
+	Network         string `json:"network,omitempty"`         // Name of the network (name of the configuration) of the attachment
+	Engine          string `json:"engine"`                    // Engine that created the host interface {vpp|ovs-dpdk}
+	ContainerEngine string `json:"containerEngine,omitempty"` // Engine that configures the container interface
+	IfType          string `json:"ifType,omitempty"`          // Type of the host interface {memif|vhostuser}
+	Tag             string `json:"tag,omitempty"`             // Tag the interface was created with, used to re-resolve the interface
+	SwIfIndex       uint32 `json:"swIfIndex,omitempty"`       // VPP Software Index of the host interface
+	PortName        string `json:"portName,omitempty"`        // OVS port of the host interface
+	SocketPath      string `json:"socketPath,omitempty"`      // Socket file shared between the host and the container
+	MemifId         uint32 `json:"memifId,omitempty"`         // Id of the memif interface on its socket
+	BridgeId        int    `json:"bridgeId,omitempty"`        // Bridge the host interface was added to
+	KernelIfName    string `json:"kernelIfName,omitempty"`    // Kernel interface created in the container netns (veth|tap), if any
+	AdminState      string `json:"adminState,omitempty"`      // Admin state requested for the host interface {up|down}
+	LinkState       string `json:"linkState,omitempty"`       // Link state of the host interface {up|down} read during the ADD, with reportLinkState
+	LinkStateTime   string `json:"linkStateTime,omitempty"`   // When the link state was read, RFC 3339
+	Unmanaged       bool   `json:"unmanaged,omitempty"`       // Host interface provisioned outside the plugin (managed false), never deleted
+	PluginVersion   string `json:"pluginVersion,omitempty"`   // Build of the plugin which last wrote the data, see usrsptypes.Version
+
+	SidecarIfName     string `json:"sidecarIfName,omitempty"`     // Kernel sidecar interface in the container
+	SidecarHostIfName string `json:"sidecarHostIfName,omitempty"` // Host end of the kernel sidecar veth pair
+
+	PortMappings  []PortMapping `json:"portMappings,omitempty"`  // Port mappings (hostPort) installed for the attachment
+	HostAddresses []string      `json:"hostAddresses,omitempty"` // Addresses (CIDR) programmed on the host interface
+
+	ResolvConf string     `json:"resolvConf,omitempty"` // resolv.conf written for the container (writeResolvConf), if any
+	DNS        *types.DNS `json:"dns,omitempty"`        // DNS settings of the attachment merged into resolvConf
+
+	Journal []JournalEntry `json:"journal,omitempty"` // Steps programming the attachment, see journal.go
+
+	Result  *current.Result `json:"result,omitempty"`  // Result of the completed ADD, returned again if the ADD is repeated
+	AddConf json.RawMessage `json:"addConf,omitempty"` // Configuration of the ADD, used to release the IPAM allocation on DEL
+}
+
+// A port mapping installed for the attachment. The pod address is saved
+// so the mapping can be removed even if the address was since reused.
+type PortMapping struct {
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"hostIP,omitempty"`
+	HostPort      int    `json:"hostPort"`
+	PodIP         string `json:"podIP"`
+	ContainerPort int    `json:"containerPort"`
+}
+
+//
+// API Functions
+//
+
+// SaveAttachment() - Write the attachment data to the state directory,
+//  replacing any previous data for the attachment. Without a journal, the
+//  journal of the previous data, or else the steps recorded so far by the
+//  process, is kept. The data is marked with the build of the plugin.
+func SaveAttachment(info *AttachmentInfo) error {
+	info.PluginVersion = usrsptypes.Version
+	if info.Journal == nil {
+		if previous, err := defaultStore.Get(info.ContainerID, info.IfName); err == nil {
+			info.Journal = previous.Journal
+		} else {
+			info.Journal = getProcessJournal(info.ContainerID, info.IfName)
+		}
+	}
+	return defaultStore.Put(info)
+}
+
+// GetAttachment() - Retrieve the attachment data for the given ContainerId
+//  and interface name.
+func GetAttachment(containerID string, ifName string) (AttachmentInfo, error) {
+	return defaultStore.Get(containerID, ifName)
+}
+
+// ListAttachments() - Retrieve the data of all the attachments on the node.
+//  Files that can't be read or are corrupt are skipped.
+func ListAttachments() ([]AttachmentInfo, error) {
+	return defaultStore.List()
+}
+
+// DeleteAttachment() - Remove the attachment data. Removing an attachment
+//  that does not exist is not an error.
+func DeleteAttachment(containerID string, ifName string) error {
+	return defaultStore.Delete(containerID, ifName)
+}
+
+// GetStore() - Store of the attachments of the node, used by the functions
+//  above.
+func GetStore() Store {
+	return defaultStore
+}
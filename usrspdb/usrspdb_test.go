@@ -0,0 +1,139 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrspdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Billy99/user-space-net-plugin/usrsptypes"
+)
+
+// useTestStore() - Point the API functions at a store in a temporary
+//  directory. The returned function removes it.
+func useTestStore(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "usrspdb")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+
+	savedStore := defaultStore
+	defaultStore = NewFileStore(dir)
+
+	return dir, func() {
+		defaultStore = savedStore
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	_, cleanup := useTestStore(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		info AttachmentInfo
+	}{
+		{"vpp", AttachmentInfo{ContainerID: "c1", IfName: "net1", Engine: "vpp", Tag: "c1/net1",
+			SwIfIndex: 3, SocketPath: "/var/run/vpp/memif-c1-net1.sock", BridgeId: 4}},
+		{"ovs", AttachmentInfo{ContainerID: "c1", IfName: "net2", Engine: "ovs-dpdk",
+			SocketPath: "/var/run/openvswitch/c1-net2"}},
+		{"other container", AttachmentInfo{ContainerID: "c2", IfName: "net1", Engine: "vpp", SwIfIndex: 5}},
+	}
+
+	for _, test := range tests {
+		info := test.info
+		if err := SaveAttachment(&info); err != nil {
+			t.Fatalf("%s: SaveAttachment(): %v", test.name, err)
+		}
+	}
+
+	for _, test := range tests {
+		got, err := GetAttachment(test.info.ContainerID, test.info.IfName)
+		if err != nil {
+			t.Errorf("%s: GetAttachment(): %v", test.name, err)
+			continue
+		}
+		if got.Engine != test.info.Engine || got.SwIfIndex != test.info.SwIfIndex ||
+			got.SocketPath != test.info.SocketPath || got.BridgeId != test.info.BridgeId || got.Tag != test.info.Tag {
+			t.Errorf("%s: GetAttachment() = %+v, want %+v", test.name, got, test.info)
+		}
+		if got.PluginVersion != usrsptypes.Version {
+			t.Errorf("%s: pluginVersion = %q, want %q", test.name, got.PluginVersion, usrsptypes.Version)
+		}
+	}
+
+	if _, err := GetAttachment("c3", "net1"); err == nil {
+		t.Errorf("GetAttachment() of an unknown attachment: no error")
+	}
+
+	if err := DeleteAttachment("c1", "net1"); err != nil {
+		t.Errorf("DeleteAttachment(): %v", err)
+	}
+	if _, err := GetAttachment("c1", "net1"); err == nil {
+		t.Errorf("GetAttachment() after DeleteAttachment(): no error")
+	}
+	if _, err := GetAttachment("c1", "net2"); err != nil {
+		t.Errorf("GetAttachment() of another interface after DeleteAttachment(): %v", err)
+	}
+	if err := DeleteAttachment("c1", "net1"); err != nil {
+		t.Errorf("DeleteAttachment() of a deleted attachment: %v", err)
+	}
+}
+
+// BenchmarkList() - List of the attachments of a node with 5000 of them,
+//  spread over 10 networks. The files are written directly, the index is
+//  built from the directories by the first List().
+func BenchmarkList(b *testing.B) {
+	dir, err := ioutil.TempDir("", "usrspdb")
+	if err != nil {
+		b.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(dir).(*fileStore)
+	for i := 0; i < 5000; i++ {
+		info := AttachmentInfo{ContainerID: fmt.Sprintf("c%d", i), IfName: "net1",
+			Network: fmt.Sprintf("net%d", i%10), Engine: "vpp", IfType: "memif", SwIfIndex: uint32(i),
+			SocketPath: fmt.Sprintf("/var/run/vpp/cni/shared/memif-c%d-net1.sock", i)}
+		dataBytes, _ := json.Marshal(&info)
+		networkDir := getNetworkDir(info.Network)
+		if err = os.MkdirAll(filepath.Join(dir, networkDir), 0700); err != nil {
+			b.Fatalf("MkdirAll(): %v", err)
+		}
+		path := store.getAttachmentPath(networkDir, getAttachmentKey(info.ContainerID, info.IfName))
+		if err = ioutil.WriteFile(path, dataBytes, 0644); err != nil {
+			b.Fatalf("WriteFile(): %v", err)
+		}
+	}
+	if _, err = store.List(); err != nil {
+		b.Fatalf("List(): %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		attachments, err := store.List()
+		if err != nil {
+			b.Fatalf("List(): %v", err)
+		}
+		if len(attachments) != 5000 {
+			b.Fatalf("List() = %d attachments, want 5000", len(attachments))
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Configuration compatibility: Early documentation used different spellings
+// of some keys (host_conf, hostconf, HostConf, ...) and engine values (VPP,
+// ovs_dpdk, ...). Go only matches keys ignoring case, so the other forms
+// silently decoded to empty structs. NetConf accepts the aliases below,
+// records each alias used in DeprecatedKeys so it can be logged, and
+// rejects a configuration with an alias and its canonical key set to
+// different values.
+//
+// Aliases are matched ignoring case and underscores.
+//
+
+package usrsptypes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//
+// Types
+//
+
+// Maps the normalized form of a key (see normalizeKey()) to the canonical key.
+type keyAliases map[string]string
+
+// NetConf without the UnmarshalJSON() method, to decode the normalized data.
+type netConfFields NetConf
+
+//
+// Variables
+//
+
+// Top level keys of NetConf.
+var netConfAliases = keyAliases{
+	"host":          "host",
+	"hostconf":      "host",
+	"container":     "container",
+	"containerconf": "container",
+	"engines":       "engines",
+	"if0name":       "if0name",
+	"kernelsidecar": "kernelSidecar",
+	"loglevel":      "logLevel",
+	"logformat":     "logFormat",
+}
+
+// Keys of the host and container sections (UserSpaceConf).
+var userSpaceConfAliases = keyAliases{
+	"engine":     "engine",
+	"iftype":     "iftype",
+	"nettype":    "netType",
+	"memif":      "memif",
+	"memifconf":  "memif",
+	"vhost":      "vhost",
+	"vhostconf":  "vhost",
+	"bridge":     "bridge",
+	"bridgeconf": "bridge",
+}
+
+// Keys of the bridge section (BridgeConf).
+var bridgeConfAliases = keyAliases{
+	"bridgeid": "bridgeId",
+	"vlanid":   "vlanId",
+}
+
+// Engine values, matched ignoring case, underscores and dashes.
+var engineAliases = map[string]string{
+	"vpp":     "vpp",
+	"ovs":     "ovs",
+	"ovsdpdk": "ovs-dpdk",
+	"linux":   "linux",
+}
+
+//
+// Exported Functions
+//
+
+// UnmarshalJSON() - Decode the configuration, accepting the aliases of the
+//  keys and engine values. See the top of this file.
+func (conf *NetConf) UnmarshalJSON(data []byte) error {
+	var fields map[string]interface{}
+	var decoded netConfFields
+	var used []string
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+
+	fields, err := normalizeKeys(fields, netConfAliases, "", &used, normalizeSection)
+	if err != nil {
+		return err
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(normalized, &decoded); err != nil {
+		return err
+	}
+
+	*conf = NetConf(decoded)
+
+	// Kept to merge the engine defaults, see engines.go.
+	conf.rawSections = make(map[string]map[string]interface{})
+	for _, name := range []string{"host", "container"} {
+		if section, ok := fields[name].(map[string]interface{}); ok {
+			conf.rawSections[name] = section
+		}
+	}
+
+	// Ambiguous paths, see path.go.
+	if conf.ContainerConf.OvsConf.DbSocket != "" {
+		used = append(used, "container.ovs.dbSocket (use container.ovs.dbSocketHostPath or dbSocketContainerPath)")
+	}
+	conf.DeprecatedKeys = used
+
+	return nil
+}
+
+//
+// Local Functions
+//
+
+// normalizeKey() - Form of a key used to look up its aliases.
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.Replace(key, "_", "", -1))
+}
+
+// normalizeKeys() - Replace the aliased keys of a JSON object with their
+//  canonical key. normalizeValue, if provided, is applied to each value of
+//  an aliased key first, so nested aliases don't cause false conflicts.
+func normalizeKeys(fields map[string]interface{}, aliases keyAliases, prefix string, used *[]string,
+	normalizeValue func(canonical string, prefix string, value interface{}, used *[]string) (interface{}, error)) (map[string]interface{}, error) {
+
+	result := make(map[string]interface{}, len(fields))
+
+	// Process the keys in order so the recorded aliases are stable.
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fields[key]
+
+		canonical, ok := aliases[normalizeKey(key)]
+		if ok == false {
+			if _, exists := result[key]; exists == false {
+				result[key] = value
+			}
+			continue
+		}
+
+		if normalizeValue != nil {
+			var err error
+			if value, err = normalizeValue(canonical, prefix+canonical+".", value, used); err != nil {
+				return nil, err
+			}
+		}
+
+		if key != canonical {
+			*used = append(*used, fmt.Sprintf("%s%s (use %s%s)", prefix, key, prefix, canonical))
+		}
+
+		if existing, exists := result[canonical]; exists && reflect.DeepEqual(existing, value) == false {
+			return nil, fmt.Errorf("ERROR: Conflicting values for %s%s, set more than once with different spellings",
+				prefix, canonical)
+		}
+		result[canonical] = value
+	}
+
+	return result, nil
+}
+
+// normalizeSection() - Normalize the host and container sections of NetConf,
+//  and the ones of the engines section.
+func normalizeSection(canonical string, prefix string, value interface{}, used *[]string) (interface{}, error) {
+	section, ok := value.(map[string]interface{})
+	if ok == false {
+		return value, nil
+	}
+
+	if canonical == "engines" {
+		return normalizeEngines(section, prefix, used)
+	}
+	if canonical != "host" && canonical != "container" {
+		return value, nil
+	}
+
+	return normalizeKeys(section, userSpaceConfAliases, prefix, used, normalizeUserSpaceValue)
+}
+
+// normalizeEngines() - Normalize the engine names of the engines section,
+//  and the host and container sections of each engine.
+func normalizeEngines(engines map[string]interface{}, prefix string, used *[]string) (interface{}, error) {
+	result := make(map[string]interface{}, len(engines))
+
+	// Process the engines in order so the recorded aliases are stable.
+	names := make([]string, 0, len(engines))
+	for engine := range engines {
+		names = append(names, engine)
+	}
+	sort.Strings(names)
+
+	for _, engine := range names {
+		value := engines[engine]
+		key := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(engine))
+		canonicalEngine, ok := engineAliases[key]
+		if ok == false {
+			canonicalEngine = engine
+		} else if canonicalEngine != engine {
+			*used = append(*used, fmt.Sprintf("%s%s (use %s%s)", prefix, engine, prefix, canonicalEngine))
+		}
+		if _, exists := result[canonicalEngine]; exists {
+			return nil, fmt.Errorf("ERROR: Engine %s%s set more than once with different spellings", prefix, canonicalEngine)
+		}
+
+		if sections, ok := value.(map[string]interface{}); ok {
+			normalized, err := normalizeKeys(sections, netConfAliases, prefix+canonicalEngine+".", used, normalizeSection)
+			if err != nil {
+				return nil, err
+			}
+			value = normalized
+		}
+		result[canonicalEngine] = value
+	}
+
+	return result, nil
+}
+
+// normalizeUserSpaceValue() - Normalize the engine value and the bridge
+//  section of a host or container section.
+func normalizeUserSpaceValue(canonical string, prefix string, value interface{}, used *[]string) (interface{}, error) {
+	if canonical == "engine" {
+		engine, ok := value.(string)
+		if ok == false {
+			return value, nil
+		}
+		key := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(engine))
+		if canonicalEngine, ok := engineAliases[key]; ok && canonicalEngine != engine {
+			*used = append(*used, fmt.Sprintf("%s value %q (use %q)", strings.TrimSuffix(prefix, "."), engine, canonicalEngine))
+			return canonicalEngine, nil
+		}
+	} else if canonical == "bridge" {
+		if section, ok := value.(map[string]interface{}); ok {
+			return normalizeKeys(section, bridgeConfAliases, prefix, used, nil)
+		}
+	}
+
+	return value, nil
+}
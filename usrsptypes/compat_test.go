@@ -0,0 +1,73 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrsptypes
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNetConfAliases(t *testing.T) {
+	tests := []struct {
+		name           string
+		conf           string
+		wantEngine     string
+		wantBridgeId   int
+		wantDeprecated int
+		wantErr        bool
+	}{
+		{"canonical", `{"name":"net1","host":{"engine":"vpp","bridge":{"bridgeId":4}}}`,
+			"vpp", 4, 0, false},
+		{"host_conf", `{"name":"net1","host_conf":{"engine":"vpp"}}`,
+			"vpp", 0, 1, false},
+		{"HostConf", `{"name":"net1","HostConf":{"engine":"vpp"}}`,
+			"vpp", 0, 1, false},
+		{"engine value", `{"name":"net1","host":{"engine":"VPP"}}`,
+			"vpp", 0, 1, false},
+		{"ovs_dpdk", `{"name":"net1","host":{"engine":"ovs_dpdk"}}`,
+			"ovs-dpdk", 0, 1, false},
+		{"nested aliases", `{"name":"net1","hostconf":{"engine":"vpp","bridge_conf":{"bridge_id":7}}}`,
+			"vpp", 7, 3, false},
+		{"alias and canonical agree", `{"name":"net1","host":{"engine":"vpp"},"host_conf":{"engine":"vpp"}}`,
+			"vpp", 0, 1, false},
+		{"alias and canonical conflict", `{"name":"net1","host":{"engine":"vpp"},"host_conf":{"engine":"ovs-dpdk"}}`,
+			"", 0, 0, true},
+		{"engines section", `{"name":"net1","engines":{"ovs_dpdk":{"host":{"iftype":"vhostuser"}}},"host":{"engine":"vpp"}}`,
+			"vpp", 0, 1, false},
+		{"engine spelled twice", `{"name":"net1","engines":{"ovs_dpdk":{},"ovs-dpdk":{}}}`,
+			"", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		var conf NetConf
+		err := json.Unmarshal([]byte(test.conf), &conf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Unmarshal() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if conf.HostConf.Engine != test.wantEngine {
+			t.Errorf("%s: engine = %q, want %q", test.name, conf.HostConf.Engine, test.wantEngine)
+		}
+		if conf.HostConf.BridgeConf.BridgeId != test.wantBridgeId {
+			t.Errorf("%s: bridgeId = %d, want %d", test.name, conf.HostConf.BridgeConf.BridgeId, test.wantBridgeId)
+		}
+		if len(conf.DeprecatedKeys) != test.wantDeprecated {
+			t.Errorf("%s: deprecated keys %q, want %d", test.name, conf.DeprecatedKeys, test.wantDeprecated)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Engine defaults: The engines section of NetConf holds, per engine, a host
+// and a container section with the settings an operator standardizes for
+// that engine (socket paths, ovs section, ...). Once the engines are known
+// (after engine auto is resolved), the defaults of the engine of each
+// section are merged into it. Keys set in the section itself always win,
+// objects (like memif or ovs) are merged key by key.
+//
+
+package usrsptypes
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//
+// Types
+//
+
+// Default host and container sections of an engine.
+type EngineDefaults struct {
+	Host      map[string]interface{} `json:"host,omitempty"`
+	Container map[string]interface{} `json:"container,omitempty"`
+}
+
+//
+// Exported Functions
+//
+
+// ApplyEngineDefaults() - Merge the defaults of the engine of the host and
+//  container sections into them. The container section uses the defaults
+//  of the host engine if it has no engine.
+func (conf *NetConf) ApplyEngineDefaults() error {
+	if len(conf.Engines) == 0 {
+		return nil
+	}
+
+	hostEngine := conf.HostConf.Engine
+	containerEngine := conf.ContainerConf.Engine
+	if containerEngine == "" {
+		containerEngine = hostEngine
+	}
+
+	if defaults, ok := conf.Engines[hostEngine]; ok && len(defaults.Host) != 0 {
+		err := mergeSection(&conf.HostConf, conf.rawSections["host"], defaults.Host, "host")
+		if err != nil {
+			return err
+		}
+	}
+
+	if defaults, ok := conf.Engines[containerEngine]; ok && len(defaults.Container) != 0 {
+		err := mergeSection(&conf.ContainerConf, conf.rawSections["container"], defaults.Container, "container")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// Local Functions
+//
+
+// mergeSection() - Decode the section merged with the defaults into the
+//  UserSpaceConf. The engine is kept as resolved, not as provided.
+func mergeSection(userSpaceConf *UserSpaceConf, section map[string]interface{}, defaults map[string]interface{}, name string) error {
+	merged := mergeDefaults(section, defaults)
+	if userSpaceConf.Engine != "" {
+		merged["engine"] = userSpaceConf.Engine
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	var mergedConf UserSpaceConf
+	if err = json.Unmarshal(data, &mergedConf); err != nil {
+		return fmt.Errorf("ERROR: Invalid engines defaults of the %s section: %v", name, err)
+	}
+	*userSpaceConf = mergedConf
+
+	return nil
+}
+
+// mergeDefaults() - Copy of the section, with the keys of the defaults it
+//  does not set. Objects set in both are merged the same way.
+func mergeDefaults(section map[string]interface{}, defaults map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(section)+len(defaults))
+	for key, value := range section {
+		merged[key] = value
+	}
+
+	for key, defaultValue := range defaults {
+		value, exists := merged[key]
+		if exists == false {
+			merged[key] = defaultValue
+			continue
+		}
+
+		object, isObject := value.(map[string]interface{})
+		defaultObject, isDefaultObject := defaultValue.(map[string]interface{})
+		if isObject && isDefaultObject {
+			merged[key] = mergeDefaults(object, defaultObject)
+		}
+	}
+
+	return merged
+}
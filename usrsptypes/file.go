@@ -0,0 +1,149 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// State files: The files written by the plugin (attachment data, saved
+// engine data, bond and bridge state, container configuration) are needed
+// by DEL. They are written to a temporary file in the same directory,
+// synced, then renamed over the previous file, so a crash of the node
+// leaves either the previous or the new content, never a truncated file.
+// A state file which is empty or can't be parsed anyway (written by an
+// older version, or edited by hand) is reported as corrupt, and can be
+// removed with "userspace cleanup --force".
+//
+
+package usrsptypes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//
+// Types
+//
+
+// CorruptStateError is returned when a state file is empty or can't be
+// parsed. It matches ErrCorruptState with errors.Is().
+type CorruptStateError struct {
+	Path string // State file
+	Err  error  // Parsing error, nil if the file is empty
+}
+
+func (e *CorruptStateError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("ERROR: Corrupt state file %s: empty", e.Path)
+	}
+	return fmt.Sprintf("ERROR: Corrupt state file %s: %v", e.Path, e.Err)
+}
+
+func (e *CorruptStateError) Is(target error) bool {
+	return target == ErrCorruptState
+}
+
+//
+// Constants
+//
+
+// Matches any CorruptStateError with errors.Is().
+var ErrCorruptState = errors.New("corrupt state file")
+
+//
+// Exported Functions
+//
+
+// WriteFileAtomic() - Write the file through a synced temporary file in
+//  the same directory, renamed over the file, so the file is never seen
+//  partially written.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+
+	// Removed unless renamed
+	defer os.Remove(tmpPath)
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Chmod(perm)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Persist the rename
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+
+	return nil
+}
+
+// ReadStateFile() - Read and decode a state file. The error of the read is
+//  returned as is (so os.IsNotExist() applies), a file which is empty or
+//  can't be decoded returns a CorruptStateError.
+func ReadStateFile(path string, v interface{}) error {
+	dataBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(dataBytes) == 0 {
+		return &CorruptStateError{Path: path}
+	}
+	if err = json.Unmarshal(dataBytes, v); err != nil {
+		return &CorruptStateError{Path: path, Err: err}
+	}
+
+	return nil
+}
+
+// FindCorruptStateFiles() - State files (*.json) of the directory which
+//  are corrupt, see ReadStateFile().
+func FindCorruptStateFiles(dir string) ([]string, error) {
+	var corrupt []string
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range matches {
+		var data json.RawMessage
+		if err = ReadStateFile(path, &data); errors.Is(err, ErrCorruptState) {
+			corrupt = append(corrupt, path)
+		}
+	}
+
+	return corrupt, nil
+}
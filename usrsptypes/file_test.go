@@ -0,0 +1,130 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrsptypes
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usrsptypes")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	tests := []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{"new file", `{"swIfIndex":1}`, 0644},
+		{"replaced", `{"swIfIndex":2}`, 0600},
+		{"shorter", `{}`, 0644},
+	}
+
+	for _, test := range tests {
+		if err = WriteFileAtomic(path, []byte(test.data), test.perm); err != nil {
+			t.Errorf("%s: WriteFileAtomic() error = %v", test.name, err)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil || string(data) != test.data {
+			t.Errorf("%s: content = %q (%v), want %q", test.name, data, err, test.data)
+		}
+		if stat, err := os.Stat(path); err != nil || stat.Mode().Perm() != test.perm {
+			t.Errorf("%s: mode = %v (%v), want %v", test.name, stat.Mode().Perm(), err, test.perm)
+		}
+
+		// No temporary file is left behind.
+		if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+			t.Errorf("%s: %d files in the directory, want 1", test.name, len(files))
+		}
+	}
+
+	if err = WriteFileAtomic(filepath.Join(dir, "missing", "state.json"), []byte("{}"), 0644); err == nil {
+		t.Errorf("WriteFileAtomic() in a missing directory: no error")
+	}
+}
+
+func TestReadStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usrsptypes")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		data        *string
+		wantErr     bool
+		wantCorrupt bool
+		wantMissing bool
+	}{
+		{"valid", stringPtr(`{"swIfIndex":3}`), false, false, false},
+		{"empty", stringPtr(""), true, true, false},
+		// Truncated by a crash of an older version
+		{"truncated", stringPtr(`{"swIfIndex":`), true, true, false},
+		{"wrong type", stringPtr(`{"swIfIndex":"three"}`), true, true, false},
+		{"missing", nil, true, false, true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name+".json")
+		if test.data != nil {
+			ioutil.WriteFile(path, []byte(*test.data), 0644)
+		}
+
+		var data struct {
+			SwIfIndex uint32 `json:"swIfIndex"`
+		}
+		err := ReadStateFile(path, &data)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ReadStateFile() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got := errors.Is(err, ErrCorruptState); got != test.wantCorrupt {
+			t.Errorf("%s: errors.Is(ErrCorruptState) = %v, want %v", test.name, got, test.wantCorrupt)
+		}
+		if got := os.IsNotExist(err); got != test.wantMissing {
+			t.Errorf("%s: os.IsNotExist() = %v, want %v", test.name, got, test.wantMissing)
+		}
+		if err == nil && data.SwIfIndex != 3 {
+			t.Errorf("%s: swIfIndex = %d, want 3", test.name, data.SwIfIndex)
+		}
+	}
+
+	corrupt, err := FindCorruptStateFiles(dir)
+	if err != nil {
+		t.Fatalf("FindCorruptStateFiles(): %v", err)
+	}
+	sort.Strings(corrupt)
+	want := []string{filepath.Join(dir, "empty.json"), filepath.Join(dir, "truncated.json")}
+	if len(corrupt) != len(want) || corrupt[0] != want[0] || corrupt[1] != want[1] {
+		t.Errorf("FindCorruptStateFiles() = %v, want %v", corrupt, want)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
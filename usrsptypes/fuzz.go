@@ -0,0 +1,28 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package usrsptypes
+
+// Fuzz() - go-fuzz target for the configuration loader. Run with:
+//   go-fuzz-build github.com/Billy99/user-space-net-plugin/usrsptypes
+//   go-fuzz -bin=usrsptypes-fuzz.zip -workdir=fuzz
+func Fuzz(data []byte) int {
+	if _, err := ParseNetConf(data, DefaultMaxConfSize); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Configuration loading: The configuration is passed by the runtime on
+// stdin. Before it is decoded, it is checked against a maximum size and a
+// maximum nesting depth, so a runaway input fails early instead of using
+// up the memory of the node. Templates are then expanded (see template.go).
+// Decoding errors include the byte offset and a snippet of the input where
+// decoding stopped.
+//
+
+package usrsptypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//
+// Constants
+//
+
+// Maximum size of the configuration, in bytes, if not provided.
+const DefaultMaxConfSize = 4 * 1024 * 1024
+
+// Maximum nesting of JSON objects and arrays in the configuration.
+const maxConfDepth = 32
+
+// Length of the input snippet included in decoding errors.
+const confSnippetLen = 40
+
+//
+// Exported Functions
+//
+
+// ParseNetConf() - Check the size and nesting of the configuration, then
+//  decode it.
+func ParseNetConf(data []byte, maxSize int) (*NetConf, error) {
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("ERROR: configuration is %d bytes, larger than the maximum of %d bytes",
+			len(data), maxSize)
+	}
+
+	if err := checkConfDepth(data); err != nil {
+		return nil, err
+	}
+
+	data, err := expandTemplates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &NetConf{}
+	if err = json.Unmarshal(data, conf); err != nil {
+		return nil, confError(data, err)
+	}
+	conf.expandedConf = data
+
+	return conf, nil
+}
+
+// GetExpandedConf() - The configuration the NetConf was parsed from, with
+//  the templates expanded, for the plugins called with the configuration
+//  (IPAM). Empty if the NetConf was not parsed by ParseNetConf().
+func (conf *NetConf) GetExpandedConf() []byte {
+	return conf.expandedConf
+}
+
+//
+// Local Functions
+//
+
+// checkConfDepth() - Make sure JSON objects and arrays are not nested
+//  deeper than maxConfDepth, without decoding the input.
+func checkConfDepth(data []byte) error {
+	depth := 0
+	inString := false
+	escaped := false
+
+	for offset, c := range data {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxConfDepth {
+				return fmt.Errorf("ERROR: configuration nested deeper than %d levels at offset %d: %s",
+					maxConfDepth, offset, getConfSnippet(data, int64(offset)))
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+
+	return nil
+}
+
+// confError() - Add the offset and a snippet of the input to a decoding
+//  error. Type errors are reported by the second decoding pass of
+//  UnmarshalJSON(), on the normalized input, so their offset is the one of
+//  the key of the field in the input.
+func confError(data []byte, err error) error {
+	switch jsonErr := err.(type) {
+	case *json.SyntaxError:
+		return fmt.Errorf("failed to load netconf: %v at offset %d: %s",
+			err, jsonErr.Offset, getConfSnippet(data, jsonErr.Offset))
+	case *json.UnmarshalTypeError:
+		if jsonErr.Field != "" {
+			fields := strings.Split(jsonErr.Field, ".")
+			key := fmt.Sprintf("%q", fields[len(fields)-1])
+			if offset := strings.Index(string(data), key); offset >= 0 {
+				return fmt.Errorf("failed to load netconf: %v at offset %d: %s",
+					err, offset, getConfSnippet(data, int64(offset)))
+			}
+		}
+	}
+
+	return fmt.Errorf("failed to load netconf: %v", err)
+}
+
+// getConfSnippet() - Quoted part of the input around the offset, at most
+//  confSnippetLen bytes long.
+func getConfSnippet(data []byte, offset int64) string {
+	start := offset - confSnippetLen/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + confSnippetLen
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	if start > end {
+		start = end
+	}
+
+	return fmt.Sprintf("%q", data[start:end])
+}
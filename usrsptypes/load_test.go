@@ -0,0 +1,80 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrsptypes
+
+import (
+	"strings"
+	"testing"
+)
+
+// nestedConf() - Configuration with its args nested depth levels deep,
+//  the configuration object included.
+func nestedConf(depth int) string {
+	return `{"name":"net1","args":` + strings.Repeat(`[`, depth-1) + strings.Repeat(`]`, depth-1) + `}`
+}
+
+func TestParseNetConfLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        string
+		maxSize     int
+		wantErr     bool
+		wantMessage string
+	}{
+		{"valid", `{"name":"net1","type":"userspace"}`, DefaultMaxConfSize, false, ""},
+		{"maximum size", `{"name":"net1"}`, len(`{"name":"net1"}`), false, ""},
+		{"too large", `{"name":"net1"}`, 10, true, "larger than the maximum of 10 bytes"},
+		{"maximum depth", nestedConf(maxConfDepth), DefaultMaxConfSize, false, ""},
+		{"too deep", nestedConf(maxConfDepth + 1), DefaultMaxConfSize, true, "nested deeper than 32 levels at offset"},
+		// Brackets in strings are not nesting.
+		{"brackets in strings", `{"name":"` + strings.Repeat(`[{`, maxConfDepth) + `\"["}`, DefaultMaxConfSize, false, ""},
+		{"syntax error", `{"name":"net1",}`, DefaultMaxConfSize, true, `at offset 16: "{\"name\":\"net1\",}"`},
+		{"type error", `{"name":"net1","mtu":"9000"}`, DefaultMaxConfSize, true, `at offset 15: "{\"name\":\"net1\",\"mtu\":\"9000\"}"`},
+	}
+
+	for _, test := range tests {
+		_, err := ParseNetConf([]byte(test.conf), test.maxSize)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ParseNetConf() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil && strings.Contains(err.Error(), test.wantMessage) == false {
+			t.Errorf("%s: ParseNetConf() error = %v, want %q", test.name, err, test.wantMessage)
+		}
+	}
+}
+
+func TestGetConfSnippet(t *testing.T) {
+	data := []byte(strings.Repeat("a", 20) + strings.Repeat("b", 20) + strings.Repeat("c", 20))
+
+	tests := []struct {
+		name   string
+		data   []byte
+		offset int64
+		want   string
+	}{
+		{"start", data, 0, `"` + strings.Repeat("a", 20) + strings.Repeat("b", 20) + `"`},
+		{"middle", data, 40, `"` + strings.Repeat("b", 20) + strings.Repeat("c", 20) + `"`},
+		{"end", data, 60, `"` + strings.Repeat("c", 20) + `"`},
+		{"short input", []byte(`{"a"`), 2, `"{\"a\""`},
+		{"past the end", []byte(`{}`), 40, `""`},
+	}
+
+	for _, test := range tests {
+		if got := getConfSnippet(test.data, test.offset); got != test.want {
+			t.Errorf("%s: getConfSnippet() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Container paths: A path of the container section can be given on the
+// host (*HostPath) or in the container rootfs (*ContainerPath). A container
+// path is translated to the host through /proc/<pid>/root of a process of
+// the container, found by its network namespace (CNI_NETNS), so it is only
+// valid while the container runs. The old field without suffix is a host
+// path, still accepted but deprecated since it is ambiguous.
+//
+
+package usrsptypes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//
+// Exported Functions
+//
+
+// ValidatePath() - A path of the configuration must be absolute and can't
+//  contain "..", so it can't escape its root (the host filesystem or the
+//  container rootfs).
+func ValidatePath(field string, path string) error {
+	if filepath.IsAbs(path) == false {
+		return fmt.Errorf("ERROR: %s %s must be an absolute path", field, path)
+	}
+	for _, element := range strings.Split(path, "/") {
+		if element == ".." {
+			return fmt.Errorf("ERROR: %s %s can't contain \"..\"", field, path)
+		}
+	}
+	return nil
+}
+
+// ResolveContainerPath() - Path on the host of a path in the rootfs of the
+//  container owning the network namespace.
+func ResolveContainerPath(netns string, path string) (string, error) {
+	pid, err := findNetnsPid(netns)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join("/proc", strconv.Itoa(pid), "root", filepath.Clean(path)), nil
+}
+
+//
+// Local Functions
+//
+
+// findNetnsPid() - A process in the network namespace, whose root is the
+//  rootfs of the container.
+func findNetnsPid(netns string) (int, error) {
+	netnsInfo, err := os.Stat(netns)
+	if err != nil {
+		return 0, fmt.Errorf("ERROR: Failed to find the container rootfs, netns %s: %v", netns, err)
+	}
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		// Processes may exit while /proc is read.
+		nsInfo, err := os.Stat(filepath.Join("/proc", entry.Name(), "ns", "net"))
+		if err == nil && os.SameFile(netnsInfo, nsInfo) {
+			return pid, nil
+		}
+	}
+
+	return 0, fmt.Errorf("ERROR: Failed to find the container rootfs, no process in netns %s", netns)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Configuration templates: A configuration distributed to all the nodes
+// (by a DaemonSet, for example) may need values which differ per node, like
+// the name of the uplink. When enableTemplates is true, every string value
+// of the configuration is expanded as a Go template before it is decoded:
+//   {{.Hostname}}    - Hostname of the node
+//   {{.NodeIP}}      - NODE_IP environment variable, or the first address
+//                      the hostname resolves to
+//   {{.Env "FOO"}}   - FOO environment variable, empty if not set
+// Keys are never expanded. Without enableTemplates, braces are kept as is.
+// The IPAM plugin is passed the expanded configuration, see
+// NetConf.GetExpandedConf().
+//
+
+package usrsptypes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+)
+
+//
+// Constants
+//
+
+// Key enabling template expansion, at the top level of the configuration.
+const templatesKey = "enableTemplates"
+
+//
+// Types
+//
+
+// Values available to the templates. Values are methods, so the ones not
+// used by the configuration are never looked up.
+type templateValues struct{}
+
+//
+// Template Values
+//
+
+// Hostname() - Hostname of the node.
+func (templateValues) Hostname() (string, error) {
+	return os.Hostname()
+}
+
+// NodeIP() - Address of the node: the NODE_IP environment variable (set
+//  with the Downward API status.hostIP, for example), or the first address
+//  the hostname resolves to.
+func (templateValues) NodeIP() (string, error) {
+	if nodeIP := os.Getenv("NODE_IP"); nodeIP != "" {
+		return nodeIP, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	addrs, err := net.LookupIP(hostname)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if addr.IsLoopback() == false {
+			return addr.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no address found for %s, set NODE_IP", hostname)
+}
+
+// Env() - Value of the environment variable, empty if not set.
+func (templateValues) Env(name string) string {
+	return os.Getenv(name)
+}
+
+//
+// Local Functions
+//
+
+// expandTemplates() - Expand the string values of the configuration, if
+//  enableTemplates is true. The input is returned unchanged otherwise.
+func expandTemplates(data []byte) ([]byte, error) {
+	if bytes.Contains(data, []byte(templatesKey)) == false {
+		return data, nil
+	}
+
+	var conf map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&conf); err != nil {
+		// Reported, with its offset, when the configuration is decoded.
+		return data, nil
+	}
+
+	if enabled, ok := conf[templatesKey].(bool); ok == false || enabled == false {
+		return data, nil
+	}
+
+	for key, value := range conf {
+		expanded, err := expandValue(key, value)
+		if err != nil {
+			return nil, err
+		}
+		conf[key] = expanded
+	}
+
+	return json.Marshal(conf)
+}
+
+// expandValue() - Expand the strings in the value, recursively. field is
+//  the path of the value in the configuration, for errors.
+func expandValue(field string, value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case string:
+		return expandString(field, typed)
+	case map[string]interface{}:
+		for key, item := range typed {
+			expanded, err := expandValue(field+"."+key, item)
+			if err != nil {
+				return nil, err
+			}
+			typed[key] = expanded
+		}
+	case []interface{}:
+		for index, item := range typed {
+			expanded, err := expandValue(fmt.Sprintf("%s[%d]", field, index), item)
+			if err != nil {
+				return nil, err
+			}
+			typed[index] = expanded
+		}
+	}
+
+	return value, nil
+}
+
+// expandString() - Expand a string value of the configuration.
+func expandString(field string, value string) (string, error) {
+	if strings.Contains(value, "{{") == false {
+		return value, nil
+	}
+
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("ERROR: Invalid template in %s: %v", field, err)
+	}
+
+	var out bytes.Buffer
+	if err = tmpl.Execute(&out, templateValues{}); err != nil {
+		return "", fmt.Errorf("ERROR: Failed to expand template in %s: %v", field, err)
+	}
+
+	return out.String(), nil
+}
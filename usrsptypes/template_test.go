@@ -0,0 +1,116 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrsptypes
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestExpandTemplates(t *testing.T) {
+	os.Setenv("USRSP_TEST_UPLINK", "eth1")
+	os.Setenv("NODE_IP", "192.0.2.10")
+	defer os.Unsetenv("USRSP_TEST_UPLINK")
+	defer os.Unsetenv("NODE_IP")
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("os.Hostname(): %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		conf        string
+		wantUplink  string
+		wantIfName  string
+		wantErr     bool
+		wantEnabled bool
+	}{
+		{"disabled", `{"name":"net1","hostIfName":"{{.Hostname}}","host":{"nat":{"uplink":"{{.Env \"USRSP_TEST_UPLINK\"}}"}}}`,
+			`{{.Env "USRSP_TEST_UPLINK"}}`, "{{.Hostname}}", false, false},
+		{"enabled false", `{"name":"net1","enableTemplates":false,"hostIfName":"{{.Hostname}}"}`,
+			"", "{{.Hostname}}", false, false},
+		{"env and hostname", `{"name":"net1","enableTemplates":true,"hostIfName":"{{.Hostname}}","host":{"nat":{"uplink":"{{.Env \"USRSP_TEST_UPLINK\"}}"}}}`,
+			"eth1", hostname, false, true},
+		{"missing env", `{"name":"net1","enableTemplates":true,"host":{"nat":{"uplink":"{{.Env \"USRSP_TEST_MISSING\"}}"}}}`,
+			"", "", false, true},
+		{"unknown value", `{"name":"net1","enableTemplates":true,"hostIfName":"{{.Rack}}"}`,
+			"", "", true, true},
+		{"invalid template", `{"name":"net1","enableTemplates":true,"hostIfName":"{{.Hostname"}`,
+			"", "", true, true},
+	}
+
+	for _, test := range tests {
+		conf, err := ParseNetConf([]byte(test.conf), DefaultMaxConfSize)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ParseNetConf() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if conf.HostConf.NatConf.Uplink != test.wantUplink {
+			t.Errorf("%s: uplink = %q, want %q", test.name, conf.HostConf.NatConf.Uplink, test.wantUplink)
+		}
+		if conf.HostIfName != test.wantIfName {
+			t.Errorf("%s: hostIfName = %q, want %q", test.name, conf.HostIfName, test.wantIfName)
+		}
+		if conf.EnableTemplates != test.wantEnabled {
+			t.Errorf("%s: enableTemplates = %v, want %v", test.name, conf.EnableTemplates, test.wantEnabled)
+		}
+	}
+}
+
+// The IPAM plugin is passed the expanded configuration, numbers and unknown
+// keys included.
+func TestGetExpandedConf(t *testing.T) {
+	os.Setenv("NODE_IP", "192.0.2.10")
+	defer os.Unsetenv("NODE_IP")
+
+	conf, err := ParseNetConf([]byte(`{"name":"net1","enableTemplates":true,"mtu":9000,`+
+		`"ipam":{"type":"host-local","subnet":"10.{{.Env \"USRSP_TEST_RACK\"}}7.0.0/16","gateway":"{{.NodeIP}}","custom":1.5}}`),
+		DefaultMaxConfSize)
+	if err != nil {
+		t.Fatalf("ParseNetConf(): %v", err)
+	}
+
+	var expanded struct {
+		Mtu  json.Number `json:"mtu"`
+		Ipam struct {
+			Subnet  string      `json:"subnet"`
+			Gateway string      `json:"gateway"`
+			Custom  json.Number `json:"custom"`
+		} `json:"ipam"`
+	}
+	if err = json.Unmarshal(conf.GetExpandedConf(), &expanded); err != nil {
+		t.Fatalf("GetExpandedConf() is not JSON: %v", err)
+	}
+	if expanded.Ipam.Subnet != "10.7.0.0/16" || expanded.Ipam.Gateway != "192.0.2.10" {
+		t.Errorf("ipam expanded to subnet %q gateway %q", expanded.Ipam.Subnet, expanded.Ipam.Gateway)
+	}
+	if expanded.Mtu != "9000" || expanded.Ipam.Custom != "1.5" {
+		t.Errorf("numbers changed by the expansion: mtu %s custom %s", expanded.Mtu, expanded.Ipam.Custom)
+	}
+
+	raw := `{"name":"net1","ipam":{"type":"host-local","subnet":"{{.NodeIP}}"}}`
+	conf, err = ParseNetConf([]byte(raw), DefaultMaxConfSize)
+	if err != nil {
+		t.Fatalf("ParseNetConf(): %v", err)
+	}
+	if string(conf.GetExpandedConf()) != raw {
+		t.Errorf("GetExpandedConf() without enableTemplates = %s, want %s", conf.GetExpandedConf(), raw)
+	}
+}
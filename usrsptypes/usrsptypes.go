@@ -15,6 +15,18 @@
 package usrsptypes
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 )
@@ -23,24 +35,176 @@ import (
 // Exported Types
 //
 type UsrSpCni interface {
-	AddOnHost(conf *NetConf, containerID string, ipResult *current.Result) error
-	AddOnContainer(conf *NetConf, containerID string, ipResult *current.Result) error
-	DelFromHost(conf *NetConf, containerID string) error
-	DelFromContainer(conf *NetConf, containerID string) error
+	AddOnHost(conf *NetConf, args *skel.CmdArgs, ipResult *current.Result) error
+	AddOnContainer(conf *NetConf, args *skel.CmdArgs, ipResult *current.Result) error
+	DelFromHost(conf *NetConf, args *skel.CmdArgs) error
+	DelFromContainer(conf *NetConf, args *skel.CmdArgs) error
+	Capabilities() []string // Features of the host section implemented, see Capability*
+	Probe() error           // Whether the engine is reachable on the node, see engine auto
+}
+
+// StackError is an error along with the stack where it was caught, see
+// WithStack(). The message is the one of the error.
+type StackError struct {
+	Err   error
+	Stack string
+}
+
+func (e *StackError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StackError) Unwrap() error {
+	return e.Err
+}
+
+// EngineNotSupportedError is returned when an engine does not implement
+// what the configuration requests. It matches ErrEngineNotSupported with
+// errors.Is().
+type EngineNotSupportedError struct {
+	Engine  string // Engine of the section, like vpp or ovs-dpdk
+	Feature string // What the engine does not implement
+}
+
+func (e *EngineNotSupportedError) Error() string {
+	return fmt.Sprintf("ERROR: Engine %s does not support: %s", e.Engine, e.Feature)
+}
+
+func (e *EngineNotSupportedError) Is(target error) bool {
+	return target == ErrEngineNotSupported
+}
+
+// UnmanagedInterfaceError is returned when the plugin is about to change
+// an interface which does not carry the interface name prefix and the tag
+// of the attachment. It matches ErrUnmanagedInterface with errors.Is().
+type UnmanagedInterfaceError struct {
+	Interface string // Interface, like its swIfIndex
+	Tag       string // Tag the interface carries
+}
+
+func (e *UnmanagedInterfaceError) Error() string {
+	return fmt.Sprintf("ERROR: refusing to touch unmanaged interface %s (tag %q)", e.Interface, e.Tag)
+}
+
+func (e *UnmanagedInterfaceError) Is(target error) bool {
+	return target == ErrUnmanagedInterface
+}
+
+// K8sArgs is the set of Kubernetes specific values passed in CNI_ARGS.
+type K8sArgs struct {
+	types.CommonArgs
+	K8S_POD_NAME               types.UnmarshallableString
+	K8S_POD_NAMESPACE          types.UnmarshallableString
+	K8S_POD_INFRA_CONTAINER_ID types.UnmarshallableString
+	MAC                        types.UnmarshallableString // MAC requested by the runtime for the container interface
 }
 
 type MemifConf struct {
-	Role string `json:"role"` // Role of memif: master|slave
-	Mode string `json:"mode"` // Mode of memif: ip|ethernet|inject-punt
+	Role       string `json:"role"`                 // Role of memif: master|slave
+	Mode       string `json:"mode"`                 // Mode of memif: ip|ethernet|inject-punt
+	BufferSize int    `json:"bufferSize,omitempty"` // Size of each memif buffer, derived from the MTU if not provided
+	SocketFile string `json:"socketFile,omitempty"` // Host only: socket file of the interface, generated if not provided
+	AttachOnly bool   `json:"attachOnly,omitempty"` // Host only: attach to the existing socketFile, owned by someone else (slave only)
+	Id         int    `json:"id,omitempty"`         // Container only: id of the memif on its socket, used by both ends, defaults to 0
 }
 
 type VhostConf struct {
-	Mode string `json:"mode"` // vhost-user mode: client|server
+	Mode     string        `json:"mode"`               // vhost-user mode: client|server
+	Features VhostFeatures `json:"features,omitempty"` // Optional virtio features, VPP defaults if not provided
+}
+
+type VhostFeatures struct {
+	// Each feature is on|off, left to the engine default if not provided.
+	Gso        string `json:"gso,omitempty"`        // Segmentation offload
+	Csum       string `json:"csum,omitempty"`       // Checksum offload
+	PackedRing string `json:"packedRing,omitempty"` // Packed virtqueue layout
 }
 
 type BridgeConf struct {
-	BridgeId int `json:"bridgeId"`         // Bridge Id
-	VlanId   int `json:"vlanId,onitempty"` // Optional VLAN Id
+	BridgeId int  `json:"bridgeId"`         // Bridge Id, allocated for the network if not provided
+	VlanId   int  `json:"vlanId,onitempty"` // Optional VLAN Id
+	Shg      int  `json:"shg,omitempty"`    // Split horizon group of the interface (0-255), 0 for none
+	Bvi      bool `json:"bvi,omitempty"`    // Interface is the BVI of the bridge, only one per bridge
+}
+
+type Ipv6Conf struct {
+	// Only applied when an IPv6 address is configured on the interface.
+	SuppressRa bool   `json:"suppressRa,omitempty"` // Suppress Router Advertisements sent on the interface
+	LinkLocal  string `json:"linkLocal,omitempty"`  // Explicit link-local address, instead of the one derived from the MAC
+	Ra         RaConf `json:"ra,omitempty"`         // Router Advertisement parameters, VPP defaults if not set
+}
+
+type RaConf struct {
+	// Parameters of the Router Advertisements sent on the interface, for
+	// SLAAC in the container. 0 keeps the VPP default.
+	Managed     bool `json:"managed,omitempty"`     // Managed address configuration flag (M), addresses from DHCPv6
+	Other       bool `json:"other,omitempty"`       // Other configuration flag (O), other settings from DHCPv6
+	MaxInterval int  `json:"maxInterval,omitempty"` // Maximum interval between RAs in seconds (4-1800)
+	MinInterval int  `json:"minInterval,omitempty"` // Minimum interval between RAs in seconds (3 to 0.75 * maxInterval)
+	Lifetime    int  `json:"lifetime,omitempty"`    // Router lifetime in seconds (maxInterval-9000)
+}
+
+type BandwidthConf struct {
+	// Optional bandwidth limit of the interface, as in the CNI bandwidth
+	// plugin. Ingress and egress are the traffic received and sent by the
+	// container. A rate requires its burst.
+	IngressRate  uint64 `json:"ingressRate,omitempty"`  // Rate in bits per second
+	IngressBurst uint64 `json:"ingressBurst,omitempty"` // Burst in bits
+	EgressRate   uint64 `json:"egressRate,omitempty"`   // Rate in bits per second
+	EgressBurst  uint64 `json:"egressBurst,omitempty"`  // Burst in bits
+}
+
+type OvsConf struct {
+	// Only used when the container engine is ovs-dpdk, to reach the OVS
+	// instance running in the container. See path.go for the paths.
+	DbSocket              string `json:"dbSocket,omitempty"`              // Deprecated: same as dbSocketHostPath
+	DbSocketHostPath      string `json:"dbSocketHostPath,omitempty"`      // Path on the host of the container ovsdb socket
+	DbSocketContainerPath string `json:"dbSocketContainerPath,omitempty"` // Path in the container rootfs of the container ovsdb socket
+	Bridge                string `json:"bridge,omitempty"`                // Bridge of the container OVS instance, defaults to br0
+}
+
+type NatConf struct {
+	// Optional NAT44 of the traffic from the interface onto the node network.
+	// VPP engine only, and the interface netType must be interface.
+	Enable      bool     `json:"enable,omitempty"`
+	Uplink      string   `json:"uplink,omitempty"`      // VPP name of the outside interface, like GigabitEthernet0/8/0
+	AddressPool string   `json:"addressPool,omitempty"` // Outside IPv4 addresses "first[-last]", the uplink address if not provided
+	CreateBond  BondConf `json:"createBond,omitempty"`  // Create the uplink as a bond of the members, if it does not exist
+}
+
+type BondConf struct {
+	// Optional bond created as the NAT uplink for redundancy. The bond is
+	// shared by all the interfaces using it, and deleted with the last one.
+	Members     []string `json:"members,omitempty"`     // VPP names of the member interfaces
+	Mode        string   `json:"mode,omitempty"`        // {round-robin|active-backup|xor|broadcast|lacp}, defaults to lacp
+	LoadBalance string   `json:"loadBalance,omitempty"` // {l2|l23|l34}, xor and lacp only, defaults to l2
+}
+
+type MirrorConf struct {
+	// Optional mirroring (SPAN) of the interface traffic for troubleshooting.
+	Destination string `json:"destination,omitempty"` // VPP interface or OVS port the traffic is mirrored to
+	Direction   string `json:"direction,omitempty"`   // Traffic mirrored {rx|tx|both}, defaults to both
+}
+
+type PuntRule struct {
+	Protocol string `json:"protocol"` // L4 protocol {tcp|udp}
+	Port     int    `json:"port"`     // L4 destination port
+}
+
+type PuntConf struct {
+	// Optional punt of control plane traffic (like BGP) received on the
+	// interface to a kernel tap in the container netns. VPP engine only.
+	IfName string     `json:"ifName,omitempty"` // Name of the tap in the container, defaults to punt0
+	Rules  []PuntRule `json:"rules,omitempty"`
+}
+
+type StaticRoute struct {
+	// Optional static route via the interface, installed in the default FIB
+	// table of VPP. Routes to the same destination are one multipath route.
+	Dst    string `json:"dst"`              // Destination, in CIDR notation
+	Gw     string `json:"gw,omitempty"`     // Next hop, the destination is attached to the interface if not provided
+	Metric int    `json:"metric,omitempty"` // Preference of the path (0-255), the lowest metric is used
+	Weight int    `json:"weight,omitempty"` // Share of the traffic among the paths of a metric (1-255), 0 defaults to 1
 }
 
 type UserSpaceConf struct {
@@ -48,18 +212,487 @@ type UserSpaceConf struct {
 	// is not provided. However, they are not required to be the same and a Container
 	// attribute can be provided to override. All values are listed as 'omitempty' to
 	// allow the Container struct to be empty where desired.
-	Engine     string     `json:"engine,omitempty"`  // CNI Implementation {vpp|ovs|ovs-dpdk|linux}
-	IfType     string     `json:"iftype,omitempty"`  // Type of interface {memif|vhostuser|veth|tap}
-	NetType    string     `json:"netType,omitempty"` // Interface network type {none|bridge|interface}
-	MemifConf  MemifConf  `json:"memif,omitempty"`
-	VhostConf  VhostConf  `json:"vhost,omitempty"`
-	BridgeConf BridgeConf `json:"bridge,omitempty"`
+	Engine           string        `json:"engine,omitempty"`           // CNI Implementation {vpp|ovs|ovs-dpdk|linux|auto}
+	EngineOrder      []string      `json:"engineOrder,omitempty"`      // Host only: engines probed in order with engine auto, defaults to vpp, ovs-dpdk
+	IfType           string        `json:"iftype,omitempty"`           // Type of interface {memif|vhostuser|veth|tap}
+	NetType          string        `json:"netType,omitempty"`          // Interface network type {none|bridge|interface}
+	Mac              string        `json:"mac,omitempty"`              // MAC address of the interface, generated if not provided
+	Address          string        `json:"address,omitempty"`          // Host only: address (CIDR) of the interface, "auto" for the first address of the IPAM subnet
+	Unnumbered       bool          `json:"unnumbered,omitempty"`       // Host only: borrow the address of unnumberedParent and route the IPAM addresses to the interface
+	UnnumberedParent string        `json:"unnumberedParent,omitempty"` // Interface the address is borrowed from, defaults to loop0
+	RouteTable       uint32        `json:"routeTable,omitempty"`       // FIB table of the unnumbered host routes, defaults to 0 (the default table)
+	AdminUp          *bool         `json:"adminUp,omitempty"`          // Set the interface admin up once created, defaults to true
+	Managed          *bool         `json:"managed,omitempty"`          // Host only: create and program the interface, defaults to true, false uses the existing interface hostIfName
+	RxMode           string        `json:"rxMode,omitempty"`           // Rx mode of the interface {polling|interrupt|adaptive}, VPP default if not provided
+	ReportLinkState  bool          `json:"reportLinkState,omitempty"`  // Host only: record the link state of the memif in the attachment data and the container data
+	SocketType       string        `json:"socketType,omitempty"`       // Host only: namespace of the memif or vhost-user socket {filesystem|abstract}, defaults to filesystem
+	MemifConf        MemifConf     `json:"memif,omitempty"`
+	VhostConf        VhostConf     `json:"vhost,omitempty"`
+	BridgeConf       BridgeConf    `json:"bridge,omitempty"`
+	Ipv6Conf         Ipv6Conf      `json:"ipv6,omitempty"`
+	NatConf          NatConf       `json:"nat,omitempty"`
+	MirrorConf       MirrorConf    `json:"mirror,omitempty"`
+	BandwidthConf    BandwidthConf `json:"bandwidth,omitempty"`
+	OvsConf          OvsConf       `json:"ovs,omitempty"`
+	PuntConf         PuntConf      `json:"punt,omitempty"`
+	Routes           []StaticRoute `json:"routes,omitempty"` // Static routes via the interface, netType interface only
+}
+
+type KernelSidecarConf struct {
+	// Optional kernel interface (veth pair) created in addition to the
+	// UserSpace interface, for traffic like Kubelet health checks that
+	// can't use the UserSpace interface.
+	Enable     bool   `json:"enable,omitempty"`
+	IfName     string `json:"ifName,omitempty"`     // Interface name in the container, defaults to CNI_IFNAME with "-k"
+	Attach     string `json:"attach,omitempty"`     // Host attachment of the veth {af_packet|bridge}
+	Bridge     string `json:"bridge,omitempty"`     // Host Linux bridge to attach to, when attach is bridge
+	Address    string `json:"address,omitempty"`    // Static address (CIDR), a host address (/32 or /128) if no prefix
+	Gateway    string `json:"gateway,omitempty"`    // Optional gateway of a default route via the veth, same family as address
+	DadTimeout int    `json:"dadTimeout,omitempty"` // Seconds to wait for the IPv6 DAD of the address, defaults to 5
+}
+
+type HugepageConf struct {
+	// Optional hugepage layout of the container, written for the DPDK app
+	// in the container to derive its EAL arguments (vpp container engine).
+	MountPath string `json:"mountPath,omitempty"` // Mount point of the hugetlbfs, same on the node and in the container
+	SocketMem []int  `json:"socketMem,omitempty"` // Memory (MB) per NUMA socket, like --socket-mem
+}
+
+type IpamConf struct {
+	// Only the fields used by the UserSpace CNI are listed, the entire IPAM
+	// section is passed to the IPAM plugin as is.
+	Type       string `json:"type,omitempty"`
+	Timeout    int    `json:"timeout,omitempty"`    // Seconds to wait on the IPAM plugin, 0 uses the default
+	Retries    int    `json:"retries,omitempty"`    // Number of times a transient IPAM failure is retried, 0 disables
+	RetryDelay int    `json:"retryDelay,omitempty"` // Milliseconds before the first retry, doubled on each retry
+}
+
+// Port mapping passed by the runtime when the portMappings capability is set.
+type PortMapEntry struct {
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"hostIP,omitempty"`
+}
+
+type RuntimeConf struct {
+	PortMaps []PortMapEntry `json:"portMappings,omitempty"`
 }
 
 type NetConf struct {
 	types.NetConf
-	Name          string        `json:"name"`
-	If0name       string        `json:"if0name,omitempty"` // Interface name
-	HostConf      UserSpaceConf `json:"host,omitempty"`
-	ContainerConf UserSpaceConf `json:"container,omitempty"`
+	Name               string        `json:"name"`
+	IPAM               IpamConf      `json:"ipam,omitempty"`
+	If0name            string        `json:"if0name,omitempty"`            // Interface name
+	HostIfName         string        `json:"hostIfName,omitempty"`         // Name (VPP tag) of the host interface, defaults to GetIfDescription()
+	OvsPortPrefix      string        `json:"ovsPortPrefix,omitempty"`      // Prefix of the names of the OVS ports, defaults to usrsp-
+	Tenant             string        `json:"tenant,omitempty"`             // Tenant of the network, memif sockets are kept in a directory per tenant
+	SharedDirMode      string        `json:"sharedDirMode,omitempty"`      // Permissions (octal) of the socket directories created by the plugin, defaults to 0700
+	Mtu                int           `json:"mtu,omitempty"`                // MTU of the interface, used to size memif buffers and as mtu_request of OVS ports
+	WaitForSocket      int           `json:"waitForSocket,omitempty"`      // Seconds ADD waits for the peer to create the socket (client mode), 0 disables
+	LinkWaitInterval   int           `json:"linkWaitInterval,omitempty"`   // Milliseconds between polls of the memif link after the socket is created, defaults to 100
+	LinkWaitTimeout    int           `json:"linkWaitTimeout,omitempty"`    // Milliseconds ADD waits for the memif link after the socket is created, defaults to 5000
+	VerifyConnectivity bool          `json:"verifyConnectivity,omitempty"` // Ping probeTarget from the host VPP at the end of ADD, ADD fails if it does not answer
+	ProbeTarget        string        `json:"probeTarget,omitempty"`        // Address pinged by verifyConnectivity, defaults to the IPAM gateway
+	ProbeTimeout       int           `json:"probeTimeout,omitempty"`       // Seconds verifyConnectivity waits for a reply, defaults to 5
+	VerifyStrict       *bool         `json:"verifyStrict,omitempty"`       // Fail the ADD if verifyConnectivity fails, defaults to true, false only warns
+	DebugTrace         int           `json:"debugTrace,omitempty"`         // Packets traced in VPP when the memif link or verifyConnectivity fails, 0 (default) disables
+	Kubeconfig         string        `json:"kubeconfig,omitempty"`         // Used to read the pod IP annotation when there is no IPAM
+	LogLevel           string        `json:"logLevel,omitempty"`           // Logging level {debug|info|warning|error}, defaults to info
+	LogFormat          string        `json:"logFormat,omitempty"`          // Logging format {text|json}, defaults to text
+	HostConf           UserSpaceConf `json:"host,omitempty"`
+	ContainerConf      UserSpaceConf `json:"container,omitempty"`
+
+	KernelSidecar KernelSidecarConf `json:"kernelSidecar,omitempty"`
+	Hugepages     HugepageConf      `json:"hugepages,omitempty"`
+	RuntimeConfig RuntimeConf       `json:"runtimeConfig,omitempty"`
+
+	// Result of the previous plugins when the plugin is chained, merged
+	// with the Result of the plugin.
+	RawPrevResult map[string]interface{} `json:"prevResult,omitempty"`
+
+	// Print a minimal Result (or the previous Result, if chained) instead
+	// of the Result of the plugin, when another plugin owns the Result.
+	SuppressResult bool `json:"suppressResult,omitempty"`
+
+	// Write the DNS settings of the configuration and of IPAM to a
+	// resolv.conf in the directory shared with the container, for pods
+	// whose runtime does not manage DNS for the network.
+	WriteResolvConf bool `json:"writeResolvConf,omitempty"`
+
+	// Delete the CNI_IFNAME kernel interface in the container netns on DEL,
+	// even if it was not created by this plugin (previous behavior).
+	ForceNetnsCleanup bool `json:"forceNetnsCleanup,omitempty"`
+
+	// Pass only the standard CNI keys and the ipam section to the IPAM
+	// plugin, instead of the entire config, for IPAM plugins that reject
+	// unknown keys.
+	IpamStrictConf bool `json:"ipamStrictConf,omitempty"`
+
+	// Return the gateway from the IPAM plugin in the Result. By default it
+	// is removed, except for the dhcp IPAM plugin.
+	KeepGateway bool `json:"keepGateway,omitempty"`
+
+	// On DEL, release the IPAM allocation with the configuration of the
+	// DEL instead of the configuration saved by the ADD.
+	IgnoreAddIpamConf bool `json:"ignoreAddIpamConf,omitempty"`
+
+	// Seconds DEL waits for the cleanup before giving up, so a hung VPP or
+	// OVS does not block the pod teardown. 0 (default) waits forever. On
+	// timeout DEL succeeds, unless delTimeoutFail is set.
+	DelTimeout     int  `json:"delTimeout,omitempty"`
+	DelTimeoutFail bool `json:"delTimeoutFail,omitempty"`
+
+	// Log the stack of the failure along with the error. The error returned
+	// to the runtime is unchanged.
+	Debug bool `json:"debug,omitempty"`
+
+	// Append a JSON record of each ADD and DEL, success or failure, to this
+	// file (absolute path on the host), for an audit trail.
+	AuditLog string `json:"auditLog,omitempty"`
+
+	// Expand the templates ({{.Hostname}}, {{.NodeIP}}, {{.Env "FOO"}}) in
+	// the string values of the configuration, see template.go.
+	EnableTemplates bool `json:"enableTemplates,omitempty"`
+
+	// Default host and container sections per engine, merged into the
+	// sections using the engine, see engines.go.
+	Engines map[string]EngineDefaults `json:"engines,omitempty"`
+
+	// Deprecated spellings of keys and values found when decoding, see
+	// UnmarshalJSON(). Not part of the configuration.
+	DeprecatedKeys []string `json:"-"`
+
+	// Host and container sections as provided, to merge the engine
+	// defaults into. Not part of the configuration.
+	rawSections map[string]map[string]interface{}
+
+	// The configuration as decoded, with the templates expanded, see
+	// GetExpandedConf(). Not part of the configuration.
+	expandedConf []byte
+}
+
+// Features of the host section, which an engine may or may not implement.
+// Each one is requested by the options listed.
+const (
+	CapabilityMemif          = "memif"          // iftype memif
+	CapabilityVhostUser      = "vhostuser"      // iftype vhostuser
+	CapabilityBridge         = "bridge"         // netType bridge
+	CapabilityVlan           = "vlan"           // bridge vlanId
+	CapabilityShg            = "shg"            // bridge shg
+	CapabilityBvi            = "bvi"            // bridge bvi
+	CapabilityAddress        = "address"        // address
+	CapabilityUnnumbered     = "unnumbered"     // unnumbered
+	CapabilityAdminDown      = "adminDown"      // adminUp false
+	CapabilityRxMode         = "rxMode"         // rxMode
+	CapabilityIpv6           = "ipv6"           // ipv6
+	CapabilityVhostFeatures  = "vhostFeatures"  // vhost features
+	CapabilityNat            = "nat"            // nat enable
+	CapabilityMirror         = "mirror"         // mirror destination
+	CapabilityPunt           = "punt"           // punt rules
+	CapabilityMtu            = "mtu"            // mtu
+	CapabilityAbstractSocket = "abstractSocket" // socketType abstract
+	CapabilityBandwidth      = "bandwidth"      // bandwidth rates
+	CapabilityRoutes         = "routes"         // routes
+	CapabilityLinkState      = "linkState"      // reportLinkState
+)
+
+// All the features, in the order they are listed.
+var Capabilities = []string{
+	CapabilityMemif,
+	CapabilityVhostUser,
+	CapabilityBridge,
+	CapabilityVlan,
+	CapabilityShg,
+	CapabilityBvi,
+	CapabilityAddress,
+	CapabilityUnnumbered,
+	CapabilityAdminDown,
+	CapabilityRxMode,
+	CapabilityIpv6,
+	CapabilityVhostFeatures,
+	CapabilityNat,
+	CapabilityMirror,
+	CapabilityPunt,
+	CapabilityMtu,
+	CapabilityAbstractSocket,
+	CapabilityBandwidth,
+	CapabilityRoutes,
+	CapabilityLinkState,
+}
+
+// Permissions of the socket directories created by the plugin, if
+// sharedDirMode is not provided.
+const DefaultSharedDirMode os.FileMode = 0700
+
+// Matches any EngineNotSupportedError with errors.Is().
+var ErrEngineNotSupported = errors.New("engine not supported")
+
+// Prefix of the names (VPP tags) of the host interfaces, if not set with
+// the USERSPACE_IFNAME_PREFIX environment variable.
+const DefaultIfNamePrefix = "usrsp-"
+
+// Prefix of the names of the OVS ports, if ovsPortPrefix is not provided.
+// The prefix is at most MaxOvsPortPrefix long, to leave room in the name
+// for the suffix identifying the interface.
+const DefaultOvsPortPrefix = "usrsp-"
+const MaxOvsPortPrefix = 8
+
+// Length of the token of the ContainerId, see GetContainerToken().
+const ContainerTokenLength = 12
+
+// ContainerIds generated by the runtimes, at least ContainerTokenLength hex
+// digits.
+var runtimeContainerIdRegexp = regexp.MustCompile(`^[0-9a-fA-F]{12,}$`)
+
+// Matches any UnmanagedInterfaceError with errors.Is().
+var ErrUnmanagedInterface = errors.New("unmanaged interface")
+
+// Set by SetDebug(), from the debug option of the configuration.
+var debugErrors = false
+
+//
+// Exported Functions
+//
+
+// SetDebug() - Enable the stacks recorded by WithStack().
+func SetDebug(debug bool) {
+	debugErrors = debug
+}
+
+// IsDebug() - Whether the debug option is enabled, see SetDebug().
+func IsDebug() bool {
+	return debugErrors
+}
+
+// WithStack() - Record the current stack with the error, if enabled with
+//  SetDebug(). An error that already has a stack is returned as is.
+func WithStack(err error) error {
+	if debugErrors == false || err == nil {
+		return err
+	}
+	if _, ok := err.(*StackError); ok {
+		return err
+	}
+	return &StackError{Err: err, Stack: string(debug.Stack())}
+}
+
+// GetErrorStack() - The stack recorded with the error by WithStack(), if any.
+func GetErrorStack(err error) string {
+	var stackErr *StackError
+	if errors.As(err, &stackErr) {
+		return stackErr.Stack
+	}
+	return ""
+}
+
+// LoadK8sArgs() - Parse the Kubernetes values out of CNI_ARGS. Unknown keys
+//  are ignored since runtimes pass additional data not used by this plugin.
+func LoadK8sArgs(args *skel.CmdArgs) (*K8sArgs, error) {
+	k8sArgs := &K8sArgs{}
+	k8sArgs.IgnoreUnknown = true
+
+	if args.Args != "" {
+		if err := types.LoadArgs(args.Args, k8sArgs); err != nil {
+			return nil, fmt.Errorf("failed to load CNI_ARGS: %v", err)
+		}
+	}
+
+	return k8sArgs, nil
+}
+
+// GetContainerToken() - Fixed-length token of the ContainerId, used in all
+//  the names derived from it (state and socket files, descriptions), so
+//  they stay within the limits of the names. A ContainerId generated by a
+//  runtime gives its first 12 digits, the names used so far. Any other
+//  ContainerId (too short, or with characters not valid in a name) gives
+//  the first 12 digits of its SHA-256, so IDs sharing a prefix still get
+//  different tokens.
+func GetContainerToken(containerID string) string {
+	if runtimeContainerIdRegexp.MatchString(containerID) {
+		return containerID[:ContainerTokenLength]
+	}
+
+	sum := sha256.Sum256([]byte(containerID))
+	return hex.EncodeToString(sum[:])[:ContainerTokenLength]
+}
+
+// GetIfDescription() - Build a human readable description of the interface
+//  owner, in the form <namespace>/<pod>/<ifName>. If Kubernetes did not
+//  provide the pod information, the ContainerId token is used instead,
+//  <ContainerToken>/<ifName>, see GetContainerToken(). Engines are
+//  responsible for truncating the description to their own limits.
+func GetIfDescription(args *skel.CmdArgs) string {
+	containerID := GetContainerToken(args.ContainerID)
+
+	if k8sArgs, err := LoadK8sArgs(args); err == nil {
+		if k8sArgs.K8S_POD_NAME != "" && k8sArgs.K8S_POD_NAMESPACE != "" {
+			return fmt.Sprintf("%s/%s/%s", k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, args.IfName)
+		}
+	}
+
+	return fmt.Sprintf("%s/%s", containerID, args.IfName)
+}
+
+// GetIfName() - Name of the interface in the container: if0name if
+//  provided, otherwise the interface name requested by the runtime
+//  (CNI_IFNAME), like net1 with Multus.
+func GetIfName(conf *NetConf, args *skel.CmdArgs) string {
+	if conf.If0name != "" {
+		return conf.If0name
+	}
+	return args.IfName
+}
+
+// GetHostIfName() - Name the host interface is tagged with, hostIfName if
+//  provided, otherwise the description of the interface owner. The name
+//  always starts with the interface name prefix, see GetIfNamePrefix().
+func GetHostIfName(conf *NetConf, args *skel.CmdArgs) string {
+	name := conf.HostIfName
+	if name == "" {
+		name = GetIfDescription(args)
+	}
+
+	if prefix := GetIfNamePrefix(); strings.HasPrefix(name, prefix) == false {
+		name = prefix + name
+	}
+	return name
+}
+
+// GetIfNamePrefix() - Prefix of the names of the host interfaces, set on a
+//  node with the USERSPACE_IFNAME_PREFIX environment variable. The plugin
+//  only deletes the interfaces carrying it.
+func GetIfNamePrefix() string {
+	if prefix, ok := os.LookupEnv("USERSPACE_IFNAME_PREFIX"); ok && prefix != "" {
+		return prefix
+	}
+	return DefaultIfNamePrefix
+}
+
+// IsAdminUp() - Whether the interface is set admin up once created, which
+//  is the default.
+func IsAdminUp(conf *UserSpaceConf) bool {
+	return conf.AdminUp == nil || *conf.AdminUp
+}
+
+// IsManaged() - Whether the plugin creates and programs the interface,
+//  managed defaults to true.
+func IsManaged(conf *UserSpaceConf) bool {
+	return conf.Managed == nil || *conf.Managed
+}
+
+// IsVerifyStrict() - Whether a failed verifyConnectivity fails the ADD,
+//  verifyStrict defaults to true.
+func IsVerifyStrict(conf *NetConf) bool {
+	return conf.VerifyStrict == nil || *conf.VerifyStrict
+}
+
+// NewEngineNotSupportedError() - Error for a feature the engine does not
+//  implement, see EngineNotSupportedError.
+func NewEngineNotSupportedError(engine string, feature string) error {
+	return &EngineNotSupportedError{Engine: engine, Feature: feature}
+}
+
+// GetRequestedCapabilities() - Features of the host section requested by
+//  the configuration, in the order of Capabilities.
+func GetRequestedCapabilities(conf *NetConf) []string {
+	hostConf := &conf.HostConf
+	requested := map[string]bool{
+		CapabilityMemif:          hostConf.IfType == "memif",
+		CapabilityVhostUser:      hostConf.IfType == "vhostuser",
+		CapabilityBridge:         hostConf.NetType == "bridge",
+		CapabilityVlan:           hostConf.BridgeConf.VlanId != 0,
+		CapabilityShg:            hostConf.BridgeConf.Shg != 0,
+		CapabilityBvi:            hostConf.BridgeConf.Bvi,
+		CapabilityAddress:        hostConf.Address != "",
+		CapabilityUnnumbered:     hostConf.Unnumbered,
+		CapabilityAdminDown:      IsAdminUp(hostConf) == false,
+		CapabilityRxMode:         hostConf.RxMode != "",
+		CapabilityIpv6:           hostConf.Ipv6Conf != (Ipv6Conf{}),
+		CapabilityVhostFeatures:  hostConf.VhostConf.Features != (VhostFeatures{}),
+		CapabilityNat:            hostConf.NatConf.Enable,
+		CapabilityMirror:         hostConf.MirrorConf.Destination != "",
+		CapabilityPunt:           len(hostConf.PuntConf.Rules) != 0,
+		CapabilityMtu:            conf.Mtu != 0,
+		CapabilityAbstractSocket: hostConf.SocketType == "abstract",
+		CapabilityBandwidth:      hostConf.BandwidthConf != (BandwidthConf{}),
+		CapabilityRoutes:         len(hostConf.Routes) != 0,
+		CapabilityLinkState:      hostConf.ReportLinkState,
+	}
+
+	var capabilities []string
+	for _, capability := range Capabilities {
+		if requested[capability] {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	return capabilities
+}
+
+// GetOvsPortPrefix() - Prefix of the names of the OVS ports, ovsPortPrefix
+//  if provided.
+func GetOvsPortPrefix(conf *NetConf) string {
+	if conf.OvsPortPrefix != "" {
+		return conf.OvsPortPrefix
+	}
+	return DefaultOvsPortPrefix
+}
+
+// GetSharedDirMode() - Permissions of the socket directories created by the
+//  plugin, from the octal string sharedDirMode if provided.
+func GetSharedDirMode(conf *NetConf) (os.FileMode, error) {
+	if conf.SharedDirMode == "" {
+		return DefaultSharedDirMode, nil
+	}
+
+	mode, err := strconv.ParseUint(conf.SharedDirMode, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return 0, fmt.Errorf("ERROR: Invalid sharedDirMode %s, must be an octal mode between 0 and 0777", conf.SharedDirMode)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// CreateSharedDir() - Create a socket directory, with the permissions of
+//  sharedDirMode. The mode is set explicitly since the umask applies on
+//  creation. An existing directory is left as is.
+func CreateSharedDir(conf *NetConf, dir string) error {
+	mode, err := GetSharedDirMode(conf)
+	if err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(dir); err == nil {
+		return nil
+	} else if os.IsNotExist(err) == false {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	return os.Chmod(dir, mode)
+}
+
+// RemoveContainerDir() - Remove the directory tree of a container, created
+//  under the given base directory. The directory must be directly under the
+//  base directory, so a malformed ContainerId can't remove anything else.
+func RemoveContainerDir(baseDir string, containerID string) error {
+	base := filepath.Clean(baseDir)
+	dir := filepath.Join(base, containerID)
+
+	if containerID == "" || filepath.Dir(dir) != base {
+		return fmt.Errorf("ERROR: Refusing to remove %s, not a container directory of %s", dir, base)
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// GetContainerEngine() - Engine that configures the container end of the
+//  interface. The Container Instance defaults to the Host Instance engine.
+func GetContainerEngine(conf *NetConf) string {
+	if conf.ContainerConf.Engine != "" {
+		return conf.ContainerConf.Engine
+	}
+	return conf.HostConf.Engine
 }
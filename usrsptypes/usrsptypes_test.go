@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usrsptypes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+)
+
+func TestEngineNotSupportedError(t *testing.T) {
+	SetDebug(true)
+	defer SetDebug(false)
+
+	notSupported := NewEngineNotSupportedError("ovs-dpdk", "netType bridge")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantIs      bool
+		wantEngine  string
+		wantMessage string
+		wantStack   bool
+	}{
+		{"plain", notSupported, true, "ovs-dpdk", "ERROR: Engine ovs-dpdk does not support: netType bridge", false},
+		// The stack recorded in debug does not hide the error.
+		{"with stack", WithStack(NewEngineNotSupportedError("vpp", "iftype vhostuser")), true, "vpp",
+			"ERROR: Engine vpp does not support: iftype vhostuser", true},
+		{"other error", WithStack(fmt.Errorf("ERROR: Unknown HostConf.IfType:tap")), false, "",
+			"ERROR: Unknown HostConf.IfType:tap", true},
+	}
+
+	for _, test := range tests {
+		if got := errors.Is(test.err, ErrEngineNotSupported); got != test.wantIs {
+			t.Errorf("%s: errors.Is(ErrEngineNotSupported) = %v, want %v", test.name, got, test.wantIs)
+		}
+		if test.err.Error() != test.wantMessage {
+			t.Errorf("%s: Error() = %q, want %q", test.name, test.err.Error(), test.wantMessage)
+		}
+
+		var engineErr *EngineNotSupportedError
+		if errors.As(test.err, &engineErr) {
+			if engineErr.Engine != test.wantEngine {
+				t.Errorf("%s: Engine = %q, want %q", test.name, engineErr.Engine, test.wantEngine)
+			}
+		} else if test.wantIs {
+			t.Errorf("%s: not an EngineNotSupportedError", test.name)
+		}
+
+		if got := GetErrorStack(test.err) != ""; got != test.wantStack {
+			t.Errorf("%s: GetErrorStack() recorded = %v, want %v", test.name, got, test.wantStack)
+		}
+	}
+}
+
+func TestGetIfName(t *testing.T) {
+	tests := []struct {
+		name    string
+		if0name string
+		ifName  string
+		want    string
+	}{
+		{"requested name", "", "net1", "net1"},
+		{"if0name", "memif1", "net1", "memif1"},
+	}
+
+	for _, test := range tests {
+		conf := &NetConf{If0name: test.if0name}
+		args := &skel.CmdArgs{ContainerID: "c1", IfName: test.ifName}
+
+		if got := GetIfName(conf, args); got != test.want {
+			t.Errorf("%s: GetIfName() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
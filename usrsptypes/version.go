@@ -0,0 +1,45 @@
+// Copyright (c) 2018 Red Hat.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//
+// Version: The build of the plugin, set when building with
+//   -ldflags "-X github.com/Billy99/user-space-net-plugin/usrsptypes.Version=..."
+// (likewise Commit and BuildDate), as "make build" does. It is logged by
+// every command and saved with the attachment data, to tell which build
+// runs on a node and which build wrote a state entry.
+//
+
+package usrsptypes
+
+import (
+	"fmt"
+)
+
+//
+// Variables
+//
+
+// Build of the plugin, set with -ldflags -X.
+var Version = "dev"
+var Commit = "unknown"
+var BuildDate = "unknown"
+
+//
+// Exported Functions
+//
+
+// GetVersionString() - Build of the plugin, as logged.
+func GetVersionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, BuildDate)
+}